@@ -0,0 +1,35 @@
+package common
+
+// SecretLabel 密标，Agent 写入文件并监控其读取和篡改
+type SecretLabel struct {
+	ID               int    `json:"id"`
+	Name             string `json:"name"`
+	LabelType        string `json:"label_type"`
+	FilePath         string `json:"file_path"`
+	FileContent      string `json:"file_content"`
+	AgentType        string `json:"agent_type"`
+	AgentList        string `json:"agent_list"`
+	MonitorTampering bool   `json:"monitor_tampering"`
+	CreateTime       string `json:"create_time"`
+	UpdateTime       string `json:"update_time"`
+}
+
+// 密标监控状态
+const (
+	WatchActive      = "watching"
+	WatchFailed      = "failed"
+	WatchRemoved     = "removed"
+	WatchUnavailable = "unavailable"
+	// WatchMissing 文件已被删除，监控保留，文件重新创建时告警
+	WatchMissing = "missing"
+)
+
+// WatchStatus 单个密标的监控状态，上报给服务端
+type WatchStatus struct {
+	LabelID  int    `json:"secret_label_id"`
+	FilePath string `json:"file_path"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	// Mode 监控方式，fanotify 或 poll
+	Mode string `json:"mode"`
+}
@@ -2,6 +2,7 @@ package control
 
 import (
 	"KubePot/core/common"
+	"errors"
 	"fmt"
 )
 
@@ -29,3 +30,64 @@ func HandleControlCommand(cmd *common.ControlCommand) string {
 
 	return "success"
 }
+
+// UpdateConfigFunc 修改服务的配置项并应用，返回值发生变化的键和处理方式
+type UpdateConfigFunc func(service string, values map[string]string) ([]string, string, error)
+
+// 修改配置函数
+var updateConfigFunc UpdateConfigFunc
+
+// RegisterUpdateConfig 注册修改配置函数
+func RegisterUpdateConfig(f UpdateConfigFunc) {
+	updateConfigFunc = f
+}
+
+// UpdateConfig 修改服务的配置项，只重启受影响的服务
+func UpdateConfig(service string, values map[string]string) ([]string, string, error) {
+	if updateConfigFunc == nil {
+		return nil, "", errors.New("config control is not registered")
+	}
+	return updateConfigFunc(service, values)
+}
+
+// SecretLabelWatcher 密标文件监控，由任务循环驱动增删和全量同步
+type SecretLabelWatcher interface {
+	// Apply 新增或更新密标的监控
+	Apply(label common.SecretLabel) common.WatchStatus
+	// Remove 取消密标的监控
+	Remove(id int) common.WatchStatus
+	// Resync 从服务端拉取密标列表，补齐缺失的监控并移除已删除的密标
+	Resync() ([]common.WatchStatus, error)
+}
+
+// 密标文件监控
+var secretLabelWatcher SecretLabelWatcher
+
+// RegisterSecretLabelWatcher 注册密标文件监控
+func RegisterSecretLabelWatcher(w SecretLabelWatcher) {
+	secretLabelWatcher = w
+}
+
+// ApplySecretLabel 新增或更新密标的监控，未注册监控时返回不可用
+func ApplySecretLabel(label common.SecretLabel) common.WatchStatus {
+	if secretLabelWatcher == nil {
+		return common.WatchStatus{LabelID: label.ID, FilePath: label.FilePath, Status: common.WatchUnavailable}
+	}
+	return secretLabelWatcher.Apply(label)
+}
+
+// RemoveSecretLabel 取消密标的监控
+func RemoveSecretLabel(id int) common.WatchStatus {
+	if secretLabelWatcher == nil {
+		return common.WatchStatus{LabelID: id, Status: common.WatchRemoved}
+	}
+	return secretLabelWatcher.Remove(id)
+}
+
+// ResyncSecretLabels 与服务端同步密标监控
+func ResyncSecretLabels() ([]common.WatchStatus, error) {
+	if secretLabelWatcher == nil {
+		return nil, nil
+	}
+	return secretLabelWatcher.Resync()
+}
@@ -0,0 +1,158 @@
+package event
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version 事件结构的版本，字段有不兼容的变化时递增，服务端据此解析
+const Version = 1
+
+// Kind 事件类型
+type Kind string
+
+const (
+	KindConnect Kind = "connect" // 建立连接
+	KindAuth    Kind = "auth"    // 登录或携带凭据
+	KindCommand Kind = "command" // 执行命令
+	KindRequest Kind = "request" // HTTP 等请求
+	KindFile    Kind = "file"    // 上传、下载或读取文件
+	KindOpen    Kind = "open"    // 会话开始
+	KindClose   Kind = "close"   // 会话结束，带有会话统计
+)
+
+// Credentials 攻击者使用的凭据
+type Credentials struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+	// PublicKey SSH 客户端提供的公钥指纹，格式为 SHA256:<base64>
+	PublicKey string `json:"public_key,omitempty"`
+	// Certificate 客户端证书的 SHA256 指纹，十六进制
+	Certificate string `json:"certificate,omitempty"`
+}
+
+// Request 请求类协议的请求信息
+type Request struct {
+	Method    string `json:"method,omitempty"`
+	URI       string `json:"uri,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	// Raw 原始请求内容，过长时由调用方截断
+	Raw string `json:"raw,omitempty"`
+}
+
+// SessionStats 会话结束时的统计
+type SessionStats struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	BytesIn     int64     `json:"bytes_in"`
+	BytesOut    int64     `json:"bytes_out"`
+	Requests    int64     `json:"requests"`
+	CloseReason string    `json:"close_reason"`
+}
+
+// Event 各协议上报给服务端的攻击事件，与服务端 core/event 保持一致
+type Event struct {
+	Version     int          `json:"version"`
+	Protocol    string       `json:"protocol"`
+	Kind        Kind         `json:"kind"`
+	SourceIP    string       `json:"source_ip"`
+	SourcePort  int          `json:"source_port,omitempty"`
+	DestPort    int          `json:"dest_port,omitempty"`
+	SessionID   string       `json:"session_id,omitempty"`
+	Time        time.Time    `json:"time"`
+	Credentials *Credentials `json:"credentials,omitempty"`
+	Command     string       `json:"command,omitempty"`
+	Request     *Request     `json:"request,omitempty"`
+	File        string       `json:"file,omitempty"`
+	// Detail 无法归入以上字段的补充说明，如 watch 持续时间、etcd 读写的键
+	Detail string `json:"detail,omitempty"`
+	// Session 仅会话结束事件携带
+	Session *SessionStats `json:"session,omitempty"`
+}
+
+// New 创建事件，remote 和 local 为连接两端的地址，可以为 nil
+func New(protocol string, kind Kind, remote net.Addr, local net.Addr) *Event {
+	ev := &Event{
+		Version:  Version,
+		Protocol: protocol,
+		Kind:     kind,
+		Time:     time.Now(),
+	}
+	if remote != nil {
+		ev.SourceIP, ev.SourcePort = splitAddr(remote.String())
+	}
+	if local != nil {
+		_, ev.DestPort = splitAddr(local.String())
+	}
+	return ev
+}
+
+// FromConn 以连接的两端地址创建事件
+func FromConn(protocol string, kind Kind, conn net.Conn) *Event {
+	return New(protocol, kind, conn.RemoteAddr(), conn.LocalAddr())
+}
+
+// FromRequest 以 HTTP 请求创建事件，填充地址、方法、URI 和 User-Agent
+func FromRequest(protocol string, kind Kind, r *http.Request) *Event {
+	local, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	ev := New(protocol, kind, nil, local)
+	ev.SourceIP, ev.SourcePort = splitAddr(r.RemoteAddr)
+	ev.Request = &Request{
+		Method:    r.Method,
+		URI:       r.URL.RequestURI(),
+		UserAgent: r.UserAgent(),
+	}
+	return ev
+}
+
+// Summary 事件的可读描述，用于日志和服务端展示
+func (e *Event) Summary() string {
+	var parts []string
+	if e.Request != nil && e.Request.Method != "" {
+		parts = append(parts, e.Request.Method+" "+e.Request.URI)
+	}
+	if c := e.Credentials; c != nil {
+		if c.Username != "" {
+			parts = append(parts, "User: "+c.Username)
+		}
+		if c.Password != "" {
+			parts = append(parts, "Password: "+c.Password)
+		}
+		if c.Token != "" {
+			parts = append(parts, "Token: "+c.Token)
+		}
+		if c.PublicKey != "" {
+			parts = append(parts, "PublicKey: "+c.PublicKey)
+		}
+		if c.Certificate != "" {
+			parts = append(parts, "Certificate: "+c.Certificate)
+		}
+	}
+	if e.Command != "" {
+		parts = append(parts, "Command: "+e.Command)
+	}
+	if e.File != "" {
+		parts = append(parts, "File: "+e.File)
+	}
+	if e.Detail != "" {
+		parts = append(parts, e.Detail)
+	}
+	if len(parts) == 0 {
+		return string(e.Kind)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// splitAddr 拆分 host:port，没有端口时返回整个地址
+func splitAddr(addr string) (string, int) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, 0
+	}
+	n, _ := strconv.Atoi(port)
+	return host, n
+}
@@ -0,0 +1,89 @@
+package health
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 服务状态
+const (
+	StateStarting = "starting"
+	StateRunning  = "running"
+	StateFailed   = "failed"
+)
+
+// ErrStopped 服务的监听循环已退出
+var ErrStopped = errors.New("stopped")
+
+// Service 已启动的蜜罐服务的监听状态
+type Service struct {
+	Name    string `json:"name"`
+	Network string `json:"network"`
+	Addr    string `json:"addr"`
+	State   string `json:"state"`
+	// Error 失败原因，端口被占用或没有权限时为绑定错误
+	Error string `json:"error,omitempty"`
+	// Since 进入当前状态的时间
+	Since time.Time `json:"since"`
+}
+
+var (
+	mu       sync.Mutex
+	services = make(map[string]*Service)
+)
+
+// Watch 登记即将启动的蜜罐服务，需要在启动服务之前调用，network 为 tcp、udp 或 unix
+// 状态由服务自身的监听结果决定，见 Listening 和 Failed，不主动连接服务，避免产生来自本机的攻击会话
+func Watch(name string, network string, addr string) {
+	mu.Lock()
+	defer mu.Unlock()
+	services[name] = &Service{Name: name, Network: network, Addr: addr, State: StateStarting, Since: time.Now()}
+}
+
+// Unwatch 蜜罐服务被关闭后不再上报状态
+func Unwatch(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(services, name)
+}
+
+// Listening 服务绑定监听地址成功后调用
+func Listening(name string) {
+	set(name, StateRunning, "")
+}
+
+// Failed 服务绑定监听地址失败或监听循环退出时调用，err 为原因
+func Failed(name string, err error) {
+	if err == nil {
+		err = ErrStopped
+	}
+	set(name, StateFailed, err.Error())
+}
+
+// Services 返回所有已登记服务的状态，按名称排序
+func Services() []Service {
+	mu.Lock()
+	defer mu.Unlock()
+	result := make([]Service, 0, len(services))
+	for _, s := range services {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// set 更新已登记服务的状态，未登记或已关闭的服务忽略
+func set(name string, state string, errMsg string) {
+	mu.Lock()
+	defer mu.Unlock()
+	s, ok := services[name]
+	if !ok {
+		return
+	}
+	if s.State != state {
+		s.Since = time.Now()
+	}
+	s.State, s.Error = state, errMsg
+}
@@ -0,0 +1,169 @@
+package honeytoken
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 同一来源重复使用蜜标时的告警间隔
+const alertInterval = 10 * time.Minute
+
+// Label 凭据所属的密标
+type Label struct {
+	ID   int
+	Name string
+}
+
+var (
+	jwtRegex       = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	bootstrapRegex = regexp.MustCompile(`\b[a-z0-9]{6}\.[a-z0-9]{16}\b`)
+	// kubeconfig、docker config 等文件中的 key: value 形式凭据
+	fieldRegex = regexp.MustCompile(`(?m)^\s*-?\s*"?(token|password|client-certificate-data)"?\s*[:=]\s*"?([^"\s,]+)"?`)
+)
+
+var (
+	mu     sync.RWMutex
+	tokens = make(map[string]Label)
+)
+
+// Register 从密标文件内容中提取令牌、密码和客户端证书，登记为蜜标凭据
+func Register(id int, name string, content string) int {
+	label := Label{ID: id, Name: name}
+
+	var keys []string
+	for _, token := range jwtRegex.FindAllString(content, -1) {
+		keys = append(keys, tokenKey(token))
+	}
+	for _, token := range bootstrapRegex.FindAllString(content, -1) {
+		keys = append(keys, tokenKey(token))
+	}
+	for _, match := range fieldRegex.FindAllStringSubmatch(content, -1) {
+		switch match[1] {
+		case "token":
+			keys = append(keys, tokenKey(match[2]))
+		case "password":
+			keys = append(keys, passwordKey(match[2]))
+		case "client-certificate-data":
+			if data, err := base64.StdEncoding.DecodeString(match[2]); err == nil {
+				keys = append(keys, certKeys(data)...)
+			}
+		}
+	}
+	keys = append(keys, certKeys([]byte(content))...)
+
+	// 单行文件本身就是令牌，如 serviceaccount/token
+	if trimmed := strings.TrimSpace(content); trimmed != "" && !strings.ContainsAny(trimmed, " \n\t") {
+		keys = append(keys, tokenKey(trimmed))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// 先清除该密标之前登记的凭据，支持密标更新
+	for k, l := range tokens {
+		if l.ID == id {
+			delete(tokens, k)
+		}
+	}
+	for _, k := range keys {
+		tokens[k] = label
+	}
+	return len(keys)
+}
+
+// Unregister 移除密标对应的全部凭据
+func Unregister(id int) {
+	mu.Lock()
+	defer mu.Unlock()
+	for k, l := range tokens {
+		if l.ID == id {
+			delete(tokens, k)
+		}
+	}
+}
+
+var (
+	alertMutex sync.Mutex
+	alertSent  = make(map[string]time.Time)
+)
+
+// ShouldAlert 同一来源使用同一蜜标在告警间隔内只告警一次，多个蜜罐服务共用
+func ShouldAlert(id int, clientIP string) bool {
+	key := strconv.Itoa(id) + "/" + clientIP
+	alertMutex.Lock()
+	defer alertMutex.Unlock()
+	if last, ok := alertSent[key]; ok && time.Since(last) < alertInterval {
+		return false
+	}
+	alertSent[key] = time.Now()
+	for k, t := range alertSent {
+		if time.Since(t) >= alertInterval {
+			delete(alertSent, k)
+		}
+	}
+	return true
+}
+
+// MatchToken 检查 Bearer 令牌是否为蜜标
+func MatchToken(token string) (Label, bool) {
+	return lookup(tokenKey(token))
+}
+
+// MatchPassword 检查 Basic 认证的密码是否为蜜标
+func MatchPassword(password string) (Label, bool) {
+	return lookup(passwordKey(password))
+}
+
+// MatchCertificate 检查客户端证书是否为蜜标
+func MatchCertificate(cert *x509.Certificate) (Label, bool) {
+	return lookup(certKey(cert.Raw))
+}
+
+// Fingerprint 返回证书的 SHA256 指纹
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func lookup(key string) (Label, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	label, ok := tokens[key]
+	return label, ok
+}
+
+func tokenKey(token string) string {
+	return "token:" + token
+}
+
+func passwordKey(password string) string {
+	return "password:" + password
+}
+
+func certKey(der []byte) string {
+	sum := sha256.Sum256(der)
+	return "cert:" + hex.EncodeToString(sum[:])
+}
+
+// certKeys 提取 PEM 数据中所有证书的指纹
+func certKeys(data []byte) []string {
+	var keys []string
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return keys
+		}
+		if block.Type == "CERTIFICATE" {
+			keys = append(keys, certKey(block.Bytes))
+		}
+	}
+}
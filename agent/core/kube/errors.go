@@ -0,0 +1,123 @@
+package kube
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// StatusError 对应 apiserver 返回的 Status 失败对象
+type StatusError struct {
+	Code    int
+	Reason  string
+	Message string
+	Name    string
+	Kind    string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+// Status 转换为 meta/v1 Status 对象
+func (e *StatusError) Status() map[string]interface{} {
+	status := map[string]interface{}{
+		"kind":       "Status",
+		"apiVersion": "v1",
+		"metadata":   map[string]interface{}{},
+		"status":     "Failure",
+		"message":    e.Message,
+		"reason":     e.Reason,
+		"code":       e.Code,
+	}
+	if e.Name != "" || e.Kind != "" {
+		details := map[string]interface{}{"kind": e.Kind}
+		if e.Name != "" {
+			details["name"] = e.Name
+		}
+		status["details"] = details
+	}
+	return status
+}
+
+// NewNotFound 资源不存在
+func NewNotFound(res Resource, name string) *StatusError {
+	return &StatusError{
+		Code:    http.StatusNotFound,
+		Reason:  "NotFound",
+		Message: fmt.Sprintf("%s %q not found", qualifiedName(res), name),
+		Name:    name,
+		Kind:    res.Name,
+	}
+}
+
+// NewAlreadyExists 资源已存在
+func NewAlreadyExists(res Resource, name string) *StatusError {
+	return &StatusError{
+		Code:    http.StatusConflict,
+		Reason:  "AlreadyExists",
+		Message: fmt.Sprintf("%s %q already exists", qualifiedName(res), name),
+		Name:    name,
+		Kind:    res.Name,
+	}
+}
+
+// NewConflict resourceVersion 不匹配
+func NewConflict(res Resource, name string) *StatusError {
+	return &StatusError{
+		Code:   http.StatusConflict,
+		Reason: "Conflict",
+		Message: fmt.Sprintf("Operation cannot be fulfilled on %s %q: the object has been modified; "+
+			"please apply your changes to the latest version and try again", qualifiedName(res), name),
+		Name: name,
+		Kind: res.Name,
+	}
+}
+
+// NewBadRequest 请求内容非法
+func NewBadRequest(message string) *StatusError {
+	return &StatusError{
+		Code:    http.StatusBadRequest,
+		Reason:  "BadRequest",
+		Message: message,
+	}
+}
+
+// NewQuotaExceeded 超出会话配额，与 ResourceQuota 拒绝请求时的返回一致
+func NewQuotaExceeded(res Resource, name string) *StatusError {
+	return &StatusError{
+		Code:    http.StatusForbidden,
+		Reason:  "Forbidden",
+		Message: fmt.Sprintf("%s %q is forbidden: exceeded quota: object-counts, requested: count/%s=1", qualifiedName(res), name, qualifiedName(res)),
+		Name:    name,
+		Kind:    res.Name,
+	}
+}
+
+// NewMethodNotSupported 资源不支持该操作
+func NewMethodNotSupported(res Resource, verb string) *StatusError {
+	return &StatusError{
+		Code:    http.StatusMethodNotAllowed,
+		Reason:  "MethodNotAllowed",
+		Message: fmt.Sprintf("%s is not supported on resources of kind %q", verb, qualifiedName(res)),
+		Kind:    res.Name,
+	}
+}
+
+// NewUnsupportedMediaType 不支持的 PATCH 类型
+func NewUnsupportedMediaType(contentType string) *StatusError {
+	return &StatusError{
+		Code:   http.StatusUnsupportedMediaType,
+		Reason: "UnsupportedMediaType",
+		Message: fmt.Sprintf("the body of the request was in an unknown format - accepted media types include: "+
+			"application/json-patch+json, application/merge-patch+json, application/apply-patch+yaml, "+
+			"application/strategic-merge-patch+json; got %q", contentType),
+	}
+}
+
+// 错误信息中的资源名，如 deployments.apps
+func qualifiedName(res Resource) string {
+	if res.Group == "" {
+		return res.Name
+	}
+	return res.Name + "." + res.Group
+}
@@ -0,0 +1,246 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 支持的 PATCH 类型
+const (
+	PatchTypeJSON           = "application/json-patch+json"
+	PatchTypeMerge          = "application/merge-patch+json"
+	PatchTypeStrategicMerge = "application/strategic-merge-patch+json"
+	PatchTypeApply          = "application/apply-patch+yaml"
+)
+
+// applyPatch 对当前对象应用补丁，strategic merge 按普通 merge patch 处理
+func applyPatch(current Object, patchType string, patch []byte) (Object, error) {
+	switch patchType {
+	case PatchTypeJSON:
+		var ops []map[string]interface{}
+		if err := json.Unmarshal(patch, &ops); err != nil {
+			return nil, NewBadRequest(err.Error())
+		}
+		var doc interface{} = deepCopy(current)
+		for _, op := range ops {
+			var err error
+			if doc, err = applyJSONPatchOp(doc, op); err != nil {
+				return nil, NewBadRequest(err.Error())
+			}
+		}
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, NewBadRequest("patch result is not an object")
+		}
+		return obj, nil
+	case PatchTypeMerge, PatchTypeStrategicMerge, PatchTypeApply:
+		obj, err := decodePatchObject(patchType, patch)
+		if err != nil {
+			return nil, err
+		}
+		return mergePatch(deepCopy(current), obj), nil
+	}
+	return nil, NewUnsupportedMediaType(patchType)
+}
+
+// decodePatchObject 解析 merge patch 或 apply 配置
+func decodePatchObject(patchType string, patch []byte) (Object, error) {
+	var obj Object
+	if patchType == PatchTypeApply {
+		if err := yaml.Unmarshal(patch, &obj); err != nil {
+			return nil, NewBadRequest(err.Error())
+		}
+		return deepCopy(obj), nil
+	}
+	if err := json.Unmarshal(patch, &obj); err != nil {
+		return nil, NewBadRequest(err.Error())
+	}
+	return obj, nil
+}
+
+// mergePatch 按 RFC 7386 合并，null 表示删除字段
+func mergePatch(target, patch map[string]interface{}) map[string]interface{} {
+	for k, v := range patch {
+		if v == nil {
+			delete(target, k)
+			continue
+		}
+		patchMap, ok := v.(map[string]interface{})
+		if !ok {
+			target[k] = v
+			continue
+		}
+		targetMap, ok := target[k].(map[string]interface{})
+		if !ok {
+			targetMap = map[string]interface{}{}
+		}
+		target[k] = mergePatch(targetMap, patchMap)
+	}
+	return target
+}
+
+// applyJSONPatchOp 执行单个 RFC 6902 操作
+func applyJSONPatchOp(doc interface{}, op map[string]interface{}) (interface{}, error) {
+	name, _ := op["op"].(string)
+	path, _ := op["path"].(string)
+	switch name {
+	case "add", "replace":
+		return setPointer(doc, path, op["value"], name == "add")
+	case "remove":
+		return removePointer(doc, path)
+	case "test":
+		value, err := getPointer(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		expected, _ := json.Marshal(op["value"])
+		actual, _ := json.Marshal(value)
+		if string(expected) != string(actual) {
+			return nil, fmt.Errorf("testing value %s failed", path)
+		}
+		return doc, nil
+	case "copy", "move":
+		from, _ := op["from"].(string)
+		value, err := getPointer(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if name == "move" {
+			if doc, err = removePointer(doc, from); err != nil {
+				return nil, err
+			}
+		}
+		return setPointer(doc, path, value, true)
+	}
+	return nil, fmt.Errorf("unexpected operation %q", name)
+}
+
+func splitPointer(path string) []string {
+	if path == "" {
+		return nil
+	}
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, p := range parts {
+		parts[i] = strings.ReplaceAll(strings.ReplaceAll(p, "~1", "/"), "~0", "~")
+	}
+	return parts
+}
+
+func getPointer(doc interface{}, path string) (interface{}, error) {
+	current := doc
+	for _, part := range splitPointer(path) {
+		switch c := current.(type) {
+		case map[string]interface{}:
+			v, ok := c[part]
+			if !ok {
+				return nil, fmt.Errorf("path %s not found", path)
+			}
+			current = v
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, fmt.Errorf("path %s not found", path)
+			}
+			current = c[i]
+		default:
+			return nil, fmt.Errorf("path %s not found", path)
+		}
+	}
+	return current, nil
+}
+
+// setPointer 设置指针位置的值，insert 为 true 时在数组中插入
+func setPointer(doc interface{}, path string, value interface{}, insert bool) (interface{}, error) {
+	parts := splitPointer(path)
+	if len(parts) == 0 {
+		return value, nil
+	}
+	parent := doc
+	var err error
+	if len(parts) > 1 {
+		if parent, err = getPointer(doc, "/"+strings.Join(escapeParts(parts[:len(parts)-1]), "/")); err != nil {
+			return nil, err
+		}
+	}
+	last := parts[len(parts)-1]
+
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		if !insert {
+			if _, ok := p[last]; !ok {
+				return nil, fmt.Errorf("path %s not found", path)
+			}
+		}
+		p[last] = value
+		return doc, nil
+	case []interface{}:
+		var i int
+		if last == "-" {
+			i = len(p)
+		} else if i, err = strconv.Atoi(last); err != nil || i < 0 || i > len(p) {
+			return nil, fmt.Errorf("invalid index in path %s", path)
+		}
+		if insert {
+			p = append(p[:i], append([]interface{}{value}, p[i:]...)...)
+		} else {
+			if i >= len(p) {
+				return nil, fmt.Errorf("invalid index in path %s", path)
+			}
+			p[i] = value
+		}
+		return replaceParent(doc, parts[:len(parts)-1], p)
+	}
+	return nil, fmt.Errorf("path %s not found", path)
+}
+
+func removePointer(doc interface{}, path string) (interface{}, error) {
+	parts := splitPointer(path)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("cannot remove root")
+	}
+	parent := doc
+	if len(parts) > 1 {
+		var err error
+		if parent, err = getPointer(doc, "/"+strings.Join(escapeParts(parts[:len(parts)-1]), "/")); err != nil {
+			return nil, err
+		}
+	}
+	last := parts[len(parts)-1]
+
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := p[last]; !ok {
+			return nil, fmt.Errorf("path %s not found", path)
+		}
+		delete(p, last)
+		return doc, nil
+	case []interface{}:
+		i, err := strconv.Atoi(last)
+		if err != nil || i < 0 || i >= len(p) {
+			return nil, fmt.Errorf("invalid index in path %s", path)
+		}
+		p = append(p[:i], p[i+1:]...)
+		return replaceParent(doc, parts[:len(parts)-1], p)
+	}
+	return nil, fmt.Errorf("path %s not found", path)
+}
+
+// replaceParent 数组长度变化后需要写回父节点
+func replaceParent(doc interface{}, parts []string, value interface{}) (interface{}, error) {
+	if len(parts) == 0 {
+		return value, nil
+	}
+	return setPointer(doc, "/"+strings.Join(escapeParts(parts), "/"), value, false)
+}
+
+func escapeParts(parts []string) []string {
+	escaped := make([]string, len(parts))
+	for i, p := range parts {
+		escaped[i] = strings.ReplaceAll(strings.ReplaceAll(p, "~", "~0"), "/", "~1")
+	}
+	return escaped
+}
@@ -0,0 +1,446 @@
+package kube
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protobufMagic apiserver 以 protobuf 格式写入 etcd 时的前缀
+var protobufMagic = []byte{0x6b, 0x38, 0x73, 0x00}
+
+// fieldKind 字段在 generated.proto 中的编码方式
+type fieldKind int
+
+const (
+	fieldString fieldKind = iota
+	fieldInt
+	fieldBool
+	fieldMessage
+	fieldStringMap
+	fieldBytesMap // Secret.data，JSON 中为 base64
+	fieldQuantityMap
+	fieldTime
+	fieldIntOrString
+)
+
+type protoField struct {
+	num  protowire.Number
+	kind fieldKind
+	// msg fieldMessage 对应的消息名
+	msg string
+}
+
+// protoSchemas 按 k8s.io/api 各类型 generated.proto 中的字段编号描述消息，未列出的字段不编码
+var protoSchemas = map[string]map[string]protoField{
+	"ObjectMeta": {
+		"name":              {1, fieldString, ""},
+		"generateName":      {2, fieldString, ""},
+		"namespace":         {3, fieldString, ""},
+		"uid":               {5, fieldString, ""},
+		"resourceVersion":   {6, fieldString, ""},
+		"generation":        {7, fieldInt, ""},
+		"creationTimestamp": {8, fieldTime, ""},
+		"deletionTimestamp": {9, fieldTime, ""},
+		"labels":            {11, fieldStringMap, ""},
+		"annotations":       {12, fieldStringMap, ""},
+		"ownerReferences":   {13, fieldMessage, "OwnerReference"},
+		"finalizers":        {14, fieldString, ""},
+	},
+	"OwnerReference": {
+		"kind":               {1, fieldString, ""},
+		"name":               {3, fieldString, ""},
+		"uid":                {4, fieldString, ""},
+		"apiVersion":         {5, fieldString, ""},
+		"controller":         {6, fieldBool, ""},
+		"blockOwnerDeletion": {7, fieldBool, ""},
+	},
+	"LabelSelector": {
+		"matchLabels": {1, fieldStringMap, ""},
+	},
+	"Namespace": {
+		"metadata": {1, fieldMessage, "ObjectMeta"},
+		"spec":     {2, fieldMessage, "NamespaceSpec"},
+		"status":   {3, fieldMessage, "NamespaceStatus"},
+	},
+	"NamespaceSpec":   {"finalizers": {1, fieldString, ""}},
+	"NamespaceStatus": {"phase": {1, fieldString, ""}},
+	"ConfigMap": {
+		"metadata":   {1, fieldMessage, "ObjectMeta"},
+		"data":       {2, fieldStringMap, ""},
+		"binaryData": {3, fieldBytesMap, ""},
+		"immutable":  {4, fieldBool, ""},
+	},
+	"Secret": {
+		"metadata":  {1, fieldMessage, "ObjectMeta"},
+		"data":      {2, fieldBytesMap, ""},
+		"type":      {3, fieldString, ""},
+		"immutable": {5, fieldBool, ""},
+	},
+	"ServiceAccount": {
+		"metadata":                     {1, fieldMessage, "ObjectMeta"},
+		"secrets":                      {2, fieldMessage, "ObjectReference"},
+		"imagePullSecrets":             {3, fieldMessage, "LocalObjectReference"},
+		"automountServiceAccountToken": {4, fieldBool, ""},
+	},
+	"ObjectReference": {
+		"kind":      {1, fieldString, ""},
+		"namespace": {2, fieldString, ""},
+		"name":      {3, fieldString, ""},
+		"uid":       {4, fieldString, ""},
+	},
+	"LocalObjectReference": {"name": {1, fieldString, ""}},
+	"Service": {
+		"metadata": {1, fieldMessage, "ObjectMeta"},
+		"spec":     {2, fieldMessage, "ServiceSpec"},
+	},
+	"ServiceSpec": {
+		"ports":           {1, fieldMessage, "ServicePort"},
+		"selector":        {2, fieldStringMap, ""},
+		"clusterIP":       {3, fieldString, ""},
+		"type":            {4, fieldString, ""},
+		"sessionAffinity": {7, fieldString, ""},
+		"clusterIPs":      {18, fieldString, ""},
+	},
+	"ServicePort": {
+		"name":       {1, fieldString, ""},
+		"protocol":   {2, fieldString, ""},
+		"port":       {3, fieldInt, ""},
+		"targetPort": {4, fieldIntOrString, ""},
+		"nodePort":   {5, fieldInt, ""},
+	},
+	"Pod": {
+		"metadata": {1, fieldMessage, "ObjectMeta"},
+		"spec":     {2, fieldMessage, "PodSpec"},
+		"status":   {3, fieldMessage, "PodStatus"},
+	},
+	"PodTemplateSpec": {
+		"metadata": {1, fieldMessage, "ObjectMeta"},
+		"spec":     {2, fieldMessage, "PodSpec"},
+	},
+	"PodSpec": {
+		"volumes":                       {1, fieldMessage, "Volume"},
+		"containers":                    {2, fieldMessage, "Container"},
+		"restartPolicy":                 {3, fieldString, ""},
+		"terminationGracePeriodSeconds": {4, fieldInt, ""},
+		"dnsPolicy":                     {6, fieldString, ""},
+		"nodeSelector":                  {7, fieldStringMap, ""},
+		"serviceAccountName":            {8, fieldString, ""},
+		"serviceAccount":                {9, fieldString, ""},
+		"nodeName":                      {10, fieldString, ""},
+		"hostNetwork":                   {11, fieldBool, ""},
+		"hostPID":                       {12, fieldBool, ""},
+		"hostIPC":                       {13, fieldBool, ""},
+		"imagePullSecrets":              {15, fieldMessage, "LocalObjectReference"},
+		"hostname":                      {16, fieldString, ""},
+		"schedulerName":                 {19, fieldString, ""},
+		"initContainers":                {20, fieldMessage, "Container"},
+		"automountServiceAccountToken":  {21, fieldBool, ""},
+		"priorityClassName":             {24, fieldString, ""},
+		"priority":                      {25, fieldInt, ""},
+	},
+	"Volume": {
+		"name":         {1, fieldString, ""},
+		"volumeSource": {2, fieldMessage, "VolumeSource"},
+	},
+	"VolumeSource": {
+		"hostPath":  {1, fieldMessage, "HostPathVolumeSource"},
+		"emptyDir":  {2, fieldMessage, "EmptyDirVolumeSource"},
+		"secret":    {6, fieldMessage, "SecretVolumeSource"},
+		"configMap": {19, fieldMessage, "ConfigMapVolumeSource"},
+	},
+	"HostPathVolumeSource":  {"path": {1, fieldString, ""}, "type": {2, fieldString, ""}},
+	"EmptyDirVolumeSource":  {"medium": {1, fieldString, ""}},
+	"SecretVolumeSource":    {"secretName": {1, fieldString, ""}, "defaultMode": {3, fieldInt, ""}},
+	"ConfigMapVolumeSource": {"name": {1, fieldString, ""}, "defaultMode": {3, fieldInt, ""}},
+	"Container": {
+		"name":            {1, fieldString, ""},
+		"image":           {2, fieldString, ""},
+		"command":         {3, fieldString, ""},
+		"args":            {4, fieldString, ""},
+		"workingDir":      {5, fieldString, ""},
+		"ports":           {6, fieldMessage, "ContainerPort"},
+		"env":             {7, fieldMessage, "EnvVar"},
+		"resources":       {8, fieldMessage, "ResourceRequirements"},
+		"volumeMounts":    {9, fieldMessage, "VolumeMount"},
+		"imagePullPolicy": {14, fieldString, ""},
+		"securityContext": {15, fieldMessage, "SecurityContext"},
+		"stdin":           {16, fieldBool, ""},
+		"tty":             {18, fieldBool, ""},
+	},
+	"ContainerPort": {
+		"name":          {1, fieldString, ""},
+		"hostPort":      {2, fieldInt, ""},
+		"containerPort": {3, fieldInt, ""},
+		"protocol":      {4, fieldString, ""},
+	},
+	"EnvVar": {
+		"name":  {1, fieldString, ""},
+		"value": {2, fieldString, ""},
+	},
+	"ResourceRequirements": {
+		"limits":   {1, fieldQuantityMap, ""},
+		"requests": {2, fieldQuantityMap, ""},
+	},
+	"VolumeMount": {
+		"name":      {1, fieldString, ""},
+		"readOnly":  {2, fieldBool, ""},
+		"mountPath": {3, fieldString, ""},
+		"subPath":   {4, fieldString, ""},
+	},
+	"SecurityContext": {
+		"privileged":               {2, fieldBool, ""},
+		"runAsUser":                {4, fieldInt, ""},
+		"runAsNonRoot":             {5, fieldBool, ""},
+		"readOnlyRootFilesystem":   {6, fieldBool, ""},
+		"allowPrivilegeEscalation": {7, fieldBool, ""},
+	},
+	"PodStatus": {
+		"phase":             {1, fieldString, ""},
+		"conditions":        {2, fieldMessage, "PodCondition"},
+		"message":           {3, fieldString, ""},
+		"reason":            {4, fieldString, ""},
+		"hostIP":            {5, fieldString, ""},
+		"podIP":             {6, fieldString, ""},
+		"startTime":         {7, fieldTime, ""},
+		"containerStatuses": {8, fieldMessage, "ContainerStatus"},
+		"qosClass":          {9, fieldString, ""},
+		"podIPs":            {12, fieldMessage, "PodIP"},
+	},
+	"PodCondition": {
+		"type":               {1, fieldString, ""},
+		"status":             {2, fieldString, ""},
+		"lastTransitionTime": {4, fieldTime, ""},
+		"reason":             {5, fieldString, ""},
+		"message":            {6, fieldString, ""},
+	},
+	"PodIP": {"ip": {1, fieldString, ""}},
+	"ContainerStatus": {
+		"name":         {1, fieldString, ""},
+		"state":        {2, fieldMessage, "ContainerState"},
+		"ready":        {4, fieldBool, ""},
+		"restartCount": {5, fieldInt, ""},
+		"image":        {6, fieldString, ""},
+		"imageID":      {7, fieldString, ""},
+		"containerID":  {8, fieldString, ""},
+		"started":      {9, fieldBool, ""},
+	},
+	"ContainerState":        {"running": {2, fieldMessage, "ContainerStateRunning"}},
+	"ContainerStateRunning": {"startedAt": {1, fieldTime, ""}},
+	"Deployment": {
+		"metadata": {1, fieldMessage, "ObjectMeta"},
+		"spec":     {2, fieldMessage, "DeploymentSpec"},
+		"status":   {3, fieldMessage, "DeploymentStatus"},
+	},
+	"DeploymentSpec": {
+		"replicas":             {1, fieldInt, ""},
+		"selector":             {2, fieldMessage, "LabelSelector"},
+		"template":             {3, fieldMessage, "PodTemplateSpec"},
+		"revisionHistoryLimit": {6, fieldInt, ""},
+	},
+	"DeploymentStatus": {
+		"observedGeneration": {1, fieldInt, ""},
+		"replicas":           {2, fieldInt, ""},
+		"updatedReplicas":    {3, fieldInt, ""},
+		"availableReplicas":  {4, fieldInt, ""},
+		"readyReplicas":      {7, fieldInt, ""},
+	},
+	"Role": {
+		"metadata": {1, fieldMessage, "ObjectMeta"},
+		"rules":    {2, fieldMessage, "PolicyRule"},
+	},
+	"PolicyRule": {
+		"verbs":           {1, fieldString, ""},
+		"apiGroups":       {3, fieldString, ""},
+		"resources":       {4, fieldString, ""},
+		"resourceNames":   {5, fieldString, ""},
+		"nonResourceURLs": {6, fieldString, ""},
+	},
+	"ClusterRoleBinding": {
+		"metadata": {1, fieldMessage, "ObjectMeta"},
+		"subjects": {2, fieldMessage, "Subject"},
+		"roleRef":  {3, fieldMessage, "RoleRef"},
+	},
+	"Subject": {
+		"kind":      {1, fieldString, ""},
+		"apiGroup":  {2, fieldString, ""},
+		"name":      {3, fieldString, ""},
+		"namespace": {4, fieldString, ""},
+	},
+	"RoleRef": {
+		"apiGroup": {1, fieldString, ""},
+		"kind":     {2, fieldString, ""},
+		"name":     {3, fieldString, ""},
+	},
+}
+
+// volumeSourceFields 已描述的 VolumeSource 字段
+var volumeSourceFields = []string{"hostPath", "emptyDir", "secret", "configMap"}
+
+// EncodeProtobuf 按 apiserver 写入 etcd 的格式编码对象：k8s\x00 前缀加 runtime.Unknown 包装
+func EncodeProtobuf(obj Object) ([]byte, error) {
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	if kind == "" {
+		return nil, fmt.Errorf("object has no kind")
+	}
+
+	schema := protoSchemas[kind]
+	if schema == nil {
+		// 未描述的类型只编码 metadata
+		schema = map[string]protoField{"metadata": {1, fieldMessage, "ObjectMeta"}}
+	}
+	raw := encodeMessage(nil, schema, obj)
+
+	var typeMeta []byte
+	typeMeta = protowire.AppendTag(typeMeta, 1, protowire.BytesType)
+	typeMeta = protowire.AppendString(typeMeta, apiVersion)
+	typeMeta = protowire.AppendTag(typeMeta, 2, protowire.BytesType)
+	typeMeta = protowire.AppendString(typeMeta, kind)
+
+	out := append([]byte{}, protobufMagic...)
+	out = protowire.AppendTag(out, 1, protowire.BytesType)
+	out = protowire.AppendBytes(out, typeMeta)
+	out = protowire.AppendTag(out, 2, protowire.BytesType)
+	out = protowire.AppendBytes(out, raw)
+	out = protowire.AppendTag(out, 3, protowire.BytesType)
+	out = protowire.AppendString(out, "")
+	out = protowire.AppendTag(out, 4, protowire.BytesType)
+	out = protowire.AppendString(out, "")
+	return out, nil
+}
+
+// encodeMessage 按字段编号顺序编码 JSON 对象，数组按 proto2 的非 packed 方式重复字段
+func encodeMessage(b []byte, schema map[string]protoField, obj map[string]interface{}) []byte {
+	// Volume 在 JSON 中内联了 VolumeSource，编码前还原为嵌套消息
+	if schema["volumeSource"].msg != "" {
+		source := map[string]interface{}{}
+		for _, name := range volumeSourceFields {
+			if v, ok := obj[name]; ok {
+				source[name] = v
+			}
+		}
+		obj = map[string]interface{}{"name": obj["name"], "volumeSource": source}
+	}
+
+	names := make([]string, 0, len(schema))
+	for name := range schema {
+		if _, ok := obj[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return schema[names[i]].num < schema[names[j]].num })
+
+	for _, name := range names {
+		field := schema[name]
+		if items, ok := obj[name].([]interface{}); ok {
+			for _, item := range items {
+				b = encodeField(b, field, item)
+			}
+			continue
+		}
+		b = encodeField(b, field, obj[name])
+	}
+	return b
+}
+
+func encodeField(b []byte, field protoField, value interface{}) []byte {
+	if value == nil {
+		return b
+	}
+	switch field.kind {
+	case fieldString:
+		b = protowire.AppendTag(b, field.num, protowire.BytesType)
+		b = protowire.AppendString(b, fmt.Sprint(value))
+	case fieldInt:
+		b = protowire.AppendTag(b, field.num, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(toInt64(value)))
+	case fieldBool:
+		v, _ := value.(bool)
+		b = protowire.AppendTag(b, field.num, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(v))
+	case fieldMessage:
+		m, _ := value.(map[string]interface{})
+		b = protowire.AppendTag(b, field.num, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeMessage(nil, protoSchemas[field.msg], m))
+	case fieldStringMap, fieldBytesMap, fieldQuantityMap:
+		m, _ := value.(map[string]interface{})
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			var entry []byte
+			entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+			entry = protowire.AppendString(entry, k)
+			s := fmt.Sprint(m[k])
+			entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+			switch field.kind {
+			case fieldBytesMap:
+				data, err := base64.StdEncoding.DecodeString(s)
+				if err != nil {
+					data = []byte(s)
+				}
+				entry = protowire.AppendBytes(entry, data)
+			case fieldQuantityMap:
+				var quantity []byte
+				quantity = protowire.AppendTag(quantity, 1, protowire.BytesType)
+				quantity = protowire.AppendString(quantity, s)
+				entry = protowire.AppendBytes(entry, quantity)
+			default:
+				entry = protowire.AppendString(entry, s)
+			}
+			b = protowire.AppendTag(b, field.num, protowire.BytesType)
+			b = protowire.AppendBytes(b, entry)
+		}
+	case fieldTime:
+		s, _ := value.(string)
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return b
+		}
+		var ts []byte
+		ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(t.Unix()))
+		ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(t.Nanosecond()))
+		b = protowire.AppendTag(b, field.num, protowire.BytesType)
+		b = protowire.AppendBytes(b, ts)
+	case fieldIntOrString:
+		var ios []byte
+		if s, ok := value.(string); ok {
+			ios = protowire.AppendTag(ios, 1, protowire.VarintType)
+			ios = protowire.AppendVarint(ios, 1)
+			ios = protowire.AppendTag(ios, 3, protowire.BytesType)
+			ios = protowire.AppendString(ios, s)
+		} else {
+			ios = protowire.AppendTag(ios, 1, protowire.VarintType)
+			ios = protowire.AppendVarint(ios, 0)
+			ios = protowire.AppendTag(ios, 2, protowire.VarintType)
+			ios = protowire.AppendVarint(ios, uint64(toInt64(value)))
+		}
+		b = protowire.AppendTag(b, field.num, protowire.BytesType)
+		b = protowire.AppendBytes(b, ios)
+	}
+	return b
+}
+
+func toInt64(value interface{}) int64 {
+	switch v := value.(type) {
+	case float64:
+		return int64(v)
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
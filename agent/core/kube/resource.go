@@ -0,0 +1,71 @@
+package kube
+
+// Resource 描述一种由对象存储托管的 Kubernetes 资源
+type Resource struct {
+	Name       string // 复数形式，如 pods
+	Group      string
+	Version    string
+	Kind       string
+	Namespaced bool
+}
+
+// APIVersion 返回对象中的 apiVersion 字段值
+func (r Resource) APIVersion() string {
+	if r.Group == "" {
+		return r.Version
+	}
+	return r.Group + "/" + r.Version
+}
+
+// ListKind 返回列表对象的 kind
+func (r Resource) ListKind() string {
+	return r.Kind + "List"
+}
+
+// 存储支持的资源类型
+var resources = []Resource{
+	{Name: "namespaces", Version: "v1", Kind: "Namespace"},
+	{Name: "pods", Version: "v1", Kind: "Pod", Namespaced: true},
+	{Name: "secrets", Version: "v1", Kind: "Secret", Namespaced: true},
+	{Name: "configmaps", Version: "v1", Kind: "ConfigMap", Namespaced: true},
+	{Name: "serviceaccounts", Version: "v1", Kind: "ServiceAccount", Namespaced: true},
+	{Name: "deployments", Group: "apps", Version: "v1", Kind: "Deployment", Namespaced: true},
+	{Name: "roles", Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "Role", Namespaced: true},
+	{Name: "clusterrolebindings", Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRoleBinding"},
+}
+
+// LookupResource 根据 API 组、版本和资源名查找资源
+func LookupResource(group, version, name string) (Resource, bool) {
+	for _, r := range resources {
+		if r.Group == group && r.Version == version && r.Name == name {
+			return r, true
+		}
+	}
+	return Resource{}, false
+}
+
+// ResourceForKind 根据 apiVersion 和 kind 查找资源，用于加载 fixture
+func ResourceForKind(apiVersion, kind string) (Resource, bool) {
+	for _, r := range resources {
+		if r.APIVersion() == apiVersion && r.Kind == kind {
+			return r, true
+		}
+	}
+	return Resource{}, false
+}
+
+// ResourcesFor 返回某个 API 组版本下托管的资源
+func ResourcesFor(group, version string) []Resource {
+	var list []Resource
+	for _, r := range resources {
+		if r.Group == group && r.Version == version {
+			list = append(list, r)
+		}
+	}
+	return list
+}
+
+// Resources 返回存储托管的全部资源
+func Resources() []Resource {
+	return append([]Resource{}, resources...)
+}
@@ -0,0 +1,110 @@
+package kube
+
+import (
+	"fmt"
+	"strings"
+)
+
+// requirement 单个选择条件
+type requirement struct {
+	key      string
+	operator string // =, !=, exists, !
+	value    string
+}
+
+// Selector 标签选择器和字段选择器
+type Selector struct {
+	labels []requirement
+	fields []requirement
+}
+
+// ParseSelector 解析 labelSelector 和 fieldSelector 查询参数
+func ParseSelector(labelSelector, fieldSelector string) (Selector, error) {
+	labels, err := parseRequirements(labelSelector, true)
+	if err != nil {
+		return Selector{}, err
+	}
+	fields, err := parseRequirements(fieldSelector, false)
+	if err != nil {
+		return Selector{}, err
+	}
+	return Selector{labels: labels, fields: fields}, nil
+}
+
+func parseRequirements(selector string, allowExists bool) ([]requirement, error) {
+	var reqs []requirement
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		switch {
+		case strings.Contains(term, "!="):
+			parts := strings.SplitN(term, "!=", 2)
+			reqs = append(reqs, requirement{key: strings.TrimSpace(parts[0]), operator: "!=", value: strings.TrimSpace(parts[1])})
+		case strings.Contains(term, "=="):
+			parts := strings.SplitN(term, "==", 2)
+			reqs = append(reqs, requirement{key: strings.TrimSpace(parts[0]), operator: "=", value: strings.TrimSpace(parts[1])})
+		case strings.Contains(term, "="):
+			parts := strings.SplitN(term, "=", 2)
+			reqs = append(reqs, requirement{key: strings.TrimSpace(parts[0]), operator: "=", value: strings.TrimSpace(parts[1])})
+		case allowExists && strings.HasPrefix(term, "!"):
+			reqs = append(reqs, requirement{key: strings.TrimPrefix(term, "!"), operator: "!"})
+		case allowExists:
+			reqs = append(reqs, requirement{key: term, operator: "exists"})
+		default:
+			return nil, fmt.Errorf("invalid selector: '%s'; can't understand '%s'", selector, term)
+		}
+	}
+	return reqs, nil
+}
+
+// Matches 判断对象是否满足选择条件
+func (sel Selector) Matches(obj Object) bool {
+	meta, _ := obj["metadata"].(map[string]interface{})
+	labels, _ := meta["labels"].(map[string]interface{})
+	for _, req := range sel.labels {
+		value, ok := labels[req.key].(string)
+		if !req.matches(value, ok) {
+			return false
+		}
+	}
+	for _, req := range sel.fields {
+		value, ok := fieldValue(obj, req.key)
+		if !req.matches(value, ok) {
+			return false
+		}
+	}
+	return true
+}
+
+func (req requirement) matches(value string, exists bool) bool {
+	switch req.operator {
+	case "=":
+		return exists && value == req.value
+	case "!=":
+		return !exists || value != req.value
+	case "exists":
+		return exists
+	case "!":
+		return !exists
+	}
+	return false
+}
+
+// fieldValue 按点分路径读取字符串字段，如 spec.nodeName
+func fieldValue(obj Object, path string) (string, bool) {
+	var current interface{} = obj
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		current, ok = m[part]
+		if !ok {
+			return "", false
+		}
+	}
+	value, ok := current.(string)
+	return value, ok
+}
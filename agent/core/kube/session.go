@@ -0,0 +1,168 @@
+package kube
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"KubePot/utils/log"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 攻击者会话空闲超时时间和最大会话数
+const (
+	sessionTTL  = time.Hour
+	maxSessions = 256
+)
+
+// 单个会话在初始数据之外最多新增的对象数和字节数
+const (
+	maxSessionObjects = 1000
+	maxSessionBytes   = 32 << 20
+)
+
+// session 单个攻击者看到的集群视图
+type session struct {
+	store    *Store
+	lastSeen time.Time
+}
+
+var (
+	// baseStore 由 fixture 初始化，所有会话从它复制
+	baseStore = NewStore()
+
+	sessionMutex sync.Mutex
+	sessions     = make(map[string]*session)
+
+	initOnce sync.Once
+)
+
+// Init 从 fixture 目录加载初始集群数据，多个蜜罐服务共用，只加载一次
+func Init(dir string) {
+	initOnce.Do(func() {
+		count, err := LoadFixtures(baseStore, dir)
+		if err != nil {
+			log.Pr("Kube", "127.0.0.1", "加载 fixture 失败", err)
+			return
+		}
+		log.Pr("Kube", "127.0.0.1", "已加载 fixture 对象数量", count)
+	})
+}
+
+// Reload 从 fixture 目录重新加载初始集群数据，已有的攻击者会话丢弃，之后的请求从新数据复制
+func Reload(dir string) (int, error) {
+	store := NewStore()
+	count, err := LoadFixtures(store, dir)
+	if err != nil {
+		return 0, err
+	}
+
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+	baseStore = store
+	sessions = make(map[string]*session)
+	return count, nil
+}
+
+// Base 返回未被攻击者修改的初始存储
+func Base() *Store {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+	return baseStore
+}
+
+// ForClient 返回攻击者专属的存储，同一来源的写操作在会话内持续可见
+func ForClient(clientIP string) *Store {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	now := time.Now()
+	if s, ok := sessions[clientIP]; ok && now.Sub(s.lastSeen) < sessionTTL {
+		s.lastSeen = now
+		return s.store
+	}
+
+	// 清理过期会话，超过上限时淘汰最久未活动的会话
+	var oldest string
+	for ip, s := range sessions {
+		if now.Sub(s.lastSeen) >= sessionTTL {
+			delete(sessions, ip)
+		} else if oldest == "" || s.lastSeen.Before(sessions[oldest].lastSeen) {
+			oldest = ip
+		}
+	}
+	if len(sessions) >= maxSessions && oldest != "" {
+		delete(sessions, oldest)
+	}
+
+	s := &session{store: baseStore.Clone(), lastSeen: now}
+	s.store.Limit(maxSessionObjects, maxSessionBytes)
+	sessions[clientIP] = s
+	return s.store
+}
+
+// LoadFixtures 读取目录下的 YAML/JSON 文件并写入存储，支持多文档和 List 对象
+func LoadFixtures(store *Store, dir string) (int, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(files)
+
+	count := 0
+	for _, file := range files {
+		ext := strings.ToLower(filepath.Ext(file))
+		if ext != ".yaml" && ext != ".yml" && ext != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return count, err
+		}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		for {
+			var doc Object
+			if err := decoder.Decode(&doc); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return count, errors.New(file + ": " + err.Error())
+			}
+			count += seedObject(store, deepCopy(doc))
+		}
+	}
+	return count, nil
+}
+
+func seedObject(store *Store, obj Object) int {
+	if obj == nil {
+		return 0
+	}
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+
+	if items, ok := obj["items"].([]interface{}); ok && strings.HasSuffix(kind, "List") {
+		count := 0
+		for _, item := range items {
+			if m, ok := item.(map[string]interface{}); ok {
+				count += seedObject(store, m)
+			}
+		}
+		return count
+	}
+
+	res, ok := ResourceForKind(apiVersion, kind)
+	if !ok || Name(obj) == "" {
+		return 0
+	}
+	store.Seed(res, obj)
+	return 1
+}
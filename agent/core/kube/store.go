@@ -0,0 +1,748 @@
+package kube
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Object 非结构化的 Kubernetes 对象
+type Object = map[string]interface{}
+
+// 模拟节点信息，fixture 中未指定时使用
+const (
+	NodeName = "node1.example.com"
+	NodeIP   = "10.0.0.10"
+)
+
+// 全局递增的 resourceVersion，所有会话共享以保证单调
+var resourceVersion int64 = 20530000
+
+func nextResourceVersion() string {
+	return strconv.FormatInt(atomic.AddInt64(&resourceVersion, 1), 10)
+}
+
+// CurrentResourceVersion 返回当前的 resourceVersion
+func CurrentResourceVersion() string {
+	return strconv.FormatInt(atomic.LoadInt64(&resourceVersion), 10)
+}
+
+// Store 按命名空间保存对象的内存存储
+type Store struct {
+	mu       sync.RWMutex
+	objects  map[string]Object
+	watchers map[*Watcher]struct{}
+
+	// sizes 各对象序列化后的字节数，used 为其总和
+	sizes map[string]int64
+	used  int64
+	// maxObjects、maxBytes 对象数和总字节数上限，为 0 时不限制
+	maxObjects int
+	maxBytes   int64
+}
+
+// NewStore 创建空存储
+func NewStore() *Store {
+	return &Store{objects: make(map[string]Object), sizes: make(map[string]int64)}
+}
+
+// Limit 在当前数据之外最多再写入 objects 个对象、bytes 字节，超出时写操作返回配额错误，为 0 的一项不限制
+func (s *Store) Limit(objects int, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxObjects, s.maxBytes = 0, 0
+	if objects > 0 {
+		s.maxObjects = len(s.objects) + objects
+	}
+	if bytes > 0 {
+		s.maxBytes = s.used + bytes
+	}
+}
+
+// Clone 深拷贝整个存储，用于为攻击者创建独立会话
+func (s *Store) Clone() *Store {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	clone := NewStore()
+	for k, obj := range s.objects {
+		clone.objects[k] = deepCopy(obj)
+		clone.sizes[k] = s.sizes[k]
+	}
+	clone.used = s.used
+	clone.maxObjects = s.maxObjects
+	clone.maxBytes = s.maxBytes
+	return clone
+}
+
+func objectKey(res Resource, namespace, name string) string {
+	if !res.Namespaced {
+		namespace = ""
+	}
+	return res.Name + "/" + namespace + "/" + name
+}
+
+// Get 获取单个对象
+func (s *Store) Get(res Resource, namespace, name string) (Object, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.objects[objectKey(res, namespace, name)]
+	if !ok {
+		return nil, NewNotFound(res, name)
+	}
+	return deepCopy(obj), nil
+}
+
+// List 列出对象，namespace 为空时返回所有命名空间
+func (s *Store) List(res Resource, namespace string, selector Selector) []Object {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.list(res, namespace, selector)
+}
+
+func (s *Store) list(res Resource, namespace string, selector Selector) []Object {
+	prefix := res.Name + "/"
+	if res.Namespaced && namespace != "" {
+		prefix += namespace + "/"
+	}
+
+	var items []Object
+	for k, obj := range s.objects {
+		if strings.HasPrefix(k, prefix) && selector.Matches(obj) {
+			items = append(items, deepCopy(obj))
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		ni, nj := Namespace(items[i]), Namespace(items[j])
+		if ni != nj {
+			return ni < nj
+		}
+		return Name(items[i]) < Name(items[j])
+	})
+	return items
+}
+
+// Create 创建对象，namespace 为请求路径中的命名空间
+func (s *Store) Create(res Resource, namespace string, obj Object) (Object, error) {
+	obj = deepCopy(obj)
+	meta := metadata(obj)
+
+	name, _ := meta["name"].(string)
+	if name == "" {
+		generateName, _ := meta["generateName"].(string)
+		if generateName == "" {
+			return nil, NewBadRequest("name or generateName is required")
+		}
+		name = generateName + randomSuffix(5)
+	}
+
+	if res.Namespaced {
+		if ns, _ := meta["namespace"].(string); ns != "" && namespace != "" && ns != namespace {
+			return nil, NewBadRequest("the namespace of the provided object does not match the namespace sent on the request")
+		} else if namespace == "" {
+			namespace = ns
+		}
+		if namespace == "" {
+			namespace = "default"
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if res.Namespaced && !s.namespaceExists(namespace) {
+		return nil, NewNotFound(namespaceResource, namespace)
+	}
+	key := objectKey(res, namespace, name)
+	if _, ok := s.objects[key]; ok {
+		return nil, NewAlreadyExists(res, name)
+	}
+	if !s.admit(res, key, obj) {
+		return nil, NewQuotaExceeded(res, name)
+	}
+
+	obj["apiVersion"] = res.APIVersion()
+	obj["kind"] = res.Kind
+	meta["name"] = name
+	if res.Namespaced {
+		meta["namespace"] = namespace
+	} else {
+		delete(meta, "namespace")
+	}
+	meta["uid"] = NewUID()
+	meta["creationTimestamp"] = time.Now().UTC().Format(time.RFC3339)
+	meta["resourceVersion"] = nextResourceVersion()
+	delete(meta, "deletionTimestamp")
+	applyDefaults(res, obj)
+
+	s.reconcile(res, obj)
+	s.set(key, obj)
+	return deepCopy(obj), nil
+}
+
+// Update 整体替换对象，携带的 resourceVersion 与当前不一致时返回冲突
+func (s *Store) Update(res Resource, namespace, name string, obj Object) (Object, error) {
+	obj = deepCopy(obj)
+	meta := metadata(obj)
+	if n, _ := meta["name"].(string); n != "" && n != name {
+		return nil, NewBadRequest("the name of the object (" + n + ") does not match the name on the URL (" + name + ")")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := objectKey(res, namespace, name)
+	current, ok := s.objects[key]
+	if !ok {
+		return nil, NewNotFound(res, name)
+	}
+	currentMeta := metadata(current)
+	if rv, _ := meta["resourceVersion"].(string); rv != "" && rv != currentMeta["resourceVersion"] {
+		return nil, NewConflict(res, name)
+	}
+
+	obj["apiVersion"] = res.APIVersion()
+	obj["kind"] = res.Kind
+	meta["name"] = name
+	if res.Namespaced {
+		meta["namespace"] = Namespace(current)
+	}
+	meta["uid"] = currentMeta["uid"]
+	meta["creationTimestamp"] = currentMeta["creationTimestamp"]
+	meta["resourceVersion"] = nextResourceVersion()
+
+	if res.Kind == "Deployment" {
+		generation, _ := currentMeta["generation"].(float64)
+		if !reflect.DeepEqual(obj["spec"], current["spec"]) {
+			generation++
+		}
+		meta["generation"] = generation
+	}
+	if _, ok := obj["status"]; !ok && current["status"] != nil {
+		obj["status"] = current["status"]
+	}
+	if !s.admit(res, key, obj) {
+		return nil, NewQuotaExceeded(res, name)
+	}
+	applyDefaults(res, obj)
+
+	s.reconcile(res, obj)
+	s.set(key, obj)
+	return deepCopy(obj), nil
+}
+
+// Patch 按 PATCH 类型修改对象，apply-patch 在对象不存在时创建
+func (s *Store) Patch(res Resource, namespace, name, patchType string, patch []byte) (Object, error) {
+	current, err := s.Get(res, namespace, name)
+	if err != nil {
+		if patchType != PatchTypeApply {
+			return nil, err
+		}
+		obj, err := decodePatchObject(patchType, patch)
+		if err != nil {
+			return nil, err
+		}
+		metadata(obj)["name"] = name
+		return s.Create(res, namespace, obj)
+	}
+
+	patched, err := applyPatch(current, patchType, patch)
+	if err != nil {
+		return nil, err
+	}
+	return s.Update(res, namespace, name, patched)
+}
+
+// Delete 删除对象并返回被删除的对象
+func (s *Store) Delete(res Resource, namespace, name string) (Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := objectKey(res, namespace, name)
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, NewNotFound(res, name)
+	}
+	s.del(key)
+
+	switch res.Kind {
+	case "Namespace":
+		// 级联删除命名空间下的所有对象
+		for k, o := range s.objects {
+			if Namespace(o) == name {
+				s.del(k)
+			}
+		}
+	case "Deployment":
+		s.deleteOwnedPods(namespace, name, "")
+	}
+
+	metadata(obj)["deletionTimestamp"] = time.Now().UTC().Format(time.RFC3339)
+	return deepCopy(obj), nil
+}
+
+// DeleteCollection 删除命名空间中匹配选择器的所有对象
+func (s *Store) DeleteCollection(res Resource, namespace string, selector Selector) []Object {
+	s.mu.Lock()
+	items := s.list(res, namespace, selector)
+	s.mu.Unlock()
+
+	var deleted []Object
+	for _, item := range items {
+		if obj, err := s.Delete(res, Namespace(item), Name(item)); err == nil {
+			deleted = append(deleted, obj)
+		}
+	}
+	return deleted
+}
+
+// Seed 加载 fixture 对象，保留其中已有的 uid、时间戳等元数据
+func (s *Store) Seed(res Resource, obj Object) {
+	obj = deepCopy(obj)
+	meta := metadata(obj)
+	if res.Namespaced {
+		if ns, _ := meta["namespace"].(string); ns == "" {
+			meta["namespace"] = "default"
+		}
+	} else {
+		delete(meta, "namespace")
+	}
+	obj["apiVersion"] = res.APIVersion()
+	obj["kind"] = res.Kind
+	if uid, _ := meta["uid"].(string); uid == "" {
+		meta["uid"] = NewUID()
+	}
+	if ts, _ := meta["creationTimestamp"].(string); ts == "" {
+		meta["creationTimestamp"] = time.Now().UTC().Format(time.RFC3339)
+	}
+	meta["resourceVersion"] = nextResourceVersion()
+	applyDefaults(res, obj)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(objectKey(res, Namespace(obj), Name(obj)), obj)
+}
+
+// admit 判断写入对象后是否仍在配额内，调用方需持有写锁。
+// Deployment 按副本数计入将要创建的 Pod，更新时先扣除它已有的 Pod
+func (s *Store) admit(res Resource, key string, obj Object) bool {
+	if s.maxObjects == 0 && s.maxBytes == 0 {
+		return true
+	}
+	objects := len(s.objects)
+	if _, ok := s.objects[key]; !ok {
+		objects++
+	}
+	bytes := s.used - s.sizes[key] + objectSize(obj)
+
+	if res.Kind == "Deployment" {
+		spec, _ := obj["spec"].(map[string]interface{})
+		replicas := 1
+		if r, ok := spec["replicas"].(float64); ok {
+			replicas = int(r)
+		}
+		if replicas < 0 || (s.maxObjects > 0 && replicas > s.maxObjects) {
+			return false
+		}
+		// 创建时对象中可能还没有命名空间，从 key 中取
+		_, rest, _ := strings.Cut(key, "/")
+		namespace, name, _ := strings.Cut(rest, "/")
+		for _, k := range s.deploymentPods(namespace, name) {
+			objects--
+			bytes -= s.sizes[k]
+		}
+		template, _ := spec["template"].(map[string]interface{})
+		objects += replicas
+		bytes += int64(replicas) * objectSize(template)
+	}
+	return (s.maxObjects == 0 || objects <= s.maxObjects) && (s.maxBytes == 0 || bytes <= s.maxBytes)
+}
+
+// objectSize 对象序列化后的字节数
+func objectSize(obj Object) int64 {
+	data, _ := json.Marshal(obj)
+	return int64(len(data))
+}
+
+// 存储中没有任何命名空间对象时不做校验
+func (s *Store) namespaceExists(namespace string) bool {
+	if _, ok := s.objects[objectKey(namespaceResource, "", namespace)]; ok {
+		return true
+	}
+	for k := range s.objects {
+		if strings.HasPrefix(k, namespaceResource.Name+"/") {
+			return false
+		}
+	}
+	return true
+}
+
+// reconcile 在对象写入前模拟控制器行为：新命名空间带 default 服务账号，Deployment 创建对应的 Pod
+func (s *Store) reconcile(res Resource, obj Object) {
+	switch res.Kind {
+	case "Namespace":
+		saKey := objectKey(serviceAccountResource, Name(obj), "default")
+		if _, ok := s.objects[saKey]; !ok {
+			s.set(saKey, Object{
+				"apiVersion": serviceAccountResource.APIVersion(),
+				"kind":       serviceAccountResource.Kind,
+				"metadata": map[string]interface{}{
+					"name":              "default",
+					"namespace":         Name(obj),
+					"uid":               NewUID(),
+					"creationTimestamp": time.Now().UTC().Format(time.RFC3339),
+					"resourceVersion":   nextResourceVersion(),
+				},
+			})
+		}
+	case "Deployment":
+		s.reconcileDeployment(obj)
+	}
+}
+
+// reconcileDeployment 按副本数创建或删除 Pod，并更新 Deployment 状态
+func (s *Store) reconcileDeployment(deploy Object) {
+	namespace, name := Namespace(deploy), Name(deploy)
+	spec, _ := deploy["spec"].(map[string]interface{})
+	template, _ := spec["template"].(map[string]interface{})
+	if template == nil {
+		return
+	}
+
+	replicas := 1
+	if r, ok := spec["replicas"].(float64); ok {
+		replicas = int(r)
+	}
+
+	templateJSON, _ := json.Marshal(template)
+	h := fnv.New32a()
+	h.Write(templateJSON)
+	hash := safeEncodeString(strconv.FormatUint(uint64(h.Sum32()), 10))
+	rsName := name + "-" + hash
+
+	// 模板变化后旧 ReplicaSet 的 Pod 全部替换
+	s.deleteOwnedPods(namespace, name, rsName)
+
+	var owned []string
+	for k, pod := range s.objects {
+		if strings.HasPrefix(k, podResource.Name+"/"+namespace+"/") && ownerName(pod) == rsName {
+			owned = append(owned, k)
+		}
+	}
+	sort.Strings(owned)
+
+	for len(owned) > replicas {
+		s.del(owned[len(owned)-1])
+		owned = owned[:len(owned)-1]
+	}
+	for i := len(owned); i < replicas; i++ {
+		pod := deepCopy(template)
+		meta := metadata(pod)
+		labels, _ := meta["labels"].(map[string]interface{})
+		if labels == nil {
+			labels = map[string]interface{}{}
+		}
+		labels["pod-template-hash"] = hash
+		podName := rsName + "-" + randomSuffix(5)
+		pod["apiVersion"] = podResource.APIVersion()
+		pod["kind"] = podResource.Kind
+		pod["metadata"] = map[string]interface{}{
+			"name":              podName,
+			"generateName":      rsName + "-",
+			"namespace":         namespace,
+			"labels":            labels,
+			"uid":               NewUID(),
+			"creationTimestamp": time.Now().UTC().Format(time.RFC3339),
+			"resourceVersion":   nextResourceVersion(),
+			"ownerReferences": []interface{}{
+				map[string]interface{}{
+					"apiVersion":         "apps/v1",
+					"kind":               "ReplicaSet",
+					"name":               rsName,
+					"uid":                NewUID(),
+					"controller":         true,
+					"blockOwnerDeletion": true,
+				},
+			},
+		}
+		applyDefaults(podResource, pod)
+		s.set(objectKey(podResource, namespace, podName), pod)
+	}
+
+	generation, _ := metadata(deploy)["generation"].(float64)
+	deploy["status"] = map[string]interface{}{
+		"observedGeneration": generation,
+		"replicas":           replicas,
+		"updatedReplicas":    replicas,
+		"readyReplicas":      replicas,
+		"availableReplicas":  replicas,
+		"conditions": []interface{}{
+			map[string]interface{}{
+				"type":    "Available",
+				"status":  "True",
+				"reason":  "MinimumReplicasAvailable",
+				"message": "Deployment has minimum availability.",
+			},
+			map[string]interface{}{
+				"type":    "Progressing",
+				"status":  "True",
+				"reason":  "NewReplicaSetAvailable",
+				"message": fmt.Sprintf("ReplicaSet %q has successfully progressed.", rsName),
+			},
+		},
+	}
+	if replicas == 0 {
+		delete(deploy["status"].(map[string]interface{}), "readyReplicas")
+		delete(deploy["status"].(map[string]interface{}), "availableReplicas")
+	}
+}
+
+// deleteOwnedPods 删除 Deployment 下除 keepRS 之外的所有 ReplicaSet 的 Pod
+func (s *Store) deleteOwnedPods(namespace, deployName, keepRS string) {
+	for _, k := range s.deploymentPods(namespace, deployName) {
+		if ownerName(s.objects[k]) != keepRS {
+			s.del(k)
+		}
+	}
+}
+
+// deploymentPods 返回 Deployment 下所有 ReplicaSet 的 Pod
+func (s *Store) deploymentPods(namespace, deployName string) []string {
+	var keys []string
+	for k, pod := range s.objects {
+		if !strings.HasPrefix(k, podResource.Name+"/"+namespace+"/") {
+			continue
+		}
+		owner := ownerName(pod)
+		if !strings.HasPrefix(owner, deployName+"-") {
+			continue
+		}
+		// ReplicaSet 名称为 <deployment>-<hash>，排除同前缀的其他 Deployment
+		if strings.Contains(strings.TrimPrefix(owner, deployName+"-"), "-") {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func ownerName(obj Object) string {
+	refs, _ := metadata(obj)["ownerReferences"].([]interface{})
+	for _, ref := range refs {
+		if m, ok := ref.(map[string]interface{}); ok && m["kind"] == "ReplicaSet" {
+			name, _ := m["name"].(string)
+			return name
+		}
+	}
+	return ""
+}
+
+// applyDefaults 补全各类资源的默认字段
+func applyDefaults(res Resource, obj Object) {
+	switch res.Kind {
+	case "Namespace":
+		obj["spec"] = map[string]interface{}{"finalizers": []interface{}{"kubernetes"}}
+		obj["status"] = map[string]interface{}{"phase": "Active"}
+		meta := metadata(obj)
+		labels, _ := meta["labels"].(map[string]interface{})
+		if labels == nil {
+			labels = map[string]interface{}{}
+			meta["labels"] = labels
+		}
+		labels["kubernetes.io/metadata.name"] = Name(obj)
+	case "Secret":
+		if t, _ := obj["type"].(string); t == "" {
+			obj["type"] = "Opaque"
+		}
+		if stringData, ok := obj["stringData"].(map[string]interface{}); ok {
+			data, _ := obj["data"].(map[string]interface{})
+			if data == nil {
+				data = map[string]interface{}{}
+			}
+			for k, v := range stringData {
+				data[k] = base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(v)))
+			}
+			obj["data"] = data
+			delete(obj, "stringData")
+		}
+	case "Deployment":
+		meta := metadata(obj)
+		if _, ok := meta["generation"]; !ok {
+			meta["generation"] = float64(1)
+		}
+		spec, _ := obj["spec"].(map[string]interface{})
+		if spec == nil {
+			spec = map[string]interface{}{}
+			obj["spec"] = spec
+		}
+		if _, ok := spec["replicas"]; !ok {
+			spec["replicas"] = float64(1)
+		}
+	case "Pod":
+		podDefaults(obj)
+	}
+}
+
+// podDefaults 为没有状态的 Pod 生成运行中的状态
+func podDefaults(pod Object) {
+	spec, _ := pod["spec"].(map[string]interface{})
+	if spec == nil {
+		spec = map[string]interface{}{}
+		pod["spec"] = spec
+	}
+	if n, _ := spec["nodeName"].(string); n == "" {
+		spec["nodeName"] = NodeName
+	}
+	for field, value := range map[string]string{
+		"restartPolicy":      "Always",
+		"dnsPolicy":          "ClusterFirst",
+		"schedulerName":      "default-scheduler",
+		"serviceAccountName": "default",
+	} {
+		if _, ok := spec[field]; !ok {
+			spec[field] = value
+		}
+	}
+
+	status, _ := pod["status"].(map[string]interface{})
+	if status != nil && status["phase"] != nil {
+		return
+	}
+
+	started := time.Now().UTC().Format(time.RFC3339)
+	if ts, _ := metadata(pod)["creationTimestamp"].(string); ts != "" {
+		started = ts
+	}
+
+	var containerStatuses []interface{}
+	containers, _ := spec["containers"].([]interface{})
+	for _, c := range containers {
+		container, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		containerStatuses = append(containerStatuses, map[string]interface{}{
+			"name":         container["name"],
+			"image":        container["image"],
+			"imageID":      "",
+			"containerID":  "containerd://" + randomHex(32),
+			"ready":        true,
+			"started":      true,
+			"restartCount": 0,
+			"state": map[string]interface{}{
+				"running": map[string]interface{}{"startedAt": started},
+			},
+		})
+	}
+
+	conditions := []interface{}{}
+	for _, t := range []string{"Initialized", "Ready", "ContainersReady", "PodScheduled"} {
+		conditions = append(conditions, map[string]interface{}{
+			"type":               t,
+			"status":             "True",
+			"lastTransitionTime": started,
+		})
+	}
+
+	b := make([]byte, 2)
+	rand.Read(b)
+	podIP := fmt.Sprintf("10.244.%d.%d", b[0]%4, int(b[1])%250+2)
+	pod["status"] = map[string]interface{}{
+		"phase":             "Running",
+		"conditions":        conditions,
+		"hostIP":            NodeIP,
+		"podIP":             podIP,
+		"podIPs":            []interface{}{map[string]interface{}{"ip": podIP}},
+		"startTime":         started,
+		"containerStatuses": containerStatuses,
+		"qosClass":          "BestEffort",
+	}
+}
+
+var (
+	namespaceResource, _      = LookupResource("", "v1", "namespaces")
+	podResource, _            = LookupResource("", "v1", "pods")
+	serviceAccountResource, _ = LookupResource("", "v1", "serviceaccounts")
+)
+
+// metadata 返回对象的 metadata，不存在时创建
+func metadata(obj Object) map[string]interface{} {
+	meta, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		meta = map[string]interface{}{}
+		obj["metadata"] = meta
+	}
+	return meta
+}
+
+// Name 返回对象名称
+func Name(obj Object) string {
+	meta, _ := obj["metadata"].(map[string]interface{})
+	name, _ := meta["name"].(string)
+	return name
+}
+
+// Namespace 返回对象所在命名空间
+func Namespace(obj Object) string {
+	meta, _ := obj["metadata"].(map[string]interface{})
+	ns, _ := meta["namespace"].(string)
+	return ns
+}
+
+// deepCopy 通过 JSON 序列化深拷贝对象，同时统一数字类型为 float64
+func deepCopy(obj Object) Object {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return Object{}
+	}
+	var out Object
+	json.Unmarshal(data, &out)
+	return out
+}
+
+// NewUID 生成 Kubernetes 风格的 UUID
+func NewUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// 与 Kubernetes 生成名称后缀使用的字符集一致
+const alphanums = "bcdfghjklmnpqrstvwxz2456789"
+
+func randomSuffix(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	for i := range b {
+		b[i] = alphanums[int(b[i])%len(alphanums)]
+	}
+	return string(b)
+}
+
+// safeEncodeString 将哈希值映射到安全字符集，与 pod-template-hash 的格式一致
+func safeEncodeString(s string) string {
+	r := make([]byte, len(s))
+	for i, b := range []byte(s) {
+		r[i] = alphanums[int(b)%len(alphanums)]
+	}
+	return string(r)
+}
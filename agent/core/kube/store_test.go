@@ -0,0 +1,141 @@
+package kube
+
+import (
+	"strings"
+	"testing"
+)
+
+var deploymentResource, _ = LookupResource("apps", "v1", "deployments")
+var configMapResource, _ = LookupResource("", "v1", "configmaps")
+
+func deployment(name string, replicas int, image string) Object {
+	return Object{
+		"metadata": map[string]interface{}{"name": name},
+		"spec": map[string]interface{}{
+			"replicas": float64(replicas),
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": name}},
+				"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{"name": name, "image": image}},
+				},
+			},
+		},
+	}
+}
+
+func configMap(name string, size int) Object {
+	return Object{
+		"metadata": map[string]interface{}{"name": name},
+		"data":     map[string]interface{}{"value": strings.Repeat("x", size)},
+	}
+}
+
+// write 创建或更新对象
+type write struct {
+	res    Resource
+	obj    Object
+	update bool
+	// quota 是否应因超出配额被拒绝
+	quota bool
+}
+
+func TestAdmit(t *testing.T) {
+	cases := []struct {
+		name    string
+		objects int
+		bytes   int64
+		writes  []write
+		// pods 最后一次写入后存储中的 Pod 数
+		pods int
+	}{
+		{"unlimited", 0, 0, []write{
+			{res: deploymentResource, obj: deployment("web", 50, "nginx")},
+			{res: configMapResource, obj: configMap("big", 1<<20)},
+		}, 50},
+		{"deployment within object quota", 5, 0, []write{
+			{res: deploymentResource, obj: deployment("web", 4, "nginx")},
+		}, 4},
+		{"deployment over object quota", 4, 0, []write{
+			{res: deploymentResource, obj: deployment("web", 4, "nginx"), quota: true},
+		}, 0},
+		// 更新时已有的 Pod 不重复计入
+		{"update keeps replicas", 5, 0, []write{
+			{res: deploymentResource, obj: deployment("web", 4, "nginx")},
+			{res: deploymentResource, obj: deployment("web", 4, "nginx:1.25"), update: true},
+			{res: deploymentResource, obj: deployment("web", 4, "nginx:1.26"), update: true},
+		}, 4},
+		{"update scales down", 5, 0, []write{
+			{res: deploymentResource, obj: deployment("web", 4, "nginx")},
+			{res: deploymentResource, obj: deployment("web", 1, "nginx"), update: true},
+			{res: configMapResource, obj: configMap("a", 10)},
+			{res: configMapResource, obj: configMap("b", 10)},
+			{res: configMapResource, obj: configMap("c", 10)},
+			{res: configMapResource, obj: configMap("d", 10), quota: true},
+		}, 1},
+		{"update scales over quota", 5, 0, []write{
+			{res: deploymentResource, obj: deployment("web", 4, "nginx")},
+			{res: deploymentResource, obj: deployment("web", 5, "nginx"), update: true, quota: true},
+		}, 4},
+		{"replicas over object quota", 10, 0, []write{
+			{res: deploymentResource, obj: deployment("web", 11, "nginx"), quota: true},
+		}, 0},
+		{"negative replicas", 10, 0, []write{
+			{res: deploymentResource, obj: deployment("web", -1, "nginx"), quota: true},
+		}, 0},
+		// 只限制字节数时对象数不限
+		{"bytes only", 0, 16 << 10, []write{
+			{res: deploymentResource, obj: deployment("web", 10, "nginx")},
+			{res: configMapResource, obj: configMap("small", 100)},
+			{res: configMapResource, obj: configMap("big", 16<<10), quota: true},
+		}, 10},
+		{"bytes over quota on update", 0, 4096, []write{
+			{res: configMapResource, obj: configMap("cm", 100)},
+			{res: configMapResource, obj: configMap("cm", 2000), update: true},
+			{res: configMapResource, obj: configMap("cm", 5000), update: true, quota: true},
+		}, 0},
+		// 只限制对象数时字节数不限
+		{"objects only", 3, 0, []write{
+			{res: configMapResource, obj: configMap("a", 1<<20)},
+			{res: configMapResource, obj: configMap("b", 1<<20)},
+			{res: configMapResource, obj: configMap("c", 1<<20)},
+			{res: configMapResource, obj: configMap("d", 1), quota: true},
+		}, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := NewStore()
+			s.Limit(c.objects, c.bytes)
+
+			for i, w := range c.writes {
+				var err error
+				if w.update {
+					_, err = s.Update(w.res, "default", Name(w.obj), w.obj)
+				} else {
+					_, err = s.Create(w.res, "default", w.obj)
+				}
+				if quota := err != nil && strings.Contains(err.Error(), "exceeded quota"); quota != w.quota || (err != nil && !quota) {
+					t.Fatalf("write %d (%s %s): err = %v, want quota error %v", i, w.res.Kind, Name(w.obj), err, w.quota)
+				}
+			}
+			if pods := len(s.List(podResource, "default", Selector{})); pods != c.pods {
+				t.Errorf("pods = %d, want %d", pods, c.pods)
+			}
+		})
+	}
+}
+
+func TestLimitCountsExistingData(t *testing.T) {
+	s := NewStore()
+	for _, name := range []string{"a", "b", "c"} {
+		s.Seed(configMapResource, configMap(name, 10))
+	}
+	s.Limit(1, 0)
+
+	if _, err := s.Create(configMapResource, "default", configMap("d", 10)); err != nil {
+		t.Fatalf("first write after limit: %v", err)
+	}
+	if _, err := s.Create(configMapResource, "default", configMap("e", 10)); err == nil {
+		t.Errorf("second write after limit succeeded")
+	}
+}
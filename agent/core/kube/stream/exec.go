@@ -0,0 +1,265 @@
+package stream
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"KubePot/core/event"
+	"KubePot/core/kube"
+	"KubePot/core/shell"
+)
+
+const (
+	// 单个会话最多保留的终端输出字节数
+	maxTranscript = 1 << 20
+	// 非交互命令最多记录的 stdin 字节数，如 kubectl cp 上传的 tar 包
+	maxStdinCapture = 1 << 20
+	// 非交互命令读取 stdin 的空闲等待时间
+	stdinIdleTimeout = 2 * time.Second
+)
+
+// Reporter 上报会话中的命令和记录，command 为执行的命令，detail 为容器等补充说明
+type Reporter func(kind event.Kind, command string, detail string)
+
+// transcript 有上限的终端记录
+type transcript struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *transcript) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if room := maxTranscript - len(t.buf); room > 0 {
+		if len(p) > room {
+			t.buf = append(t.buf, p[:room]...)
+		} else {
+			t.buf = append(t.buf, p...)
+		}
+	}
+	return len(p), nil
+}
+
+func (t *transcript) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
+
+// upgrade 按请求头选择 SPDY 或 WebSocket 完成升级
+func upgrade(w http.ResponseWriter, r *http.Request, opts Options) (*conn, error) {
+	if websocket.IsWebSocketUpgrade(r) {
+		return serveWebSocket(w, r, opts)
+	}
+	return serveSPDY(w, r, opts)
+}
+
+// validate 检查 exec 和 attach 的参数，与 apiserver 的校验一致
+func validate(opts Options, exec bool) error {
+	if exec && len(opts.Command) == 0 {
+		return kube.NewBadRequest("you must specify at least one command for the container")
+	}
+	if !opts.Stdin && !opts.Stdout && !opts.Stderr {
+		return kube.NewBadRequest("you must specify at least 1 of stdin, stdout, stderr")
+	}
+	return nil
+}
+
+// Exec 处理 exec 升级请求，在伪造的 shell 中执行命令并上报每条命令和完整的终端记录。
+// 返回 *kube.StatusError 时尚未写入响应，由调用方返回对应的 Status
+func Exec(w http.ResponseWriter, r *http.Request, target Target, opts Options, report Reporter) error {
+	if err := validate(opts, true); err != nil {
+		return err
+	}
+	c, err := upgrade(w, r, opts)
+	if err != nil {
+		return err
+	}
+
+	sh := target.NewShell(report)
+	session := newSession(c, opts.TTY)
+
+	if c.stdin != nil && shell.IsShell(opts.Command) {
+		sh.Run(session, opts.TTY)
+	} else {
+		output := sh.ExecArgs(opts.Command)
+		if opts.TTY {
+			output = strings.ReplaceAll(output, "\n", "\r\n")
+		}
+		io.WriteString(session, output)
+		session.drainStdin()
+	}
+
+	c.writeStatus(opts.Command, sh.ExitStatus())
+	c.close()
+	session.report(target, sh, report)
+	return nil
+}
+
+// Attach 处理 attach 升级请求，主进程为 shell 时提供交互，否则只记录攻击者的输入
+func Attach(w http.ResponseWriter, r *http.Request, target Target, opts Options, report Reporter) error {
+	if err := validate(opts, false); err != nil {
+		return err
+	}
+	c, err := upgrade(w, r, opts)
+	if err != nil {
+		return err
+	}
+
+	sh := target.NewShell(report)
+	session := newSession(c, opts.TTY)
+
+	if c.stdin != nil && shell.IsShell(target.Args) {
+		sh.Run(session, opts.TTY)
+	} else if c.stdin != nil {
+		session.stdinSize, _ = io.Copy(io.Discard, io.TeeReader(c.stdin, &session.input))
+	} else {
+		<-c.done
+	}
+
+	c.writeStatus(target.Args, sh.ExitStatus())
+	c.close()
+	session.report(target, sh, report)
+	return nil
+}
+
+// NewShell 构建容器对应的伪造 shell，每条命令通过 report 上报
+func (t Target) NewShell(report Reporter) *shell.Shell {
+	sh := shell.NewContainerShell(t.Container)
+	sh.OnCommand = func(line string) {
+		report(event.KindCommand, line, fmt.Sprintf("Pod: %s/%s, Container: %s, Image: %s",
+			t.Namespace, t.Pod, t.Container.Name, t.Container.Image))
+	}
+	return sh
+}
+
+// session 一次 exec 或 attach 的输入输出，同时记录终端内容
+type session struct {
+	c      *conn
+	tty    bool
+	output transcript
+	input  transcript
+	stdout io.Writer
+	// stdinSize 读取到的 stdin 总字节数，input 只保留前 maxStdinCapture 字节
+	stdinSize int64
+
+	mu   sync.Mutex
+	size TerminalSize
+}
+
+func newSession(c *conn, tty bool) *session {
+	s := &session{c: c, tty: tty}
+	s.stdout = &s.output
+	if c.stdout != nil {
+		s.stdout = io.MultiWriter(c.stdout, &s.output)
+	}
+	if c.resize != nil {
+		go func() {
+			for size := range c.resize {
+				s.mu.Lock()
+				s.size = size
+				s.mu.Unlock()
+			}
+		}()
+	}
+	return s
+}
+
+// Read 读取 stdin，客户端未请求 stdin 时直接返回 EOF
+func (s *session) Read(p []byte) (int, error) {
+	if s.c.stdin == nil {
+		return 0, io.EOF
+	}
+	n, err := s.c.stdin.Read(p)
+	if n > 0 && !s.tty {
+		// TTY 模式下 shell 会回显输入，输出中已经包含
+		s.output.Write(p[:n])
+	}
+	return n, err
+}
+
+// Write 输出到 stdout，非 TTY 模式下 shell 的错误输出也合并在这里
+func (s *session) Write(p []byte) (int, error) {
+	return s.stdout.Write(p)
+}
+
+// drainStdin 非交互命令执行后继续读取一段时间的 stdin，用于记录上传的数据
+func (s *session) drainStdin() {
+	if s.c.stdin == nil {
+		return
+	}
+	data := make(chan []byte)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(data)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := s.c.stdin.Read(buf)
+			if n > 0 {
+				select {
+				case data <- append([]byte(nil), buf[:n]...):
+				case <-stop:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	timer := time.NewTimer(stdinIdleTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case chunk, ok := <-data:
+			if !ok {
+				return
+			}
+			if s.stdinSize < maxStdinCapture {
+				s.input.Write(chunk)
+			}
+			s.stdinSize += int64(len(chunk))
+			timer.Reset(stdinIdleTimeout)
+		case <-timer.C:
+			return
+		case <-s.c.done:
+			return
+		}
+	}
+}
+
+// report 上报会话结束时的按键记录和终端记录
+func (s *session) report(target Target, sh *shell.Shell, report Reporter) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Pod: %s/%s, Container: %s, Exit: %d", target.Namespace, target.Pod, target.Container.Name, sh.ExitStatus())
+
+	s.mu.Lock()
+	if s.size.Width > 0 {
+		fmt.Fprintf(&b, ", Terminal: %dx%d", s.size.Width, s.size.Height)
+	}
+	s.mu.Unlock()
+
+	if keystrokes := sh.Keystrokes(); keystrokes != "" {
+		fmt.Fprintf(&b, ", Keystrokes: %q", keystrokes)
+	}
+	if input := s.input.String(); input != "" {
+		sum := sha256.Sum256([]byte(input))
+		preview := input
+		if len(preview) > 4096 {
+			preview = preview[:4096]
+		}
+		fmt.Fprintf(&b, ", Stdin: %d bytes, SHA256: %s, Data: %q", s.stdinSize, hex.EncodeToString(sum[:]), preview)
+	}
+	fmt.Fprintf(&b, ", Transcript: %q", s.output.String())
+	report(event.KindCommand, "", b.String())
+}
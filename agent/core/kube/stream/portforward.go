@@ -0,0 +1,255 @@
+package stream
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/moby/spdystream"
+
+	"KubePot/core/event"
+)
+
+const (
+	// 每个转发连接最多记录的数据
+	maxForwardCapture = 4096
+	// 等待攻击者发送数据的时间
+	forwardReadTimeout = 5 * time.Second
+)
+
+// WebSocket port-forward 支持的子协议，每个端口占用数据和错误两个通道
+var portForwardWebsocketProtocols = []string{protocolV4, protocolBase64V4, protocolV1, protocolBase64V1}
+
+// PortForward 处理 port-forward 升级请求，记录攻击者发往各端口的数据。
+// 容器声明的端口对 HTTP 请求返回 404，其余端口返回连接被拒绝
+func PortForward(w http.ResponseWriter, r *http.Request, target Target, report Reporter) error {
+	if websocket.IsWebSocketUpgrade(r) {
+		return portForwardWebSocket(w, r, target, report)
+	}
+
+	spdyConn, _, streams, err := upgradeSPDY(w, r, []string{protocolPortForward})
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		<-spdyConn.CloseChan()
+		close(done)
+	}()
+
+	// 按 requestID 配对 data 和 error 流
+	type pair struct {
+		data, err *spdystream.Stream
+	}
+	pairs := make(map[string]*pair)
+	var wg sync.WaitGroup
+	idle := time.NewTimer(streamIdleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case s := <-streams:
+			headers := s.Headers()
+			id := headers.Get("requestID")
+			if id == "" {
+				id = headers.Get("port")
+			}
+			p, ok := pairs[id]
+			if !ok {
+				p = &pair{}
+				pairs[id] = p
+			}
+			switch headers.Get("streamType") {
+			case streamTypeData:
+				p.data = s
+			case streamTypeError:
+				p.err = s
+			default:
+				s.Reset()
+				continue
+			}
+			if p.data == nil || p.err == nil {
+				continue
+			}
+			delete(pairs, id)
+
+			port, _ := strconv.Atoi(headers.Get("port"))
+			wg.Add(1)
+			go func(p *pair) {
+				defer wg.Done()
+				data := readInitial(p.data)
+				response, refused := target.forwardResponse(port, data)
+				report(event.KindRequest, "", target.forwardInfo(port, data))
+				if refused != "" {
+					p.err.Write([]byte(refused))
+				} else if len(response) > 0 {
+					p.data.Write(response)
+				}
+				p.err.Close()
+				p.data.Close()
+			}(p)
+			idle.Reset(streamIdleTimeout)
+		case <-idle.C:
+			wg.Wait()
+			spdyConn.Close()
+			return nil
+		case <-done:
+			wg.Wait()
+			return nil
+		}
+	}
+}
+
+// portForwardWebSocket 处理 WebSocket 形式的 port-forward，端口来自 ports 查询参数
+func portForwardWebSocket(w http.ResponseWriter, r *http.Request, target Target, report Reporter) error {
+	var ports []int
+	for _, v := range strings.Split(r.URL.Query().Get("ports"), ",") {
+		port, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || port <= 0 || port > 65535 {
+			http.Error(w, fmt.Sprintf("unable to parse %q as a port: invalid port", v), http.StatusBadRequest)
+			return fmt.Errorf("invalid port %q", v)
+		}
+		ports = append(ports, port)
+	}
+
+	ws, _, err := upgradeWebSocket(w, r, portForwardWebsocketProtocols)
+	if err != nil {
+		return err
+	}
+	defer ws.close()
+
+	// 每个通道的第一条消息为小端序的端口号
+	for i, port := range ports {
+		prefix := make([]byte, 2)
+		binary.LittleEndian.PutUint16(prefix, uint16(port))
+		ws.writeChannel(byte(i*2), prefix)
+		ws.writeChannel(byte(i*2+1), prefix)
+	}
+
+	received := make([][]byte, len(ports))
+	ws.ws.SetReadDeadline(time.Now().Add(forwardReadTimeout))
+	for {
+		channel, data, err := ws.readChannel()
+		if err != nil {
+			break
+		}
+		i := int(channel) / 2
+		if int(channel)%2 != 0 || i >= len(ports) || len(received[i]) >= maxForwardCapture {
+			continue
+		}
+		received[i] = append(received[i], data...)
+		if len(received[i]) > maxForwardCapture {
+			received[i] = received[i][:maxForwardCapture]
+		}
+	}
+
+	for i, port := range ports {
+		response, refused := target.forwardResponse(port, received[i])
+		if len(received[i]) > 0 || refused == "" {
+			report(event.KindRequest, "", target.forwardInfo(port, received[i]))
+		}
+		if refused != "" {
+			ws.writeChannel(byte(i*2+1), []byte(refused))
+		} else if len(response) > 0 {
+			ws.writeChannel(byte(i*2), response)
+		}
+	}
+	return nil
+}
+
+// readInitial 读取转发连接上的首段数据，HTTP 请求读到头部结束即返回
+func readInitial(r io.Reader) []byte {
+	chunks := make(chan []byte)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(chunks)
+		buf := make([]byte, maxForwardCapture)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				select {
+				case chunks <- append([]byte(nil), buf[:n]...):
+				case <-stop:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var data []byte
+	timer := time.NewTimer(forwardReadTimeout)
+	defer timer.Stop()
+	for len(data) < maxForwardCapture {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				return data
+			}
+			data = append(data, chunk...)
+			if bytes.Contains(data, []byte("\r\n\r\n")) {
+				return data
+			}
+		case <-timer.C:
+			return data
+		}
+	}
+	return data[:maxForwardCapture]
+}
+
+// forwardResponse 容器声明的端口收到 HTTP 请求时返回 404 页面，未声明的端口返回 kubelet 的连接拒绝错误
+func (t Target) forwardResponse(port int, data []byte) ([]byte, string) {
+	declared := false
+	for _, p := range t.Ports {
+		if p == port {
+			declared = true
+			break
+		}
+	}
+	if !declared {
+		// 沙箱ID和网络命名空间按 Pod 固定，多次转发保持一致
+		sum := sha256.Sum256([]byte(t.Namespace + "/" + t.Pod))
+		sandbox := hex.EncodeToString(sum[:])
+		netns := fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+		return nil, fmt.Sprintf("error forwarding port %d to pod %s, uid : "+
+			"failed to execute portforward in network namespace \"/var/run/netns/cni-%s\": failed to connect to localhost:%d inside namespace \"%s\", "+
+			"IPv4: dial tcp4 127.0.0.1:%d: connect: connection refused IPv6 dial tcp6 [::1]:%d: connect: connection refused ",
+			port, sandbox, netns, port, sandbox, port, port)
+	}
+
+	method, _, _ := strings.Cut(string(data), " ")
+	switch method {
+	case "GET", "POST", "PUT", "DELETE", "HEAD", "OPTIONS", "PATCH":
+	default:
+		return nil, ""
+	}
+
+	server, body := "nginx", "<html>\r\n<head><title>404 Not Found</title></head>\r\n<body>\r\n<center><h1>404 Not Found</h1></center>\r\n<hr><center>nginx</center>\r\n</body>\r\n</html>\r\n"
+	if strings.Contains(t.Container.Image, "tomcat") {
+		server, body = "", "<!doctype html><html lang=\"en\"><head><title>HTTP Status 404 – Not Found</title></head><body><h1>HTTP Status 404 – Not Found</h1></body></html>"
+	}
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 404 Not Found\r\n")
+	if server != "" {
+		b.WriteString("Server: " + server + "\r\n")
+	}
+	fmt.Fprintf(&b, "Date: %s\r\nContent-Type: text/html\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s",
+		time.Now().UTC().Format(http.TimeFormat), len(body), body)
+	return []byte(b.String()), ""
+}
+
+func (t Target) forwardInfo(port int, data []byte) string {
+	return fmt.Sprintf("Pod: %s/%s, PortForward: %d, Data: %q", t.Namespace, t.Pod, port, data)
+}
@@ -0,0 +1,177 @@
+package stream
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/moby/spdystream"
+)
+
+const (
+	// 等待客户端创建全部流的超时时间，与 kubelet 的 streamCreationTimeout 一致
+	streamCreationTimeout = 30 * time.Second
+	// 连接空闲超时，与 kubelet 默认的 streamingConnectionIdleTimeout 一致
+	streamIdleTimeout = 4 * time.Hour
+	// 关闭连接时等待客户端关闭流的时间
+	streamCloseTimeout = 5 * time.Second
+)
+
+func isSPDYUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && strings.EqualFold(r.Header.Get("Upgrade"), "SPDY/3.1")
+}
+
+func headerContains(header http.Header, key, value string) bool {
+	for _, v := range header.Values(key) {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bufferedConn 劫持连接后保留 bufio 中已经读取的数据
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// upgradeSPDY 完成 SPDY/3.1 升级，返回协商的协议和客户端创建的流
+func upgradeSPDY(w http.ResponseWriter, r *http.Request, protocols []string) (*spdystream.Connection, string, <-chan *spdystream.Stream, error) {
+	clientProtocols := r.Header.Values("X-Stream-Protocol-Version")
+	protocol, ok := negotiate(clientProtocols, protocols)
+	// 未携带协议头的旧客户端按 channel.k8s.io 处理
+	if !ok && len(clientProtocols) > 0 {
+		err := fmt.Errorf("unable to upgrade: unable to negotiate protocol: client supports %v, server accepts %v", clientProtocols, protocols)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, "", nil, err
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if r.ProtoMajor != 1 || !ok {
+		err := fmt.Errorf("unable to upgrade: unable to hijack response")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, "", nil, err
+	}
+
+	w.Header().Set("Connection", "Upgrade")
+	w.Header().Set("Upgrade", "SPDY/3.1")
+	if protocol != "" {
+		w.Header().Set("X-Stream-Protocol-Version", protocol)
+	}
+	w.WriteHeader(http.StatusSwitchingProtocols)
+
+	netConn, bufrw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	netConn.SetDeadline(time.Time{})
+	if bufrw.Reader.Buffered() > 0 {
+		netConn = &bufferedConn{Conn: netConn, r: bufrw.Reader}
+	}
+
+	spdyConn, err := spdystream.NewConnection(netConn, true)
+	if err != nil {
+		netConn.Close()
+		return nil, "", nil, err
+	}
+	spdyConn.SetIdleTimeout(streamIdleTimeout)
+	spdyConn.SetCloseTimeout(streamCloseTimeout)
+
+	streams := make(chan *spdystream.Stream, 32)
+	go spdyConn.Serve(func(s *spdystream.Stream) {
+		select {
+		case streams <- s:
+			s.SendReply(http.Header{}, false)
+		default:
+			// 客户端创建了过多的流
+			s.Reset()
+		}
+	})
+	return spdyConn, protocol, streams, nil
+}
+
+// serveSPDY 升级连接并等待 exec 和 attach 所需的全部流
+func serveSPDY(w http.ResponseWriter, r *http.Request, opts Options) (*conn, error) {
+	spdyConn, protocol, streams, err := upgradeSPDY(w, r, spdyProtocols)
+	if err != nil {
+		return nil, err
+	}
+	if protocol == "" {
+		protocol = protocolV1
+	}
+
+	// error 流 + 请求的标准流，v3 起 TTY 会话额外有 resize 流
+	expected := 1
+	for _, b := range []bool{opts.Stdin, opts.Stdout, opts.Stderr, opts.TTY && protocol != protocolV1 && protocol != protocolV2} {
+		if b {
+			expected++
+		}
+	}
+
+	c := &conn{protocol: protocol}
+	done := make(chan struct{})
+	c.done = done
+	go func() {
+		<-spdyConn.CloseChan()
+		close(done)
+	}()
+
+	var errorStream *spdystream.Stream
+	var opened []*spdystream.Stream
+	timeout := time.NewTimer(streamCreationTimeout)
+	defer timeout.Stop()
+	for received := 0; received < expected; {
+		select {
+		case s := <-streams:
+			opened = append(opened, s)
+			received++
+			switch s.Headers().Get("streamType") {
+			case streamTypeError:
+				errorStream = s
+			case streamTypeStdin:
+				c.stdin = s
+			case streamTypeStdout:
+				c.stdout = s
+			case streamTypeStderr:
+				c.stderr = s
+			case streamTypeResize:
+				sizes := make(chan TerminalSize, 1)
+				c.resize = sizes
+				go decodeResize(s, sizes)
+			default:
+				received--
+				s.Reset()
+			}
+		case <-timeout.C:
+			spdyConn.Close()
+			return nil, fmt.Errorf("timed out waiting for client to create streams")
+		case <-done:
+			return nil, fmt.Errorf("connection closed before streams were created")
+		}
+	}
+
+	c.writeError = func(data []byte) error {
+		if errorStream == nil {
+			return nil
+		}
+		_, err := errorStream.Write(data)
+		return err
+	}
+	c.close = func() {
+		for _, s := range opened {
+			s.Close()
+		}
+		spdyConn.Close()
+	}
+	return c, nil
+}
@@ -0,0 +1,159 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// 远程命令子协议，与 k8s.io/apimachinery/pkg/util/remotecommand 保持一致
+const (
+	protocolV1       = "channel.k8s.io"
+	protocolV2       = "v2.channel.k8s.io"
+	protocolV3       = "v3.channel.k8s.io"
+	protocolV4       = "v4.channel.k8s.io"
+	protocolV5       = "v5.channel.k8s.io"
+	protocolBase64V1 = "base64.channel.k8s.io"
+	protocolBase64V4 = "v4.base64.channel.k8s.io"
+
+	protocolPortForward = "portforward.k8s.io"
+)
+
+// SPDY 流的 streamType 头
+const (
+	streamTypeError  = "error"
+	streamTypeStdin  = "stdin"
+	streamTypeStdout = "stdout"
+	streamTypeStderr = "stderr"
+	streamTypeResize = "resize"
+	streamTypeData   = "data"
+)
+
+// 按服务端优先级排列的远程命令协议
+var (
+	spdyProtocols      = []string{protocolV4, protocolV3, protocolV2, protocolV1}
+	websocketProtocols = []string{protocolV5, protocolV4, protocolBase64V4, protocolV1, protocolBase64V1}
+)
+
+// Options exec 和 attach 请求的查询参数
+type Options struct {
+	Command   []string
+	Container string
+	Stdin     bool
+	Stdout    bool
+	Stderr    bool
+	TTY       bool
+}
+
+// ParseOptions 解析 ?command=sh&stdin=true&tty=true 形式的查询参数
+func ParseOptions(query url.Values) Options {
+	flag := func(key string) bool {
+		v := query.Get(key)
+		return v == "true" || v == "1"
+	}
+	return Options{
+		Command:   query["command"],
+		Container: query.Get("container"),
+		Stdin:     flag("input") || flag("stdin"),
+		Stdout:    flag("output") || flag("stdout"),
+		Stderr:    flag("error") || flag("stderr"),
+		TTY:       flag("tty"),
+	}
+}
+
+// TerminalSize resize 通道传递的终端尺寸
+type TerminalSize struct {
+	Width  uint16
+	Height uint16
+}
+
+// IsUpgrade 判断是否为 SPDY 或 WebSocket 升级请求
+func IsUpgrade(r *http.Request) bool {
+	return isSPDYUpgrade(r) || websocket.IsWebSocketUpgrade(r)
+}
+
+// conn 协商完成的流连接，屏蔽 SPDY 和 WebSocket 的差异
+type conn struct {
+	protocol string
+	stdin    io.Reader
+	stdout   io.Writer
+	stderr   io.Writer
+	resize   <-chan TerminalSize
+	// done 在客户端断开时关闭
+	done <-chan struct{}
+
+	writeError func(data []byte) error
+	close      func()
+}
+
+// writeStatus 在 error 通道写入命令的退出状态，v4 及以上版本为 Status 对象，旧版本只在失败时写入错误文本
+func (c *conn) writeStatus(command []string, exitCode int) {
+	if exitCode == 0 && !isStatusProtocol(c.protocol) {
+		return
+	}
+
+	message := fmt.Sprintf("error executing command [%s], exit code %d", strings.Join(command, " "), exitCode)
+	if !isStatusProtocol(c.protocol) {
+		c.writeError([]byte(message))
+		return
+	}
+
+	status := map[string]interface{}{"metadata": map[string]interface{}{}, "status": "Success"}
+	if exitCode != 0 {
+		status = map[string]interface{}{
+			"metadata": map[string]interface{}{},
+			"status":   "Failure",
+			"message":  "command terminated with non-zero exit code: " + message,
+			"reason":   "NonZeroExitCode",
+			"details": map[string]interface{}{
+				"causes": []interface{}{
+					map[string]interface{}{"reason": "ExitCode", "message": fmt.Sprint(exitCode)},
+				},
+			},
+		}
+	}
+	data, _ := json.Marshal(status)
+	c.writeError(data)
+}
+
+func isStatusProtocol(protocol string) bool {
+	return protocol == protocolV4 || protocol == protocolV5 || protocol == protocolBase64V4
+}
+
+// negotiate 按服务端优先级选出客户端也支持的协议
+func negotiate(client []string, server []string) (string, bool) {
+	offered := make(map[string]bool)
+	for _, v := range client {
+		for _, p := range strings.Split(v, ",") {
+			offered[strings.TrimSpace(p)] = true
+		}
+	}
+	for _, p := range server {
+		if offered[p] {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// decodeResize 持续解码 resize 通道中的 JSON，直到通道关闭
+func decodeResize(r io.Reader, sizes chan<- TerminalSize) {
+	defer close(sizes)
+	decoder := json.NewDecoder(r)
+	for {
+		var size TerminalSize
+		if err := decoder.Decode(&size); err != nil {
+			return
+		}
+		select {
+		case sizes <- size:
+		default:
+			// 没有人读取时丢弃，避免阻塞连接
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package stream
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"KubePot/core/kube"
+	"KubePot/core/shell"
+)
+
+// Pod 内服务账号令牌的挂载目录
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// 默认服务 kubernetes 注入到每个容器的环境变量
+var serviceEnv = []string{
+	"KUBERNETES_SERVICE_HOST=10.96.0.1",
+	"KUBERNETES_SERVICE_PORT=443",
+	"KUBERNETES_SERVICE_PORT_HTTPS=443",
+	"KUBERNETES_PORT=tcp://10.96.0.1:443",
+	"KUBERNETES_PORT_443_TCP=tcp://10.96.0.1:443",
+	"KUBERNETES_PORT_443_TCP_PROTO=tcp",
+	"KUBERNETES_PORT_443_TCP_PORT=443",
+	"KUBERNETES_PORT_443_TCP_ADDR=10.96.0.1",
+}
+
+// Target 流会话对应的 Pod 容器
+type Target struct {
+	Namespace string
+	Pod       string
+	Container shell.Container
+	// Args 容器的启动命令，attach 时据此判断主进程是否为 shell
+	Args []string
+	// Ports Pod 中所有容器声明的端口，port-forward 时使用
+	Ports []int
+}
+
+// NewTarget 从 Pod 对象中找到要进入的容器，container 为空时使用默认容器
+func NewTarget(store *kube.Store, pod kube.Object, container string) (Target, error) {
+	name, namespace := kube.Name(pod), kube.Namespace(pod)
+	spec, _ := pod["spec"].(map[string]interface{})
+	status, _ := pod["status"].(map[string]interface{})
+	meta, _ := pod["metadata"].(map[string]interface{})
+
+	containers, _ := spec["containers"].([]interface{})
+	if container == "" {
+		annotations, _ := meta["annotations"].(map[string]interface{})
+		container, _ = annotations["kubectl.kubernetes.io/default-container"].(string)
+	}
+
+	target := Target{Namespace: namespace, Pod: name}
+	var selected map[string]interface{}
+	for _, item := range containers {
+		c, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		cname, _ := c["name"].(string)
+		if selected == nil && (container == "" || cname == container) {
+			selected = c
+		}
+		ports, _ := c["ports"].([]interface{})
+		for _, p := range ports {
+			if port, ok := p.(map[string]interface{}); ok {
+				if n, ok := port["containerPort"].(float64); ok {
+					target.Ports = append(target.Ports, int(n))
+				}
+			}
+		}
+	}
+	if selected == nil {
+		if container == "" {
+			return target, kube.NewBadRequest(fmt.Sprintf("pod %s does not have any containers", name))
+		}
+		return target, kube.NewBadRequest(fmt.Sprintf("container %s is not valid for pod %s", container, name))
+	}
+	if phase, _ := status["phase"].(string); phase != "" && phase != "Running" {
+		return target, kube.NewBadRequest(fmt.Sprintf("cannot exec into a container in a completed pod; current phase is %s", phase))
+	}
+
+	cname, _ := selected["name"].(string)
+	image, _ := selected["image"].(string)
+	target.Args = append(stringSlice(selected["command"]), stringSlice(selected["args"])...)
+
+	containerID := kube.NewUID()
+	statuses, _ := status["containerStatuses"].([]interface{})
+	for _, item := range statuses {
+		if cs, ok := item.(map[string]interface{}); ok && cs["name"] == cname {
+			if id, _ := cs["containerID"].(string); id != "" {
+				_, containerID, _ = strings.Cut(id, "://")
+			}
+		}
+	}
+
+	var created int64
+	if startTime, _ := status["startTime"].(string); startTime != "" {
+		if t, err := time.Parse(time.RFC3339, startTime); err == nil {
+			created = t.Unix()
+		}
+	}
+
+	env := append([]string{}, serviceEnv...)
+	envVars, _ := selected["env"].([]interface{})
+	for _, item := range envVars {
+		if v, ok := item.(map[string]interface{}); ok {
+			key, _ := v["name"].(string)
+			value, _ := v["value"].(string)
+			if key != "" {
+				env = append(env, key+"="+value)
+			}
+		}
+	}
+
+	target.Container = shell.Container{
+		ID:       containerID,
+		Name:     cname,
+		Image:    image,
+		Command:  shell.JoinArgs(target.Args),
+		Created:  created,
+		Hostname: name,
+		Env:      env,
+		Files:    serviceAccountFiles(store, pod),
+	}
+	return target, nil
+}
+
+// serviceAccountFiles 生成挂载到容器中的服务账号令牌、CA 证书和命名空间
+func serviceAccountFiles(store *kube.Store, pod kube.Object) map[string]string {
+	spec, _ := pod["spec"].(map[string]interface{})
+	if automount, ok := spec["automountServiceAccountToken"].(bool); ok && !automount {
+		return nil
+	}
+
+	namespace := kube.Namespace(pod)
+	account, _ := spec["serviceAccountName"].(string)
+	if account == "" {
+		account = "default"
+	}
+
+	files := map[string]string{
+		serviceAccountDir + "/namespace": namespace,
+		serviceAccountDir + "/token":     serviceAccountToken(store, pod, account),
+	}
+	if res, ok := kube.LookupResource("", "v1", "configmaps"); ok {
+		if cm, err := store.Get(res, namespace, "kube-root-ca.crt"); err == nil {
+			if data, ok := cm["data"].(map[string]interface{}); ok {
+				if ca, ok := data["ca.crt"].(string); ok {
+					files[serviceAccountDir+"/ca.crt"] = ca
+				}
+			}
+		}
+	}
+	return files
+}
+
+// serviceAccountToken 生成与 kubelet 投射卷一致的绑定令牌，签名为随机数据
+func serviceAccountToken(store *kube.Store, pod kube.Object, account string) string {
+	namespace := kube.Namespace(pod)
+	meta, _ := pod["metadata"].(map[string]interface{})
+
+	accountUID := kube.NewUID()
+	if res, ok := kube.LookupResource("", "v1", "serviceaccounts"); ok {
+		if sa, err := store.Get(res, namespace, account); err == nil {
+			if saMeta, ok := sa["metadata"].(map[string]interface{}); ok {
+				if uid, _ := saMeta["uid"].(string); uid != "" {
+					accountUID = uid
+				}
+			}
+		}
+	}
+
+	now := time.Now().Unix()
+	claims := map[string]interface{}{
+		"aud": []string{"https://kubernetes.default.svc.cluster.local"},
+		"exp": now + 365*24*3600,
+		"iat": now,
+		"iss": "https://kubernetes.default.svc.cluster.local",
+		"jti": kube.NewUID(),
+		"kubernetes.io": map[string]interface{}{
+			"namespace": namespace,
+			"node":      map[string]interface{}{"name": kube.NodeName, "uid": kube.NewUID()},
+			"pod":       map[string]interface{}{"name": kube.Name(pod), "uid": meta["uid"]},
+			"serviceaccount": map[string]interface{}{
+				"name": account,
+				"uid":  accountUID,
+			},
+			"warnafter": now + 3607,
+		},
+		"nbf": now,
+		"sub": fmt.Sprintf("system:serviceaccount:%s:%s", namespace, account),
+	}
+
+	kid := make([]byte, 32)
+	signature := make([]byte, 256)
+	rand.Read(kid)
+	rand.Read(signature)
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": base64.RawURLEncoding.EncodeToString(kid)})
+	payload, _ := json.Marshal(claims)
+	return base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func stringSlice(v interface{}) []string {
+	items, _ := v.([]interface{})
+	var out []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,187 @@
+package stream
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket channel 协议中的通道编号
+const (
+	channelStdin  = 0
+	channelStdout = 1
+	channelStderr = 2
+	channelError  = 3
+	channelResize = 4
+	// v5 协议中客户端用于半关闭某个通道
+	channelClose = 255
+)
+
+var upgrader = websocket.Upgrader{
+	HandshakeTimeout: 10 * time.Second,
+	ReadBufferSize:   32 * 1024,
+	WriteBufferSize:  32 * 1024,
+	// 蜜罐接受任意来源
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsConn 按 channel.k8s.io 格式复用的 WebSocket 连接，每条消息首字节为通道编号
+type wsConn struct {
+	ws     *websocket.Conn
+	base64 bool
+	mu     sync.Mutex
+}
+
+// upgradeWebSocket 完成 WebSocket 升级并协商子协议
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, protocols []string) (*wsConn, string, error) {
+	clientProtocols := websocket.Subprotocols(r)
+	protocol, ok := negotiate(clientProtocols, protocols)
+	// 不支持的协议返回非 101 响应，新版 kubectl 会据此回退到 SPDY
+	if !ok && len(clientProtocols) > 0 {
+		err := fmt.Errorf("unable to upgrade: unable to negotiate protocol: client supports %v, server accepts %v", clientProtocols, protocols)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, "", err
+	}
+
+	header := http.Header{}
+	if protocol != "" {
+		header.Set("Sec-WebSocket-Protocol", protocol)
+	}
+	u := upgrader
+	u.Subprotocols = nil
+	ws, err := u.Upgrade(w, r, header)
+	if err != nil {
+		return nil, "", err
+	}
+	ws.NetConn().SetDeadline(time.Time{})
+	return &wsConn{ws: ws, base64: strings.Contains(protocol, "base64")}, protocol, nil
+}
+
+func (c *wsConn) writeChannel(channel byte, p []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.base64 {
+		msg := append([]byte{'0' + channel}, base64.StdEncoding.EncodeToString(p)...)
+		return c.ws.WriteMessage(websocket.TextMessage, msg)
+	}
+	return c.ws.WriteMessage(websocket.BinaryMessage, append([]byte{channel}, p...))
+}
+
+func (c *wsConn) readChannel() (byte, []byte, error) {
+	for {
+		_, msg, err := c.ws.ReadMessage()
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(msg) == 0 {
+			continue
+		}
+		if !c.base64 {
+			return msg[0], msg[1:], nil
+		}
+		data, err := base64.StdEncoding.DecodeString(string(msg[1:]))
+		if err != nil {
+			continue
+		}
+		return msg[0] - '0', data, nil
+	}
+}
+
+func (c *wsConn) close() {
+	c.mu.Lock()
+	c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.mu.Unlock()
+	c.ws.Close()
+}
+
+// channelWriter 将写入的数据发往指定通道
+type channelWriter struct {
+	c       *wsConn
+	channel byte
+}
+
+func (w *channelWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := w.c.writeChannel(w.channel, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// serveWebSocket 升级连接并把 stdin、resize 通道的数据分发给会话
+func serveWebSocket(w http.ResponseWriter, r *http.Request, opts Options) (*conn, error) {
+	ws, protocol, err := upgradeWebSocket(w, r, websocketProtocols)
+	if err != nil {
+		return nil, err
+	}
+	if protocol == "" {
+		protocol = protocolV1
+	}
+
+	stdinReader, stdinWriter := io.Pipe()
+	resizeReader, resizeWriter := io.Pipe()
+	done := make(chan struct{})
+
+	c := &conn{
+		protocol: protocol,
+		done:     done,
+		writeError: func(data []byte) error {
+			return ws.writeChannel(channelError, data)
+		},
+		close: func() {
+			// 解除读循环在管道上的阻塞
+			stdinReader.Close()
+			resizeReader.Close()
+			ws.close()
+		},
+	}
+	if opts.Stdin {
+		c.stdin = stdinReader
+	}
+	if opts.Stdout {
+		c.stdout = &channelWriter{c: ws, channel: channelStdout}
+	}
+	if opts.Stderr {
+		c.stderr = &channelWriter{c: ws, channel: channelStderr}
+	}
+	if opts.TTY {
+		sizes := make(chan TerminalSize, 1)
+		c.resize = sizes
+		go decodeResize(resizeReader, sizes)
+	}
+
+	go func() {
+		defer close(done)
+		defer stdinWriter.Close()
+		defer resizeWriter.Close()
+		for {
+			channel, data, err := ws.readChannel()
+			if err != nil {
+				return
+			}
+			switch channel {
+			case channelStdin:
+				if opts.Stdin {
+					stdinWriter.Write(data)
+				}
+			case channelResize:
+				if opts.TTY {
+					resizeWriter.Write(data)
+				}
+			case channelClose:
+				if protocol == protocolV5 && len(data) > 0 && data[0] == channelStdin {
+					stdinWriter.Close()
+				}
+			}
+		}
+	}()
+	return c, nil
+}
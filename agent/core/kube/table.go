@@ -0,0 +1,207 @@
+package kube
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type column struct {
+	Name     string
+	Type     string
+	Format   string
+	Priority int
+}
+
+// Table 将对象转换为 meta.k8s.io/v1 Table，供 kubectl get 直接打印
+func Table(res Resource, items []Object) Object {
+	columns := tableColumns(res)
+	definitions := make([]interface{}, 0, len(columns))
+	for _, c := range columns {
+		def := map[string]interface{}{
+			"name":        c.Name,
+			"type":        c.Type,
+			"format":      c.Format,
+			"description": "",
+			"priority":    c.Priority,
+		}
+		definitions = append(definitions, def)
+	}
+
+	rows := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		rows = append(rows, map[string]interface{}{
+			"cells": tableCells(res, item),
+			"object": map[string]interface{}{
+				"kind":       "PartialObjectMetadata",
+				"apiVersion": "meta.k8s.io/v1",
+				"metadata":   item["metadata"],
+			},
+		})
+	}
+
+	return Object{
+		"kind":              "Table",
+		"apiVersion":        "meta.k8s.io/v1",
+		"metadata":          map[string]interface{}{"resourceVersion": CurrentResourceVersion()},
+		"columnDefinitions": definitions,
+		"rows":              rows,
+	}
+}
+
+func tableColumns(res Resource) []column {
+	name := column{Name: "Name", Type: "string", Format: "name"}
+	age := column{Name: "Age", Type: "string"}
+
+	switch res.Kind {
+	case "Pod":
+		return []column{name,
+			{Name: "Ready", Type: "string"},
+			{Name: "Status", Type: "string"},
+			{Name: "Restarts", Type: "string"},
+			age,
+			{Name: "IP", Type: "string", Priority: 1},
+			{Name: "Node", Type: "string", Priority: 1},
+		}
+	case "Deployment":
+		return []column{name,
+			{Name: "Ready", Type: "string"},
+			{Name: "Up-to-date", Type: "integer"},
+			{Name: "Available", Type: "integer"},
+			age,
+		}
+	case "Secret":
+		return []column{name, {Name: "Type", Type: "string"}, {Name: "Data", Type: "string"}, age}
+	case "ConfigMap":
+		return []column{name, {Name: "Data", Type: "string"}, age}
+	case "ServiceAccount":
+		return []column{name, {Name: "Secrets", Type: "string"}, age}
+	case "Namespace":
+		return []column{name, {Name: "Status", Type: "string"}, age}
+	case "Role":
+		return []column{name, {Name: "Created At", Type: "string", Format: "date"}}
+	case "ClusterRoleBinding":
+		return []column{name, {Name: "Role", Type: "string"}, age}
+	}
+	return []column{name, age}
+}
+
+func tableCells(res Resource, obj Object) []interface{} {
+	meta, _ := obj["metadata"].(map[string]interface{})
+	created, _ := meta["creationTimestamp"].(string)
+	age := translateTimestamp(created)
+	spec, _ := obj["spec"].(map[string]interface{})
+	status, _ := obj["status"].(map[string]interface{})
+
+	switch res.Kind {
+	case "Pod":
+		containers, _ := spec["containers"].([]interface{})
+		statuses, _ := status["containerStatuses"].([]interface{})
+		ready, restarts := 0, 0
+		for _, s := range statuses {
+			cs, _ := s.(map[string]interface{})
+			if r, _ := cs["ready"].(bool); r {
+				ready++
+			}
+			if n, ok := cs["restartCount"].(float64); ok {
+				restarts += int(n)
+			}
+		}
+		phase, _ := status["phase"].(string)
+		if meta["deletionTimestamp"] != nil {
+			phase = "Terminating"
+		}
+		podIP, _ := status["podIP"].(string)
+		nodeName, _ := spec["nodeName"].(string)
+		if podIP == "" {
+			podIP = "<none>"
+		}
+		return []interface{}{Name(obj), fmt.Sprintf("%d/%d", ready, len(containers)), phase, fmt.Sprint(restarts), age, podIP, nodeName}
+	case "Deployment":
+		replicas, _ := spec["replicas"].(float64)
+		ready, _ := status["readyReplicas"].(float64)
+		updated, _ := status["updatedReplicas"].(float64)
+		available, _ := status["availableReplicas"].(float64)
+		return []interface{}{Name(obj), fmt.Sprintf("%d/%d", int(ready), int(replicas)), int(updated), int(available), age}
+	case "Secret":
+		data, _ := obj["data"].(map[string]interface{})
+		secretType, _ := obj["type"].(string)
+		return []interface{}{Name(obj), secretType, fmt.Sprint(len(data)), age}
+	case "ConfigMap":
+		data, _ := obj["data"].(map[string]interface{})
+		binaryData, _ := obj["binaryData"].(map[string]interface{})
+		return []interface{}{Name(obj), fmt.Sprint(len(data) + len(binaryData)), age}
+	case "ServiceAccount":
+		secrets, _ := obj["secrets"].([]interface{})
+		return []interface{}{Name(obj), fmt.Sprint(len(secrets)), age}
+	case "Namespace":
+		phase, _ := status["phase"].(string)
+		return []interface{}{Name(obj), phase, age}
+	case "Role":
+		return []interface{}{Name(obj), created}
+	case "ClusterRoleBinding":
+		roleRef, _ := obj["roleRef"].(map[string]interface{})
+		return []interface{}{Name(obj), fmt.Sprintf("%s/%s", roleRef["kind"], roleRef["name"]), age}
+	}
+	return []interface{}{Name(obj), age}
+}
+
+// translateTimestamp 计算对象年龄，格式与 kubectl 一致
+func translateTimestamp(timestamp string) string {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return "<unknown>"
+	}
+	return HumanDuration(time.Since(t))
+}
+
+// HumanDuration 以 kubectl 的方式格式化时长，如 5m10s、117m、3d4h
+func HumanDuration(d time.Duration) string {
+	if seconds := int(d.Seconds()); seconds < -1 {
+		return "<invalid>"
+	} else if seconds < 0 {
+		return "0s"
+	} else if seconds < 60*2 {
+		return fmt.Sprintf("%ds", seconds)
+	}
+	minutes := int(d / time.Minute)
+	if minutes < 10 {
+		s := int(d/time.Second) % 60
+		if s == 0 {
+			return fmt.Sprintf("%dm", minutes)
+		}
+		return fmt.Sprintf("%dm%ds", minutes, s)
+	} else if minutes < 60*3 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	hours := int(d / time.Hour)
+	if hours < 8 {
+		m := int(d/time.Minute) % 60
+		if m == 0 {
+			return fmt.Sprintf("%dh", hours)
+		}
+		return fmt.Sprintf("%dh%dm", hours, m)
+	} else if hours < 48 {
+		return fmt.Sprintf("%dh", hours)
+	} else if hours < 24*8 {
+		h := hours % 24
+		if h == 0 {
+			return fmt.Sprintf("%dd", hours/24)
+		}
+		return fmt.Sprintf("%dd%dh", hours/24, h)
+	} else if hours < 24*365*2 {
+		return fmt.Sprintf("%dd", hours/24)
+	} else if hours < 24*365*8 {
+		dy := int(hours/24) % 365
+		if dy == 0 {
+			return fmt.Sprintf("%dy", hours/24/365)
+		}
+		return fmt.Sprintf("%dy%dd", hours/24/365, dy)
+	}
+	return fmt.Sprintf("%dy", hours/24/365)
+}
+
+// AcceptsTable 判断 Accept 头是否请求 Table 格式
+func AcceptsTable(accept string) bool {
+	return strings.Contains(accept, "as=Table")
+}
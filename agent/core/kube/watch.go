@@ -0,0 +1,116 @@
+package kube
+
+import (
+	"strings"
+	"sync"
+)
+
+// 事件类型，与 watch.EventType 一致
+const (
+	Added    = "ADDED"
+	Modified = "MODIFIED"
+	Deleted  = "DELETED"
+	Bookmark = "BOOKMARK"
+)
+
+// 单个 watcher 的事件缓冲，消费过慢时关闭，由客户端重新发起 watch
+const watchBuffer = 128
+
+// Event 对象变更事件
+type Event struct {
+	Type   string
+	Object Object
+}
+
+// Watcher 订阅某类资源的变更
+type Watcher struct {
+	res       Resource
+	namespace string
+	selector  Selector
+	events    chan Event
+	store     *Store
+	stopOnce  sync.Once
+}
+
+// Events 返回事件通道，watcher 被停止后通道关闭
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Stop 取消订阅
+func (w *Watcher) Stop() {
+	w.store.mu.Lock()
+	defer w.store.mu.Unlock()
+	w.store.removeWatcher(w)
+}
+
+func (s *Store) removeWatcher(w *Watcher) {
+	w.stopOnce.Do(func() {
+		delete(s.watchers, w)
+		close(w.events)
+	})
+}
+
+// Watch 订阅资源变更，并原子地返回订阅时刻的对象快照
+func (s *Store) Watch(res Resource, namespace string, selector Selector) (*Watcher, []Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := &Watcher{
+		res:       res,
+		namespace: namespace,
+		selector:  selector,
+		events:    make(chan Event, watchBuffer),
+		store:     s,
+	}
+	if s.watchers == nil {
+		s.watchers = make(map[*Watcher]struct{})
+	}
+	s.watchers[w] = struct{}{}
+	return w, s.list(res, namespace, selector)
+}
+
+// set 写入对象并通知 watcher，调用方需持有写锁
+func (s *Store) set(key string, obj Object) {
+	eventType := Added
+	if _, ok := s.objects[key]; ok {
+		eventType = Modified
+	}
+	size := objectSize(obj)
+	s.used += size - s.sizes[key]
+	s.sizes[key] = size
+	s.objects[key] = obj
+	s.notify(key, eventType, obj)
+}
+
+// del 删除对象并通知 watcher，调用方需持有写锁
+func (s *Store) del(key string) {
+	obj, ok := s.objects[key]
+	if !ok {
+		return
+	}
+	delete(s.objects, key)
+	s.used -= s.sizes[key]
+	delete(s.sizes, key)
+	s.notify(key, Deleted, obj)
+}
+
+func (s *Store) notify(key, eventType string, obj Object) {
+	if len(s.watchers) == 0 {
+		return
+	}
+	resourceName := key[:strings.Index(key, "/")]
+	for w := range s.watchers {
+		if w.res.Name != resourceName || (w.res.Namespaced && w.namespace != "" && w.namespace != Namespace(obj)) {
+			continue
+		}
+		if !w.selector.Matches(obj) {
+			continue
+		}
+		select {
+		case w.events <- Event{Type: eventType, Object: deepCopy(obj)}:
+		default:
+			s.removeWatcher(w)
+		}
+	}
+}
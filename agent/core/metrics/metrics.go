@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"KubePot/core/health"
+	"KubePot/core/spool"
+	"KubePot/utils/log"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	connections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubepot_connections_total",
+		Help: "Connections accepted by each honeypot.",
+	}, []string{"protocol"})
+
+	sessions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kubepot_active_sessions",
+		Help: "Attack sessions currently open on each honeypot.",
+	}, []string{"protocol"})
+
+	authAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubepot_auth_attempts_total",
+		Help: "Login attempts or requests carrying credentials captured by each honeypot.",
+	}, []string{"protocol"})
+
+	commands = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubepot_commands_total",
+		Help: "Commands captured by each honeypot.",
+	}, []string{"protocol"})
+
+	reports = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubepot_reports_total",
+		Help: "Attempts to send spooled reports to the server, by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		connections, sessions, authAttempts, commands, reports, listenerCollector{},
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "kubepot_spool_depth",
+			Help: "Reports waiting in the local spool.",
+		}, func() float64 {
+			depth, _ := spool.Stats()
+			return float64(depth)
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "kubepot_spool_dropped_total",
+			Help: "Reports dropped because the spool was full or the server rejected them.",
+		}, func() float64 {
+			_, dropped := spool.Stats()
+			return float64(dropped)
+		}),
+	)
+}
+
+// SessionOpened 记录一次新连接和会话开始
+func SessionOpened(protocol string) {
+	connections.WithLabelValues(protocol).Inc()
+	sessions.WithLabelValues(protocol).Inc()
+}
+
+// SessionClosed 记录会话结束
+func SessionClosed(protocol string) {
+	sessions.WithLabelValues(protocol).Dec()
+}
+
+// AuthAttempt 记录一次登录尝试
+func AuthAttempt(protocol string) {
+	authAttempts.WithLabelValues(protocol).Inc()
+}
+
+// Command 记录一条捕获的命令
+func Command(protocol string) {
+	commands.WithLabelValues(protocol).Inc()
+}
+
+// Report 记录一次上报的结果
+func Report(err error) {
+	if err != nil {
+		reports.WithLabelValues("failure").Inc()
+		return
+	}
+	reports.WithLabelValues("success").Inc()
+}
+
+// listenerCollector 按 health 中各服务的监听结果输出监听状态
+type listenerCollector struct{}
+
+var listenerUp = prometheus.NewDesc(
+	"kubepot_listener_up",
+	"Whether each started honeypot service is listening (1) or failed to listen (0).",
+	[]string{"service", "addr"}, nil,
+)
+
+func (listenerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- listenerUp
+}
+
+func (listenerCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range health.Services() {
+		// 尚未完成监听的服务不输出
+		if s.State == health.StateStarting {
+			continue
+		}
+		up := 0.0
+		if s.State == health.StateRunning {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(listenerUp, prometheus.GaugeValue, up, s.Name, s.Addr)
+	}
+}
+
+// Start 在 addr 上提供 /metrics
+func Start(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	log.Pr("Metrics", "127.0.0.1", "指标服务启动", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Pr("Metrics", "127.0.0.1", "指标服务启动失败", err)
+	}
+}
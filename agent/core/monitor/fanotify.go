@@ -0,0 +1,189 @@
+//go:build linux
+// +build linux
+
+package monitor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// 监控关注的 fanotify 事件，通知模式下文件描述符事件只支持读写和打开关闭
+const (
+	// 读取监控对所有密标开启
+	accessMask = unix.FAN_OPEN | unix.FAN_ACCESS
+	// 篡改监控只对开启了 MonitorTampering 的密标开启。每次 write 都会产生 FAN_MODIFY，
+	// 只在以写方式打开的文件关闭时告警，一次修改只告警一次
+	tamperMask = unix.FAN_CLOSE_WRITE
+)
+
+// fanotify 通过 fanotify 接收密标文件的读写事件，能得到访问进程
+type fanotify struct {
+	fm *FileMonitor
+	fd int
+	// wake 关闭时写入的 eventfd，唤醒阻塞在 poll 上的监控循环，两个描述符都由监控循环关闭
+	wake    int
+	running atomic.Bool
+}
+
+// newFanotify 初始化 fanotify，需要 CAP_SYS_ADMIN，普通容器内会返回 EPERM
+func newFanotify(fm *FileMonitor) (backend, error) {
+	fd, err := unix.FanotifyInit(unix.FAN_CLOEXEC|unix.FAN_CLASS_NOTIF|unix.FAN_NONBLOCK, unix.O_RDONLY|unix.O_LARGEFILE)
+	if err != nil {
+		return nil, fmt.Errorf("fanotify init failed: %v", err)
+	}
+	wake, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("eventfd init failed: %v", err)
+	}
+
+	f := &fanotify{fm: fm, fd: fd, wake: wake}
+	f.running.Store(true)
+
+	// 启动监控循环
+	go f.monitorLoop()
+
+	return f, nil
+}
+
+// mark 按文件所属的全部密标重新计算 fanotify 标记
+func (f *fanotify) mark(path string, labels []SecretLabel) error {
+	var mask uint64
+	for _, label := range labels {
+		mask |= labelMask(label)
+	}
+
+	// 先去掉不再需要的事件，文件已删除或从未标记时忽略错误
+	if unused := (accessMask | tamperMask) &^ mask; unused != 0 {
+		unix.FanotifyMark(f.fd, unix.FAN_MARK_REMOVE, unused, unix.AT_FDCWD, path)
+	}
+	if mask == 0 {
+		return nil
+	}
+
+	// 只标记该文件本身，不监控整个文件系统
+	return unix.FanotifyMark(f.fd, unix.FAN_MARK_ADD, mask, unix.AT_FDCWD, path)
+}
+
+// close 停止监控循环，循环退出时关闭 fanotify 描述符
+func (f *fanotify) close() {
+	if !f.running.CompareAndSwap(true, false) {
+		return
+	}
+	var buf [8]byte
+	binary.NativeEndian.PutUint64(buf[:], 1)
+	unix.Write(f.wake, buf[:])
+}
+
+// labelMask 密标需要监控的事件
+func labelMask(label SecretLabel) uint64 {
+	if label.MonitorTampering {
+		return accessMask | tamperMask
+	}
+	return accessMask
+}
+
+// monitorLoop 监控循环，同时等待 fanotify 事件和关闭通知
+func (f *fanotify) monitorLoop() {
+	defer unix.Close(f.wake)
+	defer unix.Close(f.fd)
+
+	buf := make([]byte, 4096)
+	fds := []unix.PollFd{
+		{Fd: int32(f.fd), Events: unix.POLLIN},
+		{Fd: int32(f.wake), Events: unix.POLLIN},
+	}
+
+	for f.running.Load() {
+		if _, err := unix.Poll(fds, -1); err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			fmt.Printf("poll fanotify failed: %v\n", err)
+			break
+		}
+		if fds[1].Revents != 0 {
+			break
+		}
+		if fds[0].Revents&(unix.POLLERR|unix.POLLHUP|unix.POLLNVAL) != 0 {
+			fmt.Printf("fanotify descriptor failed, events: %#x\n", fds[0].Revents)
+			break
+		}
+		if fds[0].Revents&unix.POLLIN == 0 {
+			continue
+		}
+
+		n, err := unix.Read(f.fd, buf)
+		if err != nil {
+			if err == unix.EINTR || err == unix.EAGAIN {
+				continue
+			}
+			fmt.Printf("read fanotify event failed: %v\n", err)
+			break
+		}
+
+		if n <= 0 {
+			continue
+		}
+
+		// 处理事件
+		f.handleEvents(buf[:n])
+	}
+}
+
+// handleEvents 解析 fanotify_event_metadata 记录，一次读取可能包含多个事件
+func (f *fanotify) handleEvents(buf []byte) {
+	const metaLen = int(unsafe.Sizeof(unix.FanotifyEventMetadata{}))
+	self := os.Getpid()
+
+	for len(buf) >= metaLen {
+		meta := (*unix.FanotifyEventMetadata)(unsafe.Pointer(&buf[0]))
+		eventLen := int(meta.Event_len)
+		if meta.Vers != unix.FANOTIFY_METADATA_VERSION || eventLen < metaLen || eventLen > len(buf) {
+			fmt.Printf("invalid fanotify event, version: %d, length: %d\n", meta.Vers, eventLen)
+			return
+		}
+		buf = buf[eventLen:]
+
+		if meta.Mask&unix.FAN_Q_OVERFLOW != 0 {
+			fmt.Println("fanotify event queue overflow, some events are lost")
+			continue
+		}
+		if meta.Fd == unix.FAN_NOFD {
+			continue
+		}
+
+		// 内核为每个事件打开一个文件描述符，通过 /proc/self/fd 得到文件路径
+		path, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", meta.Fd))
+		unix.Close(int(meta.Fd))
+		if err != nil {
+			fmt.Printf("resolve fanotify event fd failed: %v\n", err)
+			continue
+		}
+
+		// 忽略 Agent 自身的访问
+		pid := int(meta.Pid)
+		if pid == self {
+			continue
+		}
+
+		if len(f.fm.lookup(path)) == 0 {
+			continue
+		}
+
+		proc := lookupProcess(pid)
+
+		if meta.Mask&tamperMask != 0 {
+			f.fm.tampered(path, proc, "文件被篡改")
+		}
+		if meta.Mask&accessMask != 0 {
+			f.fm.read(path, proc)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package monitor
+
+import "errors"
+
+// newFanotify 非Linux系统上没有 fanotify
+func newFanotify(fm *FileMonitor) (backend, error) {
+	return nil, errors.New("fanotify is only supported on Linux systems")
+}
@@ -1,67 +1,105 @@
-// +build linux
-
 package monitor
 
 import (
-	"encoding/json"
 	"fmt"
-	"net/http"
-	"net/url"
 	"os"
-	"strings"
-	"syscall"
+	"path/filepath"
+	"sync"
 	"time"
 
+	"KubePot/core/common"
+	"KubePot/core/honeytoken"
 	"KubePot/core/report"
 	"KubePot/utils/config"
 )
 
+// 监控方式
+const (
+	ModeFanotify = "fanotify"
+	ModePoll     = "poll"
+)
+
+// 同一进程反复读取同一文件时的告警间隔，一次 cat 会产生多个读取事件
+const accessInterval = time.Minute
+
+// backend 监控后端，按文件设置需要监控的密标
+type backend interface {
+	// mark 按文件所属的全部密标更新监控，labels 为空时取消该文件的监控
+	mark(path string, labels []SecretLabel) error
+	close()
+}
+
+// 上报密标告警，测试中替换为本地记录
+var (
+	reportAccess = report.ReportSecretLabelAccess
+	reportAlert  = report.ReportSecretLabelAlert
+)
+
+// watch 已监控的密标
+type watch struct {
+	label SecretLabel
+	// path 解析符号链接后的实际路径，事件中的路径与之一致
+	path string
+	// missing 添加监控时文件不存在，下次同步时重新标记
+	missing bool
+}
+
 // FileMonitor 文件监控结构体
 type FileMonitor struct {
 	running bool
-	fd      int
+	mode    string
+	backend backend
+
+	mu      sync.RWMutex
+	watches map[int]watch
+	// labels 按文件实际路径索引的密标，同一文件可能属于多个密标
+	labels map[string][]SecretLabel
+
+	// accessed 按文件和进程记录最近一次读取告警的时间
+	accessMu sync.Mutex
+	accessed map[string]time.Time
 }
 
 // NewFileMonitor 创建新的文件监控实例
 func NewFileMonitor() *FileMonitor {
 	return &FileMonitor{
-		running: false,
+		running:  false,
+		watches:  make(map[int]watch),
+		labels:   make(map[string][]SecretLabel),
+		accessed: make(map[string]time.Time),
 	}
 }
 
-// Start 启动文件监控
+// Start 启动文件监控，auto 模式下 fanotify 不可用（非 Linux 或容器内没有权限）时退回轮询
 func (fm *FileMonitor) Start() error {
 	if fm.running {
 		return fmt.Errorf("file monitor already running")
 	}
 
-	// 初始化fanotify
-	fd, err := syscall.FanotifyInit(syscall.FAN_CLOEXEC|syscall.FAN_CLASS_NOTIF, syscall.O_RDONLY|syscall.O_LARGEFILE)
-	if err != nil {
-		return fmt.Errorf("fanotify init failed: %v", err)
-	}
-	fm.fd = fd
-
-	// 获取需要监控的文件列表
-	files, err := fm.getMonitoredFiles()
-	if err != nil {
-		return err
-	}
-
-	// 添加监控文件
-	for _, file := range files {
-		err := fm.addWatch(file)
+	mode := config.Get("monitor", "mode")
+	var err error
+	if mode != ModePoll {
+		fm.backend, err = newFanotify(fm)
+		fm.mode = ModeFanotify
+		if err != nil && mode == ModeFanotify {
+			return err
+		}
 		if err != nil {
-			fmt.Printf("add watch failed for %s: %v\n", file, err)
-			continue
+			fmt.Printf("%v, fall back to polling\n", err)
 		}
-		fmt.Printf("added watch for %s\n", file)
 	}
-
+	if fm.backend == nil {
+		interval := time.Duration(config.GetInt("monitor", "poll_interval")) * time.Second
+		fm.backend = newPoll(fm, interval)
+		fm.mode = ModePoll
+	}
 	fm.running = true
+	fmt.Printf("file monitor mode: %s\n", fm.mode)
 
-	// 启动监控循环
-	go fm.monitorLoop()
+	// 拉取密标失败时先空跑，由任务循环定期同步
+	if _, err := fm.Resync(); err != nil {
+		fmt.Printf("sync secret labels failed: %v\n", err)
+	}
 
 	return nil
 }
@@ -73,148 +111,229 @@ func (fm *FileMonitor) Stop() error {
 	}
 
 	fm.running = false
-	syscall.Close(fm.fd)
+	fm.backend.close()
 
 	return nil
 }
 
-// addWatch 添加文件监控
-func (fm *FileMonitor) addWatch(path string) error {
-	// 确保路径存在
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return fmt.Errorf("path does not exist: %s", path)
+// Mode 当前使用的监控方式
+func (fm *FileMonitor) Mode() string {
+	return fm.mode
+}
+
+// Apply 新增或更新密标的监控，密标文件路径或篡改开关变化时重新标记，否则保留已有基线。
+// 文件被删除时保留监控并报告文件缺失，轮询在文件重新创建时告警
+func (fm *FileMonitor) Apply(label SecretLabel) common.WatchStatus {
+	status := common.WatchStatus{LabelID: label.ID, FilePath: label.FilePath, Mode: fm.mode}
+	if !fm.running {
+		status.Status = common.WatchUnavailable
+		return status
 	}
 
-	// 打开文件
-	file, err := os.Open(path)
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	old, ok := fm.watches[label.ID]
+	path, err := resolvePath(label.FilePath)
+	missing := os.IsNotExist(err)
+	if missing {
+		path, err = filepath.Abs(label.FilePath)
+		if ok && old.label.FilePath == label.FilePath {
+			path = old.path
+		}
+	}
 	if err != nil {
-		return err
+		fm.unwatchLocked(label.ID)
+		fmt.Printf("add watch failed for %s: %v\n", label.FilePath, err)
+		status.Status = common.WatchFailed
+		status.Error = err.Error()
+		return status
 	}
-	defer file.Close()
 
-	// 添加fanotify监控
-	err = syscall.FanotifyMark(
-		fm.fd,
-		syscall.FAN_MARK_ADD|syscall.FAN_MARK_FILESYSTEM,
-		syscall.FAN_MODIFY|syscall.FAN_DELETE|syscall.FAN_CREATE|syscall.FAN_ATTRIB,
-		file.Fd(),
-		path,
-	)
+	if ok && !old.missing && !missing && old.path == path && old.label.MonitorTampering == label.MonitorTampering {
+		fm.watches[label.ID] = watch{label: label, path: path}
+		fm.labelsLocked(path)
+		status.Status = common.WatchActive
+		return status
+	}
 
-	return err
+	if ok && old.path != path {
+		fm.unwatchLocked(label.ID)
+	}
+	fm.watches[label.ID] = watch{label: label, path: path, missing: missing}
+	err = fm.markLocked(path)
+	if missing {
+		fmt.Printf("watched file is missing: %s\n", path)
+		status.Status = common.WatchMissing
+		status.Error = fmt.Sprintf("file does not exist: %s", path)
+		return status
+	}
+	if err != nil {
+		fm.unwatchLocked(label.ID)
+		fmt.Printf("add watch failed for %s: %v\n", label.FilePath, err)
+		status.Status = common.WatchFailed
+		status.Error = err.Error()
+		return status
+	}
+
+	fmt.Printf("added watch for %s\n", path)
+	status.Status = common.WatchActive
+	return status
 }
 
-// monitorLoop 监控循环
-func (fm *FileMonitor) monitorLoop() {
-	buf := make([]byte, 4096)
+// Remove 取消密标的监控，文件仍属于其他密标时保留这些密标需要的监控
+func (fm *FileMonitor) Remove(id int) common.WatchStatus {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
 
-	for fm.running {
-		n, err := syscall.Read(fm.fd, buf)
-		if err != nil {
-			if err == syscall.EINTR {
-				continue
-			}
-			fmt.Printf("read fanotify event failed: %v\n", err)
-			break
-		}
+	status := common.WatchStatus{LabelID: id, Status: common.WatchRemoved, Mode: fm.mode}
+	if w, ok := fm.watches[id]; ok {
+		status.FilePath = w.label.FilePath
+		fm.unwatchLocked(id)
+		fmt.Printf("removed watch for %s\n", w.path)
+	}
+	return status
+}
 
-		if n <= 0 {
-			continue
-		}
+// Resync 从服务端拉取密标列表，补齐缺失的监控并移除服务端已删除的密标
+func (fm *FileMonitor) Resync() ([]common.WatchStatus, error) {
+	labels, err := getMonitoredLabels()
+	if err != nil {
+		return nil, err
+	}
 
-		// 处理事件
-		fm.handleEvents(buf[:n])
+	wanted := make(map[int]bool, len(labels))
+	statuses := make([]common.WatchStatus, 0, len(labels))
+	for _, label := range labels {
+		wanted[label.ID] = true
+		statuses = append(statuses, fm.Apply(label))
 	}
-}
 
-// handleEvents 处理文件事件
-func (fm *FileMonitor) handleEvents(buf []byte) {
-	// 这里需要解析fanotify事件
-	// 由于fanotify事件结构复杂，这里简化处理
-	// 实际实现需要根据系统架构解析事件结构
+	fm.mu.RLock()
+	var stale []int
+	for id := range fm.watches {
+		if !wanted[id] {
+			stale = append(stale, id)
+		}
+	}
+	fm.mu.RUnlock()
 
-	// 模拟处理，实际需要解析事件获取文件路径
-	fmt.Printf("file tampering detected\n")
+	for _, id := range stale {
+		honeytoken.Unregister(id)
+		statuses = append(statuses, fm.Remove(id))
+	}
 
-	// 上报文件篡改事件
-	fm.reportTamperingEvent("/path/to/tampered/file", "文件被篡改")
+	return statuses, nil
 }
 
-// reportTamperingEvent 上报文件篡改事件
-func (fm *FileMonitor) reportTamperingEvent(filePath string, message string) {
-	agentName := config.Get("rpc", "name")
-	if agentName == "" {
-		agentName = "default"
+// unwatchLocked 删除密标并更新其文件的监控，调用方持有 mu
+func (fm *FileMonitor) unwatchLocked(id int) {
+	w, ok := fm.watches[id]
+	if !ok {
+		return
 	}
+	delete(fm.watches, id)
+	if err := fm.markLocked(w.path); err != nil {
+		fmt.Printf("update watch failed for %s: %v\n", w.path, err)
+	}
+}
 
-	// 构建上报信息
-	info := fmt.Sprintf("File: %s, Message: %s", filePath, message)
-
-	// 上报到密标告警
-	go report.ReportSecretLabelAlert(agentName, filePath, info)
+// markLocked 按文件所属的全部密标更新后端的监控，调用方持有 mu
+func (fm *FileMonitor) markLocked(path string) error {
+	return fm.backend.mark(path, fm.labelsLocked(path))
 }
 
-// 密标结构体
-type SecretLabel struct {
-	ID               int    `json:"id"`
-	Name             string `json:"name"`
-	LabelType        string `json:"label_type"`
-	FilePath         string `json:"file_path"`
-	FileContent      string `json:"file_content"`
-	AgentType        string `json:"agent_type"`
-	AgentList        string `json:"agent_list"`
-	MonitorTampering bool   `json:"monitor_tampering"`
-	CreateTime       string `json:"create_time"`
-	UpdateTime       string `json:"update_time"`
+// labelsLocked 重新收集文件所属的密标，调用方持有 mu
+func (fm *FileMonitor) labelsLocked(path string) []SecretLabel {
+	var labels []SecretLabel
+	for _, w := range fm.watches {
+		if w.path == path {
+			labels = append(labels, w.label)
+		}
+	}
+	if len(labels) == 0 {
+		delete(fm.labels, path)
+	} else {
+		fm.labels[path] = labels
+	}
+	return labels
 }
 
-// 响应结构体
-type SecretLabelResponse struct {
-	Code int            `json:"code"`
-	Msg  string         `json:"msg"`
-	Data []SecretLabel `json:"data"`
+// lookup 返回文件所属的密标
+func (fm *FileMonitor) lookup(path string) []SecretLabel {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+	return fm.labels[path]
 }
 
-// getMonitoredFiles 获取需要监控的文件列表
-func (fm *FileMonitor) getMonitoredFiles() ([]string, error) {
-	// 获取Agent名称
-	agentName := config.Get("rpc", "name")
-	if agentName == "" {
-		agentName = "default"
+// resolvePath 返回解析符号链接后的实际路径
+func resolvePath(path string) (string, error) {
+	// 确保路径存在，文件不存在时返回的错误满足 os.IsNotExist
+	if _, err := os.Stat(path); err != nil {
+		return "", err
 	}
+	return filepath.EvalSymlinks(path)
+}
 
-	// 获取服务器地址
-	serverAddr := config.Get("rpc", "addr")
-	if !strings.HasPrefix(serverAddr, "http://") && !strings.HasPrefix(serverAddr, "https://") {
-		serverAddr = "http://" + serverAddr
+// tampered 上报文件所属密标中开启了篡改监控的密标
+func (fm *FileMonitor) tampered(path string, proc *Process, message string) {
+	fmt.Printf("file tampering detected: %s, %s\n", path, proc)
+	for _, label := range fm.lookup(path) {
+		if label.MonitorTampering {
+			fm.reportTamperingEvent(label, path, proc, message)
+		}
 	}
+}
 
-	// 构建请求URL
-	url := serverAddr + "/api/v1/secretlabel/agent/list?agent=" + url.QueryEscape(agentName)
-
-	// 发送HTTP请求
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+// read 上报文件被读取，同一进程在间隔内重复读取只上报一次
+func (fm *FileMonitor) read(path string, proc *Process) {
+	pid := 0
+	if proc != nil {
+		pid = proc.PID
 	}
-	resp, err := client.Get(url)
-	if err != nil {
-		return []string{}, fmt.Errorf("get secret labels failed: %v", err)
+	if !fm.shouldAlertAccess(path, pid) {
+		return
 	}
-	defer resp.Body.Close()
-
-	// 解析响应
-	var response SecretLabelResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return []string{}, fmt.Errorf("decode response failed: %v", err)
+	fmt.Printf("file access detected: %s, %s\n", path, proc)
+	for _, label := range fm.lookup(path) {
+		fm.reportAccessEvent(label, path, proc)
 	}
+}
 
-	// 提取需要监控的文件路径
-	var files []string
-	for _, label := range response.Data {
-		if label.MonitorTampering && label.FilePath != "" {
-			files = append(files, label.FilePath)
+// shouldAlertAccess 同一进程在间隔内重复读取同一文件只告警一次
+func (fm *FileMonitor) shouldAlertAccess(path string, pid int) bool {
+	fm.accessMu.Lock()
+	defer fm.accessMu.Unlock()
+
+	now := time.Now()
+	for key, last := range fm.accessed {
+		if now.Sub(last) > accessInterval {
+			delete(fm.accessed, key)
 		}
 	}
 
-	return files, nil
+	key := fmt.Sprintf("%s:%d", path, pid)
+	if _, ok := fm.accessed[key]; ok {
+		return false
+	}
+	fm.accessed[key] = now
+	return true
+}
+
+// reportAccessEvent 上报密标文件被读取事件
+func (fm *FileMonitor) reportAccessEvent(label SecretLabel, filePath string, proc *Process) {
+	// 构建上报信息
+	info := fmt.Sprintf("File: %s, Message: 文件被读取, %s", filePath, proc)
+
+	// 上报到密标告警
+	go reportAccess(agentName(), label.ID, label.Name, filePath, info)
+}
+
+// reportTamperingEvent 上报文件篡改事件
+func (fm *FileMonitor) reportTamperingEvent(label SecretLabel, filePath string, proc *Process, message string) {
+	// 构建上报信息
+	info := fmt.Sprintf("File: %s, Message: %s, %s", filePath, message, proc)
+
+	// 上报到密标告警
+	go reportAlert(agentName(), label.ID, label.Name, filePath, info)
 }
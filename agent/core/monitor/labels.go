@@ -0,0 +1,66 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"KubePot/core/common"
+	"KubePot/core/honeytoken"
+	"KubePot/core/rpc/auth"
+	"KubePot/utils/config"
+)
+
+// SecretLabel 密标结构体
+type SecretLabel = common.SecretLabel
+
+// 响应结构体
+type SecretLabelResponse struct {
+	Code int           `json:"code"`
+	Msg  string        `json:"msg"`
+	Data []SecretLabel `json:"data"`
+}
+
+// getMonitoredLabels 获取需要监控的密标，所有密标都监控读取，篡改按 MonitorTampering 开启
+func getMonitoredLabels() ([]SecretLabel, error) {
+	// 获取服务器地址
+	serverAddr := config.Get("rpc", "addr")
+	if !strings.HasPrefix(serverAddr, "http://") && !strings.HasPrefix(serverAddr, "https://") {
+		serverAddr = "http://" + serverAddr
+	}
+
+	// 发送签名的HTTP请求
+	body, err := auth.Get(serverAddr + "/api/v1/secretlabel/agent/list?agent=" + url.QueryEscape(agentName()))
+	if err != nil {
+		return nil, fmt.Errorf("get secret labels failed: %v", err)
+	}
+
+	// 解析响应
+	var response SecretLabelResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("decode response failed: %v", err)
+	}
+	if response.Code != 200 {
+		return nil, fmt.Errorf("get secret labels failed: %s", response.Msg)
+	}
+
+	// 提取需要监控的密标
+	var labels []SecretLabel
+	for _, label := range response.Data {
+		honeytoken.Register(label.ID, label.Name, label.FileContent)
+		if label.FilePath != "" {
+			labels = append(labels, label)
+		}
+	}
+
+	return labels, nil
+}
+
+// agentName 告警中使用的 Agent 名称
+func agentName() string {
+	if name := config.Get("rpc", "name"); name != "" {
+		return name
+	}
+	return "default"
+}
@@ -0,0 +1,192 @@
+package monitor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// baseline 密标文件的基线
+type baseline struct {
+	exists  bool
+	hash    string
+	size    int64
+	modTime time.Time
+	stat    fileStat
+}
+
+// poll 定期比对 SHA-256、大小、修改时间、inode 和访问时间，用于没有 fanotify 权限的环境
+// 轮询拿不到访问进程；文件系统以 noatime 挂载时无法发现读取
+type poll struct {
+	fm       *FileMonitor
+	interval time.Duration
+
+	mu    sync.Mutex
+	files map[string]*baseline
+	stop  chan struct{}
+}
+
+func newPoll(fm *FileMonitor, interval time.Duration) backend {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	p := &poll{
+		fm:       fm,
+		interval: interval,
+		files:    make(map[string]*baseline),
+		stop:     make(chan struct{}),
+	}
+
+	// 启动轮询循环
+	go p.loop()
+
+	return p
+}
+
+// mark 新文件记录基线，已有基线的文件保持不变。文件不存在时记录为已删除，重新创建时告警
+func (p *poll) mark(path string, labels []SecretLabel) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(labels) == 0 {
+		delete(p.files, path)
+		return nil
+	}
+	if _, ok := p.files[path]; ok {
+		return nil
+	}
+
+	b := &baseline{}
+	if err := b.reset(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	p.files[path] = b
+	return nil
+}
+
+func (p *poll) close() {
+	close(p.stop)
+}
+
+func (p *poll) loop() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.scan()
+		}
+	}
+}
+
+// scan 逐个比对基线，上报时不持有锁，避免与 Apply 互相等待
+func (p *poll) scan() {
+	p.mu.Lock()
+	files := make(map[string]*baseline, len(p.files))
+	for path, b := range p.files {
+		files[path] = b
+	}
+	p.mu.Unlock()
+
+	for path, b := range files {
+		p.check(path, b)
+	}
+}
+
+// check 比对一个文件，发现变化后以当前状态作为新的基线
+func (p *poll) check(path string, b *baseline) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) && b.exists {
+			b.exists = false
+			p.fm.tampered(path, nil, "文件被删除")
+		}
+		return
+	}
+
+	if !b.exists {
+		p.fm.tampered(path, nil, "文件被删除后重新创建")
+		p.rebase(path, b)
+		return
+	}
+
+	st := statOf(fi)
+	if st.ok && b.stat.ok && (st.dev != b.stat.dev || st.ino != b.stat.ino) {
+		p.fm.tampered(path, nil, "文件被替换")
+		p.rebase(path, b)
+		return
+	}
+
+	// 大小、修改时间或状态变化时间变化才计算哈希，修改时间可以伪造，状态变化时间不能
+	if fi.Size() != b.size || !fi.ModTime().Equal(b.modTime) || !st.ctime.Equal(b.stat.ctime) {
+		hash, err := hashFile(path)
+		if err != nil {
+			fmt.Printf("hash file failed for %s: %v\n", path, err)
+			return
+		}
+		if hash != b.hash {
+			p.fm.tampered(path, nil, "文件内容被修改")
+		}
+		p.rebase(path, b)
+		return
+	}
+
+	if st.ok && st.atime.After(b.stat.atime) {
+		p.fm.read(path, nil)
+		p.rebase(path, b)
+	}
+}
+
+func (p *poll) rebase(path string, b *baseline) {
+	if err := b.reset(path); err != nil {
+		fmt.Printf("reset baseline failed for %s: %v\n", path, err)
+	}
+}
+
+// reset 重新记录基线。计算哈希会读文件，之后把访问时间设回修改时间，
+// 这样 relatime 挂载下的下一次读取仍会更新访问时间
+func (b *baseline) reset(path string) error {
+	hash, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	os.Chtimes(path, fi.ModTime(), fi.ModTime())
+	if fi, err = os.Stat(path); err != nil {
+		return err
+	}
+
+	*b = baseline{
+		exists:  true,
+		hash:    hash,
+		size:    fi.Size(),
+		modTime: fi.ModTime(),
+		stat:    statOf(fi),
+	}
+	return nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
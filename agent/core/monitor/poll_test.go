@@ -0,0 +1,211 @@
+package monitor
+
+import (
+	"KubePot/core/common"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pollEnv 创建使用轮询后端的文件监控，告警写入返回的通道
+func pollEnv(t *testing.T) (*FileMonitor, *poll, chan string) {
+	access, alert := reportAccess, reportAlert
+	t.Cleanup(func() {
+		reportAccess, reportAlert = access, alert
+	})
+
+	alerts := make(chan string, 16)
+	reportAccess = func(agent string, labelID int, labelName string, ip string, info string) {
+		alerts <- "读取: " + info
+	}
+	reportAlert = func(agent string, labelID int, labelName string, ip string, info string) {
+		alerts <- "篡改: " + info
+	}
+
+	fm := NewFileMonitor()
+	p := &poll{fm: fm, interval: time.Hour, files: make(map[string]*baseline), stop: make(chan struct{})}
+	fm.backend, fm.mode, fm.running = p, ModePoll, true
+	return fm, p, alerts
+}
+
+// received 返回一次扫描产生的告警，上报在单独的 goroutine 中进行
+func received(alerts chan string) []string {
+	var got []string
+	for {
+		select {
+		case a := <-alerts:
+			got = append(got, a)
+		case <-time.After(100 * time.Millisecond):
+			return got
+		}
+	}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// watchFile 添加监控，文件应当存在
+func watchFile(t *testing.T, fm *FileMonitor, label SecretLabel) {
+	if status := fm.Apply(label); status.Status != common.WatchActive {
+		t.Fatalf("apply %s: %+v", label.FilePath, status)
+	}
+}
+
+// expect 检查一次扫描只产生一条篡改告警，want 为空时不应有告警
+func expect(t *testing.T, got []string, want string) {
+	t.Helper()
+	if want == "" {
+		if len(got) != 0 {
+			t.Errorf("unexpected alerts: %v", got)
+		}
+		return
+	}
+	if len(got) != 1 || !strings.HasPrefix(got[0], "篡改: ") || !strings.Contains(got[0], want) {
+		t.Errorf("alerts = %v, want one containing %q", got, want)
+	}
+}
+
+func TestPollCheck(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(t *testing.T, p *poll, alerts chan string, path string)
+		want   string
+	}{
+		{"unchanged", func(t *testing.T, p *poll, alerts chan string, path string) {}, ""},
+		{"same content rewritten", func(t *testing.T, p *poll, alerts chan string, path string) {
+			writeFile(t, path, "AKIAEXAMPLE")
+		}, ""},
+		{"content modified", func(t *testing.T, p *poll, alerts chan string, path string) {
+			writeFile(t, path, "AKIAMODIFIED")
+		}, "Message: 文件内容被修改"},
+		{"modified with forged mtime", func(t *testing.T, p *poll, alerts chan string, path string) {
+			fi, _ := os.Stat(path)
+			writeFile(t, path, "AKIAEXAMPL3")
+			os.Chtimes(path, fi.ModTime(), fi.ModTime())
+		}, "文件内容被修改"},
+		{"deleted", func(t *testing.T, p *poll, alerts chan string, path string) {
+			os.Remove(path)
+		}, "文件被删除"},
+		{"replaced", func(t *testing.T, p *poll, alerts chan string, path string) {
+			writeFile(t, path+".new", "AKIAEXAMPLE")
+			os.Rename(path+".new", path)
+		}, "文件被替换"},
+		{"deleted and recreated", func(t *testing.T, p *poll, alerts chan string, path string) {
+			os.Remove(path)
+			p.scan()
+			expect(t, received(alerts), "文件被删除")
+			writeFile(t, path, "AKIAEXAMPLE")
+		}, "文件被删除后重新创建"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fm, p, alerts := pollEnv(t)
+			path := filepath.Join(t.TempDir(), "credentials")
+			writeFile(t, path, "AKIAEXAMPLE")
+			watchFile(t, fm, SecretLabel{ID: 1, Name: "aws", FilePath: path, MonitorTampering: true})
+
+			c.change(t, p, alerts, path)
+			p.scan()
+			expect(t, received(alerts), c.want)
+		})
+	}
+}
+
+// 重新同步同一密标时保留基线，同步前发生的修改仍会告警
+func TestApplyKeepsBaseline(t *testing.T) {
+	cases := []struct {
+		name  string
+		label func(label SecretLabel) SecretLabel
+	}{
+		{"same label", func(label SecretLabel) SecretLabel { return label }},
+		{"renamed", func(label SecretLabel) SecretLabel { label.Name = "aws-prod"; return label }},
+		{"content updated on server", func(label SecretLabel) SecretLabel { label.FileContent = "AKIANEW"; return label }},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fm, p, alerts := pollEnv(t)
+			path := filepath.Join(t.TempDir(), "credentials")
+			writeFile(t, path, "AKIAEXAMPLE")
+			label := SecretLabel{ID: 1, Name: "aws", FilePath: path, MonitorTampering: true}
+			watchFile(t, fm, label)
+
+			writeFile(t, path, "AKIAMODIFIED")
+			watchFile(t, fm, c.label(label))
+			p.scan()
+			expect(t, received(alerts), "文件内容被修改")
+		})
+	}
+}
+
+// 密标改到其他文件时移除原文件的监控
+func TestApplyMovesWatch(t *testing.T) {
+	fm, p, alerts := pollEnv(t)
+	dir := t.TempDir()
+	oldPath, newPath := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+	writeFile(t, oldPath, "AKIAEXAMPLE")
+	writeFile(t, newPath, "AKIAEXAMPLE")
+
+	label := SecretLabel{ID: 1, Name: "aws", FilePath: oldPath, MonitorTampering: true}
+	watchFile(t, fm, label)
+	label.FilePath = newPath
+	watchFile(t, fm, label)
+
+	if _, ok := p.files[oldPath]; ok {
+		t.Errorf("old file still polled")
+	}
+	writeFile(t, oldPath, "AKIAMODIFIED")
+	writeFile(t, newPath, "AKIAMODIFIED")
+	p.scan()
+	if got := received(alerts); len(got) != 1 || !strings.Contains(got[0], "File: "+newPath) {
+		t.Errorf("alerts = %v, want one for %s", got, newPath)
+	}
+}
+
+// 文件被删除后同步时保留监控并报告缺失，重新创建时告警
+func TestApplyMissingFile(t *testing.T) {
+	cases := []struct {
+		name    string
+		existed bool
+	}{
+		{"deleted after watch", true},
+		{"missing on first sync", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fm, p, alerts := pollEnv(t)
+			path := filepath.Join(t.TempDir(), "credentials")
+			label := SecretLabel{ID: 1, Name: "aws", FilePath: path, MonitorTampering: true}
+			if c.existed {
+				writeFile(t, path, "AKIAEXAMPLE")
+				watchFile(t, fm, label)
+				os.Remove(path)
+			}
+
+			if status := fm.Apply(label); status.Status != common.WatchMissing {
+				t.Fatalf("apply of missing file: %+v", status)
+			}
+			if _, ok := fm.watches[label.ID]; !ok {
+				t.Fatalf("watch of missing file dropped")
+			}
+			p.scan()
+			if c.existed {
+				expect(t, received(alerts), "文件被删除")
+			} else {
+				expect(t, received(alerts), "")
+			}
+
+			writeFile(t, path, "AKIAEXAMPLE")
+			p.scan()
+			expect(t, received(alerts), "文件被删除后重新创建")
+			watchFile(t, fm, label)
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package monitor
+
+import "fmt"
+
+// Process 访问密标文件的进程
+type Process struct {
+	PID         int    `json:"pid"`
+	Exe         string `json:"exe"`
+	Cmdline     string `json:"cmdline"`
+	UID         int    `json:"uid"`
+	Cgroup      string `json:"cgroup"`
+	ContainerID string `json:"container_id"`
+}
+
+func (p *Process) String() string {
+	if p == nil {
+		return "Process: unknown"
+	}
+	s := fmt.Sprintf("PID: %d, UID: %d, Exe: %s, Cmdline: %s", p.PID, p.UID, p.Exe, p.Cmdline)
+	if p.ContainerID != "" {
+		s += ", Container: " + p.ContainerID
+	} else if p.Cgroup != "" {
+		s += ", Cgroup: " + p.Cgroup
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+//go:build linux
+// +build linux
+
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 容器运行时在 cgroup 路径中使用的 64 位十六进制容器 ID
+var containerIDRegex = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// lookupProcess 从 /proc 读取进程信息，进程可能已经退出，读不到的字段留空
+func lookupProcess(pid int) *Process {
+	p := &Process{PID: pid, UID: -1}
+	dir := "/proc/" + strconv.Itoa(pid)
+
+	p.Exe, _ = os.Readlink(dir + "/exe")
+
+	if data, err := os.ReadFile(dir + "/cmdline"); err == nil {
+		p.Cmdline = strings.TrimSpace(string(bytes.ReplaceAll(data, []byte{0}, []byte{' '})))
+	}
+
+	if f, err := os.Open(dir + "/status"); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			// Uid: 实际 有效 保存 文件系统
+			if fields := strings.Fields(scanner.Text()); len(fields) > 1 && fields[0] == "Uid:" {
+				p.UID, _ = strconv.Atoi(fields[1])
+				break
+			}
+		}
+		f.Close()
+	}
+
+	if data, err := os.ReadFile(dir + "/cgroup"); err == nil {
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			// hierarchy-ID:controller-list:cgroup-path
+			parts := strings.SplitN(line, ":", 3)
+			if len(parts) != 3 {
+				continue
+			}
+			if p.Cgroup == "" || parts[0] == "0" {
+				p.Cgroup = parts[2]
+			}
+			if ids := containerIDRegex.FindAllString(parts[2], -1); len(ids) > 0 {
+				p.ContainerID = ids[len(ids)-1]
+			}
+		}
+	}
+
+	return p
+}
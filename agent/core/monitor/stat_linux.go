@@ -0,0 +1,33 @@
+//go:build linux
+// +build linux
+
+package monitor
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileStat 文件的设备号、inode、访问时间和状态变化时间
+type fileStat struct {
+	ok    bool
+	dev   uint64
+	ino   uint64
+	atime time.Time
+	ctime time.Time
+}
+
+func statOf(fi os.FileInfo) fileStat {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileStat{}
+	}
+	return fileStat{
+		ok:    true,
+		dev:   uint64(st.Dev),
+		ino:   uint64(st.Ino),
+		atime: time.Unix(st.Atim.Unix()),
+		ctime: time.Unix(st.Ctim.Unix()),
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+// +build !linux
+
+package monitor
+
+import (
+	"os"
+	"time"
+)
+
+// fileStat 非Linux系统上只比较内容、大小和修改时间
+type fileStat struct {
+	ok    bool
+	dev   uint64
+	ino   uint64
+	atime time.Time
+	ctime time.Time
+}
+
+func statOf(fi os.FileInfo) fileStat {
+	return fileStat{}
+}
@@ -1,15 +1,23 @@
 package apiserver
 
 import (
+	"KubePot/core/health"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	stdlog "log"
 	"net"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
-	"KubePot/core/pool"
+	"KubePot/core/event"
+	"KubePot/core/kube"
 	"KubePot/core/rpc/client"
+	"KubePot/core/session"
+	"KubePot/utils/config"
 	"KubePot/utils/is"
 	"KubePot/utils/log"
 )
@@ -17,7 +25,24 @@ import (
 // 服务运行状态标志
 var serverRunning bool
 
-// Start 启动 Kubelet 蜜罐服务
+var (
+	// running 运行中的服务，Stop 据此关闭
+	running   *http.Server
+	runningMu sync.Mutex
+	// started Start 返回后 Stop 才返回，保证之后可以重新启动
+	started sync.WaitGroup
+)
+
+// 上报时的蜜罐名称
+const projectName = "Apiserver 蜜罐"
+
+// 单个请求体最大读取长度
+const maxBodySize = 10 << 20
+
+// 上报信息中请求体的最大长度
+const maxReportBody = 4096
+
+// Start 启动 Apiserver 蜜罐服务
 func Start(addr string) {
 	// 检查服务是否已经在运行
 	if serverRunning {
@@ -25,15 +50,34 @@ func Start(addr string) {
 		return
 	}
 
+	// 加载或生成集群 CA 和服务证书
+	certDir := config.Get("apiserver", "cert_dir")
+	if certDir == "" {
+		certDir = "./pki"
+	}
+	tlsConfig, err := loadOrCreateCerts(certDir)
+	if err != nil {
+		log.Pr("apiserver", "127.0.0.1", "apiserver 证书生成失败", err)
+		health.Failed("apiserver", err)
+		return
+	}
+
+	// 加载集群初始对象
+	kube.Init(config.Get("apiserver", "fixture_dir"))
+
 	// 建立socket，监听端口
 	netListen, err := net.Listen("tcp", addr)
 	if err != nil {
 		log.Pr("apiserver", "127.0.0.1", "apiserver 监听失败", err)
+		health.Failed("apiserver", err)
 		return
 	}
+	health.Listening("apiserver")
 	defer netListen.Close()
 
 	// 设置服务运行状态为true
+	started.Add(1)
+	defer started.Done()
 	serverRunning = true
 	defer func() {
 		serverRunning = false
@@ -41,568 +85,155 @@ func Start(addr string) {
 
 	log.Pr("apiserver", addr, "蜜罐服务已启动")
 
-	// 创建连接池
-	wg, poolX := pool.New(10)
-	defer poolX.Release()
-
-	// 循环接受连接
-	for {
-		wg.Add(1)
-		poolX.Submit(func() {
-			// 稍微延迟，避免过快接受连接
-			time.Sleep(time.Second * 1)
+	server := &http.Server{
+		Handler:           http.HandlerFunc(handleRequest),
+		ConnContext:       session.ConnContext,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 30 * time.Second,
+		IdleTimeout:       5 * time.Minute,
+		// 握手失败等错误属于扫描噪音，不输出到标准日志
+		ErrorLog: stdlog.New(io.Discard, "", 0),
+	}
 
-			conn, err := netListen.Accept()
-			if err != nil {
-				log.Pr("Apiserver", "127.0.0.1", "apiserver 连接失败", err)
-				wg.Done()
-				return
-			}
+	runningMu.Lock()
+	running = server
+	runningMu.Unlock()
 
-			// 获取客户端IP
-			clientIP := strings.Split(conn.RemoteAddr().String(), ":")[0]
-			log.Pr("Apiserver", clientIP, "已经连接")
+	// 证书已在 TLSConfig 中配置，ServeTLS 会同时启用 HTTP/2
+	if err := server.ServeTLS(session.Listen(netListen, "Apiserver", projectName), "", ""); err != nil && err != http.ErrServerClosed {
+		log.Pr("apiserver", "127.0.0.1", "apiserver 服务异常退出", err)
+		health.Failed("apiserver", err)
+	}
+}
 
-			// 上报连接事件
-			var attackID string
+// Stop 关闭服务并等待 Start 返回
+func Stop() {
+	runningMu.Lock()
+	server := running
+	running = nil
+	runningMu.Unlock()
+	if server == nil {
+		return
+	}
 
-			// 处理连接
-			go handleConnection(conn, attackID, clientIP)
-			wg.Done()
-		})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
 	}
+	started.Wait()
+	log.Pr("apiserver", "127.0.0.1", "蜜罐服务已关闭")
 }
 
-// handleConnection 处理客户端连接
-func handleConnection(conn net.Conn, attackID string, clientIP string) {
-	defer conn.Close()
+// handleRequest 处理客户端请求
+func handleRequest(w http.ResponseWriter, r *http.Request) {
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
 
-	// 创建缓冲区
-	buffer := make([]byte, 4096)
+	// 读取请求体，net/http 已处理 chunked 编码
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		log.Pr("Apiserver", clientIP, "读取请求体失败", err)
+	}
 
-	// 循环读取客户端请求
-	for {
-		// 读取请求数据
-		n, err := conn.Read(buffer)
-		if err != nil {
-			if err != io.EOF {
-				log.Pr("apiserver", clientIP, "读取数据失败", err)
-			}
-			break
-		}
+	// 记录请求
+	log.Pr("Apiserver", clientIP, "请求", r.Method+" "+r.URL.RequestURI())
+	id := authenticate(r)
+	if is.Rpc() {
+		ev := newEvent(r, event.KindRequest)
+		ev.Request.Raw = formatRequestInfo(r, body)
+		ev.Credentials = id.credentials()
+		ev.Detail = id.describe()
+		go client.ReportResult(projectName, ev, "")
+	}
+	if id.Honeytoken != nil {
+		reportHoneytoken(id, r, clientIP)
+	}
 
-		// 解析请求路径
-		requestData := string(buffer[:n])
-		path := extractPath(requestData)
-		//queryParams := extractQueryParams(requestData)
+	w.Header().Set("Audit-Id", kube.NewUID())
+	w.Header().Set("Cache-Control", "no-cache, private")
 
-		// 记录请求
-		log.Pr("Apiserver", clientIP, "请求路径", path)
-		info := path
-		if is.Rpc() {
-			go client.ReportResult("Apiserver", "Apiserver 蜜罐", conn.RemoteAddr().String(), info, attackID)
-		} else {
-			//go report.ReportKubelet("Kubelet", "本机", conn.RemoteAddr().String(), path)
-		}
+	// 按配置模拟认证和鉴权结果
+	if statusErr := authorize(id, r); statusErr != nil {
+		writeJSON(w, statusErr.Code, statusErr.Status())
+		return
+	}
+	if serveAuthReview(w, r, id, body) {
+		return
+	}
 
-		// 获取响应数据
-		responseData := getResponseData(path)
+	// 对象存储托管的资源
+	if serveResource(w, r, body, clientIP) {
+		return
+	}
 
-		if responseData != "ok" {
-			// 将响应数据转换为 JSON
-			jsonData, err := json.MarshalIndent(responseData, "", "  ")
-			if err != nil {
-				log.Pr("Kubelet", clientIP, "JSON 编码失败", err)
-				conn.Write([]byte("HTTP/1.1 500 Internal Server Error\r\nContent-Type: text/plain\r\n\r\nInternal Server Error"))
-				continue
-			}
+	// 获取响应数据
+	responseData := getResponseData(r.URL.Path)
 
-			// 构建 HTTP 响应
-			response := fmt.Sprintf(
-				"HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s",
-				len(jsonData), jsonData,
-			)
+	if text, ok := responseData.(string); ok {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, text)
+		return
+	}
 
-			// 发送响应
-			conn.Write([]byte(response))
-		} else {
-			// 构建 HTTP 响应
-			response := fmt.Sprintf(
-				"HTTP/1.1 200 OK\r\nContent-Type: text/plain; \r\nContent-Length: %d\r\n\r\n%s",
-				len(responseData.(string)), responseData.(string),
-			)
-			// 发送响应
-			conn.Write([]byte(response))
-		}
+	writeJSON(w, statusCode(responseData), responseData)
+}
 
+// writeJSON 输出 JSON 响应
+func writeJSON(w http.ResponseWriter, code int, data interface{}) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(jsonData)
 }
 
-// extractPath 从请求中提取路径（去除参数）
-func extractPath(request string) string {
-	lines := strings.Split(request, "\r\n")
-	if len(lines) > 0 {
-		parts := strings.Split(lines[0], " ")
-		if len(parts) > 1 {
-			// 提取路径并去除查询参数（如 ?limit=500）
-			path := parts[1]
-			queryStart := strings.Index(path, "?")
-			if queryStart > 0 {
-				return path[:queryStart]
-			}
-			return path
+// newEvent 创建关联到连接会话的事件
+func newEvent(r *http.Request, kind event.Kind) *event.Event {
+	return session.FromRequest(r, "Apiserver", projectName).Request(kind, r)
+}
+
+// formatRequestInfo 生成上报信息，包含方法、地址、关键请求头和请求体
+func formatRequestInfo(r *http.Request, body []byte) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s %s\n", r.Method, r.URL.RequestURI(), r.Proto)
+	for _, name := range []string{"User-Agent", "Authorization", "Content-Type", "Accept", "Impersonate-User", "Impersonate-Group"} {
+		if value := r.Header.Get(name); value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
 		}
 	}
-	return "/"
+	if len(body) > 0 {
+		if len(body) > maxReportBody {
+			body = body[:maxReportBody]
+		}
+		fmt.Fprintf(&b, "\n%s", body)
+	}
+	return b.String()
 }
 
-// // extractPath 从请求中提取路径
-// func extractPath(request string) string {
-// 	lines := strings.Split(request, "\r\n")
-// 	if len(lines) > 0 {
-// 		parts := strings.Split(lines[0], " ")
-// 		if len(parts) > 1 {
-// 			return parts[1]
-// 		}
-// 	}
-// 	return "/"
-// }
+// statusCode 根据 Status 对象中的 code 字段确定 HTTP 状态码
+func statusCode(data interface{}) int {
+	m, ok := data.(map[string]interface{})
+	if !ok || m["kind"] != "Status" {
+		return http.StatusOK
+	}
+	if code, ok := m["code"].(int); ok && code >= 100 {
+		return code
+	}
+	return http.StatusOK
+}
 
 // getResponseData 根据路径获取响应数据
 func getResponseData(path string) interface{} {
-	// // 初始化 namespacePodData 结构体
-	// var namespacePodData = map[string]interface{}{
-	// 	"default": map[string]interface{}{
-	// 		"kind":       "PodList",
-	// 		"apiVersion": "v1",
-	// 		"metadata": map[string]interface{}{
-	// 			"resourceVersion": "20529619",
-	// 		},
-	// 		"items": []map[string]interface{}{
-	// 			{
-	// 				"metadata": map[string]interface{}{
-	// 					"name":              "tomcat01-7dccfcbff8-qdgns",
-	// 					"generateName":      "tomcat01-7dccfcbff8-",
-	// 					"namespace":         "default",
-	// 					"uid":               "a186dd48-61ea-4b2b-bb4b-c1a818d8daca",
-	// 					"resourceVersion":   "20529092",
-	// 					"creationTimestamp": "2025-06-28T12:05:19Z",
-	// 					"labels": map[string]string{
-	// 						"app":               "tomcat01",
-	// 						"pod-template-hash": "7dccfcbff8",
-	// 					},
-	// 					"ownerReferences": []map[string]interface{}{
-	// 						{
-	// 							"apiVersion":         "apps/v1",
-	// 							"kind":               "ReplicaSet",
-	// 							"name":               "tomcat01-7dccfcbff8",
-	// 							"uid":                "0f48166a-ed7f-4b64-bf15-02ac3b1aa683",
-	// 							"controller":         true,
-	// 							"blockOwnerDeletion": true,
-	// 						},
-	// 					},
-	// 					"managedFields": []map[string]interface{}{
-	// 						{
-	// 							"manager":    "kube-controller-manager",
-	// 							"operation":  "Update",
-	// 							"apiVersion": "v1",
-	// 							"time":       "2025-06-28T12:05:19Z",
-	// 							"fieldsType": "FieldsV1",
-	// 							"fieldsV1":   map[string]interface{}{ /* 省略，内容较多 */ },
-	// 						},
-	// 						{
-	// 							"manager":     "kubelet",
-	// 							"operation":   "Update",
-	// 							"apiVersion":  "v1",
-	// 							"time":        "2025-06-28T12:05:21Z",
-	// 							"fieldsType":  "FieldsV1",
-	// 							"fieldsV1":    map[string]interface{}{ /* 省略，内容较多 */ },
-	// 							"subresource": "status",
-	// 						},
-	// 					},
-	// 				},
-	// 				"spec": map[string]interface{}{
-	// 					"volumes": []map[string]interface{}{
-	// 						{
-	// 							"name": "kube-api-access-vd4n5",
-	// 							"projected": map[string]interface{}{
-	// 								"sources": []map[string]interface{}{
-	// 									{
-	// 										"serviceAccountToken": map[string]interface{}{
-	// 											"expirationSeconds": 3607,
-	// 											"path":              "token",
-	// 										},
-	// 									},
-	// 									{
-	// 										"configMap": map[string]interface{}{
-	// 											"name": "kube-root-ca.crt",
-	// 											"items": []map[string]interface{}{
-	// 												{
-	// 													"key":  "ca.crt",
-	// 													"path": "ca.crt",
-	// 												},
-	// 											},
-	// 										},
-	// 									},
-	// 									{
-	// 										"downwardAPI": map[string]interface{}{
-	// 											"items": []map[string]interface{}{
-	// 												{
-	// 													"path": "namespace",
-	// 													"fieldRef": map[string]interface{}{
-	// 														"apiVersion": "v1",
-	// 														"fieldPath":  "metadata.namespace",
-	// 													},
-	// 												},
-	// 											},
-	// 										},
-	// 									},
-	// 								},
-	// 								"defaultMode": 420,
-	// 							},
-	// 						},
-	// 					},
-	// 					"containers": []map[string]interface{}{
-	// 						{
-	// 							"name":  "tomcat01",
-	// 							"image": "tomcat:latest",
-	// 							"ports": []map[string]interface{}{
-	// 								{
-	// 									"containerPort": 8080,
-	// 									"protocol":      "TCP",
-	// 								},
-	// 							},
-	// 							"resources": map[string]interface{}{},
-	// 							"volumeMounts": []map[string]interface{}{
-	// 								{
-	// 									"name":      "kube-api-access-vd4n5",
-	// 									"readOnly":  true,
-	// 									"mountPath": "/var/run/secrets/kubernetes.io/serviceaccount",
-	// 								},
-	// 							},
-	// 							"terminationMessagePath":   "/dev/termination-log",
-	// 							"terminationMessagePolicy": "File",
-	// 							"imagePullPolicy":          "Never",
-	// 							"securityContext": map[string]interface{}{
-	// 								"privileged": true,
-	// 							},
-	// 						},
-	// 					},
-	// 					"restartPolicy":                 "Always",
-	// 					"terminationGracePeriodSeconds": 30,
-	// 					"dnsPolicy":                     "ClusterFirst",
-	// 					"serviceAccountName":            "lisi",
-	// 					"serviceAccount":                "lisi",
-	// 					"nodeName":                      "node2",
-	// 					"securityContext":               map[string]interface{}{},
-	// 					"schedulerName":                 "default-scheduler",
-	// 					"tolerations": []map[string]interface{}{
-	// 						{
-	// 							"key":               "node.kubernetes.io/not-ready",
-	// 							"operator":          "Exists",
-	// 							"effect":            "NoExecute",
-	// 							"tolerationSeconds": 300,
-	// 						},
-	// 						{
-	// 							"key":               "node.kubernetes.io/unreachable",
-	// 							"operator":          "Exists",
-	// 							"effect":            "NoExecute",
-	// 							"tolerationSeconds": 300,
-	// 						},
-	// 					},
-	// 					"priority":           0,
-	// 					"enableServiceLinks": true,
-	// 					"preemptionPolicy":   "PreemptLowerPriority",
-	// 				},
-	// 				"status": map[string]interface{}{
-	// 					"phase": "Running",
-	// 					"conditions": []map[string]interface{}{
-	// 						{
-	// 							"type":               "Initialized",
-	// 							"status":             "True",
-	// 							"lastProbeTime":      nil,
-	// 							"lastTransitionTime": "2025-06-28T12:05:19Z",
-	// 						},
-	// 						{
-	// 							"type":               "Ready",
-	// 							"status":             "True",
-	// 							"lastProbeTime":      nil,
-	// 							"lastTransitionTime": "2025-06-28T12:05:21Z",
-	// 						},
-	// 						{
-	// 							"type":               "ContainersReady",
-	// 							"status":             "True",
-	// 							"lastProbeTime":      nil,
-	// 							"lastTransitionTime": "2025-06-28T12:05:21Z",
-	// 						},
-	// 						{
-	// 							"type":               "PodScheduled",
-	// 							"status":             "True",
-	// 							"lastProbeTime":      nil,
-	// 							"lastTransitionTime": "2025-06-28T12:05:19Z",
-	// 						},
-	// 					},
-	// 					"hostIP": "10.211.55.7",
-	// 					"podIP":  "10.244.1.108",
-	// 					"podIPs": []map[string]interface{}{
-	// 						{
-	// 							"ip": "10.244.1.108",
-	// 						},
-	// 					},
-	// 					"startTime": "2025-06-28T12:05:19Z",
-	// 					"containerStatuses": []map[string]interface{}{
-	// 						{
-	// 							"name": "tomcat01",
-	// 							"state": map[string]interface{}{
-	// 								"running": map[string]interface{}{
-	// 									"startedAt": "2025-06-28T12:05:21Z",
-	// 								},
-	// 							},
-	// 							"lastState":    map[string]interface{}{},
-	// 							"ready":        true,
-	// 							"restartCount": 0,
-	// 							"image":        "tomcat:latest",
-	// 							"imageID":      "docker-pullable://tomcat@sha256:1374a565d5122fdb42807f3a5f2d4fcc245a5e15420ff5bb5123afedc8ef769d",
-	// 							"containerID":  "docker://8ae66327906ed63219d6885c556893ed42956eb4b50d8c8486a5c858344304b6",
-	// 							"started":      true,
-	// 						},
-	// 					},
-	// 					"qosClass": "BestEffort",
-	// 				},
-	// 			},
-	// 		},
-	// 	},
-	// }
-	// 初始化 namespacePodData 结构体（适配 kubectl 表格显示）
-	var namespacePodData = map[string]interface{}{
-		"default": map[string]interface{}{
-			"kind":       "Table",
-			"apiVersion": "meta.k8s.io/v1",
-			"metadata": map[string]interface{}{
-				"resourceVersion": "20529619",
-			},
-			"columnDefinitions": []map[string]interface{}{
-				{"name": "NAME", "type": "string", "format": "name"},
-				{"name": "READY", "type": "string"},
-				{"name": "STATUS", "type": "string"},
-				{"name": "RESTARTS", "type": "string"},
-				{"name": "AGE", "type": "string"},
-			},
-			"rows": []map[string]interface{}{
-				{
-					"cells": []interface{}{
-						"tomcat01-7dccfcbff8-qdgns",
-						"1/1",
-						"Running",
-						"0",
-						"117m",
-					},
-					"object": map[string]interface{}{
-						"kind":       "Pod",
-						"apiVersion": "v1",
-						"metadata": map[string]interface{}{
-							"name":              "tomcat01-7dccfcbff8-qdgns",
-							"namespace":         "default",
-							"creationTimestamp": "2025-06-28T12:05:19Z",
-						},
-						"status": map[string]interface{}{
-							"phase": "Running",
-							"containerStatuses": []map[string]interface{}{
-								{
-									"name":  "tomcat01",
-									"ready": true,
-									"state": map[string]interface{}{
-										"running": map[string]interface{}{},
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-		},
-	}
 	switch {
-	// 处理命名空间Pod列表请求
-	case strings.HasPrefix(path, "/api/v1/namespaces/") && strings.HasSuffix(path, "/pods"):
-		{
-			// 提取命名空间名称
-			namespace := strings.TrimPrefix(path, "/api/v1/namespaces/")
-			namespace = strings.TrimSuffix(namespace, "/pods")
-
-			// 检查命名空间是否存在
-			if data, exists := namespacePodData[namespace]; exists {
-				return data
-			}
-
-			// 为不存在的命名空间返回空Pod列表
-			return map[string]interface{}{
-				"kind":       "PodList",
-				"apiVersion": "v1",
-				"metadata": map[string]interface{}{
-					"resourceVersion": "20523975",
-				},
-				"items": []map[string]interface{}{},
-			}
-		}
-	case path == "/api/v1/pods?limit=500":
-		{
-			return map[string]interface{}{
-				"kind":       "PodList",
-				"apiVersion": "v1",
-				"metadata": map[string]interface{}{
-					"selfLink":        "/api/v1/pods",
-					"resourceVersion": "123456",
-					"continue":        "",
-				},
-				"items": []map[string]interface{}{
-					{
-						"metadata": map[string]interface{}{
-							"name":              "nginx-78d6c9b7d4-5j6k7",
-							"generateName":      "nginx-78d6c9b7d4-",
-							"namespace":         "default",
-							"selfLink":          "/api/v1/namespaces/default/pods/nginx-78d6c9b7d4-5j6k7",
-							"uid":               "6d9f4e3c-1e2f-11ea-8d71-0242ac130003",
-							"resourceVersion":   "12345",
-							"creationTimestamp": "2025-06-26T08:30:00Z",
-							"labels": map[string]string{
-								"app":  "nginx",
-								"tier": "web",
-							},
-							"annotations": map[string]string{
-								"kubernetes.io/limit-ranger": "LimitRanger plugin set: cpu request for container nginx",
-							},
-							"ownerReferences": []map[string]interface{}{
-								{
-									"apiVersion":         "apps/v1",
-									"kind":               "ReplicaSet",
-									"name":               "nginx-78d6c9b7d4",
-									"uid":                "6d9d9e3c-1e2f-11ea-8d71-0242ac130003",
-									"controller":         true,
-									"blockOwnerDeletion": true,
-								},
-							},
-						},
-						"spec": map[string]interface{}{
-							"volumes": []map[string]interface{}{
-								{
-									"name": "default-token-5q7c9",
-									"secret": map[string]interface{}{
-										"secretName":  "default-token-5q7c9",
-										"defaultMode": 420,
-									},
-								},
-							},
-							"containers": []map[string]interface{}{
-								{
-									"name":  "nginx",
-									"image": "nginx:1.23",
-									"ports": []map[string]interface{}{
-										{
-											"containerPort": 80,
-											"protocol":      "TCP",
-										},
-									},
-									"resources": map[string]interface{}{
-										"requests": map[string]interface{}{
-											"cpu": "100m",
-										},
-									},
-									"volumeMounts": []map[string]interface{}{
-										{
-											"name":      "default-token-5q7c9",
-											"readOnly":  true,
-											"mountPath": "/var/run/secrets/kubernetes.io/serviceaccount",
-										},
-									},
-									"terminationMessagePath":   "/dev/termination-log",
-									"terminationMessagePolicy": "File",
-									"imagePullPolicy":          "Always",
-								},
-							},
-							"restartPolicy":                 "Always",
-							"terminationGracePeriodSeconds": 30,
-							"dnsPolicy":                     "ClusterFirst",
-							"serviceAccountName":            "default",
-							"serviceAccount":                "default",
-							"nodeName":                      "node1",
-							"securityContext":               map[string]interface{}{},
-							"schedulerName":                 "default-scheduler",
-							"tolerations": []map[string]interface{}{
-								{
-									"key":               "node.kubernetes.io/not-ready",
-									"operator":          "Exists",
-									"effect":            "NoExecute",
-									"tolerationSeconds": 300,
-								},
-								{
-									"key":               "node.kubernetes.io/unreachable",
-									"operator":          "Exists",
-									"effect":            "NoExecute",
-									"tolerationSeconds": 300,
-								},
-							},
-						},
-						"status": map[string]interface{}{
-							"phase": "Running",
-							"conditions": []map[string]interface{}{
-								{
-									"type":               "Initialized",
-									"status":             "True",
-									"lastProbeTime":      nil,
-									"lastTransitionTime": "2025-06-26T08:30:00Z",
-								},
-								{
-									"type":               "Ready",
-									"status":             "True",
-									"lastProbeTime":      nil,
-									"lastTransitionTime": "2025-06-26T08:32:00Z",
-								},
-								{
-									"type":               "ContainersReady",
-									"status":             "True",
-									"lastProbeTime":      nil,
-									"lastTransitionTime": "2025-06-26T08:32:00Z",
-								},
-								{
-									"type":               "PodScheduled",
-									"status":             "True",
-									"lastProbeTime":      nil,
-									"lastTransitionTime": "2025-06-26T08:30:00Z",
-								},
-							},
-							"hostIP": "192.168.1.101",
-							"podIP":  "10.244.1.5",
-							"podIPs": []map[string]interface{}{
-								{
-									"ip": "10.244.1.5",
-								},
-							},
-							"startTime": "2025-06-26T08:30:00Z",
-							"containerStatuses": []map[string]interface{}{
-								{
-									"name": "nginx",
-									"state": map[string]interface{}{
-										"running": map[string]interface{}{
-											"startedAt": "2025-06-26T08:32:00Z",
-										},
-									},
-									"lastState":    map[string]interface{}{},
-									"ready":        true,
-									"restartCount": 0,
-									"image":        "nginx:1.23",
-									"imageID":      "docker-pullable://nginx@sha256:1234567890abcdef1234567890abcdef",
-									"containerID":  "docker://1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef",
-									"started":      true,
-								},
-							},
-							"qosClass": "Burstable",
-						},
-					},
-					// 其他 Pod 类似结构，此处省略...
-				},
-			}
-		}
 	// 处理 /api/v1 路径
 	case path == "/api/v1":
 		{
@@ -1023,18 +654,54 @@ func getResponseData(path string) interface{} {
 	case path == "/apis/apps/v1":
 		{
 			return map[string]interface{}{
-				"kind":       "APIGroup",
-				"apiVersion": "v1",
-				"name":       "apiextensions.k8s.io",
-				"versions": []map[string]interface{}{
+				"kind":         "APIResourceList",
+				"apiVersion":   "v1",
+				"groupVersion": "apps/v1",
+				"resources": []map[string]interface{}{
 					{
-						"groupVersion": "apiextensions.k8s.io/v1",
-						"version":      "v1",
+						"name":         "daemonsets",
+						"singularName": "",
+						"namespaced":   true,
+						"kind":         "DaemonSet",
+						"verbs": []string{
+							"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch",
+						},
+						"shortNames":         []string{"ds"},
+						"storageVersionHash": "dd7pWHUlMKQ=",
+					},
+					{
+						"name":         "deployments",
+						"singularName": "",
+						"namespaced":   true,
+						"kind":         "Deployment",
+						"verbs": []string{
+							"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch",
+						},
+						"shortNames":         []string{"deploy"},
+						"storageVersionHash": "8aSe+NMegvE=",
+					},
+					{
+						"name":         "replicasets",
+						"singularName": "",
+						"namespaced":   true,
+						"kind":         "ReplicaSet",
+						"verbs": []string{
+							"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch",
+						},
+						"shortNames":         []string{"rs"},
+						"storageVersionHash": "P1RzHs8/mWQ=",
+					},
+					{
+						"name":         "statefulsets",
+						"singularName": "",
+						"namespaced":   true,
+						"kind":         "StatefulSet",
+						"verbs": []string{
+							"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch",
+						},
+						"shortNames":         []string{"sts"},
+						"storageVersionHash": "H+vl74LkKdo=",
 					},
-				},
-				"preferredVersion": map[string]string{
-					"groupVersion": "apiextensions.k8s.io/v1",
-					"version":      "v1",
 				},
 			}
 		}
@@ -2988,36 +2655,6 @@ func getResponseData(path string) interface{} {
 				},
 			},
 		}
-	case strings.HasPrefix(path, "/api/v1/pods"):
-		return map[string]interface{}{
-			"kind":       "PodList",
-			"apiVersion": "v1",
-			"metadata": map[string]interface{}{
-				"selfLink":        "/api/v1/pods",
-				"resourceVersion": "12345",
-			},
-			"items": []map[string]interface{}{
-				{
-					"metadata": map[string]interface{}{
-						"name":              "nginx-deployment-76bf4969df-2bsk9",
-						"namespace":         "default",
-						"uid":               "a1b2c3d4-e5f6-4a5b-9c8d-7e6f5a4b3c2d",
-						"creationTimestamp": time.Now().Format(time.RFC3339),
-					},
-					"spec": map[string]interface{}{
-						"containers": []map[string]interface{}{
-							{
-								"name":  "nginx",
-								"image": "nginx:1.14.2",
-							},
-						},
-					},
-					"status": map[string]interface{}{
-						"phase": "Running",
-					},
-				},
-			},
-		}
 	case strings.HasPrefix(path, "/api/v1/nodes"):
 		return map[string]interface{}{
 			"kind":       "NodeList",
@@ -0,0 +1,320 @@
+package apiserver
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"KubePot/core/event"
+	"KubePot/core/honeytoken"
+	"KubePot/core/kube"
+	"KubePot/core/report"
+	"KubePot/core/rpc/client"
+	"KubePot/utils/config"
+	"KubePot/utils/is"
+	"KubePot/utils/log"
+)
+
+// 认证决策，通过 apiserver 的 auth_anonymous 和 auth_credentials 配置
+const (
+	authAllow        = "allow"        // 放行
+	authForbid       = "forbid"       // 返回 403
+	authUnauthorized = "unauthorized" // 返回 401
+)
+
+// 匿名用户也可以访问的路径，对应 system:public-info-viewer
+var publicPaths = []string{"/healthz", "/livez", "/readyz", "/version"}
+
+// identity 请求携带的身份信息
+type identity struct {
+	Method      string // anonymous、bearer、basic、x509
+	User        string
+	Groups      []string
+	Token       string
+	Password    string
+	Claims      map[string]interface{}
+	Certificate *x509.Certificate
+	Honeytoken  *honeytoken.Label
+}
+
+// authenticate 解析 Bearer 令牌、Basic 认证和客户端证书
+func authenticate(r *http.Request) *identity {
+	auth := strings.TrimSpace(r.Header.Get("Authorization"))
+
+	switch {
+	case len(auth) > 7 && strings.EqualFold(auth[:7], "bearer "):
+		token := strings.TrimSpace(auth[7:])
+		id := &identity{Method: "bearer", Token: token}
+		if claims, ok := decodeJWT(token); ok {
+			id.Claims = claims
+			id.User, id.Groups = serviceAccountUser(claims)
+		} else if parts := strings.SplitN(token, ".", 2); len(parts) == 2 && len(parts[0]) == 6 && len(parts[1]) == 16 {
+			// 引导令牌格式 abcdef.0123456789abcdef
+			id.User = "system:bootstrap:" + parts[0]
+			id.Groups = []string{"system:bootstrappers", "system:bootstrappers:kubeadm:default-node-token"}
+		} else {
+			id.User = "token-user"
+			id.Groups = []string{"system:authenticated"}
+		}
+		if label, ok := honeytoken.MatchToken(token); ok {
+			id.Honeytoken = &label
+		}
+		return id
+
+	case len(auth) > 6 && strings.EqualFold(auth[:6], "basic "):
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(auth[6:]))
+		if err != nil {
+			break
+		}
+		user, password, _ := strings.Cut(string(data), ":")
+		id := &identity{Method: "basic", User: user, Password: password, Groups: []string{"system:authenticated"}}
+		if label, ok := honeytoken.MatchPassword(password); ok {
+			id.Honeytoken = &label
+		}
+		return id
+	}
+
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		cert := r.TLS.PeerCertificates[0]
+		groups := append(append([]string{}, cert.Subject.Organization...), "system:authenticated")
+		id := &identity{Method: "x509", User: cert.Subject.CommonName, Groups: groups, Certificate: cert}
+		if label, ok := honeytoken.MatchCertificate(cert); ok {
+			id.Honeytoken = &label
+		}
+		return id
+	}
+
+	return &identity{Method: "anonymous", User: "system:anonymous", Groups: []string{"system:unauthenticated"}}
+}
+
+// decodeJWT 解码 JWT 载荷，不校验签名
+func decodeJWT(token string) (map[string]interface{}, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, false
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, false
+	}
+	return claims, true
+}
+
+// serviceAccountUser 从服务账号令牌中还原用户名，兼容旧版 Secret 令牌和新版绑定令牌
+func serviceAccountUser(claims map[string]interface{}) (string, []string) {
+	namespace := claimNamespace(claims)
+	if sub, _ := claims["sub"].(string); sub != "" {
+		if namespace != "" {
+			return sub, []string{"system:serviceaccounts", "system:serviceaccounts:" + namespace, "system:authenticated"}
+		}
+		return sub, []string{"system:authenticated"}
+	}
+	if name, _ := claims["kubernetes.io/serviceaccount/service-account.name"].(string); name != "" {
+		return "system:serviceaccount:" + namespace + ":" + name, []string{"system:serviceaccounts", "system:serviceaccounts:" + namespace, "system:authenticated"}
+	}
+	return "token-user", []string{"system:authenticated"}
+}
+
+func claimNamespace(claims map[string]interface{}) string {
+	if k8s, ok := claims["kubernetes.io"].(map[string]interface{}); ok {
+		if ns, _ := k8s["namespace"].(string); ns != "" {
+			return ns
+		}
+	}
+	ns, _ := claims["kubernetes.io/serviceaccount/namespace"].(string)
+	return ns
+}
+
+// credentials 转换为上报事件中的凭据，匿名访问返回 nil
+func (id *identity) credentials() *event.Credentials {
+	if id.Method == "anonymous" {
+		return nil
+	}
+	credentials := &event.Credentials{Username: id.User, Password: id.Password, Token: id.Token}
+	if id.Certificate != nil {
+		credentials.Certificate = honeytoken.Fingerprint(id.Certificate)
+	}
+	return credentials
+}
+
+// describe 生成上报用的身份摘要，包含捕获的凭据
+func (id *identity) describe() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Auth: %s, User: %s", id.Method, id.User)
+	if len(id.Groups) > 0 {
+		fmt.Fprintf(&b, ", Groups: %s", strings.Join(id.Groups, ","))
+	}
+	if id.Claims != nil {
+		iss, _ := id.Claims["iss"].(string)
+		sub, _ := id.Claims["sub"].(string)
+		fmt.Fprintf(&b, ", Issuer: %s, Subject: %s, Namespace: %s", iss, sub, claimNamespace(id.Claims))
+		if exp, ok := id.Claims["exp"].(float64); ok {
+			expiry := time.Unix(int64(exp), 0)
+			fmt.Fprintf(&b, ", Expiry: %s", expiry.Format(time.RFC3339))
+			if expiry.Before(time.Now()) {
+				b.WriteString(" (expired)")
+			}
+		}
+	}
+	if id.Password != "" {
+		fmt.Fprintf(&b, ", Password: %s", id.Password)
+	}
+	if id.Certificate != nil {
+		fmt.Fprintf(&b, ", Issuer: %s, Fingerprint: %s", id.Certificate.Issuer.CommonName, honeytoken.Fingerprint(id.Certificate))
+	}
+	if id.Honeytoken != nil {
+		fmt.Fprintf(&b, ", Honeytoken: %d (%s)", id.Honeytoken.ID, id.Honeytoken.Name)
+	}
+	return b.String()
+}
+
+// reportHoneytoken 上报蜜标凭据被使用，同一来源同一密标在间隔内只告警一次
+func reportHoneytoken(id *identity, r *http.Request, clientIP string) {
+	if !honeytoken.ShouldAlert(id.Honeytoken.ID, clientIP) {
+		return
+	}
+
+	log.Pr("Apiserver", clientIP, "蜜标凭据被使用", fmt.Sprintf("%d %s", id.Honeytoken.ID, id.Honeytoken.Name))
+
+	info := fmt.Sprintf("Honeytoken used on Apiserver, Label: %d, Request: %s %s, %s",
+		id.Honeytoken.ID, r.Method, r.URL.RequestURI(), id.describe())
+	if is.Rpc() {
+		agentName := config.Get("rpc", "name")
+		go report.ReportHoneytokenAlert(agentName, clientIP, id.Honeytoken.ID, id.Honeytoken.Name, info)
+
+		ev := newEvent(r, event.KindAuth)
+		ev.Credentials = id.credentials()
+		ev.Detail = fmt.Sprintf("Honeytoken used on Apiserver, Label: %d, %s", id.Honeytoken.ID, id.describe())
+		go client.ReportResult(projectName, ev, "")
+	}
+}
+
+// authorize 按配置决定放行或拒绝，拒绝时返回对应的 Status
+func authorize(id *identity, r *http.Request) *kube.StatusError {
+	// 蜜标凭据始终放行，以便观察攻击者的后续行为
+	if id.Honeytoken != nil {
+		return nil
+	}
+
+	decision := config.Get("apiserver", "auth_credentials")
+	if id.Method == "anonymous" {
+		for _, p := range publicPaths {
+			if r.URL.Path == p || strings.HasPrefix(r.URL.Path, p+"/") {
+				return nil
+			}
+		}
+		decision = config.Get("apiserver", "auth_anonymous")
+	}
+
+	switch decision {
+	case authUnauthorized:
+		return &kube.StatusError{Code: http.StatusUnauthorized, Reason: "Unauthorized", Message: "Unauthorized"}
+	case authForbid:
+		return forbidden(id, r)
+	}
+	return nil
+}
+
+// forbidden 生成与 RBAC 拒绝一致的 403 Status
+func forbidden(id *identity, r *http.Request) *kube.StatusError {
+	req, ok := parseResourcePath(r.URL.Path)
+	if !ok {
+		return &kube.StatusError{
+			Code:    http.StatusForbidden,
+			Reason:  "Forbidden",
+			Message: fmt.Sprintf("forbidden: User %q cannot %s path %q", id.User, strings.ToLower(r.Method), r.URL.Path),
+		}
+	}
+
+	resource := req.Resource.Name
+	if req.Subresource != "" {
+		resource += "/" + req.Subresource
+	}
+	message := fmt.Sprintf("%s is forbidden: User %q cannot %s resource %q in API group %q",
+		req.Resource.Name, id.User, requestVerb(r, req), resource, req.Resource.Group)
+	if req.Name != "" {
+		message = fmt.Sprintf("%s %q is forbidden: User %q cannot %s resource %q in API group %q",
+			req.Resource.Name, req.Name, id.User, requestVerb(r, req), resource, req.Resource.Group)
+	}
+	if req.Namespace != "" {
+		message += fmt.Sprintf(" in the namespace %q", req.Namespace)
+	} else if !req.Resource.Namespaced || req.Name == "" {
+		message += " at the cluster scope"
+	}
+	return &kube.StatusError{
+		Code:    http.StatusForbidden,
+		Reason:  "Forbidden",
+		Message: message,
+		Name:    req.Name,
+		Kind:    req.Resource.Name,
+	}
+}
+
+// requestVerb 将 HTTP 方法转换为 RBAC 动词
+func requestVerb(r *http.Request, req resourceRequest) string {
+	switch r.Method {
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut:
+		return "update"
+	case http.MethodPatch:
+		return "patch"
+	case http.MethodDelete:
+		if req.Name == "" {
+			return "deletecollection"
+		}
+		return "delete"
+	}
+	if isWatch(r, req) {
+		return "watch"
+	}
+	if req.Name == "" {
+		return "list"
+	}
+	return "get"
+}
+
+// serveAuthReview 处理 kubectl auth whoami 和 kubectl auth can-i 的自查请求
+func serveAuthReview(w http.ResponseWriter, r *http.Request, id *identity, body []byte) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+
+	var review map[string]interface{}
+	json.Unmarshal(body, &review)
+	if review == nil {
+		review = map[string]interface{}{}
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/apis/authentication.k8s.io/") && strings.HasSuffix(r.URL.Path, "/selfsubjectreviews"):
+		userInfo := map[string]interface{}{"username": id.User, "groups": id.Groups}
+		if id.Claims != nil {
+			if k8s, ok := id.Claims["kubernetes.io"].(map[string]interface{}); ok {
+				if sa, ok := k8s["serviceaccount"].(map[string]interface{}); ok {
+					userInfo["uid"] = sa["uid"]
+				}
+			}
+		}
+		review["status"] = map[string]interface{}{"userInfo": userInfo}
+	case strings.HasPrefix(r.URL.Path, "/apis/authorization.k8s.io/") && strings.HasSuffix(r.URL.Path, "/selfsubjectaccessreviews"):
+		// 被拒绝的身份在 authorize 阶段已经返回，能走到这里的都视为有权限
+		review["status"] = map[string]interface{}{"allowed": true}
+	default:
+		return false
+	}
+
+	if meta, ok := review["metadata"].(map[string]interface{}); ok {
+		meta["creationTimestamp"] = nil
+	}
+	writeJSON(w, http.StatusCreated, review)
+	return true
+}
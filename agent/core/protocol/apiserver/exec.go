@@ -0,0 +1,75 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+
+	"KubePot/core/event"
+	"KubePot/core/kube"
+	"KubePot/core/kube/stream"
+	"KubePot/core/rpc/client"
+	"KubePot/utils/is"
+	"KubePot/utils/log"
+)
+
+// isStreamRequest 判断是否为 Pod 的 exec、attach、portforward 升级请求
+func isStreamRequest(r *http.Request, req resourceRequest) bool {
+	if req.Resource.Kind != "Pod" || req.Name == "" {
+		return false
+	}
+	switch req.Subresource {
+	case "exec", "attach", "portforward":
+		return stream.IsUpgrade(r)
+	}
+	return false
+}
+
+// serveStream 在 Pod 对应的伪造容器中处理 kubectl exec、attach 和 port-forward
+func serveStream(w http.ResponseWriter, r *http.Request, store *kube.Store, req resourceRequest, clientIP string) {
+	pod, err := store.Get(req.Resource, req.Namespace, req.Name)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+
+	opts := stream.ParseOptions(r.URL.Query())
+	target, err := stream.NewTarget(store, pod, opts.Container)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+
+	log.Pr("Apiserver", clientIP, "建立流连接", fmt.Sprintf("%s %s/%s %s", req.Subresource, req.Namespace, req.Name, target.Container.Name))
+
+	report := func(kind event.Kind, command string, detail string) {
+		ev := newEvent(r, kind)
+		ev.Command, ev.Detail = command, detail
+		log.Pr("Apiserver", clientIP, req.Subresource, ev.Summary())
+		if is.Rpc() {
+			go client.ReportResult(projectName, ev, "")
+		}
+	}
+
+	switch req.Subresource {
+	case "exec":
+		err = stream.Exec(w, r, target, opts, report)
+	case "attach":
+		err = stream.Attach(w, r, target, opts, report)
+	case "portforward":
+		err = stream.PortForward(w, r, target, report)
+	}
+	if statusErr, ok := err.(*kube.StatusError); ok {
+		writeJSON(w, statusErr.Code, statusErr.Status())
+	} else if err != nil {
+		log.Pr("Apiserver", clientIP, "流连接升级失败", err)
+	}
+}
+
+// writeStatusError 以 Status 对象返回错误
+func writeStatusError(w http.ResponseWriter, err error) {
+	statusErr, ok := err.(*kube.StatusError)
+	if !ok {
+		statusErr = kube.NewBadRequest(err.Error())
+	}
+	writeJSON(w, statusErr.Code, statusErr.Status())
+}
@@ -0,0 +1,195 @@
+package apiserver
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 与 kubeadm 生成的证书文件名保持一致
+const (
+	caCertFile     = "ca.crt"
+	caKeyFile      = "ca.key"
+	servingCrtFile = "apiserver.crt"
+	servingKeyFile = "apiserver.key"
+)
+
+// 集群 Service 网段中 kubernetes 服务的 ClusterIP
+var kubernetesServiceIP = net.ParseIP("10.96.0.1")
+
+// loadOrCreateCerts 加载集群 CA 和 apiserver 服务证书，不存在或过期时重新生成并保存到 dir
+func loadOrCreateCerts(dir string) (*tls.Config, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	caCert, caKey, err := loadKeyPair(filepath.Join(dir, caCertFile), filepath.Join(dir, caKeyFile))
+	if err != nil {
+		caCert, caKey, err = newCA()
+		if err != nil {
+			return nil, err
+		}
+		if err := writeKeyPair(dir, caCertFile, caKeyFile, caCert, caKey); err != nil {
+			return nil, err
+		}
+	}
+
+	cert, key, err := loadKeyPair(filepath.Join(dir, servingCrtFile), filepath.Join(dir, servingKeyFile))
+	if err != nil || cert.CheckSignatureFrom(caCert) != nil || time.Now().After(cert.NotAfter) {
+		cert, key, err = newServingCert(caCert, caKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeKeyPair(dir, servingCrtFile, servingKeyFile, cert, key); err != nil {
+			return nil, err
+		}
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// 只索取客户端证书用于记录身份，不做校验
+		ClientAuth: tls.RequestClientCert,
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{cert.Raw, caCert.Raw},
+			PrivateKey:  key,
+			Leaf:        cert,
+		}},
+	}, nil
+}
+
+// newCA 生成与 kubeadm 默认参数一致的自签名集群 CA，有效期 10 年
+func newCA() (*x509.Certificate, *rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: "kubernetes"},
+		NotBefore:             now.Add(-5 * time.Minute).UTC(),
+		NotAfter:              now.AddDate(10, 0, 0).UTC(),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	return cert, key, err
+}
+
+// newServingCert 使用集群 CA 签发 apiserver 服务证书，有效期 1 年
+func newServingCert(caCert *x509.Certificate, caKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dnsNames := []string{
+		"kubernetes",
+		"kubernetes.default",
+		"kubernetes.default.svc",
+		"kubernetes.default.svc.cluster.local",
+		"localhost",
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		dnsNames = append(dnsNames, hostname)
+	}
+
+	ips := []net.IP{kubernetesServiceIP, net.ParseIP("127.0.0.1")}
+	ips = append(ips, hostIPs()...)
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: "kube-apiserver"},
+		NotBefore:    now.Add(-5 * time.Minute).UTC(),
+		NotAfter:     now.AddDate(1, 0, 0).UTC(),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	return cert, key, err
+}
+
+// hostIPs 返回本机非回环 IPv4 地址，写入证书 SAN
+func hostIPs() []net.IP {
+	var ips []net.IP
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ips
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+	return ips
+}
+
+func randomSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 63))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
+
+// loadKeyPair 从 PEM 文件读取证书和 RSA 私钥
+func loadKeyPair(certPath, keyPath string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, errors.New("invalid PEM data")
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// writeKeyPair 以 PEM 格式保存证书和私钥，私钥权限为 0600
+func writeKeyPair(dir, certName, keyName string, cert *x509.Certificate, key *rsa.PrivateKey) error {
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	if err := os.WriteFile(filepath.Join(dir, certName), certPEM, 0644); err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return os.WriteFile(filepath.Join(dir, keyName), keyPEM, 0600)
+}
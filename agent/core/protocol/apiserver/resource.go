@@ -0,0 +1,226 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"KubePot/core/kube"
+	"KubePot/utils/log"
+)
+
+// resourceRequest 解析后的资源请求路径
+type resourceRequest struct {
+	Resource    kube.Resource
+	Namespace   string
+	Name        string
+	Subresource string
+	Watch       bool
+}
+
+// parseResourcePath 解析 /api/v1/... 和 /apis/{group}/{version}/... 形式的资源路径
+func parseResourcePath(path string) (resourceRequest, bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	var group, version string
+	switch {
+	case len(parts) >= 3 && parts[0] == "api":
+		version, parts = parts[1], parts[2:]
+	case len(parts) >= 4 && parts[0] == "apis":
+		group, version, parts = parts[1], parts[2], parts[3:]
+	default:
+		return resourceRequest{}, false
+	}
+
+	var req resourceRequest
+	// 旧式的 /watch/ 路径前缀
+	if parts[0] == "watch" && len(parts) > 1 {
+		req.Watch, parts = true, parts[1:]
+	}
+	// /namespaces/{ns}/{resource}/... 为命名空间内的资源，/namespaces/{ns} 本身是命名空间对象
+	if parts[0] == "namespaces" && len(parts) >= 3 {
+		req.Namespace, parts = parts[1], parts[2:]
+	}
+
+	res, ok := kube.LookupResource(group, version, parts[0])
+	if !ok || (req.Namespace != "" && !res.Namespaced) || len(parts) > 3 {
+		return resourceRequest{}, false
+	}
+	req.Resource = res
+	if len(parts) > 1 {
+		req.Name = parts[1]
+	}
+	if len(parts) > 2 {
+		req.Subresource = parts[2]
+	}
+	return req, true
+}
+
+// serveResource 处理对象存储托管的资源，非托管资源返回 false 交给静态数据处理
+func serveResource(w http.ResponseWriter, r *http.Request, body []byte, clientIP string) bool {
+	req, ok := parseResourcePath(r.URL.Path)
+	if !ok {
+		return false
+	}
+
+	store := kube.ForClient(clientIP)
+	query := r.URL.Query()
+	if query.Get("dryRun") == "All" {
+		store = store.Clone()
+	}
+
+	if isWatch(r, req) {
+		serveWatch(w, r, store, req, clientIP)
+		return true
+	}
+	if isStreamRequest(r, req) {
+		serveStream(w, r, store, req, clientIP)
+		return true
+	}
+
+	result, code, err := handleResource(store, req, r, body)
+	if err != nil {
+		writeStatusError(w, err)
+		return true
+	}
+
+	if r.Method != http.MethodGet {
+		log.Pr("Apiserver", clientIP, "资源变更", fmt.Sprintf("%s %s %s/%s", r.Method, req.Resource.Name, req.Namespace, req.Name))
+	}
+	writeJSON(w, code, result)
+	return true
+}
+
+// handleResource 根据请求方法对存储执行操作，返回响应对象和状态码
+func handleResource(store *kube.Store, req resourceRequest, r *http.Request, body []byte) (interface{}, int, error) {
+	res := req.Resource
+	query := r.URL.Query()
+
+	switch req.Subresource {
+	case "":
+	case "status":
+		// status 子资源与对象本身共用存储
+	case "exec", "attach", "portforward":
+		// 升级请求已经由 serveStream 处理
+		return nil, 0, kube.NewBadRequest("Upgrade request required")
+	case "log":
+		return nil, 0, kube.NewBadRequest(fmt.Sprintf("a container name must be specified for pod %s", req.Name))
+	default:
+		return nil, 0, kube.NewNotFound(res, req.Name)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if req.Name != "" {
+			obj, err := store.Get(res, req.Namespace, req.Name)
+			if err != nil {
+				return nil, 0, err
+			}
+			if kube.AcceptsTable(r.Header.Get("Accept")) {
+				return kube.Table(res, []kube.Object{obj}), http.StatusOK, nil
+			}
+			return obj, http.StatusOK, nil
+		}
+
+		selector, err := kube.ParseSelector(query.Get("labelSelector"), query.Get("fieldSelector"))
+		if err != nil {
+			return nil, 0, kube.NewBadRequest(err.Error())
+		}
+		items := store.List(res, req.Namespace, selector)
+		if kube.AcceptsTable(r.Header.Get("Accept")) {
+			return kube.Table(res, items), http.StatusOK, nil
+		}
+		list := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			list = append(list, item)
+		}
+		return map[string]interface{}{
+			"kind":       res.ListKind(),
+			"apiVersion": res.APIVersion(),
+			"metadata":   map[string]interface{}{"resourceVersion": kube.CurrentResourceVersion()},
+			"items":      list,
+		}, http.StatusOK, nil
+
+	case http.MethodPost:
+		if req.Name != "" {
+			return nil, 0, kube.NewMethodNotSupported(res, "create")
+		}
+		obj, err := decodeObject(body)
+		if err != nil {
+			return nil, 0, err
+		}
+		created, err := store.Create(res, req.Namespace, obj)
+		return created, http.StatusCreated, err
+
+	case http.MethodPut:
+		if req.Name == "" {
+			return nil, 0, kube.NewMethodNotSupported(res, "update")
+		}
+		obj, err := decodeObject(body)
+		if err != nil {
+			return nil, 0, err
+		}
+		updated, err := store.Update(res, req.Namespace, req.Name, obj)
+		return updated, http.StatusOK, err
+
+	case http.MethodPatch:
+		if req.Name == "" {
+			return nil, 0, kube.NewMethodNotSupported(res, "patch")
+		}
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		patched, err := store.Patch(res, req.Namespace, req.Name, contentType, body)
+		return patched, http.StatusOK, err
+
+	case http.MethodDelete:
+		if req.Name == "" {
+			selector, err := kube.ParseSelector(query.Get("labelSelector"), query.Get("fieldSelector"))
+			if err != nil {
+				return nil, 0, kube.NewBadRequest(err.Error())
+			}
+			deleted := store.DeleteCollection(res, req.Namespace, selector)
+			items := make([]interface{}, 0, len(deleted))
+			for _, item := range deleted {
+				items = append(items, item)
+			}
+			return map[string]interface{}{
+				"kind":       res.ListKind(),
+				"apiVersion": res.APIVersion(),
+				"metadata":   map[string]interface{}{"resourceVersion": kube.CurrentResourceVersion()},
+				"items":      items,
+			}, http.StatusOK, nil
+		}
+		obj, err := store.Delete(res, req.Namespace, req.Name)
+		if err != nil {
+			return nil, 0, err
+		}
+		// Pod 和 Namespace 返回带 deletionTimestamp 的对象，其余返回 Success 状态
+		if res.Kind == "Pod" || res.Kind == "Namespace" {
+			return obj, http.StatusOK, nil
+		}
+		return map[string]interface{}{
+			"kind":       "Status",
+			"apiVersion": "v1",
+			"metadata":   map[string]interface{}{},
+			"status":     "Success",
+			"details": map[string]interface{}{
+				"name":  req.Name,
+				"group": res.Group,
+				"kind":  res.Name,
+				"uid":   obj["metadata"].(map[string]interface{})["uid"],
+			},
+		}, http.StatusOK, nil
+	}
+
+	return nil, 0, kube.NewMethodNotSupported(res, strings.ToLower(r.Method))
+}
+
+// decodeObject 解析请求体中的 JSON 对象
+func decodeObject(body []byte) (kube.Object, error) {
+	var obj kube.Object
+	if err := json.Unmarshal(body, &obj); err != nil || obj == nil {
+		return nil, kube.NewBadRequest("the object provided is unrecognized (must be of type JSON)")
+	}
+	return obj, nil
+}
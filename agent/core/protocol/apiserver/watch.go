@@ -0,0 +1,166 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"KubePot/core/event"
+	"KubePot/core/kube"
+	"KubePot/core/rpc/client"
+	"KubePot/utils/is"
+	"KubePot/utils/log"
+)
+
+// 未指定 timeoutSeconds 时 watch 的最长保持时间，与 apiserver 默认的 min-request-timeout 一致
+const defaultWatchTimeout = 30 * time.Minute
+
+// 书签事件发送间隔
+const bookmarkInterval = time.Minute
+
+// isWatch 判断是否为 watch 请求，兼容 ?watch=1 和 /watch/ 前缀两种形式
+func isWatch(r *http.Request, req resourceRequest) bool {
+	if req.Watch {
+		return true
+	}
+	watch, _ := strconv.ParseBool(r.URL.Query().Get("watch"))
+	return watch && r.Method == http.MethodGet
+}
+
+// serveWatch 以 chunked 流的形式持续输出 WatchEvent，直到客户端断开或超时
+func serveWatch(w http.ResponseWriter, r *http.Request, store *kube.Store, req resourceRequest, clientIP string) {
+	res := req.Resource
+	query := r.URL.Query()
+
+	fieldSelector := query.Get("fieldSelector")
+	if req.Name != "" {
+		if fieldSelector != "" {
+			fieldSelector += ","
+		}
+		fieldSelector += "metadata.name=" + req.Name
+	}
+	selector, err := kube.ParseSelector(query.Get("labelSelector"), fieldSelector)
+	if err != nil {
+		statusErr := kube.NewBadRequest(err.Error())
+		writeJSON(w, statusErr.Code, statusErr.Status())
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	timeout := defaultWatchTimeout
+	if seconds, err := strconv.Atoi(query.Get("timeoutSeconds")); err == nil && seconds > 0 && time.Duration(seconds)*time.Second < timeout {
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	// 未指定 resourceVersion 或为 0 时先发送现有对象的 ADDED 事件
+	resourceVersion := query.Get("resourceVersion")
+	sendInitialEvents, _ := strconv.ParseBool(query.Get("sendInitialEvents"))
+	allowBookmarks, _ := strconv.ParseBool(query.Get("allowWatchBookmarks"))
+	asTable := kube.AcceptsTable(r.Header.Get("Accept"))
+
+	watcher, initial := store.Watch(res, req.Namespace, selector)
+	defer watcher.Stop()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	events := 0
+	send := func(eventType string, obj kube.Object) error {
+		var object interface{} = obj
+		if asTable && eventType != kube.Bookmark {
+			object = kube.Table(res, []kube.Object{obj})
+		}
+		if err := encoder.Encode(map[string]interface{}{"type": eventType, "object": object}); err != nil {
+			return err
+		}
+		flusher.Flush()
+		events++
+		return nil
+	}
+	bookmark := func(annotations map[string]interface{}) error {
+		meta := map[string]interface{}{"resourceVersion": kube.CurrentResourceVersion()}
+		if annotations != nil {
+			meta["annotations"] = annotations
+		}
+		return send(kube.Bookmark, kube.Object{"kind": res.Kind, "apiVersion": res.APIVersion(), "metadata": meta})
+	}
+
+	start := time.Now()
+	log.Pr("Apiserver", clientIP, "开始 watch", fmt.Sprintf("%s %s", res.Name, req.Namespace))
+
+	reason := ""
+	if resourceVersion == "" || resourceVersion == "0" || sendInitialEvents {
+		for _, obj := range initial {
+			if err := send(kube.Added, obj); err != nil {
+				reason = "write failed"
+				break
+			}
+		}
+		if reason == "" && sendInitialEvents && allowBookmarks {
+			if err := bookmark(map[string]interface{}{"k8s.io/initial-events-end": "true"}); err != nil {
+				reason = "write failed"
+			}
+		}
+	}
+
+	ticker := time.NewTicker(bookmarkInterval)
+	defer ticker.Stop()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for reason == "" {
+		select {
+		case <-r.Context().Done():
+			reason = "client closed"
+		case <-timer.C:
+			reason = "timeout"
+		case <-ticker.C:
+			if allowBookmarks {
+				if err := bookmark(nil); err != nil {
+					reason = "write failed"
+				}
+			}
+		case event, ok := <-watcher.Events():
+			if !ok {
+				reason = "watcher too slow"
+			} else if err := send(event.Type, event.Object); err != nil {
+				reason = "write failed"
+			}
+		}
+	}
+
+	// 上报 watch 会话
+	duration := time.Since(start).Round(time.Second)
+	log.Pr("Apiserver", clientIP, "watch 结束", fmt.Sprintf("%s %s 持续 %s", res.Name, req.Namespace, duration))
+
+	namespace := req.Namespace
+	if namespace == "" && res.Namespaced {
+		namespace = "*"
+	}
+	info := fmt.Sprintf("Watch: %s, Namespace: %s, Selector: %s, Duration: %s, Events: %d, Close: %s",
+		res.Name, namespace, selectorString(query.Get("labelSelector"), fieldSelector), duration, events, reason)
+	if is.Rpc() {
+		ev := newEvent(r, event.KindRequest)
+		ev.Detail = info
+		go client.ReportResult(projectName, ev, "")
+	}
+}
+
+func selectorString(labelSelector, fieldSelector string) string {
+	switch {
+	case labelSelector != "" && fieldSelector != "":
+		return labelSelector + "," + fieldSelector
+	case labelSelector != "":
+		return labelSelector
+	}
+	return fieldSelector
+}
@@ -1,7 +1,10 @@
 package bash
 
 import (
+	"KubePot/core/event"
+	"KubePot/core/health"
 	"KubePot/core/rpc/client"
+	"KubePot/core/session"
 	"KubePot/utils/is"
 	"KubePot/utils/log"
 
@@ -47,7 +50,9 @@ func handleConnection(conn net.Conn) {
 		fmt.Printf("从 %s 收到消息: %s\n", clientAddr, message)
 
 		if is.Rpc() {
-			go client.ReportResult("BASH", "BASH 蜜罐", conn.RemoteAddr().String(), message, "")
+			ev := session.FromConn("BASH", event.KindCommand, conn)
+			ev.Command = message
+			go client.ReportResult("BASH 蜜罐", ev, "")
 		} else {
 			//go report.ReportKubelet("Kubelet", "本机", conn.RemoteAddr().String(), "")
 		}
@@ -56,6 +61,9 @@ func handleConnection(conn net.Conn) {
 	fmt.Printf("客户端已断开连接: %s\n", clientAddr)
 }
 
+// SocketPath Unix Socket 文件路径
+const SocketPath = "/tmp/c_keepalive.sock"
+
 // Start 启动 bash 蜜罐服务
 func Start() {
 	// 检查服务是否已经在运行
@@ -64,8 +72,7 @@ func Start() {
 		return
 	}
 
-	// Unix Socket 文件路径
-	socketPath := "/tmp/c_keepalive.sock"
+	socketPath := SocketPath
 
 	// 删除可能存在的旧socket文件
 	if _, err := os.Stat(socketPath); err == nil {
@@ -79,9 +86,12 @@ func Start() {
 	listener, err := net.Listen("unix", socketPath)
 	if err != nil {
 		log.Pr("Bash", "", "创建socket监听失败", err)
+		health.Failed("bash", err)
 		return
 	}
+	health.Listening("bash")
 	defer listener.Close()
+	listener = session.Listen(listener, "BASH", "BASH 蜜罐")
 
 	// 设置服务运行状态为true
 	serverRunning = true
@@ -1,7 +1,7 @@
 package docker
 
 import (
-	"bufio"
+	"KubePot/core/health"
 	"crypto/md5"
 	"encoding/json"
 	"fmt"
@@ -9,16 +9,14 @@ import (
 	"net"
 	"net/http"
 	"net/url"
-	"os"
-	"os/exec"
 	"regexp"
 	"strings"
-	"sync"
-	"syscall"
 	"time"
 
+	"KubePot/core/event"
 	"KubePot/core/pool"
 	"KubePot/core/rpc/client"
+	"KubePot/core/session"
 	"KubePot/utils/is"
 	"KubePot/utils/log"
 )
@@ -26,6 +24,9 @@ import (
 // 服务运行状态标志
 var serverRunning bool
 
+// 上报时的蜜罐名称
+const projectName = "Docker 2375蜜罐"
+
 type DeleteResponse struct {
 	// The image ID of an image that was deleted
 	Deleted string `json:"Deleted,omitempty"`
@@ -351,8 +352,10 @@ func Start(addr string) {
 	netListen, err := net.Listen("tcp", addr)
 	if err != nil {
 		log.Pr("Docker", "127.0.0.1", "Docker 监听失败", err)
+		health.Failed("docker", err)
 		return
 	}
+	health.Listening("docker")
 	defer netListen.Close()
 
 	// 设置服务运行状态为true
@@ -385,11 +388,8 @@ func Start(addr string) {
 			clientIP := strings.Split(conn.RemoteAddr().String(), ":")[0]
 			log.Pr("Docker", clientIP, "已经连接")
 
-			// 上报连接事件
-			var attackID string
-
-			// 处理连接
-			go handleConnection(conn, attackID, clientIP)
+			// 创建会话并上报连接事件
+			go handleConnection(session.Wrap(conn, "DOCKER", projectName), clientIP)
 			wg.Done()
 		})
 	}
@@ -405,7 +405,7 @@ type RequestInfo struct {
 }
 
 // handleConnection 处理客户端连接
-func handleConnection(conn net.Conn, attackID string, clientIP string) {
+func handleConnection(conn *session.Conn, clientIP string) {
 	defer conn.Close()
 
 	// 创建缓冲区
@@ -429,15 +429,21 @@ func handleConnection(conn net.Conn, attackID string, clientIP string) {
 		// 记录请求
 		log.Pr("Docker", clientIP, fmt.Sprintf("请求方法: %s, 路径: %s", requestInfo.Method, requestInfo.Path))
 
-		info := fmt.Sprintf("Method: %s, Path: %s", requestInfo.Method, requestInfo.Path)
 		if is.Rpc() {
-			go client.ReportResult("DOCKER", "Docker 2375蜜罐", conn.RemoteAddr().String(), info, attackID)
+			ev := conn.Session.Event(event.KindRequest)
+			ev.Request = &event.Request{
+				Method:    requestInfo.Method,
+				URI:       requestInfo.Path,
+				UserAgent: requestInfo.Headers["User-Agent"],
+				Raw:       requestData,
+			}
+			go client.ReportResult(projectName, ev, "")
 		} else {
 			//go report.ReportDocker("Docker", "本机", conn.RemoteAddr().String(), path)
 		}
 
 		// 获取响应数据
-		responseData, statusCode, headers := getResponseData(requestInfo.Method, requestInfo.Path)
+		responseData, statusCode, headers := getResponseData(requestInfo.Method, requestInfo.Path, requestInfo.Body)
 		// 处理TCP升级连接劫持
 		if statusCode == http.StatusSwitchingProtocols {
 			// 直接使用现有TCP连接，无需HTTP Hijacker
@@ -455,103 +461,10 @@ func handleConnection(conn net.Conn, attackID string, clientIP string) {
 				return
 			}
 
-			defer conn.Close()
-			cmd := exec.Command("/bin/bash", "-i")
-
-			// 设置必要的环境变量
-			cmd.Env = append(os.Environ(), "TERM=xterm", "HISTFILE=/dev/null", "INPUTRC=/etc/inputrc")
-
-			// 创建双向管道
-			stdin, err := cmd.StdinPipe()
-			if err != nil {
-				//log.Printf("创建标准输入管道失败: %v", err)
-				return
-			}
-			stdout, err := cmd.StdoutPipe()
-			if err != nil {
-				//log.Printf("创建标准输出管道失败: %v", err)
-				return
+			// 在模拟容器中运行伪造的 shell，不在宿主机执行任何命令
+			if inst := lookupExec(requestInfo.Path); inst != nil {
+				handleExecSession(conn, inst, clientIP)
 			}
-			cmd.Stderr = cmd.Stdout // 合并标准错误到标准输出
-
-			// 启动命令
-			if err := cmd.Start(); err != nil {
-				//log.Printf("启动bash进程失败: %v", err)
-				return
-			}
-
-			// 使用带缓冲的读取器，按行处理输出
-			reader := bufio.NewReader(stdout)
-			var wg sync.WaitGroup
-
-			// // 从连接读取数据并写入bash标准输入
-			// wg.Add(1)
-			// go func() {
-			// 	defer wg.Done()
-			// 	defer stdin.Close()
-			// 	io.Copy(stdin, conn)
-			// }()
-			// 从连接读取数据并写入bash标准输入（添加回显）
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				defer stdin.Close()
-				// 使用TeeReader同时实现输入转发和回显
-				reader := bufio.NewReader(conn)
-				for {
-					b, err := reader.ReadByte()
-					if err != nil {
-						break
-					}
-					if b == 0x03 {
-						if cmd.Process != nil {
-							cmd.Process.Signal(syscall.SIGINT)
-						}
-						// 向客户端发送^C视觉反馈
-						conn.Write([]byte{0x5E, 0x43, 0x0D, 0x0A}) // ^C
-					}
-
-					// 处理退格字符
-					if b == 0x08 || b == 0x7F { // 检测BS(0x08)或DEL(0x7F)退格字符
-						// 发送终端控制序列：回退一格、空格删除、再回退一格
-						conn.Write([]byte{0x08, 0x20, 0x08})
-						// 向bash发送DEL字符实现实际删除
-						stdin.Write([]byte{0x7F})
-					} else {
-						// 普通字符：正常回显并发送到bash
-						conn.Write([]byte{b})
-						stdin.Write([]byte{b})
-					}
-				}
-			}()
-
-			// 从bash标准输出读取数据并写入连接
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				for {
-					line, err := reader.ReadString('\n')
-					if err != nil {
-						if err != io.EOF {
-							//log.Printf("读取bash输出失败: %v", err)
-						}
-						break
-					}
-					// 过滤掉zsh切换提示（如果不需要显示）
-					if !strings.Contains(line, "The default interactive shell is now zsh") {
-						processedLine := ""
-						//if !strings.Contains(line, "bash-3.2") {
-						processedLine = strings.ReplaceAll(line, "\n", "\r\n")
-						//}
-						conn.Write([]byte(processedLine))
-					}
-				}
-			}()
-
-			// 等待goroutine完成并处理命令退出
-			wg.Wait()
-			cmd.Wait()
-
 			return
 		}
 		// // 处理 404 情况
@@ -688,10 +601,9 @@ func getUniqueImages() []Image {
 }
 
 // getResponseData 根据路径和方法获取响应数据
-func getResponseData(method, path string) (interface{}, int, map[string]string) {
+func getResponseData(method, path, body string) (interface{}, int, map[string]string) {
 	var containerGetRegex = regexp.MustCompile(`^/v\d+\.\d+/containers/([a-zA-Z0-9_\-.:]+)/json$`)
 	var containerExeceRegex = regexp.MustCompile(`^/v1\.(\d+)/containers/([a-zA-Z0-9_.-]+)/exec$`)
-	var execStartRegex = regexp.MustCompile(`^/v1\.(\d+)/exec/([a-zA-Z0-9_.-]+)/start$`)
 	var execResizeRegex = regexp.MustCompile(`^/v1\.(\d+)/exec/([^/]+)/resize(\?.*)?$`)
 	var imagesCreateRegex = regexp.MustCompile(`^/v1\.(\d+)/images/create(\?.*)?$`)
 	var imagesTagRegex = regexp.MustCompile(`^/v1\.(\d+)/images/([^/]+/[^/]+):([^/]+)/tag(\?.*)?$`)
@@ -875,34 +787,44 @@ func getResponseData(method, path string) (interface{}, int, map[string]string)
 			containerID := matches[2]
 
 			// 检查容器是否存在
-			containerExists := false
-			for _, c := range MockContainers {
-				if c.Id == containerID {
-					containerExists = true
-					break
-				}
-			}
-			if !containerExists {
-				return map[string]string{"message": "No such container"},
+			container := findContainer(containerID)
+			if container == nil {
+				return map[string]string{"message": "No such container: " + containerID},
 					http.StatusNotFound, defaultHeaders
 			}
 
-			// // 解析请求体
-			// var req ExecCreateRequest
-			// if err := json.Unmarshal([]byte(requestInfo.Body), &req); err != nil {
-			// 	return map[string]string{"message": "invalid request body: " + err.Error()},
-			// 		http.StatusBadRequest, defaultHeaders
-			// }
+			// 解析请求体
+			var req ExecCreateRequest
+			if err := json.Unmarshal([]byte(strings.TrimSpace(body)), &req); err != nil {
+				return map[string]string{"message": "invalid request body: " + err.Error()},
+					http.StatusBadRequest, defaultHeaders
+			}
+			if len(req.Cmd) == 0 {
+				return map[string]string{"message": "No exec command specified"},
+					http.StatusBadRequest, defaultHeaders
+			}
 
-			// 生成exec ID (模拟)
-			//execID := fmt.Sprintf("%x", md5.Sum([]byte(time.Now().String()+containerID)))[0:16]
-			execID := "10026b3e684410026b3e684410026b3e"
+			// 生成exec ID并记录对应的容器和命令
+			execID := newExec(container, req)
 
 			return ExecCreateResponse{Id: execID}, http.StatusCreated, defaultHeaders
 		}
 		return map[string]string{"message": "Method Not Allowed"},
 			http.StatusMethodNotAllowed, defaultHeaders
 
+	case execInspectRegex.MatchString(path):
+		if method == "GET" {
+			inst := lookupExec(path)
+			if inst == nil {
+				matches := execInspectRegex.FindStringSubmatch(path)
+				return map[string]string{"message": "No such exec instance: " + matches[2]},
+					http.StatusNotFound, defaultHeaders
+			}
+			return inst.inspect(), http.StatusOK, defaultHeaders
+		}
+		return map[string]string{"message": "Method Not Allowed"},
+			http.StatusMethodNotAllowed, defaultHeaders
+
 	case execStartRegex.MatchString(path):
 		if method == "POST" {
 			// 解析exec ID
@@ -912,9 +834,19 @@ func getResponseData(method, path string) (interface{}, int, map[string]string)
 					http.StatusBadRequest, defaultHeaders
 			}
 
+			inst := lookupExec(path)
+			if inst == nil {
+				return map[string]string{"message": "No such exec instance: " + matches[2]},
+					http.StatusNotFound, defaultHeaders
+			}
+
 			// 模拟TTY交互响应 - 使用完全自定义的头部
+			contentType := "application/vnd.docker.raw-stream"
+			if !inst.Request.Tty {
+				contentType = "application/vnd.docker.multiplexed-stream"
+			}
 			headers := map[string]string{
-				"Content-Type":        "application/vnd.docker.raw-stream",
+				"Content-Type":        contentType,
 				"Connection":          "Upgrade",
 				"Upgrade":             "tcp",
 				"Api-Version":         "1.47",
@@ -0,0 +1,199 @@
+package docker
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+
+	"KubePot/core/event"
+	"KubePot/core/rpc/client"
+	"KubePot/core/session"
+	"KubePot/core/shell"
+	"KubePot/utils/is"
+	"KubePot/utils/log"
+)
+
+// 最多保留的 exec 实例数量，防止被恶意刷爆内存
+const maxExecInstances = 1024
+
+var (
+	execStartRegex   = regexp.MustCompile(`^/v1\.(\d+)/exec/([a-zA-Z0-9_.-]+)/start$`)
+	execInspectRegex = regexp.MustCompile(`^/v1\.(\d+)/exec/([a-zA-Z0-9_.-]+)/json$`)
+	execPathRegex    = regexp.MustCompile(`^/v1\.\d+/exec/([a-zA-Z0-9_.-]+)/`)
+)
+
+// execInstance 通过 exec create 创建的执行实例
+type execInstance struct {
+	ID        string
+	Container Container
+	Request   ExecCreateRequest
+	Running   bool
+	ExitCode  int
+}
+
+var (
+	execMutex     sync.Mutex
+	execInstances = make(map[string]*execInstance)
+)
+
+// findContainer 按容器ID、ID前缀或名称查找模拟容器
+func findContainer(idOrName string) *Container {
+	if idOrName == "" {
+		return nil
+	}
+	for i, c := range MockContainers {
+		if c.Id == idOrName || strings.HasPrefix(c.Id, idOrName) {
+			return &MockContainers[i]
+		}
+		for _, name := range c.Names {
+			if strings.TrimPrefix(name, "/") == strings.TrimPrefix(idOrName, "/") {
+				return &MockContainers[i]
+			}
+		}
+	}
+	return nil
+}
+
+// newExec 创建 exec 实例并返回其ID
+func newExec(container *Container, req ExecCreateRequest) string {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	id := hex.EncodeToString(buf)
+
+	execMutex.Lock()
+	defer execMutex.Unlock()
+
+	if len(execInstances) >= maxExecInstances {
+		for k := range execInstances {
+			delete(execInstances, k)
+			break
+		}
+	}
+	execInstances[id] = &execInstance{
+		ID:        id,
+		Container: *container,
+		Request:   req,
+	}
+	return id
+}
+
+// lookupExec 根据请求路径中的 exec ID 查找实例
+func lookupExec(path string) *execInstance {
+	matches := execPathRegex.FindStringSubmatch(path)
+	if len(matches) < 2 {
+		return nil
+	}
+
+	execMutex.Lock()
+	defer execMutex.Unlock()
+	return execInstances[matches[1]]
+}
+
+// inspect 返回 exec inspect 接口的数据
+func (e *execInstance) inspect() map[string]interface{} {
+	execMutex.Lock()
+	defer execMutex.Unlock()
+
+	entrypoint, args := "", []string{}
+	if len(e.Request.Cmd) > 0 {
+		entrypoint, args = e.Request.Cmd[0], e.Request.Cmd[1:]
+	}
+	return map[string]interface{}{
+		"ID":            e.ID,
+		"Running":       e.Running,
+		"ExitCode":      e.ExitCode,
+		"ProcessConfig": map[string]interface{}{"tty": e.Request.Tty, "entrypoint": entrypoint, "arguments": args, "privileged": false},
+		"OpenStdin":     e.Request.AttachStdin,
+		"OpenStderr":    e.Request.AttachStderr,
+		"OpenStdout":    e.Request.AttachStdout,
+		"CanRemove":     false,
+		"ContainerID":   e.Container.Id,
+		"DetachKeys":    "",
+		"Pid":           0,
+	}
+}
+
+// multiplexedStream 非 TTY 模式下按 Docker 多路复用格式输出 stdout
+type multiplexedStream struct {
+	conn net.Conn
+}
+
+func (m *multiplexedStream) Read(p []byte) (int, error) {
+	return m.conn.Read(p)
+}
+
+func (m *multiplexedStream) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	header := make([]byte, 8)
+	header[0] = 1
+	binary.BigEndian.PutUint32(header[4:], uint32(len(p)))
+	if _, err := m.conn.Write(append(header, p...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// handleExecSession 在模拟容器中运行伪造的 shell，记录全部按键和命令
+func handleExecSession(conn *session.Conn, inst *execInstance, clientIP string) {
+	containerName := strings.TrimPrefix(strings.Join(inst.Container.Names, ","), "/")
+
+	sh := shell.NewContainerShell(shell.Container{
+		ID:      inst.Container.Id,
+		Name:    containerName,
+		Image:   inst.Container.Image,
+		Command: inst.Container.Command,
+		Created: inst.Container.Created,
+	})
+	sh.OnCommand = func(line string) {
+		log.Pr("Docker", clientIP, fmt.Sprintf("容器 %s 执行命令: %s", containerName, line))
+
+		if is.Rpc() {
+			ev := conn.Session.Event(event.KindCommand)
+			ev.Command = line
+			ev.Detail = fmt.Sprintf("Container: %s, Image: %s", containerName, inst.Container.Image)
+			go client.ReportResult(projectName, ev, "")
+		}
+	}
+
+	execMutex.Lock()
+	inst.Running = true
+	execMutex.Unlock()
+
+	var stream io.ReadWriter = conn
+	if !inst.Request.Tty {
+		stream = &multiplexedStream{conn: conn}
+	}
+
+	if shell.IsShell(inst.Request.Cmd) && inst.Request.AttachStdin {
+		sh.Run(stream, inst.Request.Tty)
+	} else {
+		output := sh.ExecArgs(inst.Request.Cmd)
+		if inst.Request.Tty {
+			output = strings.ReplaceAll(output, "\n", "\r\n")
+		}
+		io.WriteString(stream, output)
+	}
+
+	execMutex.Lock()
+	inst.Running = false
+	execMutex.Unlock()
+
+	// 上报完整的按键记录
+	if keystrokes := sh.Keystrokes(); keystrokes != "" {
+		log.Pr("Docker", clientIP, "交互会话结束", fmt.Sprintf("%q", keystrokes))
+
+		if is.Rpc() {
+			ev := conn.Session.Event(event.KindCommand)
+			ev.Detail = fmt.Sprintf("Container: %s, Keystrokes: %q", containerName, keystrokes)
+			go client.ReportResult(projectName, ev, "")
+		}
+	}
+}
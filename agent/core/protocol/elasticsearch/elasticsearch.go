@@ -1,11 +1,15 @@
 package elasticsearch
 
 import (
+	"KubePot/core/event"
+	"KubePot/core/health"
 	"KubePot/core/report"
 	"KubePot/core/rpc/client"
+	"KubePot/core/session"
 	"KubePot/utils/is"
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -192,7 +196,7 @@ func printInfo(r *http.Request) {
 
 	// 判断是否为 RPC 客户端
 	if is.Rpc() {
-		go client.ReportResult("ES", "ES蜜罐", arr[0], info, "0")
+		go client.ReportResult("ES蜜罐", session.FromRequest(r, "ES", "ES蜜罐").Request(event.KindRequest, r), "0")
 	} else {
 		go report.ReportEs("ES蜜罐", "本机", arr[0], info)
 	}
@@ -214,14 +218,24 @@ func Start(address string) {
 
 	// 创建HTTP服务器
 	server = &http.Server{
-		Addr:    address,
-		Handler: mux,
+		Addr:        address,
+		Handler:     mux,
+		ConnContext: session.ConnContext,
 	}
 
-	// 启动服务器
+	// 启动服务器，每个连接创建一个会话
+	netListen, err := net.Listen("tcp", address)
+	if err != nil {
+		fmt.Printf("服务器启动失败: %v\n", err)
+		health.Failed("elasticsearch", err)
+		server = nil
+		return
+	}
+	health.Listening("elasticsearch")
 	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := server.Serve(session.Listen(netListen, "ES", "ES蜜罐")); err != nil && err != http.ErrServerClosed {
 			fmt.Printf("服务器启动失败: %v\n", err)
+			health.Failed("elasticsearch", err)
 		}
 	}()
 }
@@ -1,17 +1,24 @@
 package etcd
 
 import (
+	"KubePot/core/health"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	stdlog "log"
 	"net"
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
-	"KubePot/core/pool"
+	attack "KubePot/core/event"
+	"KubePot/core/kube"
 	"KubePot/core/rpc/client"
+	attacksession "KubePot/core/session"
+	"KubePot/utils/config"
 	"KubePot/utils/is"
 	"KubePot/utils/log"
 )
@@ -19,6 +26,17 @@ import (
 // 服务运行状态标志
 var serverRunning bool
 
+var (
+	// running 运行中的服务，Stop 据此关闭
+	running   *http.Server
+	runningMu sync.Mutex
+	// started Start 返回后 Stop 才返回，保证之后可以重新启动
+	started sync.WaitGroup
+)
+
+// 上报时的蜜罐名称
+const projectName = "Etcd 2379蜜罐"
+
 type EtcdNode struct {
 	Key           string     `json:"key"`
 	Value         string     `json:"value,omitempty"`
@@ -113,7 +131,7 @@ var MockEtcdData = []EtcdKV{
 
 	// 7. Secret数据
 	{Key: "/registry/secrets", Dir: true, CreatedIndex: 13, ModifiedIndex: 13},
-	{Key: "/registry/secrets/default/default-token-5k7z8", Value: "eyJraW5kIjoiU2VjcmV0IiwiYXBpVmVyc2lvbiI6InYxIiwibWV0YWRhdGEiOnsibmFtZSI6ImRlZmF1bHQtdG9rZW4tNWs3ejgifX0=", CreatedIndex: 14, ModifiedIndex: 14},
+	{Key: "/registry/secrets/default/default-token-5k7z8", Value: "eyJraW5kIjoiU2VjcmV0IiwiYXBpVmVyc2lvbiI6InYxIiwibWV0YWRhdGEiOnsibmFtZSI6ImRlZmF1bHQtdG9rZW4tNWs3ejgiLCJuYW1lc3BhY2UiOiJkZWZhdWx0IiwidWlkIjoiOGMxZDJlM2YtNGE1Yi00YzZkLThlN2YtOWEwYjFjMmQzZTRmIiwiY3JlYXRpb25UaW1lc3RhbXAiOiIyMDI0LTAzLTExVDA4OjIxOjM3WiIsImFubm90YXRpb25zIjp7Imt1YmVybmV0ZXMuaW8vc2VydmljZS1hY2NvdW50Lm5hbWUiOiJkZWZhdWx0Iiwia3ViZXJuZXRlcy5pby9zZXJ2aWNlLWFjY291bnQudWlkIjoiM2YyYjZhOGUtMWM0ZC00ZTdmLTlhMGItNWQ2YzdlOGY5YTAxIn19LCJ0eXBlIjoia3ViZXJuZXRlcy5pby9zZXJ2aWNlLWFjY291bnQtdG9rZW4iLCJkYXRhIjp7Im5hbWVzcGFjZSI6IlpHVm1ZWFZzZEE9PSIsInRva2VuIjoiWlhsS2FHSkhZMmxQYVVwVFZYcEpNVTVwU1hOSmJYUndXa05KTmtsc2FIbE5SV1I0VFcwMVRHUjZXbEppVlZsM1dYcEdXV1JxYUhwVGJsSjRUMVZvYWxkWVFrMWxhbEpvVGpKU1JrMHpWa05PVnpsUFRXc3dhV1pSTG1WNVNuQmpNMDFwVDJsS2NtUlhTbXhqYlRWc1pFZFdla3d6VG14amJscHdXVEpXYUZreVRuWmtWelV3U1dsM2FXRXpWbWxhV0VwMVdsaFNiR041TlhCaWVUbDZXbGhLTW1GWFRteFpWMDVxWWpOV2RXUkRPWFZaVnpGc1l6TkNhRmt5VldsUGFVcHJXbGRhYUdSWGVEQkphWGRwWVROV2FWcFlTblZhV0ZKc1kzazFjR0o1T1hwYVdFb3lZVmRPYkZsWFRtcGlNMVoxWkVNNWVscFhUbmxhV0ZGMVltMUdkRnBUU1RaSmJWSnNXbTFHTVdKSVVYUmtSemx5V2xjMGRFNVhjek5sYW1kcFRFTktjbVJYU214amJUVnNaRWRXZWt4dGJIWk1NMDVzWTI1YWNGa3lWbWhaTWs1MlpGYzFNRXd6VG14amJscHdXVEpWZEZsWFRtcGlNMVoxWkVNMWRWbFhNV3hKYW05cFdrZFdiVmxZVm5Oa1EwbHpTVzEwTVZsdFZubGliVll3V2xoTmRXRlhPSFpqTWxaNVpHMXNhbHBYUm1wWk1qa3hZbTVSZG1NeVZubGtiV3hxV2xNeGFGa3lUblprVnpVd1RHNVdjRnBEU1RaSmFrNXRUVzFKTWxsVWFHeE1WRVpxVGtkUmRFNUhWVE5hYVRBMVdWUkNhVXhVVm10T2JVMHpXbFJvYlU5WFJYZE5VMGx6U1c1T01WbHBTVFpKYms0MVl6TlNiR0pVY0hwYVdFb3lZVmRPYkZsWFRtcGlNMVoxWkVSd2ExcFhXbWhrVjNnd1QyMVNiRnB0UmpGaVNGRnBabEV1WW1wUlRHNVFMWHBsY0dsamNGVlViWFV6WjB0TVNHbFJTRlF0ZWs1NmFESm9Va2RxUW1obGRtOUNNVXc1VWtsMlRrVldWWGhVZG1WTWNuVk5NSEptYWpCWFFVc3hha2hFYUdGWVdIcFBTVGhrTkZaR2JYUjJRblJOYTBGZkxWTk9WakYwWkhCaldUUkNRVVZzT1d3eWQxOXFOR3RUVlhReU5uQm9hMVk1YlVkRFJWOTBRMHhzTkhJd01UbEhWM0F3VW5Gb2NsZEJRMlZaTW5Sb1NHSkdhVVZpV21GdGNUTmZTMk5ZYkV4YWVGRnFSa0ZxVW5wU1RtcEJaWFJyWTNaWFFtOXlPR1JtT1dscmRrSnBiMHA1YW1kamFXVmpaV1EzYlhCeWNEUjNjMDUyWW1JeFJVdEthemMxTTI1blZrRmtaVEoxVTNKdmJuSkNXbmhoZERCUVlsb3hhSFZ0VUhKVFptRkROV3h2ZGtGUFlVaDJUazFyTlhWaWFteEpObWt0TFVveFNHaG5ha1kzVUdKTFRsbGtXVGwwU2kxaVVGSlRZM0JPTldRMlpFbGZXV2MxU0dKYU5YcDBjRGw0TnpobVFVWTNiMlZSIn19", CreatedIndex: 14, ModifiedIndex: 14},
 }
 
 // EtcdMembers 存储模拟的集群成员
@@ -154,7 +172,7 @@ func loadEtcdData() {
 	}
 }
 
-// Start 启动etcd蜜罐服务
+// Start 启动etcd蜜罐服务，同一端口提供 HTTP/1.1 的 v2 接口和 JSON 网关，以及明文 HTTP/2 上的 v3 gRPC
 func Start(addr string) {
 	// 检查服务是否已经在运行
 	if serverRunning {
@@ -162,15 +180,23 @@ func Start(addr string) {
 		return
 	}
 
+	// 与 apiserver 蜜罐共用集群对象，/registry 下的数据与其一致
+	kube.Init(config.Get("apiserver", "fixture_dir"))
+	seedKeyspace()
+
 	// 建立socket，监听端口
 	netListen, err := net.Listen("tcp", addr)
 	if err != nil {
 		log.Pr("Etcd", "127.0.0.1", "Etcd 监听失败", err)
+		health.Failed("etcd", err)
 		return
 	}
+	health.Listening("etcd")
 	defer netListen.Close()
 
 	// 设置服务运行状态为true
+	started.Add(1)
+	defer started.Done()
 	serverRunning = true
 	defer func() {
 		serverRunning = false
@@ -178,102 +204,214 @@ func Start(addr string) {
 
 	log.Pr("Etcd", addr, "蜜罐服务已启动")
 
-	// 创建连接池
-	wg, poolX := pool.New(10)
-	defer poolX.Release()
-
-	// 循环接受连接
-	for {
-		wg.Add(1)
-		poolX.Submit(func() {
-			// 稍微延迟，避免过快接受连接
-			time.Sleep(time.Second * 1)
-
-			conn, err := netListen.Accept()
-			if err != nil {
-				log.Pr("Etcd", "127.0.0.1", "Etcd 连接失败", err)
-				wg.Done()
-				return
-			}
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	server := &http.Server{
+		Handler:           http.HandlerFunc(handleRequest),
+		ConnContext:       attacksession.ConnContext,
+		Protocols:         protocols,
+		ReadHeaderTimeout: 30 * time.Second,
+		IdleTimeout:       5 * time.Minute,
+		ErrorLog:          stdlog.New(io.Discard, "", 0),
+	}
+	runningMu.Lock()
+	running = server
+	runningMu.Unlock()
 
-			// 获取客户端IP
-			clientIP := strings.Split(conn.RemoteAddr().String(), ":")[0]
-			log.Pr("Etcd", clientIP, "已经连接")
+	if err := server.Serve(attacksession.Listen(netListen, "ETCD", projectName)); err != nil && err != http.ErrServerClosed {
+		log.Pr("Etcd", "127.0.0.1", "Etcd 服务异常退出", err)
+		health.Failed("etcd", err)
+	}
+}
 
-			// 上报连接事件
-			var attackID string
+// Stop 关闭服务并等待 Start 返回
+func Stop() {
+	runningMu.Lock()
+	server := running
+	running = nil
+	runningMu.Unlock()
+	if server == nil {
+		return
+	}
 
-			// 处理连接
-			go handleConnection(conn, attackID, clientIP)
-			wg.Done()
-		})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
 	}
+	started.Wait()
+	log.Pr("Etcd", "127.0.0.1", "蜜罐服务已关闭")
 }
 
-// handleConnection 处理客户端连接
-func handleConnection(conn net.Conn, attackID string, clientIP string) {
-	defer conn.Close()
+// newEvent 创建关联到连接会话的请求事件
+func newEvent(r *http.Request) *attack.Event {
+	return attacksession.FromRequest(r, "ETCD", projectName).Request(attack.KindRequest, r)
+}
 
-	// 创建缓冲区
-	buffer := make([]byte, 4096)
+// handleRequest 处理客户端请求
+func handleRequest(w http.ResponseWriter, r *http.Request) {
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+	c := &call{ks: forClient(clientIP)}
 
-	// 循环读取客户端请求
-	for {
-		// 读取请求数据
-		n, err := conn.Read(buffer)
-		if err != nil {
-			if err != io.EOF {
-				log.Pr("Etcd", clientIP, "读取数据失败", err)
-			}
-			break
-		}
+	if isGRPC(r) {
+		serveGRPC(w, r, c)
+		return
+	}
 
-		// 解析请求路径和方法
-		requestData := string(buffer[:n])
-		path, method := extractPathAndMethod(requestData)
-		//queryParams := extractQueryParams(requestData)
+	// 记录请求
+	log.Pr("Etcd", clientIP, fmt.Sprintf("请求方法: %s, 路径: %s", r.Method, r.URL.RequestURI()))
 
-		// 记录请求
-		log.Pr("Etcd", clientIP, fmt.Sprintf("请求方法: %s, 路径: %s", method, path))
+	if method, ok := gatewayMethods[r.URL.Path]; ok && r.Method == http.MethodPost {
+		serveGateway(w, r, c, method)
+		return
+	}
 
-		if is.Rpc() {
-			go client.ReportResult("ETCD", "Etcd 2379蜜罐", conn.RemoteAddr().String(), conn.RemoteAddr().String(), attackID)
-		} else {
-			//go report.ReportEtcd("Etcd", "本机", conn.RemoteAddr().String(), fmt.Sprintf("%s %s", method, path))
-		}
+	if is.Rpc() {
+		go client.ReportResult(projectName, newEvent(r), "")
+	}
 
-		// 获取响应数据
-		responseData, statusCode := getResponseData(path, method, requestData)
+	// 获取响应数据
+	responseData, statusCode := getResponseData(r.URL.Path, r.Method)
 
-		// 将响应数据转换为 JSON
-		jsonData, err := json.MarshalIndent(responseData, "", "  ")
-		if err != nil {
-			log.Pr("Etcd", clientIP, "JSON 编码失败", err)
-			conn.Write([]byte("HTTP/1.1 500 Internal Server Error\r\nContent-Type: text/plain\r\n\r\nInternal Server Error"))
-			continue
-		}
+	// 将响应数据转换为 JSON
+	jsonData, err := json.MarshalIndent(responseData, "", "  ")
+	if err != nil {
+		log.Pr("Etcd", clientIP, "JSON 编码失败", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(jsonData)
+}
+
+// gatewayMethods grpc-gateway 的 JSON 路径到 gRPC 方法
+var gatewayMethods = map[string]string{
+	"/v3/kv/range":            "/etcdserverpb.KV/Range",
+	"/v3/kv/put":              "/etcdserverpb.KV/Put",
+	"/v3/kv/deleterange":      "/etcdserverpb.KV/DeleteRange",
+	"/v3/kv/txn":              "/etcdserverpb.KV/Txn",
+	"/v3/kv/compaction":       "/etcdserverpb.KV/Compact",
+	"/v3/lease/grant":         "/etcdserverpb.Lease/LeaseGrant",
+	"/v3/lease/revoke":        "/etcdserverpb.Lease/LeaseRevoke",
+	"/v3/kv/lease/revoke":     "/etcdserverpb.Lease/LeaseRevoke",
+	"/v3/lease/timetolive":    "/etcdserverpb.Lease/LeaseTimeToLive",
+	"/v3/kv/lease/timetolive": "/etcdserverpb.Lease/LeaseTimeToLive",
+	"/v3/lease/leases":        "/etcdserverpb.Lease/LeaseLeases",
+	"/v3/kv/lease/leases":     "/etcdserverpb.Lease/LeaseLeases",
+	"/v3/auth/authenticate":   "/etcdserverpb.Auth/Authenticate",
+	"/v3/auth/status":         "/etcdserverpb.Auth/AuthStatus",
+	"/v3/auth/user/list":      "/etcdserverpb.Auth/UserList",
+	"/v3/maintenance/status":  "/etcdserverpb.Maintenance/Status",
+	"/v3/maintenance/alarm":   "/etcdserverpb.Maintenance/Alarm",
+	"/v3/maintenance/hashkv":  "/etcdserverpb.Maintenance/HashKV",
+	"/v3/cluster/member/list": "/etcdserverpb.Cluster/MemberList",
+	"/v3/lease/keepalive":     "/etcdserverpb.Lease/LeaseKeepAlive",
+}
+
+// serveGateway 处理 JSON 网关请求，与 gRPC 共用处理函数
+func serveGateway(w http.ResponseWriter, r *http.Request, c *call, method string) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxGRPCMessageSize))
+	var req *request
+	if err == nil {
+		req, err = decodeJSON(body)
+	}
+	if err != nil {
+		writeGatewayError(w, &rpcError{codeInvalidArgument, err.Error()})
+		return
+	}
+
+	var resp *message
+	if method == "/etcdserverpb.Lease/LeaseKeepAlive" {
+		resp = (&message{}).set(1, "result", c.keepAlive(req))
+	} else {
+		resp, err = unaryMethods[method](c, req)
+	}
+	record(r, c, method, errorText(err))
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
 
-		// 构建 HTTP 响应
-		response := fmt.Sprintf(
-			"HTTP/1.1 %d OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s",
-			statusCode, len(jsonData), jsonData,
-		)
+	data, _ := json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
 
-		// 发送响应
-		conn.Write([]byte(response))
+// writeGatewayError 与 grpc-gateway 一样返回 gRPC 状态和对应的 HTTP 状态码
+func writeGatewayError(w http.ResponseWriter, err error) {
+	e, ok := err.(*rpcError)
+	if !ok {
+		e = &rpcError{13, err.Error()}
 	}
+	status := http.StatusInternalServerError
+	switch e.code {
+	case codeInvalidArgument, codeFailedPrecondition, codeOutOfRange:
+		status = http.StatusBadRequest
+	case codeNotFound:
+		status = http.StatusNotFound
+	case codeUnimplemented:
+		status = http.StatusNotImplemented
+	}
+	data, _ := json.Marshal(map[string]interface{}{"error": e.message, "code": e.code, "message": e.message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
 }
 
-// extractPathAndMethod 从请求中提取路径和方法
-func extractPathAndMethod(request string) (string, string) {
-	lines := strings.Split(request, "\r\n")
-	if len(lines) > 0 {
-		parts := strings.Split(lines[0], " ")
-		if len(parts) > 2 {
-			return parts[1], parts[0]
+// 单条记录中列出的键数上限
+const maxRecordedKeys = 200
+
+// record 记录并上报一次 v3 调用读写的键
+func record(r *http.Request, c *call, method, errText string) {
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+
+	ev := newEvent(r)
+	ev.Command = method
+
+	info := method
+	if token := r.Header.Get("Token"); token != "" {
+		info += ", Token: " + token
+		ev.Credentials = &attack.Credentials{Token: token}
+	}
+	if ua := r.UserAgent(); ua != "" {
+		info += ", User-Agent: " + ua
+	}
+	var detail []string
+	detail = append(detail, c.detail...)
+	for _, keys := range []struct {
+		name string
+		keys []string
+	}{{"Read", c.reads}, {"Write", c.writes}} {
+		if len(keys.keys) == 0 {
+			continue
 		}
+		list := keys.keys
+		if len(list) > maxRecordedKeys {
+			list = append(list[:maxRecordedKeys:maxRecordedKeys], fmt.Sprintf("... (%d more)", len(keys.keys)-maxRecordedKeys))
+		}
+		detail = append(detail, fmt.Sprintf("%s %d keys: %s", keys.name, len(keys.keys), strings.Join(list, ", ")))
+	}
+	if errText != "" {
+		detail = append(detail, "Error: "+errText)
+	}
+	c.detail, c.reads, c.writes = nil, nil, nil
+	ev.Detail = strings.Join(detail, "\n")
+	if ev.Detail != "" {
+		info += "\n" + ev.Detail
+	}
+
+	log.Pr("Etcd", clientIP, "v3 调用", info)
+	if is.Rpc() {
+		go client.ReportResult(projectName, ev, "")
 	}
-	return "/", "GET"
 }
 
 // 从v2 API路径中提取键
@@ -288,7 +426,7 @@ func extractKeyFromV2Path(path string) string {
 }
 
 // getResponseData 根据路径和方法获取响应数据和状态码
-func getResponseData(path string, method string, requestData string) (interface{}, int) {
+func getResponseData(path string, method string) (interface{}, int) {
 	// 编译v2 keys路径正则表达式
 	v2KeysRegex := regexp.MustCompile(`^/v2/keys(/.*)?$`)
 	//v2KeyRegex := regexp.MustCompile(`^/v2/keys(/.*)$`)
@@ -344,55 +482,3 @@ func getResponseData(path string, method string, requestData string) (interface{
 		}, 200
 	}
 }
-
-// extractKeyFromRequest 从请求中提取键
-func extractKeyFromRequest(request string) string {
-	// 简单解析JSON请求体中的键
-	// 实际应用中应该使用JSON解析库
-	if strings.Contains(request, "\"key\"") {
-		start := strings.Index(request, "\"key\":\"") + 7
-		end := strings.Index(request[start:], "\"")
-		if end > 0 {
-			key := request[start : start+end]
-			return base64Decode(key)
-		}
-	}
-	return ""
-}
-
-// extractKeyAndValueFromRequest 从请求中提取键和值
-func extractKeyAndValueFromRequest(request string) (string, string) {
-	// 简单解析JSON请求体中的键和值
-	// 实际应用中应该使用JSON解析库
-	var key, value string
-
-	if strings.Contains(request, "\"key\"") {
-		start := strings.Index(request, "\"key\":\"") + 7
-		end := strings.Index(request[start:], "\"")
-		if end > 0 {
-			key = base64Decode(request[start : start+end])
-		}
-	}
-
-	if strings.Contains(request, "\"value\"") {
-		start := strings.Index(request, "\"value\":\"") + 9
-		end := strings.Index(request[start:], "\"")
-		if end > 0 {
-			value = request[start : start+end]
-		}
-	}
-
-	return key, value
-}
-
-// base64Encode 模拟base64编码
-func base64Encode(s string) string {
-	// 实际应用中应该使用标准库的base64编码
-	return fmt.Sprintf("%x", []byte(s))
-}
-
-// base64Decode 模拟base64解码
-func base64Decode(s string) string {
-	// 实际应用中应该使用标准库的base64解码
-	return string([]byte(s))
-}
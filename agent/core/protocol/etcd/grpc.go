@@ -0,0 +1,283 @@
+package etcd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 单条 gRPC 消息的大小上限，与 etcd 默认的 --max-request-bytes 加上 gRPC 开销一致
+const maxGRPCMessageSize = 2*1024*1024 + 512*1024
+
+// isGRPC 判断是否为 gRPC 请求，etcdctl 通过明文 HTTP/2 直接发起
+func isGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// readMessage 读取一条长度前缀的 gRPC 消息
+func readMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	if prefix[0] != 0 {
+		return nil, &rpcError{codeUnimplemented, "grpc: Decompressor is not installed for grpc-encoding"}
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxGRPCMessageSize {
+		return nil, &rpcError{8, fmt.Sprintf("grpc: received message larger than max (%d vs. %d)", size, maxGRPCMessageSize)}
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeMessage 写入一条 gRPC 消息并立即发送
+func writeMessage(w http.ResponseWriter, m *message) {
+	body := m.Marshal()
+	frame := make([]byte, 5, 5+len(body))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(body)))
+	w.Write(append(frame, body...))
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// setStatus 响应体发送完后通过 HTTP/2 trailer 返回成功状态
+func setStatus(w http.ResponseWriter) {
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+}
+
+// writeError 以只有头部的方式返回 gRPC 错误
+func writeError(w http.ResponseWriter, err error) {
+	code, msg := 13, err.Error()
+	if e, ok := err.(*rpcError); ok {
+		code = e.code
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", encodeGRPCMessage(msg))
+	w.WriteHeader(http.StatusOK)
+}
+
+// encodeGRPCMessage 按 gRPC 协议对 grpc-message 做百分号编码
+func encodeGRPCMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// serveGRPC 处理 gRPC 请求，Watch 和 LeaseKeepAlive 为双向流，其余为一元调用
+func serveGRPC(w http.ResponseWriter, r *http.Request, c *call) {
+	w.Header().Set("Content-Type", "application/grpc")
+	method := r.URL.Path
+
+	switch method {
+	case "/etcdserverpb.Watch/Watch":
+		w.WriteHeader(http.StatusOK)
+		serveWatch(w, r, c)
+		setStatus(w)
+		return
+	case "/etcdserverpb.Lease/LeaseKeepAlive":
+		w.WriteHeader(http.StatusOK)
+		for {
+			msg, err := readMessage(r.Body)
+			if err != nil {
+				break
+			}
+			req, err := decodeProto(msg)
+			if err != nil {
+				break
+			}
+			writeMessage(w, c.keepAlive(req))
+		}
+		setStatus(w)
+		return
+	}
+
+	handler, ok := unaryMethods[method]
+	if !ok {
+		record(r, c, method, "unimplemented")
+		writeError(w, &rpcError{codeUnimplemented, fmt.Sprintf("unknown method %s for service %s", methodName(method), serviceName(method))})
+		return
+	}
+
+	msg, err := readMessage(r.Body)
+	var req *request
+	if err == nil {
+		req, err = decodeProto(msg)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	resp, err := handler(c, req)
+	record(r, c, method, errorText(err))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	writeMessage(w, resp)
+	setStatus(w)
+}
+
+func serviceName(method string) string {
+	parts := strings.Split(strings.Trim(method, "/"), "/")
+	return parts[0]
+}
+
+func methodName(method string) string {
+	parts := strings.Split(strings.Trim(method, "/"), "/")
+	return parts[len(parts)-1]
+}
+
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// serveWatch 处理双向流的 Watch 请求
+func serveWatch(w http.ResponseWriter, r *http.Request, c *call) {
+	requests := make(chan *request)
+	go func() {
+		defer close(requests)
+		for {
+			msg, err := readMessage(r.Body)
+			if err != nil {
+				return
+			}
+			req, err := decodeProto(msg)
+			if err != nil {
+				return
+			}
+			select {
+			case requests <- req:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}()
+
+	// 所有监听共用一个事件通道，按 watcher 区分 watch_id
+	type delivery struct {
+		w      *watcher
+		events []event
+	}
+	deliveries := make(chan delivery, 64)
+	watchers := make(map[int64]*watcher)
+	defer func() {
+		for _, wt := range watchers {
+			c.ks.removeWatcher(wt)
+		}
+	}()
+
+	var nextID int64
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case req, ok := <-requests:
+			if !ok {
+				return
+			}
+			switch {
+			case req.message(1, "create_request") != nil:
+				create := req.message(1, "create_request")
+				wt := &watcher{
+					id:     create.int(7, "watch_id"),
+					key:    string(create.bytes(1, "key")),
+					end:    string(create.bytes(2, "range_end")),
+					prevKV: create.bool(6, "prev_kv"),
+					events: make(chan []event, 16),
+				}
+				if wt.id == 0 {
+					wt.id = nextID
+					nextID++
+				}
+				watchers[wt.id] = wt
+				go func() {
+					for evs := range wt.events {
+						select {
+						case deliveries <- delivery{wt, evs}:
+						case <-r.Context().Done():
+							return
+						}
+					}
+				}()
+
+				c.detail = append(c.detail[:0], "watch "+describeRange(wt.key, wt.end))
+				record(r, c, "/etcdserverpb.Watch/Watch", "")
+
+				c.ks.mu.Lock()
+				header := c.header()
+				// start_revision 之后修改过的键作为历史事件补发
+				var replay []event
+				if start := create.int(3, "start_revision"); start > 0 {
+					for _, kv := range c.ks.rangeKeys(wt.key, wt.end) {
+						if kv.ModRevision >= start {
+							replay = append(replay, event{typ: eventPut, kv: kv})
+						}
+					}
+				}
+				c.ks.watchers[wt] = struct{}{}
+				c.ks.mu.Unlock()
+
+				writeMessage(w, (&message{}).set(1, "header", header).set(2, "watch_id", wt.id).set(3, "created", true))
+				if len(replay) > 0 {
+					writeMessage(w, watchResponse(c, wt, replay))
+				}
+			case req.message(2, "cancel_request") != nil:
+				id := req.message(2, "cancel_request").int(1, "watch_id")
+				if wt, ok := watchers[id]; ok {
+					c.ks.removeWatcher(wt)
+					delete(watchers, id)
+				}
+				c.ks.mu.Lock()
+				header := c.header()
+				c.ks.mu.Unlock()
+				writeMessage(w, (&message{}).set(1, "header", header).set(2, "watch_id", id).set(4, "canceled", true))
+			case req.message(3, "progress_request") != nil:
+				c.ks.mu.Lock()
+				header := c.header()
+				c.ks.mu.Unlock()
+				writeMessage(w, (&message{}).set(1, "header", header).set(2, "watch_id", int64(-1)))
+			}
+		case d := <-deliveries:
+			if watchers[d.w.id] != d.w {
+				continue
+			}
+			writeMessage(w, watchResponse(c, d.w, d.events))
+		}
+	}
+}
+
+func watchResponse(c *call, wt *watcher, events []event) *message {
+	c.ks.mu.Lock()
+	header := c.header()
+	c.ks.mu.Unlock()
+
+	var items []*message
+	for _, ev := range events {
+		item := (&message{}).set(1, "type", ev.typ).set(2, "kv", ev.kv.message(false))
+		if wt.prevKV && ev.prev != nil {
+			item.set(3, "prev_kv", ev.prev.message(false))
+		}
+		items = append(items, item)
+	}
+	return (&message{}).set(1, "header", header).set(2, "watch_id", wt.id).set(11, "events", items)
+}
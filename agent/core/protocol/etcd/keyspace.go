@@ -0,0 +1,396 @@
+package etcd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"KubePot/core/kube"
+)
+
+// 攻击者会话空闲超时时间和最大会话数，与 apiserver 蜜罐一致
+const (
+	sessionTTL  = time.Hour
+	maxSessions = 256
+)
+
+// 事件类型，对应 mvccpb.Event_EventType
+const (
+	eventPut    = 0
+	eventDelete = 1
+)
+
+// keyValue 对应 mvccpb.KeyValue
+type keyValue struct {
+	Key            string
+	Value          []byte
+	CreateRevision int64
+	ModRevision    int64
+	Version        int64
+	Lease          int64
+}
+
+func (kv *keyValue) message(keysOnly bool) *message {
+	m := &message{}
+	m.set(1, "key", []byte(kv.Key)).
+		set(2, "create_revision", kv.CreateRevision).
+		set(3, "mod_revision", kv.ModRevision).
+		set(4, "version", kv.Version)
+	if !keysOnly {
+		m.set(5, "value", kv.Value)
+	}
+	return m.set(6, "lease", kv.Lease)
+}
+
+type event struct {
+	typ  int64
+	kv   *keyValue
+	prev *keyValue
+}
+
+type lease struct {
+	id      int64
+	ttl     int64
+	granted time.Time
+	keys    map[string]struct{}
+}
+
+func (l *lease) remaining() int64 {
+	return l.ttl - int64(time.Since(l.granted).Seconds())
+}
+
+// watcher 一个 Watch 请求创建的监听
+type watcher struct {
+	id     int64
+	key    string
+	end    string
+	prevKV bool
+	events chan []event
+}
+
+// keyspace 单个攻击者看到的 etcd 数据，按 mvcc 的方式维护修订号
+type keyspace struct {
+	mu       sync.Mutex
+	revision int64
+	kvs      map[string]*keyValue
+	leases   map[int64]*lease
+	watchers map[*watcher]struct{}
+	// pending 事务中的写操作共用一个修订号
+	pending []event
+}
+
+func newKeyspace() *keyspace {
+	return &keyspace{
+		kvs:      make(map[string]*keyValue),
+		leases:   make(map[int64]*lease),
+		watchers: make(map[*watcher]struct{}),
+	}
+}
+
+func (s *keyspace) clone() *keyspace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := newKeyspace()
+	c.revision = s.revision
+	for k, kv := range s.kvs {
+		copied := *kv
+		c.kvs[k] = &copied
+	}
+	return c
+}
+
+// inRange 与 etcd 一致：end 为空时只匹配 key，end 为 \x00 时匹配 key 之后的所有键
+func inRange(k, key, end string) bool {
+	switch end {
+	case "":
+		return k == key
+	case "\x00":
+		return k >= key
+	}
+	return k >= key && k < end
+}
+
+// rangeKeys 返回范围内按键排序的键值，调用方持有锁
+func (s *keyspace) rangeKeys(key, end string) []*keyValue {
+	var out []*keyValue
+	if end == "" {
+		if kv, ok := s.kvs[key]; ok {
+			out = append(out, kv)
+		}
+		return out
+	}
+	for k, kv := range s.kvs {
+		if inRange(k, key, end) {
+			out = append(out, kv)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// expireLeases 删除已过期租约关联的键，调用方持有锁
+func (s *keyspace) expireLeases() {
+	var expired []*lease
+	for _, l := range s.leases {
+		if l.remaining() <= 0 {
+			expired = append(expired, l)
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	for _, l := range expired {
+		s.revokeLocked(l.id)
+	}
+	s.commit()
+}
+
+// put 写入键，调用方持有锁并在之后调用 commit
+func (s *keyspace) put(key string, value []byte, leaseID int64) (*keyValue, error) {
+	if leaseID != 0 {
+		if _, ok := s.leases[leaseID]; !ok {
+			return nil, errLeaseNotFound
+		}
+	}
+
+	rev := s.revision + 1
+	prev := s.kvs[key]
+	kv := &keyValue{Key: key, Value: value, CreateRevision: rev, ModRevision: rev, Version: 1, Lease: leaseID}
+	if prev != nil {
+		kv.CreateRevision = prev.CreateRevision
+		kv.Version = prev.Version + 1
+		if l, ok := s.leases[prev.Lease]; ok && prev.Lease != leaseID {
+			delete(l.keys, key)
+		}
+	}
+	if l, ok := s.leases[leaseID]; ok {
+		l.keys[key] = struct{}{}
+	}
+	s.kvs[key] = kv
+	s.pending = append(s.pending, event{typ: eventPut, kv: kv, prev: prev})
+	return prev, nil
+}
+
+// deleteRange 删除范围内的键，调用方持有锁并在之后调用 commit
+func (s *keyspace) deleteRange(key, end string) []*keyValue {
+	deleted := s.rangeKeys(key, end)
+	rev := s.revision + 1
+	for _, kv := range deleted {
+		delete(s.kvs, kv.Key)
+		if l, ok := s.leases[kv.Lease]; ok {
+			delete(l.keys, kv.Key)
+		}
+		s.pending = append(s.pending, event{typ: eventDelete, kv: &keyValue{Key: kv.Key, ModRevision: rev}, prev: kv})
+	}
+	return deleted
+}
+
+func (s *keyspace) revokeLocked(id int64) bool {
+	l, ok := s.leases[id]
+	if !ok {
+		return false
+	}
+	keys := make([]string, 0, len(l.keys))
+	for k := range l.keys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s.deleteRange(k, "")
+	}
+	delete(s.leases, id)
+	return true
+}
+
+// commit 提交待处理的写操作，修订号加一并通知监听者
+func (s *keyspace) commit() {
+	if len(s.pending) == 0 {
+		return
+	}
+	s.revision++
+	for w := range s.watchers {
+		var matched []event
+		for _, ev := range s.pending {
+			if inRange(ev.kv.Key, w.key, w.end) {
+				if !w.prevKV {
+					ev.prev = nil
+				}
+				matched = append(matched, ev)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		// 监听者处理不过来时丢弃事件，避免阻塞写操作
+		select {
+		case w.events <- matched:
+		default:
+		}
+	}
+	s.pending = nil
+}
+
+// grant 创建租约，id 为 0 时自动分配
+func (s *keyspace) grant(id, ttl int64) (*lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id == 0 {
+		id = time.Now().UnixNano() & 0x7fffffffffffffff
+		for s.leases[id] != nil {
+			id++
+		}
+	} else if s.leases[id] != nil {
+		return nil, errLeaseExist
+	}
+	// etcd 要求 TTL 至少为 electionTicks * heartbeat 的 1.5 倍
+	if ttl < 5 {
+		ttl = 5
+	}
+	l := &lease{id: id, ttl: ttl, granted: time.Now(), keys: make(map[string]struct{})}
+	s.leases[id] = l
+	return l, nil
+}
+
+func (s *keyspace) removeWatcher(w *watcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.watchers[w]; ok {
+		delete(s.watchers, w)
+		close(w.events)
+	}
+}
+
+var (
+	// baseKeyspace 由 MockEtcdData 和集群 fixture 初始化，所有会话从它复制
+	baseKeyspace = newKeyspace()
+
+	sessionMutex sync.Mutex
+	sessions     = make(map[string]*session)
+
+	seedOnce sync.Once
+)
+
+type session struct {
+	keyspace *keyspace
+	lastSeen time.Time
+}
+
+// forClient 返回攻击者专属的键空间，同一来源的写操作在会话内持续可见
+func forClient(clientIP string) *keyspace {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+
+	now := time.Now()
+	if s, ok := sessions[clientIP]; ok && now.Sub(s.lastSeen) < sessionTTL {
+		s.lastSeen = now
+		return s.keyspace
+	}
+
+	var oldest string
+	for ip, s := range sessions {
+		if now.Sub(s.lastSeen) >= sessionTTL {
+			delete(sessions, ip)
+		} else if oldest == "" || s.lastSeen.Before(sessions[oldest].lastSeen) {
+			oldest = ip
+		}
+	}
+	if len(sessions) >= maxSessions && oldest != "" {
+		delete(sessions, oldest)
+	}
+
+	s := &session{keyspace: baseKeyspace.clone(), lastSeen: now}
+	sessions[clientIP] = s
+	return s.keyspace
+}
+
+// registryPrefix 资源在 /registry 下的目录名，与 kube-apiserver 的存储路径一致
+func registryPrefix(res kube.Resource) string {
+	switch res.Name {
+	case "services":
+		return "services/specs"
+	case "nodes":
+		return "minions"
+	}
+	return res.Name
+}
+
+// seedKeyspace 把 MockEtcdData 和 apiserver 蜜罐的 fixture 以 protobuf 编码写入 /registry
+func seedKeyspace() {
+	seedOnce.Do(func() {
+		s := baseKeyspace
+		for _, entry := range MockEtcdData {
+			if entry.Dir {
+				continue
+			}
+			value := []byte(entry.Value)
+			if data, err := base64.StdEncoding.DecodeString(entry.Value); err == nil {
+				value = data
+				var obj kube.Object
+				if json.Unmarshal(data, &obj) == nil {
+					if encoded, err := encodeObject(obj); err == nil {
+						value = encoded
+					}
+				}
+			}
+			s.kvs[entry.Key] = &keyValue{
+				Key:            entry.Key,
+				Value:          value,
+				CreateRevision: entry.CreatedIndex,
+				ModRevision:    entry.ModifiedIndex,
+				Version:        1,
+			}
+			if entry.ModifiedIndex > s.revision {
+				s.revision = entry.ModifiedIndex
+			}
+		}
+
+		for _, res := range kube.Resources() {
+			for _, obj := range kube.Base().List(res, "", kube.Selector{}) {
+				key := "/registry/" + registryPrefix(res) + "/"
+				if res.Namespaced {
+					key += kube.Namespace(obj) + "/"
+				}
+				key += kube.Name(obj)
+
+				meta, _ := obj["metadata"].(map[string]interface{})
+				rv, _ := strconv.ParseInt(metaString(meta, "resourceVersion"), 10, 64)
+				value, err := encodeObject(obj)
+				if err != nil {
+					continue
+				}
+				s.kvs[key] = &keyValue{Key: key, Value: value, CreateRevision: rv, ModRevision: rv, Version: 1}
+				if rv > s.revision {
+					s.revision = rv
+				}
+			}
+		}
+	})
+}
+
+// encodeObject 与 apiserver 一样写入前清空 resourceVersion
+func encodeObject(obj kube.Object) ([]byte, error) {
+	if meta, ok := obj["metadata"].(map[string]interface{}); ok {
+		delete(meta, "resourceVersion")
+		delete(meta, "selfLink")
+	}
+	return kube.EncodeProtobuf(obj)
+}
+
+func metaString(meta map[string]interface{}, key string) string {
+	s, _ := meta[key].(string)
+	return s
+}
+
+// printable 判断值是否可以直接写入日志
+func printable(value []byte) bool {
+	return !bytes.ContainsFunc(value, func(r rune) bool {
+		return r < 0x20 && r != '\n' && r != '\t' && r != '\r'
+	}) && strings.ToValidUTF8(string(value), "") == string(value)
+}
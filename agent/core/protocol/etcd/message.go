@@ -0,0 +1,309 @@
+package etcd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// message 待返回的 etcdserverpb 消息，字段同时带 protobuf 编号和 grpc-gateway 使用的 JSON 名称
+type message struct {
+	fields []messageField
+}
+
+type messageField struct {
+	num   protowire.Number
+	name  string
+	value interface{}
+}
+
+// set 追加字段，与 proto3 一样零值不编码
+func (m *message) set(num protowire.Number, name string, value interface{}) *message {
+	switch v := value.(type) {
+	case int64:
+		if v == 0 {
+			return m
+		}
+	case uint64:
+		if v == 0 {
+			return m
+		}
+	case bool:
+		if !v {
+			return m
+		}
+	case string:
+		if v == "" {
+			return m
+		}
+	case []byte:
+		if len(v) == 0 {
+			return m
+		}
+	case *message:
+		if v == nil {
+			return m
+		}
+	case []*message:
+		if len(v) == 0 {
+			return m
+		}
+	case []string:
+		if len(v) == 0 {
+			return m
+		}
+	case [][]byte:
+		if len(v) == 0 {
+			return m
+		}
+	}
+	m.fields = append(m.fields, messageField{num, name, value})
+	return m
+}
+
+// Marshal 编码为 protobuf
+func (m *message) Marshal() []byte {
+	var b []byte
+	for _, f := range m.fields {
+		switch v := f.value.(type) {
+		case int64:
+			b = protowire.AppendTag(b, f.num, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(v))
+		case uint64:
+			b = protowire.AppendTag(b, f.num, protowire.VarintType)
+			b = protowire.AppendVarint(b, v)
+		case bool:
+			b = protowire.AppendTag(b, f.num, protowire.VarintType)
+			b = protowire.AppendVarint(b, protowire.EncodeBool(v))
+		case string:
+			b = protowire.AppendTag(b, f.num, protowire.BytesType)
+			b = protowire.AppendString(b, v)
+		case []byte:
+			b = protowire.AppendTag(b, f.num, protowire.BytesType)
+			b = protowire.AppendBytes(b, v)
+		case *message:
+			b = protowire.AppendTag(b, f.num, protowire.BytesType)
+			b = protowire.AppendBytes(b, v.Marshal())
+		case []*message:
+			for _, item := range v {
+				b = protowire.AppendTag(b, f.num, protowire.BytesType)
+				b = protowire.AppendBytes(b, item.Marshal())
+			}
+		case []string:
+			for _, item := range v {
+				b = protowire.AppendTag(b, f.num, protowire.BytesType)
+				b = protowire.AppendString(b, item)
+			}
+		case [][]byte:
+			for _, item := range v {
+				b = protowire.AppendTag(b, f.num, protowire.BytesType)
+				b = protowire.AppendBytes(b, item)
+			}
+		}
+	}
+	return b
+}
+
+// MarshalJSON 按 grpc-gateway 的规则编码：64 位整数为字符串，bytes 为 base64
+func (m *message) MarshalJSON() ([]byte, error) {
+	obj := make(map[string]interface{}, len(m.fields))
+	for _, f := range m.fields {
+		switch v := f.value.(type) {
+		case int64:
+			obj[f.name] = strconv.FormatInt(v, 10)
+		case uint64:
+			obj[f.name] = strconv.FormatUint(v, 10)
+		case []byte:
+			obj[f.name] = base64.StdEncoding.EncodeToString(v)
+		case [][]byte:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, base64.StdEncoding.EncodeToString(item))
+			}
+			obj[f.name] = items
+		default:
+			obj[f.name] = v
+		}
+	}
+	return json.Marshal(obj)
+}
+
+// request 解码后的请求消息，可能来自 gRPC 的 protobuf 或 JSON 网关
+type request struct {
+	proto map[protowire.Number][]interface{}
+	json  map[string]interface{}
+}
+
+var errMalformed = errors.New("grpc: failed to unmarshal the received message")
+
+// decodeProto 解码 protobuf，字段值为 uint64 或 []byte
+func decodeProto(b []byte) (*request, error) {
+	req := &request{proto: make(map[protowire.Number][]interface{})}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, errMalformed
+		}
+		b = b[n:]
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, errMalformed
+			}
+			req.proto[num] = append(req.proto[num], v)
+			b = b[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, errMalformed
+			}
+			req.proto[num] = append(req.proto[num], v)
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, errMalformed
+			}
+			b = b[n:]
+		}
+	}
+	return req, nil
+}
+
+// decodeJSON 解码 JSON 网关的请求体
+func decodeJSON(b []byte) (*request, error) {
+	req := &request{json: map[string]interface{}{}}
+	if len(b) == 0 {
+		return req, nil
+	}
+	if err := json.Unmarshal(b, &req.json); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (r *request) last(num protowire.Number, name string) (interface{}, bool) {
+	if r == nil {
+		return nil, false
+	}
+	if r.json != nil {
+		v, ok := r.json[name]
+		return v, ok && v != nil
+	}
+	values := r.proto[num]
+	if len(values) == 0 {
+		return nil, false
+	}
+	return values[len(values)-1], true
+}
+
+func (r *request) bytes(num protowire.Number, name string) []byte {
+	v, _ := r.last(num, name)
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		data, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return []byte(v)
+		}
+		return data
+	}
+	return nil
+}
+
+func (r *request) string(num protowire.Number, name string) string {
+	v, _ := r.last(num, name)
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	}
+	return ""
+}
+
+func (r *request) int(num protowire.Number, name string) int64 {
+	v, _ := r.last(num, name)
+	switch v := v.(type) {
+	case uint64:
+		return int64(v)
+	case float64:
+		return int64(v)
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
+
+// enum 读取枚举字段，JSON 中可以是名称或数字
+func (r *request) enum(num protowire.Number, name string, names []string) int64 {
+	if v, ok := r.last(num, name); ok {
+		if s, ok := v.(string); ok {
+			for i, n := range names {
+				if n == s {
+					return int64(i)
+				}
+			}
+		}
+	}
+	return r.int(num, name)
+}
+
+func (r *request) bool(num protowire.Number, name string) bool {
+	v, _ := r.last(num, name)
+	switch v := v.(type) {
+	case uint64:
+		return v != 0
+	case bool:
+		return v
+	}
+	return false
+}
+
+// message 读取嵌套消息，不存在时返回 nil
+func (r *request) message(num protowire.Number, name string) *request {
+	if v, ok := r.last(num, name); ok {
+		return toRequest(v)
+	}
+	return nil
+}
+
+// messages 读取重复的嵌套消息
+func (r *request) messages(num protowire.Number, name string) []*request {
+	if r == nil {
+		return nil
+	}
+	var values []interface{}
+	if r.json != nil {
+		values, _ = r.json[name].([]interface{})
+	} else {
+		values = r.proto[num]
+	}
+	var out []*request
+	for _, v := range values {
+		if req := toRequest(v); req != nil {
+			out = append(out, req)
+		}
+	}
+	return out
+}
+
+func toRequest(v interface{}) *request {
+	switch v := v.(type) {
+	case []byte:
+		req, err := decodeProto(v)
+		if err != nil {
+			return nil
+		}
+		return req
+	case map[string]interface{}:
+		return &request{json: v}
+	}
+	return nil
+}
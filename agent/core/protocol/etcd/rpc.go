@@ -0,0 +1,612 @@
+package etcd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"KubePot/core/honeytoken"
+)
+
+// 模拟集群的标识，member_id 与 EtcdMembers 中第一个成员一致
+const (
+	clusterID   uint64 = 0xcdf818194e3a8c32
+	raftTerm    uint64 = 7
+	etcdVersion        = "3.5.0"
+)
+
+// gRPC 状态码
+const (
+	codeInvalidArgument    = 3
+	codeNotFound           = 5
+	codeFailedPrecondition = 9
+	codeOutOfRange         = 11
+	codeUnimplemented      = 12
+)
+
+// rpcError 与 etcdserver/api/v3rpc/rpctypes 中的错误一致
+type rpcError struct {
+	code    int
+	message string
+}
+
+func (e *rpcError) Error() string {
+	return e.message
+}
+
+var (
+	errLeaseNotFound   = &rpcError{codeNotFound, "etcdserver: requested lease not found"}
+	errLeaseExist      = &rpcError{codeFailedPrecondition, "etcdserver: lease already exists"}
+	errEmptyKey        = &rpcError{codeInvalidArgument, "etcdserver: key is not provided"}
+	errFutureRevision  = &rpcError{codeOutOfRange, "etcdserver: mvcc: required revision is a future revision"}
+	errTooManyOps      = &rpcError{codeInvalidArgument, "etcdserver: too many operations in txn request"}
+	errInvalidAuthUser = &rpcError{codeInvalidArgument, "etcdserver: authentication failed, invalid user ID or password"}
+)
+
+// 单个事务的操作数上限，与 etcd 默认的 --max-txn-ops 一致
+const maxTxnOps = 128
+
+// call 一次 RPC 调用，reads/writes 记录攻击者读取和写入的键
+type call struct {
+	ks     *keyspace
+	reads  []string
+	writes []string
+	detail []string
+}
+
+type unaryHandler func(c *call, req *request) (*message, error)
+
+// unaryMethods gRPC 方法名到处理函数，JSON 网关按路径映射到同样的方法
+var unaryMethods = map[string]unaryHandler{
+	"/etcdserverpb.KV/Range":              (*call).rangeKV,
+	"/etcdserverpb.KV/Put":                (*call).put,
+	"/etcdserverpb.KV/DeleteRange":        (*call).deleteRange,
+	"/etcdserverpb.KV/Txn":                (*call).txn,
+	"/etcdserverpb.KV/Compact":            (*call).compact,
+	"/etcdserverpb.Lease/LeaseGrant":      (*call).leaseGrant,
+	"/etcdserverpb.Lease/LeaseRevoke":     (*call).leaseRevoke,
+	"/etcdserverpb.Lease/LeaseTimeToLive": (*call).leaseTimeToLive,
+	"/etcdserverpb.Lease/LeaseLeases":     (*call).leaseLeases,
+	"/etcdserverpb.Auth/Authenticate":     (*call).authenticate,
+	"/etcdserverpb.Auth/AuthStatus":       (*call).authStatus,
+	"/etcdserverpb.Maintenance/Status":    (*call).status,
+	"/etcdserverpb.Maintenance/Alarm":     (*call).alarm,
+	"/etcdserverpb.Cluster/MemberList":    (*call).memberList,
+	"/etcdserverpb.Auth/UserList":         (*call).userList,
+	"/etcdserverpb.Maintenance/HashKV":    (*call).hashKV,
+}
+
+// header 对应 etcdserverpb.ResponseHeader，调用方持有锁
+func (c *call) header() *message {
+	return (&message{}).
+		set(1, "cluster_id", clusterID).
+		set(2, "member_id", memberID(0)).
+		set(3, "revision", c.ks.revision).
+		set(4, "raft_term", raftTerm)
+}
+
+func (c *call) lock() {
+	c.ks.mu.Lock()
+	c.ks.expireLeases()
+}
+
+func (c *call) unlock() {
+	c.ks.mu.Unlock()
+}
+
+// 排序字段的名称，对应 RangeRequest_SortOrder 和 RangeRequest_SortTarget
+var (
+	sortOrders  = []string{"NONE", "ASCEND", "DESCEND"}
+	sortTargets = []string{"KEY", "VERSION", "CREATE", "MOD", "VALUE"}
+)
+
+func (c *call) rangeKV(req *request) (*message, error) {
+	c.lock()
+	defer c.unlock()
+	return c.rangeLocked(req)
+}
+
+func (c *call) rangeLocked(req *request) (*message, error) {
+	key, end := string(req.bytes(1, "key")), string(req.bytes(2, "range_end"))
+	limit := req.int(3, "limit")
+	if rev := req.int(4, "revision"); rev > c.ks.revision {
+		return nil, errFutureRevision
+	}
+	keysOnly, countOnly := req.bool(8, "keys_only"), req.bool(9, "count_only")
+
+	kvs := c.ks.rangeKeys(key, end)
+	var filtered []*keyValue
+	for _, kv := range kvs {
+		if min := req.int(10, "min_mod_revision"); min > 0 && kv.ModRevision < min {
+			continue
+		}
+		if max := req.int(11, "max_mod_revision"); max > 0 && kv.ModRevision > max {
+			continue
+		}
+		if min := req.int(12, "min_create_revision"); min > 0 && kv.CreateRevision < min {
+			continue
+		}
+		if max := req.int(13, "max_create_revision"); max > 0 && kv.CreateRevision > max {
+			continue
+		}
+		filtered = append(filtered, kv)
+	}
+	sortKeyValues(filtered, req.enum(5, "sort_order", sortOrders), req.enum(6, "sort_target", sortTargets))
+
+	count := int64(len(filtered))
+	more := false
+	if limit > 0 && int64(len(filtered)) > limit {
+		filtered = filtered[:limit]
+		more = true
+	}
+
+	c.detail = append(c.detail, "range "+describeRange(key, end))
+	resp := (&message{}).set(1, "header", c.header())
+	if !countOnly {
+		items := make([]*message, 0, len(filtered))
+		for _, kv := range filtered {
+			c.reads = append(c.reads, kv.Key)
+			items = append(items, kv.message(keysOnly))
+		}
+		resp.set(2, "kvs", items)
+	}
+	return resp.set(3, "more", more).set(4, "count", count), nil
+}
+
+func sortKeyValues(kvs []*keyValue, order, target int64) {
+	if order == 0 {
+		return
+	}
+	less := func(a, b *keyValue) bool {
+		switch target {
+		case 1:
+			return a.Version < b.Version
+		case 2:
+			return a.CreateRevision < b.CreateRevision
+		case 3:
+			return a.ModRevision < b.ModRevision
+		case 4:
+			return bytes.Compare(a.Value, b.Value) < 0
+		}
+		return a.Key < b.Key
+	}
+	sort.SliceStable(kvs, func(i, j int) bool {
+		if order == 2 {
+			return less(kvs[j], kvs[i])
+		}
+		return less(kvs[i], kvs[j])
+	})
+}
+
+func (c *call) put(req *request) (*message, error) {
+	c.lock()
+	defer c.unlock()
+	resp, err := c.putLocked(req)
+	c.ks.commit()
+	if resp != nil {
+		resp.fields = append([]messageField{{1, "header", c.header()}}, resp.fields...)
+	}
+	return resp, err
+}
+
+// putLocked 返回不带 header 的 PutResponse，事务中由调用方统一提交
+func (c *call) putLocked(req *request) (*message, error) {
+	key := string(req.bytes(1, "key"))
+	if key == "" {
+		return nil, errEmptyKey
+	}
+	value, leaseID := req.bytes(2, "value"), req.int(3, "lease")
+	current := c.ks.kvs[key]
+	if req.bool(5, "ignore_value") && current != nil {
+		value = current.Value
+	}
+	if req.bool(6, "ignore_lease") && current != nil {
+		leaseID = current.Lease
+	}
+
+	prev, err := c.ks.put(key, value, leaseID)
+	if err != nil {
+		return nil, err
+	}
+	c.writes = append(c.writes, key)
+	c.detail = append(c.detail, "put "+key+" = "+describeValue(value))
+
+	resp := &message{}
+	if prev != nil && req.bool(4, "prev_kv") {
+		resp.set(2, "prev_kv", prev.message(false))
+	}
+	return resp, nil
+}
+
+func (c *call) deleteRange(req *request) (*message, error) {
+	c.lock()
+	defer c.unlock()
+	resp := c.deleteLocked(req)
+	c.ks.commit()
+	resp.fields = append([]messageField{{1, "header", c.header()}}, resp.fields...)
+	return resp, nil
+}
+
+func (c *call) deleteLocked(req *request) *message {
+	key, end := string(req.bytes(1, "key")), string(req.bytes(2, "range_end"))
+	deleted := c.ks.deleteRange(key, end)
+	c.detail = append(c.detail, "delete "+describeRange(key, end))
+
+	resp := (&message{}).set(2, "deleted", int64(len(deleted)))
+	var prevKVs []*message
+	for _, kv := range deleted {
+		c.writes = append(c.writes, kv.Key)
+		if req.bool(3, "prev_kv") {
+			prevKVs = append(prevKVs, kv.message(false))
+		}
+	}
+	return resp.set(3, "prev_kvs", prevKVs)
+}
+
+// 比较操作的名称，对应 Compare_CompareResult 和 Compare_CompareTarget
+var (
+	compareResults = []string{"EQUAL", "GREATER", "LESS", "NOT_EQUAL"}
+	compareTargets = []string{"VERSION", "CREATE", "MOD", "VALUE", "LEASE"}
+)
+
+func (c *call) txn(req *request) (*message, error) {
+	c.lock()
+	defer c.unlock()
+	resp, err := c.txnLocked(req)
+	c.ks.commit()
+	if err != nil {
+		return nil, err
+	}
+	resp.fields = append([]messageField{{1, "header", c.header()}}, resp.fields...)
+	return resp, nil
+}
+
+func (c *call) txnLocked(req *request) (*message, error) {
+	compares := req.messages(1, "compare")
+	success, failure := req.messages(2, "success"), req.messages(3, "failure")
+	if len(compares) > maxTxnOps || len(success) > maxTxnOps || len(failure) > maxTxnOps {
+		return nil, errTooManyOps
+	}
+
+	succeeded := true
+	for _, cmp := range compares {
+		if !c.compare(cmp) {
+			succeeded = false
+			break
+		}
+	}
+	ops := failure
+	if succeeded {
+		ops = success
+	}
+
+	var responses []*message
+	for _, op := range ops {
+		var resp *message
+		switch {
+		case op.message(1, "request_range") != nil:
+			r, err := c.rangeLocked(op.message(1, "request_range"))
+			if err != nil {
+				return nil, err
+			}
+			resp = (&message{}).set(1, "response_range", r)
+		case op.message(2, "request_put") != nil:
+			r, err := c.putLocked(op.message(2, "request_put"))
+			if err != nil {
+				return nil, err
+			}
+			resp = (&message{}).set(2, "response_put", r)
+		case op.message(3, "request_delete_range") != nil:
+			resp = (&message{}).set(3, "response_delete_range", c.deleteLocked(op.message(3, "request_delete_range")))
+		case op.message(4, "request_txn") != nil:
+			r, err := c.txnLocked(op.message(4, "request_txn"))
+			if err != nil {
+				return nil, err
+			}
+			resp = (&message{}).set(4, "response_txn", r)
+		default:
+			continue
+		}
+		responses = append(responses, resp)
+	}
+	return (&message{}).set(2, "succeeded", succeeded).set(3, "responses", responses), nil
+}
+
+// compare 判断事务条件，range_end 不为空时范围内所有键都要满足
+func (c *call) compare(cmp *request) bool {
+	key, end := string(cmp.bytes(3, "key")), string(cmp.bytes(64, "range_end"))
+	result, target := cmp.enum(1, "result", compareResults), cmp.enum(2, "target", compareTargets)
+	c.reads = append(c.reads, key)
+
+	kvs := c.ks.rangeKeys(key, end)
+	if len(kvs) == 0 {
+		kvs = []*keyValue{{Key: key}}
+	}
+	for _, kv := range kvs {
+		var diff int
+		switch target {
+		case 0:
+			diff = compareInt(kv.Version, cmp.int(4, "version"))
+		case 1:
+			diff = compareInt(kv.CreateRevision, cmp.int(5, "create_revision"))
+		case 2:
+			diff = compareInt(kv.ModRevision, cmp.int(6, "mod_revision"))
+		case 3:
+			diff = bytes.Compare(kv.Value, cmp.bytes(7, "value"))
+		case 4:
+			diff = compareInt(kv.Lease, cmp.int(8, "lease"))
+		}
+		ok := false
+		switch result {
+		case 0:
+			ok = diff == 0
+		case 1:
+			ok = diff > 0
+		case 2:
+			ok = diff < 0
+		case 3:
+			ok = diff != 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (c *call) compact(req *request) (*message, error) {
+	c.lock()
+	defer c.unlock()
+	if rev := req.int(1, "revision"); rev > c.ks.revision {
+		return nil, errFutureRevision
+	}
+	c.detail = append(c.detail, fmt.Sprintf("compact %d", req.int(1, "revision")))
+	return (&message{}).set(1, "header", c.header()), nil
+}
+
+func (c *call) leaseGrant(req *request) (*message, error) {
+	l, err := c.ks.grant(req.int(2, "ID"), req.int(1, "TTL"))
+	if err != nil {
+		return nil, err
+	}
+	c.lock()
+	defer c.unlock()
+	c.detail = append(c.detail, fmt.Sprintf("lease grant %x ttl %d", l.id, l.ttl))
+	return (&message{}).
+		set(1, "header", c.header()).
+		set(2, "ID", l.id).
+		set(3, "TTL", l.ttl), nil
+}
+
+func (c *call) leaseRevoke(req *request) (*message, error) {
+	c.lock()
+	defer c.unlock()
+	id := req.int(1, "ID")
+	if !c.ks.revokeLocked(id) {
+		return nil, errLeaseNotFound
+	}
+	c.ks.commit()
+	c.detail = append(c.detail, fmt.Sprintf("lease revoke %x", id))
+	return (&message{}).set(1, "header", c.header()), nil
+}
+
+// keepAlive 续约，租约不存在时与 etcd 一样返回 TTL 0
+func (c *call) keepAlive(req *request) *message {
+	c.lock()
+	defer c.unlock()
+	id := req.int(1, "ID")
+	var ttl int64
+	if l, ok := c.ks.leases[id]; ok {
+		l.granted = time.Now()
+		ttl = l.ttl
+	}
+	return (&message{}).
+		set(1, "header", c.header()).
+		set(2, "ID", id).
+		set(3, "TTL", ttl)
+}
+
+func (c *call) leaseTimeToLive(req *request) (*message, error) {
+	c.lock()
+	defer c.unlock()
+	id := req.int(1, "ID")
+	resp := (&message{}).set(1, "header", c.header()).set(2, "ID", id)
+	l, ok := c.ks.leases[id]
+	if !ok {
+		return resp.set(3, "TTL", int64(-1)), nil
+	}
+	resp.set(3, "TTL", l.remaining()).set(4, "grantedTTL", l.ttl)
+	if req.bool(2, "keys") {
+		var keys []string
+		for k := range l.keys {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		items := make([][]byte, 0, len(keys))
+		for _, k := range keys {
+			items = append(items, []byte(k))
+		}
+		resp.set(5, "keys", items)
+	}
+	return resp, nil
+}
+
+func (c *call) leaseLeases(req *request) (*message, error) {
+	c.lock()
+	defer c.unlock()
+	ids := make([]int64, 0, len(c.ks.leases))
+	for id := range c.ks.leases {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var leases []*message
+	for _, id := range ids {
+		leases = append(leases, (&message{}).set(1, "ID", id))
+	}
+	return (&message{}).set(1, "header", c.header()).set(2, "leases", leases), nil
+}
+
+// authenticate 记录攻击者提交的用户名和密码，任何凭据都签发令牌以便继续观察
+func (c *call) authenticate(req *request) (*message, error) {
+	name, password := req.string(1, "name"), req.string(2, "password")
+	c.detail = append(c.detail, fmt.Sprintf("authenticate user %q password %q", name, password))
+	if label, ok := honeytoken.MatchPassword(password); ok {
+		c.detail = append(c.detail, fmt.Sprintf("Honeytoken: %d (%s)", label.ID, label.Name))
+	}
+	if name == "" {
+		return nil, errInvalidAuthUser
+	}
+
+	c.lock()
+	defer c.unlock()
+	token := make([]byte, 8)
+	rand.Read(token)
+	return (&message{}).
+		set(1, "header", c.header()).
+		set(2, "token", hex.EncodeToString(token)+"."+strconv.FormatInt(c.ks.revision, 10)), nil
+}
+
+func (c *call) authStatus(req *request) (*message, error) {
+	c.lock()
+	defer c.unlock()
+	return (&message{}).set(1, "header", c.header()).set(3, "authRevision", uint64(1)), nil
+}
+
+func (c *call) userList(req *request) (*message, error) {
+	c.lock()
+	defer c.unlock()
+	return (&message{}).set(1, "header", c.header()).set(2, "users", []string{"root"}), nil
+}
+
+func (c *call) status(req *request) (*message, error) {
+	c.lock()
+	defer c.unlock()
+	var size int64
+	for _, kv := range c.ks.kvs {
+		size += int64(len(kv.Key) + len(kv.Value))
+	}
+	dbSize := (size/4096 + 1) * 4096 * 6
+	return (&message{}).
+		set(1, "header", c.header()).
+		set(2, "version", etcdVersion).
+		set(3, "dbSize", dbSize).
+		set(4, "leader", memberID(0)).
+		set(5, "raftIndex", uint64(c.ks.revision)+1024).
+		set(6, "raftTerm", raftTerm).
+		set(7, "raftAppliedIndex", uint64(c.ks.revision)+1024).
+		set(9, "dbSizeInUse", dbSize/2), nil
+}
+
+func (c *call) alarm(req *request) (*message, error) {
+	c.lock()
+	defer c.unlock()
+	return (&message{}).set(1, "header", c.header()), nil
+}
+
+func (c *call) hashKV(req *request) (*message, error) {
+	c.lock()
+	defer c.unlock()
+	keys := make([]string, 0, len(c.ks.kvs))
+	for k := range c.ks.kvs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var hash uint32 = 2166136261
+	for _, k := range keys {
+		for _, b := range append([]byte(k), c.ks.kvs[k].Value...) {
+			hash ^= uint32(b)
+			hash *= 16777619
+		}
+	}
+	return (&message{}).
+		set(1, "header", c.header()).
+		set(2, "hash", uint64(hash)).
+		set(3, "compact_revision", int64(1)), nil
+}
+
+func (c *call) memberList(req *request) (*message, error) {
+	c.lock()
+	defer c.unlock()
+	members, _ := EtcdMembers["members"].([]interface{})
+	var items []*message
+	for i, item := range members {
+		m, _ := item.(map[string]interface{})
+		name, _ := m["name"].(string)
+		peerURLs, _ := m["peerURLs"].([]string)
+		clientURLs, _ := m["clientURLs"].([]string)
+		items = append(items, (&message{}).
+			set(1, "ID", memberID(i)).
+			set(2, "name", name).
+			set(3, "peerURLs", peerURLs).
+			set(4, "clientURLs", clientURLs))
+	}
+	return (&message{}).set(1, "header", c.header()).set(2, "members", items), nil
+}
+
+// memberID 解析 EtcdMembers 中第 i 个成员的十六进制 ID
+func memberID(i int) uint64 {
+	members, _ := EtcdMembers["members"].([]interface{})
+	if i >= len(members) {
+		return 0
+	}
+	m, _ := members[i].(map[string]interface{})
+	id, _ := m["ID"].(string)
+	n, _ := strconv.ParseUint(id, 16, 64)
+	return n
+}
+
+// describeRange 按 etcdctl 的习惯描述键范围
+func describeRange(key, end string) string {
+	switch {
+	case end == "":
+		return key
+	case end == "\x00":
+		return key + " (from key)"
+	case end == prefixEnd(key):
+		return key + " (prefix)"
+	}
+	return key + " .. " + end
+}
+
+// prefixEnd 与 clientv3.GetPrefixRangeEnd 一致
+func prefixEnd(key string) string {
+	end := []byte(key)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return "\x00"
+}
+
+// describeValue 可打印的值原样记录，否则记录长度和十六进制前缀
+func describeValue(value []byte) string {
+	const max = 1024
+	if printable(value) {
+		if len(value) > max {
+			return strconv.Quote(string(value[:max])) + "..."
+		}
+		return strconv.Quote(string(value))
+	}
+	prefix := value
+	if len(prefix) > 64 {
+		prefix = prefix[:64]
+	}
+	return fmt.Sprintf("(%d bytes) %s", len(value), strings.ToUpper(hex.EncodeToString(prefix)))
+}
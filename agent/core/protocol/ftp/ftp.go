@@ -1,9 +1,11 @@
 package ftp
 
 import (
+	"KubePot/core/health"
 	"KubePot/core/protocol/ftp/graval"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"strconv"
 	"strings"
@@ -114,7 +116,15 @@ func Start(addr string) {
 	factory := &MemDriverFactory{}
 	ftpServer := graval.NewFTPServer(&graval.FTPServerOpts{Factory: factory, Hostname: arr[0], Port: port})
 
-	err := ftpServer.ListenAndServe()
+	laddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err == nil {
+		var listener *net.TCPListener
+		if listener, err = net.ListenTCP("tcp", laddr); err == nil {
+			health.Listening("ftp")
+			err = ftpServer.Serve(listener)
+		}
+	}
+	health.Failed("ftp", err)
 	if err != nil {
 		fmt.Print(err)
 	}
@@ -1,9 +1,11 @@
 package graval
 
 import (
+	"KubePot/core/event"
 	"KubePot/core/pool"
 	"KubePot/core/report"
 	"KubePot/core/rpc/client"
+	"KubePot/core/session"
 	"KubePot/utils/is"
 	"fmt"
 	"github.com/jehiah/go-strftime"
@@ -342,7 +344,9 @@ func (cmd commandPass) Execute(conn *ftpConn, param string) {
 
 		// 判断是否为 RPC 客户端
 		if is.Rpc() {
-			go client.ReportResult("FTP", "", arr[0], info, "0")
+			ev := session.FromConn("FTP", event.KindAuth, conn.conn)
+			ev.Credentials = &event.Credentials{Username: conn.reqUser, Password: param}
+			go client.ReportResult("", ev, "0")
 		} else {
 			go report.ReportFTP(arr[0], "本机", info)
 		}
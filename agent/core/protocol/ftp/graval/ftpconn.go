@@ -18,7 +18,7 @@ const (
 )
 
 type ftpConn struct {
-	conn          *net.TCPConn
+	conn          net.Conn
 	controlReader *bufio.Reader
 	controlWriter *bufio.Writer
 	dataConn      ftpDataSocket
@@ -35,7 +35,7 @@ type ftpConn struct {
 // an active net.TCPConn. The TCP connection should already be open before
 // it is handed to this functions. driver is an instance of FTPDriver that
 // will handle all auth and persistence details.
-func newftpConn(tcpConn *net.TCPConn, driver FTPDriver) *ftpConn {
+func newftpConn(tcpConn net.Conn, driver FTPDriver) *ftpConn {
 	c := new(ftpConn)
 	c.namePrefix = "/"
 	c.conn = tcpConn
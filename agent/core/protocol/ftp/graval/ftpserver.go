@@ -9,6 +9,7 @@
 package graval
 
 import (
+	"KubePot/core/session"
 	"net"
 	"strconv"
 	"strings"
@@ -104,6 +105,12 @@ func (ftpServer *FTPServer) ListenAndServe() error {
 	if err != nil {
 		return err
 	}
+	return ftpServer.Serve(listener)
+}
+
+// Serve accepts client connections on an already opened listener, so callers
+// can tell a bind failure apart from the server stopping.
+func (ftpServer *FTPServer) Serve(listener *net.TCPListener) error {
 	for {
 		tcpConn, err := listener.AcceptTCP()
 		if err != nil {
@@ -115,7 +122,7 @@ func (ftpServer *FTPServer) ListenAndServe() error {
 		if err != nil {
 			ftpServer.logger.Print("Error creating driver, aborting client connection")
 		} else {
-			ftpConn := newftpConn(tcpConn, driver)
+			ftpConn := newftpConn(session.Wrap(tcpConn, "FTP", ""), driver)
 			go ftpConn.Serve()
 		}
 	}
@@ -1,11 +1,15 @@
 package httpx
 
 import (
+	"KubePot/core/event"
+	"KubePot/core/health"
 	"KubePot/core/report"
 	"KubePot/core/rpc/client"
+	"KubePot/core/session"
 	"KubePot/utils/is"
 	"context"
 	"github.com/elazarl/goproxy"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -32,7 +36,10 @@ func Start(address string) {
 
 			// 判断是否为 RPC 客户端
 			if is.Rpc() {
-				go client.ReportResult("HTTP", "HTTP代理蜜罐", arr[0], info, "0")
+				ev := session.FromRequest(r, "HTTP", "HTTP代理蜜罐").Request(event.KindRequest, r)
+				// 代理请求记录完整的目标 URL
+				ev.Request.URI = r.URL.String()
+				go client.ReportResult("HTTP代理蜜罐", ev, "0")
 			} else {
 				go report.ReportHttp("HTTP代理蜜罐", "本机", arr[0], info)
 			}
@@ -49,14 +56,24 @@ func Start(address string) {
 
 	// 创建HTTP服务器
 	server = &http.Server{
-		Addr:    address,
-		Handler: proxy,
+		Addr:        address,
+		Handler:     proxy,
+		ConnContext: session.ConnContext,
 	}
 
-	// 启动服务器
+	// 启动服务器，每个连接创建一个会话
+	netListen, err := net.Listen("tcp", address)
+	if err != nil {
+		println("服务器启动失败:", err)
+		health.Failed("http", err)
+		server = nil
+		return
+	}
+	health.Listening("http")
 	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := server.Serve(session.Listen(netListen, "HTTP", "HTTP代理蜜罐")); err != nil && err != http.ErrServerClosed {
 			println("服务器启动失败:", err)
+			health.Failed("http", err)
 		}
 	}()
 }
@@ -0,0 +1,143 @@
+package kubelet
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"KubePot/core/event"
+	"KubePot/core/kube"
+	"KubePot/core/kube/stream"
+	"KubePot/core/rpc/client"
+	"KubePot/utils/is"
+	"KubePot/utils/log"
+)
+
+var podResource, _ = kube.LookupResource("", "v1", "pods")
+
+// parseContainerPath 解析 /{action}/{ns}/{pod}/[{uid}/]{container} 和 /portforward/{ns}/{pod}[/{uid}] 形式的路径
+func parseContainerPath(path string) (action, namespace, pod, container string, ok bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 3 {
+		return "", "", "", "", false
+	}
+	action, namespace, pod = parts[0], parts[1], parts[2]
+	switch action {
+	case "exec", "attach", "run", "containerLogs":
+		switch len(parts) {
+		case 4:
+			container = parts[3]
+		case 5:
+			container = parts[4]
+		default:
+			return "", "", "", "", false
+		}
+	case "portforward":
+		if len(parts) > 4 {
+			return "", "", "", "", false
+		}
+	default:
+		return "", "", "", "", false
+	}
+	return action, namespace, pod, container, true
+}
+
+// reporter 返回记录并上报会话内容的回调
+func (s *server) reporter(r *http.Request, clientIP, action string) stream.Reporter {
+	return func(kind event.Kind, command string, detail string) {
+		ev := s.newEvent(r, kind)
+		ev.Command, ev.Detail = command, detail
+		log.Pr("Kubelet", clientIP, action, ev.Summary())
+		if is.Rpc() {
+			go client.ReportResult(s.name, ev, "")
+		}
+	}
+}
+
+// serveStream 处理 exec、attach 和 portforward 接口，非流式路径返回 false
+func (s *server) serveStream(w http.ResponseWriter, r *http.Request, store *kube.Store, clientIP string) bool {
+	action, namespace, podName, container, ok := parseContainerPath(r.URL.Path)
+	if !ok || action == "run" || action == "containerLogs" {
+		return false
+	}
+
+	if !stream.IsUpgrade(r) {
+		http.Error(w, fmt.Sprintf("unable to upgrade: missing upgrade headers in request: %#v", r.Header), http.StatusBadRequest)
+		return true
+	}
+
+	pod, err := store.Get(podResource, namespace, podName)
+	if err != nil {
+		http.Error(w, "pod does not exist", http.StatusNotFound)
+		return true
+	}
+
+	opts := stream.ParseOptions(r.URL.Query())
+	target, err := stream.NewTarget(store, pod, container)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("container not found (%q)", container), http.StatusNotFound)
+		return true
+	}
+
+	log.Pr("Kubelet", clientIP, "建立流连接", fmt.Sprintf("%s %s/%s %s", action, namespace, podName, target.Container.Name))
+
+	report := s.reporter(r, clientIP, action)
+	switch action {
+	case "exec":
+		err = stream.Exec(w, r, target, opts, report)
+	case "attach":
+		err = stream.Attach(w, r, target, opts, report)
+	case "portforward":
+		err = stream.PortForward(w, r, target, report)
+	}
+	if statusErr, ok := err.(*kube.StatusError); ok {
+		http.Error(w, statusErr.Message, statusErr.Code)
+	} else if err != nil {
+		log.Pr("Kubelet", clientIP, "流连接升级失败", err)
+	}
+	return true
+}
+
+// serveRun 处理 POST /run/{ns}/{pod}/{container}，与 kubelet 一样按空白拆分 cmd 参数后直接执行，不经过 shell
+func (s *server) serveRun(w http.ResponseWriter, r *http.Request, store *kube.Store, clientIP string) {
+	_, namespace, podName, container, ok := parseContainerPath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "405: Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pod, err := store.Get(podResource, namespace, podName)
+	if err != nil {
+		http.Error(w, "pod does not exist", http.StatusNotFound)
+		return
+	}
+	target, err := stream.NewTarget(store, pod, container)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("container not found (%q)", container), http.StatusNotFound)
+		return
+	}
+
+	args := strings.Fields(r.FormValue("cmd"))
+	if len(args) == 0 {
+		http.Error(w, "failed to exec in container: failed to start exec: OCI runtime exec failed: exec failed: unable to start container process: exec: \"\": executable file not found in $PATH: unknown", http.StatusInternalServerError)
+		return
+	}
+
+	sh := target.NewShell(s.reporter(r, clientIP, "run"))
+	output := sh.ExecArgs(args)
+
+	switch code := sh.ExitStatus(); code {
+	case 0:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, output)
+	case 127:
+		http.Error(w, fmt.Sprintf("failed to exec in container: failed to start exec: OCI runtime exec failed: exec failed: unable to start container process: exec: %q: executable file not found in $PATH: unknown", args[0]), http.StatusInternalServerError)
+	default:
+		http.Error(w, fmt.Sprintf("command '%s' exited with %d: %s", strings.Join(args, " "), code, output), http.StatusInternalServerError)
+	}
+}
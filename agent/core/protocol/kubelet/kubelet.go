@@ -1,72 +1,52 @@
 package kubelet
 
 import (
+	"KubePot/core/health"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
+	stdlog "log"
 	"net"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
-	"KubePot/core/pool"
+	"KubePot/core/event"
+	"KubePot/core/honeytoken"
+	"KubePot/core/kube"
+	"KubePot/core/report"
 	"KubePot/core/rpc/client"
+	"KubePot/core/session"
+	"KubePot/utils/config"
 	"KubePot/utils/is"
 	"KubePot/utils/log"
 )
 
-// KubeletInfo 存储蜜罐信息
-var KubeletInfo map[string]interface{}
+// 与 apiserver 蜜罐中节点上报的 kubeletVersion 一致
+const kubeletVersion = "v1.21.0"
 
 // 服务运行状态标志
 var serverRunning bool
 
-// 初始化 Kubelet 蜜罐配置
-func init() {
-	// 加载 Kubelet 模拟数据
-	loadKubeletData()
-}
+var (
+	// running 运行中的两个端口的服务，Stop 据此关闭
+	running   []*http.Server
+	runningMu sync.Mutex
+	// started Start 和只读端口返回后 Stop 才返回，保证之后可以重新启动
+	started sync.WaitGroup
+)
 
-// 加载 Kubelet 模拟数据
-func loadKubeletData() {
-	// 从配置文件或预设数据加载模拟的 Kubelet 信息
-	KubeletInfo = map[string]interface{}{
-		"nodes": map[string]interface{}{
-			"node1.example.com": map[string]interface{}{
-				"pods": []interface{}{
-					map[string]interface{}{
-						"name":      "nginx-pod",
-						"namespace": "default",
-						"containers": []interface{}{
-							map[string]interface{}{
-								"name":  "nginx",
-								"image": "nginx:1.14.2",
-							},
-						},
-					},
-				},
-			},
-		},
-		"pods": map[string]interface{}{
-			"default/nginx-pod": map[string]interface{}{
-				"metadata": map[string]interface{}{
-					"name":      "nginx-pod",
-					"namespace": "default",
-				},
-				"spec": map[string]interface{}{
-					"containers": []interface{}{
-						map[string]interface{}{
-							"name":  "nginx",
-							"image": "nginx:1.14.2",
-						},
-					},
-				},
-			},
-		},
-		"healthz": "ok",
-	}
+// server 一个 kubelet 监听端口，readOnly 对应 10255 只读端口
+type server struct {
+	readOnly bool
+	// name 上报时使用的蜜罐名称
+	name string
 }
 
-// Start 启动 Kubelet 蜜罐服务
+// Start 启动 Kubelet 蜜罐服务，addr 为 10250 认证端口，只读端口由 read_only_addr 配置
 func Start(addr string) {
 	// 检查服务是否已经在运行
 	if serverRunning {
@@ -74,140 +54,243 @@ func Start(addr string) {
 		return
 	}
 
-	// 建立socket，监听端口
-	netListen, err := net.Listen("tcp", addr)
+	// 与 apiserver 蜜罐共用集群对象，保证 Pod 数据一致
+	kube.Init(config.Get("apiserver", "fixture_dir"))
+
+	certDir := config.Get("kubelet", "cert_dir")
+	if certDir == "" {
+		certDir = "./pki/kubelet"
+	}
+	tlsConfig, err := loadOrCreateCert(certDir)
 	if err != nil {
-		log.Pr("Kubelet", "127.0.0.1", "Kubelet 监听失败", err)
+		log.Pr("Kubelet", "127.0.0.1", "Kubelet 证书生成失败", err)
+		health.Failed("kubelet", err)
 		return
 	}
-	defer netListen.Close()
 
 	// 设置服务运行状态为true
+	started.Add(1)
+	defer started.Done()
 	serverRunning = true
 	defer func() {
 		serverRunning = false
 	}()
 
+	if readOnlyAddr := config.Get("kubelet", "read_only_addr"); readOnlyAddr != "" {
+		started.Add(1)
+		go func() {
+			defer started.Done()
+			listenAndServe(readOnlyAddr, &server{readOnly: true, name: "Kubelet 10255蜜罐"}, nil)
+		}()
+	}
+	listenAndServe(addr, &server{name: "Kubelet 10250蜜罐"}, tlsConfig)
+}
+
+// Stop 关闭两个端口的服务并等待 Start 返回
+func Stop() {
+	runningMu.Lock()
+	servers := running
+	running = nil
+	runningMu.Unlock()
+	if len(servers) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, s := range servers {
+		if err := s.Shutdown(ctx); err != nil {
+			s.Close()
+		}
+	}
+	started.Wait()
+	log.Pr("Kubelet", "127.0.0.1", "蜜罐服务已关闭")
+}
+
+// listenAndServe 监听端口，tlsConfig 为空时以明文 HTTP 提供服务
+func listenAndServe(addr string, s *server, tlsConfig *tls.Config) {
+	// 建立socket，监听端口
+	netListen, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Pr("Kubelet", "127.0.0.1", "Kubelet 监听失败", err)
+		if !s.readOnly {
+			health.Failed("kubelet", err)
+		}
+		return
+	}
+	// 只读端口是可选的，服务状态以 10250 端口为准
+	if !s.readOnly {
+		health.Listening("kubelet")
+	}
+	defer netListen.Close()
+
 	log.Pr("Kubelet", addr, "蜜罐服务已启动")
+	netListen = session.Listen(netListen, "KUBELET", s.name)
 
-	// 创建连接池
-	wg, poolX := pool.New(10)
-	defer poolX.Release()
+	httpServer := &http.Server{
+		Handler:           s,
+		ConnContext:       session.ConnContext,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 30 * time.Second,
+		IdleTimeout:       5 * time.Minute,
+		ErrorLog:          stdlog.New(io.Discard, "", 0),
+	}
+	runningMu.Lock()
+	running = append(running, httpServer)
+	runningMu.Unlock()
 
-	// 循环接受连接
-	for {
-		wg.Add(1)
-		poolX.Submit(func() {
-			// 稍微延迟，避免过快接受连接
-			time.Sleep(time.Second * 1)
+	if tlsConfig != nil {
+		err = httpServer.ServeTLS(netListen, "", "")
+	} else {
+		err = httpServer.Serve(netListen)
+	}
+	if err != nil && err != http.ErrServerClosed {
+		log.Pr("Kubelet", "127.0.0.1", "Kubelet 服务异常退出", err)
+		if !s.readOnly {
+			health.Failed("kubelet", err)
+		}
+	}
+}
 
-			conn, err := netListen.Accept()
-			if err != nil {
-				log.Pr("Kubelet", "127.0.0.1", "Kubelet 连接失败", err)
-				wg.Done()
-				return
-			}
+// ServeHTTP 处理客户端请求
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
 
-			// 获取客户端IP
-			clientIP := strings.Split(conn.RemoteAddr().String(), ":")[0]
-			log.Pr("Kubelet", clientIP, "已经连接")
+	// 记录请求
+	log.Pr("Kubelet", clientIP, "请求路径", r.Method+" "+r.URL.RequestURI())
+	auth := s.authenticate(r, clientIP)
+	if is.Rpc() {
+		ev := s.newEvent(r, event.KindRequest)
+		ev.Credentials = requestCredentials(r)
+		ev.Detail = auth
+		go client.ReportResult(s.name, ev, "")
+	}
 
-			// 上报连接事件
-			var attackID string
+	if auth == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
 
-			// 处理连接
-			go handleConnection(conn, attackID, clientIP)
-			wg.Done()
-		})
+	if !s.route(w, r, clientIP) {
+		http.NotFound(w, r)
 	}
 }
 
-// handleConnection 处理客户端连接
-func handleConnection(conn net.Conn, attackID string, clientIP string) {
-	defer conn.Close()
-
-	// 创建缓冲区
-	buffer := make([]byte, 4096)
-
-	// 循环读取客户端请求
-	for {
-		// 读取请求数据
-		n, err := conn.Read(buffer)
-		if err != nil {
-			if err != io.EOF {
-				log.Pr("Kubelet", clientIP, "读取数据失败", err)
-			}
-			break
-		}
+// authenticate 识别请求身份，返回空字符串表示拒绝匿名访问
+func (s *server) authenticate(r *http.Request, clientIP string) string {
+	if s.readOnly {
+		return "Auth: none"
+	}
 
-		// 解析请求路径
-		requestData := string(buffer[:n])
-		path := extractPath(requestData)
-		//queryParams := extractQueryParams(requestData)
-
-		// 记录请求
-		log.Pr("Kubelet", clientIP, "请求路径", path)
-		info := path
-		if is.Rpc() {
-			go client.ReportResult("KUBELET", "Kubelet 10255蜜罐", conn.RemoteAddr().String(), info, attackID)
-		} else {
-			//go report.ReportKubelet("Kubelet", "本机", conn.RemoteAddr().String(), path)
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		token := strings.TrimSpace(header[7:])
+		if label, ok := honeytoken.MatchToken(token); ok {
+			s.reportHoneytoken(label, r, clientIP)
+			return fmt.Sprintf("Auth: bearer, Token: %s, Honeytoken: %d (%s)", token, label.ID, label.Name)
 		}
-
-		if path != "/" {
-			// 获取响应数据
-			responseData := getResponseData(path)
-
-			// 将响应数据转换为 JSON
-			jsonData, err := json.MarshalIndent(responseData, "", "  ")
-			if err != nil {
-				log.Pr("Kubelet", clientIP, "JSON 编码失败", err)
-				conn.Write([]byte("HTTP/1.1 500 Internal Server Error\r\nContent-Type: text/plain\r\n\r\nInternal Server Error"))
-				continue
-			}
-
-			// 构建 HTTP 响应
-			response := fmt.Sprintf(
-				"HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s",
-				len(jsonData), jsonData,
-			)
-
-			// 发送响应
-			conn.Write([]byte(response))
-
-		} else {
-			response := "HTTP/1.1 404 Not Found\r\nContent-Type: text/plain\r\nContent-Length: 19\r\n\r\n404 page not found\n"
-			conn.Write([]byte(response))
+		return "Auth: bearer, Token: " + token
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		cert := r.TLS.PeerCertificates[0]
+		if label, ok := honeytoken.MatchCertificate(cert); ok {
+			s.reportHoneytoken(label, r, clientIP)
+			return fmt.Sprintf("Auth: x509, User: %s, Honeytoken: %d (%s)", cert.Subject.CommonName, label.ID, label.Name)
 		}
+		return fmt.Sprintf("Auth: x509, User: %s, Fingerprint: %s", cert.Subject.CommonName, honeytoken.Fingerprint(cert))
+	}
 
+	if config.Get("kubelet", "anonymous_auth") == "false" {
+		return ""
 	}
+	return "Auth: anonymous"
 }
 
-// extractPath 从请求中提取路径
-func extractPath(request string) string {
-	lines := strings.Split(request, "\r\n")
-	if len(lines) > 0 {
-		parts := strings.Split(lines[0], " ")
-		if len(parts) > 1 {
-			return parts[1]
-		}
+// newEvent 创建关联到连接会话的事件
+func (s *server) newEvent(r *http.Request, kind event.Kind) *event.Event {
+	return session.FromRequest(r, "KUBELET", s.name).Request(kind, r)
+}
+
+// requestCredentials 提取请求携带的 Bearer 令牌或客户端证书用户和指纹，未携带时返回 nil
+func requestCredentials(r *http.Request) *event.Credentials {
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return &event.Credentials{Token: strings.TrimSpace(header[7:])}
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		cert := r.TLS.PeerCertificates[0]
+		return &event.Credentials{Username: cert.Subject.CommonName, Certificate: honeytoken.Fingerprint(cert)}
+	}
+	return nil
+}
+
+// reportHoneytoken 上报蜜标凭据在 kubelet 上被使用
+func (s *server) reportHoneytoken(label honeytoken.Label, r *http.Request, clientIP string) {
+	if !honeytoken.ShouldAlert(label.ID, clientIP) {
+		return
+	}
+	log.Pr("Kubelet", clientIP, "蜜标凭据被使用", fmt.Sprintf("%d %s", label.ID, label.Name))
+
+	info := fmt.Sprintf("Honeytoken used on Kubelet, Label: %d, Request: %s %s", label.ID, r.Method, r.URL.RequestURI())
+	if is.Rpc() {
+		agentName := config.Get("rpc", "name")
+		go report.ReportHoneytokenAlert(agentName, clientIP, label.ID, label.Name, info)
+
+		ev := s.newEvent(r, event.KindAuth)
+		ev.Credentials = requestCredentials(r)
+		ev.Detail = fmt.Sprintf("Honeytoken used on Kubelet, Label: %d (%s)", label.ID, label.Name)
+		go client.ReportResult(s.name, ev, "")
 	}
-	return "/"
 }
 
-// getResponseData 根据路径获取响应数据
-func getResponseData(path string) interface{} {
+// route 按路径分发请求，只读端口只提供查询类接口，未知路径返回 false
+func (s *server) route(w http.ResponseWriter, r *http.Request, clientIP string) bool {
+	path := r.URL.Path
+	store := kube.ForClient(clientIP)
+
 	switch {
-	case strings.HasPrefix(path, "/pods"):
-		return KubeletInfo["pods"]
-	case strings.HasPrefix(path, "/nodes"):
-		return KubeletInfo["nodes"]
-	case strings.HasPrefix(path, "/healthz"):
-		return KubeletInfo["healthz"]
+	case path == "/healthz":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, "ok")
+	case path == "/pods" || path == "/pods/":
+		writeJSON(w, podList(store))
+	case path == "/stats/summary" || path == "/stats/summary/":
+		writeJSON(w, statsSummary(store))
+	case path == "/metrics":
+		writeMetrics(w, kubeletMetrics(store))
+	case path == "/metrics/cadvisor":
+		writeMetrics(w, cadvisorMetrics(store))
+	case path == "/metrics/resource":
+		writeMetrics(w, resourceMetrics(store))
+	case path == "/metrics/probes":
+		writeMetrics(w, probeMetrics(store))
+	case s.readOnly:
+		return false
+	case path == "/runningpods" || path == "/runningpods/":
+		writeJSON(w, runningPods(store))
+	case path == "/configz":
+		writeJSON(w, configz())
+	case strings.HasPrefix(path, "/run/"):
+		s.serveRun(w, r, store, clientIP)
+	case strings.HasPrefix(path, "/containerLogs/"):
+		serveContainerLogs(w, r, store)
+	case path == "/logs" || strings.HasPrefix(path, "/logs/"):
+		serveNodeLogs(w, r, store)
 	default:
-		// 返回默认的 API 列表
-		return map[string]string{
-			"availableEndpoints": "/pods, /nodes, /healthz",
-		}
+		return s.serveStream(w, r, store, clientIP)
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
 }
@@ -0,0 +1,243 @@
+package kubelet
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"KubePot/core/kube"
+)
+
+// 伪造日志的条数上限
+const maxLogLines = 200
+
+// nodeLogFiles /logs/ 下可以浏览的 /var/log 文件
+var nodeLogFiles = map[string]func() string{
+	"syslog":   syslogContent,
+	"auth.log": authLogContent,
+	"dpkg.log": dpkgLogContent,
+	"kern.log": kernLogContent,
+	"cloud-init.log": func() string {
+		return nodeBootTime.UTC().Format("2006-01-02 15:04:05,000") + " - util.py[DEBUG]: Cloud-init v. 23.1.2-0ubuntu0~20.04.2 finished at " + nodeBootTime.UTC().Format(time.RFC1123Z) + ". Datasource DataSourceNone.  Up 21.46 seconds\n"
+	},
+}
+
+// nodeLogDirs /logs/ 下的子目录
+var nodeLogDirs = []string{"apt", "containers", "journal", "pods"}
+
+// serveContainerLogs 处理 /containerLogs/{ns}/{pod}/{container}，按镜像生成容器日志
+func serveContainerLogs(w http.ResponseWriter, r *http.Request, store *kube.Store) {
+	_, namespace, podName, container, ok := parseContainerPath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	pod, err := store.Get(podResource, namespace, podName)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("pod %q in namespace %q not found", podName, namespace), http.StatusNotFound)
+		return
+	}
+
+	var image string
+	for _, c := range podContainers(pod) {
+		if name, _ := c["name"].(string); name == container {
+			image, _ = c["image"].(string)
+		}
+	}
+	if image == "" {
+		http.Error(w, fmt.Sprintf("container %q in pod %q is not available", container, podName), http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	lines := containerLog(namespace+"/"+podName+"/"+container, image, podStartTime(pod))
+	if n, err := strconv.Atoi(query.Get("tailLines")); err == nil && n >= 0 && n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	timestamps := query.Get("timestamps") == "true" || query.Get("timestamps") == "1"
+	for _, line := range lines {
+		if timestamps {
+			io.WriteString(w, line.time.UTC().Format(time.RFC3339Nano)+" ")
+		}
+		io.WriteString(w, line.text+"\n")
+	}
+}
+
+type logLine struct {
+	time time.Time
+	text string
+}
+
+// containerLog 从启动时间开始按固定间隔生成日志，同一容器每次请求结果一致
+func containerLog(key, image string, started time.Time) []logLine {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	seed := h.Sum32()
+
+	name := path.Base(strings.SplitN(image, ":", 2)[0])
+	var lines []logLine
+	add := func(t time.Time, text string) {
+		lines = append(lines, logLine{t, text})
+	}
+
+	switch {
+	case strings.Contains(name, "nginx"):
+		add(started, "/docker-entrypoint.sh: /docker-entrypoint.d/ is not empty, will attempt to perform configuration")
+		add(started, "/docker-entrypoint.sh: Looking for shell scripts in /docker-entrypoint.d/")
+		add(started, "/docker-entrypoint.sh: Launching /docker-entrypoint.d/10-listen-on-ipv6-by-default.sh")
+		add(started, "/docker-entrypoint.sh: Configuration complete; ready for start up")
+		for i, first := 0, logWindow(started, 10*time.Second); len(lines) < maxLogLines; i++ {
+			t := first.Add(time.Duration(i) * 10 * time.Second)
+			if t.After(time.Now()) {
+				break
+			}
+			add(t, fmt.Sprintf("10.244.0.1 - - [%s] \"GET / HTTP/1.1\" 200 615 \"-\" \"kube-probe/1.21\" \"-\"", t.Format("02/Jan/2006:15:04:05 -0700")))
+		}
+	case strings.Contains(name, "redis"):
+		add(started, "1:C "+started.Format("02 Jan 2006 15:04:05.000")+" # oO0OoO0OoO0Oo Redis is starting oO0OoO0OoO0Oo")
+		add(started, "1:M "+started.Format("02 Jan 2006 15:04:05.000")+" * Running mode=standalone, port=6379.")
+		add(started, "1:M "+started.Format("02 Jan 2006 15:04:05.000")+" * Ready to accept connections")
+		for i, first := 0, logWindow(started, time.Hour); len(lines) < maxLogLines; i++ {
+			t := first.Add(time.Duration(i) * time.Hour)
+			if t.After(time.Now()) {
+				break
+			}
+			add(t, "1:M "+t.Format("02 Jan 2006 15:04:05.000")+" * 1 changes in 3600 seconds. Saving...")
+			add(t, "1:M "+t.Format("02 Jan 2006 15:04:05.000")+" * Background saving terminated with success")
+		}
+	default:
+		add(started, "Starting application")
+		add(started, fmt.Sprintf("Listening on :%d", 8000+seed%1000))
+		for i, first := 0, logWindow(started, time.Minute); len(lines) < maxLogLines; i++ {
+			t := first.Add(time.Duration(i) * time.Minute)
+			if t.After(time.Now()) {
+				break
+			}
+			add(t, fmt.Sprintf("%s INFO health check ok latency=%dms", t.UTC().Format("2006-01-02T15:04:05Z"), 1+(seed+uint32(i))%9))
+		}
+	}
+	return lines
+}
+
+// logWindow 返回周期日志的第一条时间，只保留最近 maxLogLines 个周期
+func logWindow(started time.Time, interval time.Duration) time.Time {
+	first := started.Add(interval)
+	if earliest := time.Now().Add(-maxLogLines * interval); first.Before(earliest) {
+		first = started.Add(time.Now().Sub(started) / interval * interval).Add(-(maxLogLines - 1) * interval)
+	}
+	return first
+}
+
+// serveNodeLogs 处理 /logs/，目录返回与 http.FileServer 相同的列表页面
+func serveNodeLogs(w http.ResponseWriter, r *http.Request, store *kube.Store) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/logs"), "/")
+	switch {
+	case name == "":
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, "/logs/", http.StatusMovedPermanently)
+			return
+		}
+		var entries []string
+		for file := range nodeLogFiles {
+			entries = append(entries, file)
+		}
+		for _, dir := range nodeLogDirs {
+			entries = append(entries, dir+"/")
+		}
+		writeDirListing(w, entries)
+	case name == "pods" || name == "containers":
+		var entries []string
+		for _, pod := range nodePods(store) {
+			meta, _ := pod["metadata"].(map[string]interface{})
+			if name == "pods" {
+				uid, _ := meta["uid"].(string)
+				entries = append(entries, fmt.Sprintf("%s_%s_%s/", kube.Namespace(pod), kube.Name(pod), uid))
+				continue
+			}
+			status, _ := pod["status"].(map[string]interface{})
+			statuses, _ := status["containerStatuses"].([]interface{})
+			for _, item := range statuses {
+				cs, _ := item.(map[string]interface{})
+				id, _ := cs["containerID"].(string)
+				if _, id, ok := strings.Cut(id, "://"); ok {
+					entries = append(entries, fmt.Sprintf("%s_%s_%s-%s.log", kube.Name(pod), kube.Namespace(pod), cs["name"], id))
+				}
+			}
+		}
+		writeDirListing(w, entries)
+	case nodeLogFiles[name] != nil:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, nodeLogFiles[name]())
+	default:
+		for _, dir := range nodeLogDirs {
+			if name == dir {
+				writeDirListing(w, nil)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}
+}
+
+func writeDirListing(w http.ResponseWriter, entries []string) {
+	sort.Strings(entries)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	var b strings.Builder
+	b.WriteString("<pre>\n")
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "<a href=\"%s\">%s</a>\n", html.EscapeString(entry), html.EscapeString(entry))
+	}
+	b.WriteString("</pre>\n")
+	io.WriteString(w, b.String())
+}
+
+func syslogContent() string {
+	var b strings.Builder
+	now := time.Now()
+	for i := 12; i > 0; i-- {
+		t := now.Add(-time.Duration(i) * 5 * time.Minute)
+		fmt.Fprintf(&b, "%s %s kubelet[1042]: I%s 1042 kubelet_getters.go:300] \"Path does not exist\" path=\"/var/lib/kubelet/pods\"\n",
+			t.Format(time.Stamp), kube.NodeName, t.Format("0102 15:04:05.000000"))
+		fmt.Fprintf(&b, "%s %s containerd[871]: time=\"%s\" level=info msg=\"ImageUpdate event &ImageUpdate{Name:registry.k8s.io/pause:3.4.1,Labels:map[string]string{io.cri-containerd.image: managed,},XXX_unrecognized:[],}\"\n",
+			t.Add(time.Second).Format(time.Stamp), kube.NodeName, t.Add(time.Second).UTC().Format(time.RFC3339Nano))
+	}
+	return b.String()
+}
+
+func authLogContent() string {
+	var b strings.Builder
+	now := time.Now()
+	for i := 6; i > 0; i-- {
+		t := now.Add(-time.Duration(i) * 17 * time.Minute)
+		fmt.Fprintf(&b, "%s %s CRON[%d]: pam_unix(cron:session): session opened for user root by (uid=0)\n", t.Format(time.Stamp), kube.NodeName, 20000+i*131)
+		fmt.Fprintf(&b, "%s %s CRON[%d]: pam_unix(cron:session): session closed for user root\n", t.Add(time.Second).Format(time.Stamp), kube.NodeName, 20000+i*131)
+	}
+	return b.String()
+}
+
+func dpkgLogContent() string {
+	t := nodeBootTime.Add(-2 * time.Hour).Format("2006-01-02 15:04:05")
+	return t + " startup archives unpack\n" +
+		t + " install kubelet:amd64 <none> " + strings.TrimPrefix(kubeletVersion, "v") + "-00\n" +
+		t + " status half-installed kubelet:amd64 " + strings.TrimPrefix(kubeletVersion, "v") + "-00\n" +
+		t + " install kubeadm:amd64 <none> " + strings.TrimPrefix(kubeletVersion, "v") + "-00\n" +
+		t + " install containerd.io:amd64 <none> 1.4.4-1\n" +
+		t + " status installed kubelet:amd64 " + strings.TrimPrefix(kubeletVersion, "v") + "-00\n"
+}
+
+func kernLogContent() string {
+	t := nodeBootTime.Format(time.Stamp)
+	return t + " " + kube.NodeName + " kernel: [    0.000000] Linux version 5.4.0-150-generic (buildd@lcy02-amd64-010) (gcc version 9.4.0 (Ubuntu 9.4.0-1ubuntu1~20.04.1)) #167-Ubuntu SMP Mon May 15 17:35:05 UTC 2023\n" +
+		t + " " + kube.NodeName + " kernel: [    0.000000] Command line: BOOT_IMAGE=/vmlinuz-5.4.0-150-generic root=/dev/sda1 ro console=tty1 console=ttyS0\n" +
+		t + " " + kube.NodeName + " kernel: [    6.812345] bridge: filtering via arp/ip/ip6tables is no longer available by default.\n" +
+		t + " " + kube.NodeName + " kernel: [    6.913201] Bridge firewalling registered\n"
+}
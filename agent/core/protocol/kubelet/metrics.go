@@ -0,0 +1,175 @@
+package kubelet
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"KubePot/core/kube"
+)
+
+// metric Prometheus 文本格式中的一个指标族
+type metric struct {
+	name    string
+	help    string
+	typ     string
+	samples []sample
+}
+
+type sample struct {
+	labels string
+	value  float64
+}
+
+func labels(pairs ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=%q", pairs[i], pairs[i+1]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// writeMetrics 以 Prometheus 文本格式输出指标
+func writeMetrics(w http.ResponseWriter, metrics []metric) {
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+
+	var b strings.Builder
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for _, s := range m.samples {
+			labels := s.labels
+			if labels == "{}" {
+				labels = ""
+			}
+			fmt.Fprintf(&b, "%s%s %v\n", m.name, labels, s.value)
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// kubeletMetrics 对应 /metrics，kubelet 自身的运行指标
+func kubeletMetrics(store *kube.Store) []metric {
+	pods := nodePods(store)
+	containers := 0
+	for _, pod := range pods {
+		containers += len(podContainers(pod))
+	}
+
+	return []metric{
+		{"kubernetes_build_info", "[ALPHA] A metric with a constant '1' value labeled by major, minor, git version, git commit, git tree state, build date, Go version, and compiler from which Kubernetes was built, and platform on which it is running.", "gauge", []sample{
+			{labels("build_date", "2021-04-08T16:25:06Z", "compiler", "gc", "git_commit", "cb303e613a121a29364f75cc67d3d580833a7479", "git_tree_state", "clean", "git_version", kubeletVersion, "go_version", "go1.16.1", "major", "1", "minor", "21", "platform", "linux/amd64"), 1},
+		}},
+		{"kubelet_node_name", "[ALPHA] The node's name. The count is always 1.", "gauge", []sample{
+			{labels("node", kube.NodeName), 1},
+		}},
+		{"kubelet_running_pods", "[ALPHA] Number of pods that have a running pod sandbox", "gauge", []sample{
+			{"", float64(len(pods))},
+		}},
+		{"kubelet_running_containers", "[ALPHA] Number of containers currently running", "gauge", []sample{
+			{labels("container_state", "running"), float64(containers)},
+		}},
+		{"kubelet_certificate_manager_client_ttl_seconds", "[ALPHA] Gauge of the TTL (time-to-live) of the Kubelet's client certificate. The value is in seconds until certificate expiry (negative if already expired). If client certificate is invalid or unused, the value will be +INF.", "gauge", []sample{
+			{"", float64(int64(time.Until(nodeBootTime.AddDate(1, 0, 0)).Seconds()))},
+		}},
+		{"process_start_time_seconds", "[ALPHA] Start time of the process since unix epoch in seconds.", "gauge", []sample{
+			{"", float64(nodeBootTime.Unix())},
+		}},
+		{"go_goroutines", "Number of goroutines that currently exist.", "gauge", []sample{
+			{"", float64(usage(kube.NodeName+"/goroutines", 280, 360))},
+		}},
+	}
+}
+
+// cadvisorMetrics 对应 /metrics/cadvisor，按容器输出 CPU 和内存用量
+func cadvisorMetrics(store *kube.Store) []metric {
+	cpu := metric{"container_cpu_usage_seconds_total", "Cumulative cpu time consumed in seconds.", "counter", nil}
+	memory := metric{"container_memory_working_set_bytes", "Current working set in bytes.", "gauge", nil}
+	start := metric{"container_start_time_seconds", "Start time of the container since unix epoch in seconds.", "gauge", nil}
+
+	for _, pod := range nodePods(store) {
+		namespace, name := kube.Namespace(pod), kube.Name(pod)
+		started := podStartTime(pod)
+		for _, c := range podContainers(pod) {
+			cname, _ := c["name"].(string)
+			image, _ := c["image"].(string)
+			key := namespace + "/" + name + "/" + cname
+			l := labels("container", cname, "image", image, "namespace", namespace, "pod", name)
+			cores := float64(usage(key+"/cpu", 1000000, 50000000)) / 1e9
+			cpu.samples = append(cpu.samples, sample{l, cores * time.Since(started).Seconds()})
+			memory.samples = append(memory.samples, sample{l, float64(usage(key+"/memory", 8*1024*1024, 256*1024*1024))})
+			start.samples = append(start.samples, sample{l, float64(started.Unix())})
+		}
+	}
+	return []metric{
+		{"cadvisor_version_info", "A metric with a constant '1' value labeled by kernel version, OS version, docker version, cadvisor version & cadvisor revision.", "gauge", []sample{
+			{labels("cadvisorRevision", "", "cadvisorVersion", "", "dockerVersion", "", "kernelVersion", "5.4.0-150-generic", "osVersion", "Ubuntu 20.04.6 LTS"), 1},
+		}},
+		{"machine_cpu_cores", "Number of logical CPU cores.", "gauge", []sample{
+			{labels("machine_id", "", "node", kube.NodeName), nodeCPUCores},
+		}},
+		{"machine_memory_bytes", "Amount of memory installed on the machine.", "gauge", []sample{
+			{labels("machine_id", "", "node", kube.NodeName), nodeMemoryBytes},
+		}},
+		cpu, memory, start,
+	}
+}
+
+// resourceMetrics 对应 /metrics/resource，metrics-server 采集的数据
+func resourceMetrics(store *kube.Store) []metric {
+	summary := statsSummary(store)
+	node, _ := summary["node"].(map[string]interface{})
+	nodeCPU, _ := node["cpu"].(map[string]interface{})["usageNanoCores"].(uint64)
+	nodeMemory, _ := node["memory"].(map[string]interface{})["workingSetBytes"].(uint64)
+
+	cpu := metric{"container_cpu_usage_seconds_total", "[ALPHA] Cumulative cpu time consumed by the container in core-seconds", "counter", nil}
+	memory := metric{"container_memory_working_set_bytes", "[ALPHA] Current working set of the container in bytes", "gauge", nil}
+	for _, pod := range nodePods(store) {
+		namespace, name := kube.Namespace(pod), kube.Name(pod)
+		started := podStartTime(pod)
+		for _, c := range podContainers(pod) {
+			cname, _ := c["name"].(string)
+			key := namespace + "/" + name + "/" + cname
+			l := labels("container", cname, "namespace", namespace, "pod", name)
+			cores := float64(usage(key+"/cpu", 1000000, 50000000)) / 1e9
+			cpu.samples = append(cpu.samples, sample{l, cores * time.Since(started).Seconds()})
+			memory.samples = append(memory.samples, sample{l, float64(usage(key+"/memory", 8*1024*1024, 256*1024*1024))})
+		}
+	}
+
+	return []metric{
+		{"node_cpu_usage_seconds_total", "[ALPHA] Cumulative cpu time consumed by the node in core-seconds", "counter", []sample{
+			{"", float64(nodeCPU) / 1e9 * time.Since(nodeBootTime).Seconds()},
+		}},
+		{"node_memory_working_set_bytes", "[ALPHA] Current working set of the node in bytes", "gauge", []sample{
+			{"", float64(nodeMemory)},
+		}},
+		{"scrape_error", "[ALPHA] 1 if there was an error while getting container metrics, 0 otherwise", "gauge", []sample{
+			{"", 0},
+		}},
+		cpu, memory,
+	}
+}
+
+// probeMetrics 对应 /metrics/probes，声明了探针的容器全部返回成功
+func probeMetrics(store *kube.Store) []metric {
+	probes := metric{"prober_probe_total", "[ALPHA] Cumulative number of a liveness, readiness or startup probe for a container by result.", "counter", nil}
+	for _, pod := range nodePods(store) {
+		namespace, name := kube.Namespace(pod), kube.Name(pod)
+		elapsed := time.Since(podStartTime(pod)).Seconds()
+		for _, c := range podContainers(pod) {
+			cname, _ := c["name"].(string)
+			for field, probeType := range map[string]string{"livenessProbe": "Liveness", "readinessProbe": "Readiness", "startupProbe": "Startup"} {
+				if _, ok := c[field]; !ok {
+					continue
+				}
+				l := labels("container", cname, "namespace", namespace, "pod", name, "pod_uid", "", "probe_type", probeType, "result", "successful")
+				probes.samples = append(probes.samples, sample{l, float64(int64(elapsed / 10))})
+			}
+		}
+	}
+	sort.Slice(probes.samples, func(i, j int) bool { return probes.samples[i].labels < probes.samples[j].labels })
+	return []metric{probes}
+}
@@ -0,0 +1,259 @@
+package kubelet
+
+import (
+	"hash/fnv"
+	"time"
+
+	"KubePot/core/kube"
+	"KubePot/utils/config"
+)
+
+// 节点容量，与 /stats/summary 和 /metrics 中的数值保持一致
+const (
+	nodeCPUCores     = 4
+	nodeMemoryBytes  = 8 * 1024 * 1024 * 1024
+	nodeFsBytes      = 100 * 1024 * 1024 * 1024
+	nodeBootInterval = 37 * 24 * time.Hour
+)
+
+// nodeBootTime 模拟的节点启动时间
+var nodeBootTime = time.Now().Add(-nodeBootInterval).Truncate(time.Second)
+
+// nodePods 返回调度到本节点的 Pod
+func nodePods(store *kube.Store) []kube.Object {
+	var pods []kube.Object
+	for _, pod := range store.List(podResource, "", kube.Selector{}) {
+		spec, _ := pod["spec"].(map[string]interface{})
+		if node, _ := spec["nodeName"].(string); node == "" || node == kube.NodeName {
+			pods = append(pods, pod)
+		}
+	}
+	return pods
+}
+
+// podList 对应 /pods，返回本节点上完整的 Pod 对象
+func podList(store *kube.Store) map[string]interface{} {
+	items := []interface{}{}
+	for _, pod := range nodePods(store) {
+		items = append(items, pod)
+	}
+	return map[string]interface{}{
+		"kind":       "PodList",
+		"apiVersion": "v1",
+		"metadata":   map[string]interface{}{},
+		"items":      items,
+	}
+}
+
+// runningPods 对应 /runningpods/，与 kubelet 一样只包含容器运行时能看到的字段
+func runningPods(store *kube.Store) map[string]interface{} {
+	items := []interface{}{}
+	for _, pod := range nodePods(store) {
+		meta, _ := pod["metadata"].(map[string]interface{})
+		var containers []interface{}
+		for _, c := range podContainers(pod) {
+			containers = append(containers, map[string]interface{}{
+				"name":      c["name"],
+				"image":     c["image"],
+				"resources": map[string]interface{}{},
+			})
+		}
+		items = append(items, map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":              meta["name"],
+				"namespace":         meta["namespace"],
+				"uid":               meta["uid"],
+				"creationTimestamp": nil,
+			},
+			"spec":   map[string]interface{}{"containers": containers},
+			"status": map[string]interface{}{},
+		})
+	}
+	return map[string]interface{}{
+		"kind":       "PodList",
+		"apiVersion": "v1",
+		"metadata":   map[string]interface{}{},
+		"items":      items,
+	}
+}
+
+func podContainers(pod kube.Object) []map[string]interface{} {
+	spec, _ := pod["spec"].(map[string]interface{})
+	items, _ := spec["containers"].([]interface{})
+	var containers []map[string]interface{}
+	for _, item := range items {
+		if c, ok := item.(map[string]interface{}); ok {
+			containers = append(containers, c)
+		}
+	}
+	return containers
+}
+
+// podStartTime 返回 Pod 的启动时间，没有记录时使用节点启动时间
+func podStartTime(pod kube.Object) time.Time {
+	status, _ := pod["status"].(map[string]interface{})
+	if s, _ := status["startTime"].(string); s != "" {
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t
+		}
+	}
+	return nodeBootTime
+}
+
+// usage 按名称生成稳定的资源用量，同一容器多次查询结果相近
+func usage(name string, min, max uint64) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	base := min + h.Sum64()%(max-min)
+	// 按分钟小幅波动
+	jitter := uint64(time.Now().Unix()/60) % 7
+	return base + base*jitter/100
+}
+
+// statsSummary 对应 /stats/summary，返回节点和各 Pod 的资源用量
+func statsSummary(store *kube.Store) map[string]interface{} {
+	now := time.Now().UTC().Format(time.RFC3339)
+	bootTime := nodeBootTime.UTC().Format(time.RFC3339)
+
+	var podsStats []interface{}
+	var totalCPU, totalMemory uint64
+	for _, pod := range nodePods(store) {
+		meta, _ := pod["metadata"].(map[string]interface{})
+		started := podStartTime(pod).UTC().Format(time.RFC3339)
+		key := kube.Namespace(pod) + "/" + kube.Name(pod)
+
+		var containers []interface{}
+		var podCPU, podMemory uint64
+		for _, c := range podContainers(pod) {
+			name, _ := c["name"].(string)
+			cpu := usage(key+"/"+name+"/cpu", 1000000, 50000000)
+			memory := usage(key+"/"+name+"/memory", 8*1024*1024, 256*1024*1024)
+			podCPU += cpu
+			podMemory += memory
+			containers = append(containers, map[string]interface{}{
+				"name":      name,
+				"startTime": started,
+				"cpu":       map[string]interface{}{"time": now, "usageNanoCores": cpu},
+				"memory": map[string]interface{}{
+					"time":            now,
+					"usageBytes":      memory + memory/4,
+					"workingSetBytes": memory,
+					"rssBytes":        memory * 3 / 4,
+				},
+				"rootfs": map[string]interface{}{
+					"time":           now,
+					"availableBytes": nodeFsBytes / 2,
+					"capacityBytes":  nodeFsBytes,
+					"usedBytes":      usage(key+"/"+name+"/fs", 4096, 1024*1024),
+				},
+				"logs": map[string]interface{}{
+					"time":           now,
+					"availableBytes": nodeFsBytes / 2,
+					"capacityBytes":  nodeFsBytes,
+					"usedBytes":      usage(key+"/"+name+"/logs", 4096, 4*1024*1024),
+				},
+			})
+		}
+		totalCPU += podCPU
+		totalMemory += podMemory
+
+		podsStats = append(podsStats, map[string]interface{}{
+			"podRef": map[string]interface{}{
+				"name":      meta["name"],
+				"namespace": meta["namespace"],
+				"uid":       meta["uid"],
+			},
+			"startTime":  started,
+			"containers": containers,
+			"cpu":        map[string]interface{}{"time": now, "usageNanoCores": podCPU},
+			"memory":     map[string]interface{}{"time": now, "usageBytes": podMemory + podMemory/4, "workingSetBytes": podMemory},
+			"network": map[string]interface{}{
+				"time":    now,
+				"name":    "eth0",
+				"rxBytes": usage(key+"/rx", 1024*1024, 512*1024*1024),
+				"txBytes": usage(key+"/tx", 1024*1024, 256*1024*1024),
+			},
+		})
+	}
+
+	nodeCPU := totalCPU + usage(kube.NodeName+"/cpu", 100000000, 400000000)
+	nodeMemory := totalMemory + usage(kube.NodeName+"/memory", 1024*1024*1024, 2*1024*1024*1024)
+	return map[string]interface{}{
+		"node": map[string]interface{}{
+			"nodeName":  kube.NodeName,
+			"startTime": bootTime,
+			"systemContainers": []interface{}{
+				map[string]interface{}{"name": "kubelet", "startTime": bootTime},
+				map[string]interface{}{"name": "runtime", "startTime": bootTime},
+				map[string]interface{}{"name": "pods", "startTime": bootTime},
+			},
+			"cpu": map[string]interface{}{"time": now, "usageNanoCores": nodeCPU},
+			"memory": map[string]interface{}{
+				"time":            now,
+				"availableBytes":  nodeMemoryBytes - nodeMemory,
+				"usageBytes":      nodeMemory + nodeMemory/4,
+				"workingSetBytes": nodeMemory,
+			},
+			"network": map[string]interface{}{
+				"time":    now,
+				"name":    "eth0",
+				"rxBytes": usage(kube.NodeName+"/rx", 10*1024*1024*1024, 40*1024*1024*1024),
+				"txBytes": usage(kube.NodeName+"/tx", 5*1024*1024*1024, 20*1024*1024*1024),
+			},
+			"fs": map[string]interface{}{
+				"time":           now,
+				"availableBytes": nodeFsBytes / 2,
+				"capacityBytes":  nodeFsBytes,
+				"usedBytes":      nodeFsBytes / 2,
+			},
+		},
+		"pods": podsStats,
+	}
+}
+
+// configz 对应 /configz，返回 kubeadm 部署节点的默认 kubelet 配置
+func configz() map[string]interface{} {
+	return map[string]interface{}{
+		"kubeletconfig": map[string]interface{}{
+			"enableServer":      true,
+			"staticPodPath":     "/etc/kubernetes/manifests",
+			"syncFrequency":     "1m0s",
+			"address":           "0.0.0.0",
+			"port":              10250,
+			"readOnlyPort":      10255,
+			"tlsCertFile":       "/var/lib/kubelet/pki/kubelet.crt",
+			"tlsPrivateKeyFile": "/var/lib/kubelet/pki/kubelet.key",
+			"authentication": map[string]interface{}{
+				"x509":      map[string]interface{}{"clientCAFile": "/etc/kubernetes/pki/ca.crt"},
+				"webhook":   map[string]interface{}{"enabled": true, "cacheTTL": "2m0s"},
+				"anonymous": map[string]interface{}{"enabled": config.Get("kubelet", "anonymous_auth") != "false"},
+			},
+			"authorization": map[string]interface{}{
+				"mode": "AlwaysAllow",
+			},
+			"clusterDomain":                  "cluster.local",
+			"clusterDNS":                     []string{"10.96.0.10"},
+			"streamingConnectionIdleTimeout": "4h0m0s",
+			"nodeStatusUpdateFrequency":      "10s",
+			"healthzPort":                    10248,
+			"healthzBindAddress":             "127.0.0.1",
+			"cgroupDriver":                   "systemd",
+			"hairpinMode":                    "promiscuous-bridge",
+			"maxPods":                        110,
+			"podPidsLimit":                   -1,
+			"resolvConf":                     "/run/systemd/resolve/resolv.conf",
+			"containerRuntimeEndpoint":       "unix:///var/run/containerd/containerd.sock",
+			"rotateCertificates":             true,
+			"serverTLSBootstrap":             false,
+			"evictionHard": map[string]interface{}{
+				"imagefs.available": "15%",
+				"memory.available":  "100Mi",
+				"nodefs.available":  "10%",
+				"nodefs.inodesFree": "5%",
+			},
+			"failSwapOn":          true,
+			"logging":             map[string]interface{}{"format": "text", "verbosity": 0},
+			"shutdownGracePeriod": "0s",
+		},
+	}
+}
@@ -19,10 +19,13 @@ package memcache
  */
 
 import (
+	"KubePot/core/event"
+	"KubePot/core/health"
 	"KubePot/core/pool"
 	"KubePot/core/protocol/memcache/LinkedHashMap"
 	"KubePot/core/report"
 	"KubePot/core/rpc/client"
+	"KubePot/core/session"
 	"KubePot/utils/is"
 	"KubePot/utils/log"
 	"bufio"
@@ -407,11 +410,14 @@ func tcpServer(address string, rateLimitChan chan int, exitChan chan int) {
 
 	if err != nil {
 		fmt.Println(err.Error())
+		health.Failed("memcache", err)
 		exitChan <- 1
 		return
 	}
+	health.Listening("memcache")
 
 	defer l.Close()
+	l = session.Listen(l, "MEMCACHE", "")
 
 	wg, poolX := pool.New(10)
 	defer poolX.Release()
@@ -437,7 +443,7 @@ func tcpServer(address string, rateLimitChan chan int, exitChan chan int) {
 				var id string
 
 				if is.Rpc() {
-					id = client.ReportResult("MEMCACHE", "", arr[0], conn.RemoteAddr().String()+" 已经连接", "0")
+					id = client.ReportResult("", session.FromConn("MEMCACHE", event.KindConnect, conn), "0")
 				} else {
 					id = strconv.FormatInt(report.ReportMemCche(arr[0], "本机", conn.RemoteAddr().String()+" 已经连接"), 10)
 				}
@@ -456,7 +462,9 @@ func tcpServer(address string, rateLimitChan chan int, exitChan chan int) {
 					str = strings.TrimSpace(str)
 
 					if is.Rpc() {
-						go client.ReportResult("MEMCACHE", "", "", "&&"+str, id)
+						ev := session.FromConn("MEMCACHE", event.KindCommand, conn)
+						ev.Command = str
+						go client.ReportResult("", ev, id)
 					} else {
 						go report.ReportUpdateMemCche(id, "&&"+str)
 					}
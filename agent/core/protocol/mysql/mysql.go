@@ -1,9 +1,12 @@
 package mysql
 
 import (
+	"KubePot/core/event"
+	"KubePot/core/health"
 	"KubePot/core/pool"
 	"KubePot/core/report"
 	"KubePot/core/rpc/client"
+	"KubePot/core/session"
 	"KubePot/error"
 	"KubePot/utils/is"
 	"KubePot/utils/log"
@@ -55,14 +58,17 @@ func Start(addr string, files string) {
 	serverAddr, err := net.ResolveTCPAddr("tcp", addr)
 	if err != nil {
 		log.Pr("Mysql", "127.0.0.1", "解析地址失败", err)
+		health.Failed("mysql", err)
 		return
 	}
 
 	listener, err := net.ListenTCP("tcp", serverAddr)
 	if err != nil {
 		log.Pr("Mysql", "127.0.0.1", "监听失败", err)
+		health.Failed("mysql", err)
 		return
 	}
+	health.Listening("mysql")
 	defer listener.Close()
 
 	// 设置服务运行状态为true
@@ -88,6 +94,7 @@ func Start(addr string, files string) {
 				log.Pr("Mysql", "127.0.0.1", "Mysql 连接失败", err)
 				return
 			}
+			conn = session.Wrap(conn, "MYSQL", "")
 
 			arr := strings.Split(conn.RemoteAddr().String(), ":")
 
@@ -120,7 +127,7 @@ func connectionClientHandler(conn net.Conn) {
 	var id string
 
 	if is.Rpc() {
-		id = client.ReportResult("MYSQL", "", arr[0], connFrom+" 已经连接", "0")
+		id = client.ReportResult("", session.FromConn("MYSQL", event.KindConnect, conn), "0")
 	} else {
 		id = strconv.FormatInt(report.ReportMysql(arr[0], "本机", connFrom+" 已经连接"), 10)
 	}
@@ -132,7 +139,9 @@ func connectionClientHandler(conn net.Conn) {
 			log.Pr("Mysql", arr[0], "该客户端正在使用扫描器扫描")
 
 			if is.Rpc() {
-				go client.ReportResult("MYSQL", "", "", "&&该客户端正在使用扫描器扫描", id)
+				ev := session.FromConn("MYSQL", event.KindConnect, conn)
+				ev.Detail = "该客户端正在使用扫描器扫描"
+				go client.ReportResult("", ev, id)
 			} else {
 				// 有扫描器扫描
 				go report.ReportUpdateMysql(id, "&&该客户端正在使用扫描器扫描")
@@ -162,16 +171,17 @@ func connectionClientHandler(conn net.Conn) {
 
 	//这里根据客户端连接的次数来选择读取文件列表里面的第几个文件
 	ip, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
-	getFileData := []byte{byte(len(fileNames[recordClient[ip]]) + 1), 0x00, 0x00, 0x01, 0xfb}
-	getFileData = append(getFileData, fileNames[recordClient[ip]]...)
+	fileName := fileNames[recordClient[ip]]
+	getFileData := []byte{byte(len(fileName) + 1), 0x00, 0x00, 0x01, 0xfb}
+	getFileData = append(getFileData, fileName...)
 
 	//第五个包
 	_, err = conn.Write(getFileData)
-	getRequestContent(conn, id)
+	getRequestContent(conn, id, fileName)
 }
 
 // 获取客户端传来的文件数据
-func getRequestContent(conn net.Conn, id string) {
+func getRequestContent(conn net.Conn, id string, fileName string) {
 	var content bytes.Buffer
 	//先读取数据包长度，前面3字节
 	lengthBuf := make([]byte, 3)
@@ -199,7 +209,7 @@ func getRequestContent(conn net.Conn, id string) {
 			totalReadLength += length
 			if totalReadLength == totalDataLength {
 				//读取完成保存到本地文件
-				getFileContent(content, id)
+				getFileContent(conn, content, id, fileName)
 				//随便写点数据给客户端
 				_, _ = conn.Write(OkData)
 			}
@@ -214,9 +224,12 @@ func getRequestContent(conn net.Conn, id string) {
 }
 
 // 获取文件内容
-func getFileContent(content bytes.Buffer, id string) {
+func getFileContent(conn net.Conn, content bytes.Buffer, id string, fileName string) {
 	if is.Rpc() {
-		go client.ReportResult("MYSQL", "", "", "&&"+content.String(), id)
+		ev := session.FromConn("MYSQL", event.KindFile, conn)
+		ev.File = fileName
+		ev.Detail = content.String()
+		go client.ReportResult("", ev, id)
 	} else {
 		go report.ReportUpdateMysql(id, "&&"+content.String())
 	}
@@ -1,9 +1,12 @@
 package redis
 
 import (
+	"KubePot/core/event"
+	"KubePot/core/health"
 	"KubePot/core/pool"
 	"KubePot/core/report"
 	"KubePot/core/rpc/client"
+	"KubePot/core/session"
 	"KubePot/utils/is"
 	"KubePot/utils/log"
 	"bufio"
@@ -32,8 +35,10 @@ func Start(addr string) {
 	netListen, err := net.Listen("tcp", addr)
 	if err != nil {
 		log.Pr("Redis", "127.0.0.1", "Redis 监听失败", err)
+		health.Failed("redis", err)
 		return
 	}
+	health.Listening("redis")
 
 	// 设置服务运行状态为true
 	serverRunning = true
@@ -42,6 +47,7 @@ func Start(addr string) {
 	}()
 
 	defer netListen.Close()
+	netListen = session.Listen(netListen, "REDIS", "")
 
 	wg, poolX := pool.New(10)
 	defer poolX.Release()
@@ -64,7 +70,7 @@ func Start(addr string) {
 			var id string
 
 			if is.Rpc() {
-				id = client.ReportResult("REDIS", "", arr[0], conn.RemoteAddr().String()+" 已经连接", "0")
+				id = client.ReportResult("", session.FromConn("REDIS", event.KindConnect, conn), "0")
 			} else {
 				id = strconv.FormatInt(report.ReportRedis(arr[0], "本机", conn.RemoteAddr().String()+" 已经连接"), 10)
 			}
@@ -89,7 +95,7 @@ func handleConnection(conn net.Conn, id string) {
 		switch value := str.(type) {
 		case string:
 			if is.Rpc() {
-				go client.ReportResult("REDIS", "", "", "&&"+str.(string), id)
+				go reportCommand(conn, id, str.(string))
 			} else {
 				go report.ReportUpdateRedis(id, "&&"+str.(string))
 			}
@@ -112,7 +118,7 @@ func handleConnection(conn net.Conn, id string) {
 					kvData[key] = val
 
 					if is.Rpc() {
-						go client.ReportResult("REDIS", "", "", "&&"+value[0]+" "+value[1]+" "+value[2], id)
+						go reportCommand(conn, id, value[0]+" "+value[1]+" "+value[2])
 					} else {
 						go report.ReportUpdateRedis(id, "&&"+value[0]+" "+value[1]+" "+value[2])
 					}
@@ -133,7 +139,7 @@ func handleConnection(conn net.Conn, id string) {
 					str := "$" + valLen + "\r\n" + val + "\r\n"
 
 					if is.Rpc() {
-						go client.ReportResult("REDIS", "", "", "&&"+value[0]+" "+value[1], id)
+						go reportCommand(conn, id, value[0]+" "+value[1])
 					} else {
 						go report.ReportUpdateRedis(id, "&&"+value[0]+" "+value[1])
 					}
@@ -146,7 +152,7 @@ func handleConnection(conn net.Conn, id string) {
 				defer func() {
 					if r := recover(); r != nil {
 						if is.Rpc() {
-							go client.ReportResult("REDIS", "", "", "&&"+value[0], id)
+							go reportCommand(conn, id, value[0])
 						} else {
 							go report.ReportUpdateRedis(id, "&&"+value[0])
 						}
@@ -154,13 +160,13 @@ func handleConnection(conn net.Conn, id string) {
 				}()
 				if len(value) >= 2 {
 					if is.Rpc() {
-						go client.ReportResult("REDIS", "", "", "&&"+value[0]+" "+value[1], id)
+						go reportCommand(conn, id, value[0]+" "+value[1])
 					} else {
 						go report.ReportUpdateRedis(id, "&&"+value[0]+" "+value[1])
 					}
 				} else {
 					if is.Rpc() {
-						go client.ReportResult("REDIS", "", "", "&&"+value[0], id)
+						go reportCommand(conn, id, value[0])
 					} else {
 						go report.ReportUpdateRedis(id, "&&"+value[0])
 					}
@@ -176,6 +182,13 @@ end:
 	conn.Close()
 }
 
+// reportCommand 上报 Redis 命令，追加到连接建立时的记录
+func reportCommand(conn net.Conn, id string, command string) {
+	ev := session.FromConn("REDIS", event.KindCommand, conn)
+	ev.Command = command
+	client.ReportResult("", ev, id)
+}
+
 // 解析 Redis 协议
 func parseRESP(conn net.Conn) interface{} {
 	r := bufio.NewReader(conn)
@@ -82,7 +82,7 @@ type Pty struct {
 // then calls handler to handle sessions. Handler is typically nil, in which
 // case the DefaultHandler is used.
 func Serve(l net.Listener, handler Handler, options ...Option) error {
-	srv := &Server{Handler: handler}
+	srv := &Server{Handler: handler, Version: "OpenSSH_7.4"}
 	for _, option := range options {
 		if err := srv.SetOption(option); err != nil {
 			return err
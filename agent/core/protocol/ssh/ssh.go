@@ -1,9 +1,12 @@
 package ssh
 
 import (
+	"KubePot/core/event"
+	"KubePot/core/health"
 	"KubePot/core/protocol/ssh/gliderlabs"
 	"KubePot/core/report"
 	"KubePot/core/rpc/client"
+	"KubePot/core/session"
 	"KubePot/utils/config"
 	"KubePot/utils/file"
 	"KubePot/utils/is"
@@ -11,10 +14,12 @@ import (
 	"KubePot/utils/log"
 	"fmt"
 	"io"
+	"net"
 	"strconv"
 	"strings"
 
 	"github.com/bitly/go-simplejson"
+	gossh "golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
@@ -44,8 +49,17 @@ func Start(addr string) {
 
 	clientData = make(map[string]string)
 
-	ssh.ListenAndServe(
-		addr,
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Pr("SSH", "127.0.0.1", "SSH 监听失败", err)
+		health.Failed("ssh", err)
+		serverRunning = false
+		return
+	}
+	health.Listening("ssh")
+
+	err = ssh.Serve(
+		l,
 		func(s ssh.Session) {
 			res := getJson()
 
@@ -68,7 +82,9 @@ func Start(addr string) {
 				id := clientData[s.RemoteAddr().String()]
 
 				if is.Rpc() {
-					go client.ReportResult("SSH", "", "", "&&"+line, id)
+					ev := session.FromAddr("SSH", event.KindCommand, s.RemoteAddr(), s.LocalAddr())
+					ev.Command = line
+					go client.ReportResult("", ev, id)
 				} else {
 					go report.ReportUpdateSSH(id, "&&"+line)
 				}
@@ -87,7 +103,9 @@ func Start(addr string) {
 
 			// 判断是否为 RPC 客户端
 			if is.Rpc() {
-				id = client.ReportResult("SSH", "", arr[0], info, "0")
+				ev := session.FromAddr("SSH", event.KindAuth, s.RemoteAddr(), s.LocalAddr())
+				ev.Credentials = &event.Credentials{Username: s.User(), Password: password}
+				id = client.ReportResult("", ev, "0")
 			} else {
 				id = strconv.FormatInt(report.ReportSSH(arr[0], "本机", info), 10)
 			}
@@ -109,5 +127,22 @@ func Start(addr string) {
 			// 低交互模式，返回账号密码不正确
 			return false
 		}),
+		// 记录客户端提供的公钥指纹，服务端据此追溯被盗的诱饵私钥，公钥认证总是失败
+		ssh.PublicKeyAuth(func(s ssh.Context, key ssh.PublicKey) bool {
+			fingerprint := gossh.FingerprintSHA256(key)
+			log.Pr("SSH", strings.Split(s.RemoteAddr().String(), ":")[0], "公钥认证", s.User()+" "+fingerprint)
+
+			if is.Rpc() {
+				ev := session.FromAddr("SSH", event.KindAuth, s.RemoteAddr(), s.LocalAddr())
+				ev.Credentials = &event.Credentials{Username: s.User(), PublicKey: fingerprint}
+				client.ReportResult("", ev, "0")
+			}
+			return false
+		}),
+		// 每个连接创建一个会话，认证和命令事件都关联到它
+		ssh.WrapConn(func(conn net.Conn) net.Conn {
+			return session.Wrap(conn, "SSH", "")
+		}),
 	)
+	health.Failed("ssh", err)
 }
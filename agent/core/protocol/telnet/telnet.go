@@ -1,9 +1,12 @@
 package telnet
 
 import (
+	"KubePot/core/event"
+	"KubePot/core/health"
 	"KubePot/core/pool"
 	"KubePot/core/report"
 	"KubePot/core/rpc/client"
+	"KubePot/core/session"
 	"KubePot/utils/file"
 	"KubePot/utils/is"
 	"KubePot/utils/json"
@@ -27,10 +30,13 @@ func server(address string, exitChan chan int) {
 
 	if err != nil {
 		log.Pr("Telnet", "127.0.0.1", "监听端口失败", err)
+		health.Failed("telnet", err)
 		return
 	}
+	health.Listening("telnet")
 
 	defer l.Close()
+	l = session.Listen(l, "TELNET", "")
 
 	wg, poolX := pool.New(10)
 	defer poolX.Release()
@@ -52,7 +58,7 @@ func server(address string, exitChan chan int) {
 
 			// 判断是否为 RPC 客户端
 			if is.Rpc() {
-				id = client.ReportResult("TELNET", "", arr[0], conn.RemoteAddr().String()+" 已经连接", "0")
+				id = client.ReportResult("", session.FromConn("TELNET", event.KindConnect, conn), "0")
 			} else {
 				id = strconv.FormatInt(report.ReportTelnet(arr[0], "本机", conn.RemoteAddr().String()+" 已经连接"), 10)
 			}
@@ -89,7 +95,9 @@ func handleSession(conn net.Conn, exitChan chan int, id string) {
 			str = strings.TrimSpace(str)
 
 			if is.Rpc() {
-				go client.ReportResult("TELNET", "", "", "&&"+str, id)
+				ev := session.FromConn("TELNET", event.KindCommand, conn)
+				ev.Command = str
+				go client.ReportResult("", ev, id)
 			} else {
 				go report.ReportUpdateTelnet(id, "&&"+str)
 			}
@@ -7,8 +7,10 @@ import (
 	"sync"
 	"time"
 
+	"KubePot/core/event"
 	"KubePot/core/report"
 	"KubePot/core/rpc/client"
+	"KubePot/core/session"
 	"KubePot/utils/is"
 	"golang.org/x/net/ipv4"
 	"golang.org/x/net/ipv6"
@@ -332,9 +334,14 @@ func (s *Server) handlePacket(localAddr net.IP, remoteAddr *net.UDPAddr, buffer
 
 		id, ok := clientData[remoteAddr.String()]
 
+		// 每次传输作为一个会话，传输结束时关闭
+		sess := session.New("TFTP", "", remoteAddr, s.conn.LocalAddr())
+		ev := sess.Event(event.KindFile)
+		ev.Command, ev.File = "put", filename
+
 		if ok {
 			if is.Rpc() {
-				go client.ReportResult("TFTP", "", "", "&&"+info, id)
+				go client.ReportResult("", ev, id)
 			} else {
 				go report.ReportUpdateTFtp(id, "&&"+info)
 			}
@@ -343,7 +350,7 @@ func (s *Server) handlePacket(localAddr net.IP, remoteAddr *net.UDPAddr, buffer
 
 			// 判断是否为 RPC 客户端
 			if is.Rpc() {
-				idx = client.ReportResult("TFTP", "", arr[0], info, "0")
+				idx = client.ReportResult("", ev, "0")
 			} else {
 				idx = strconv.FormatInt(report.ReportTFtp(arr[0], "本机", info), 10)
 			}
@@ -354,6 +361,7 @@ func (s *Server) handlePacket(localAddr net.IP, remoteAddr *net.UDPAddr, buffer
 		}
 
 		if err != nil {
+			sess.Close(err.Error())
 			return fmt.Errorf("unpack WRQ: %v", err)
 		}
 		wt := &receiver{
@@ -383,6 +391,7 @@ func (s *Server) handlePacket(localAddr net.IP, remoteAddr *net.UDPAddr, buffer
 		} else {
 			conn, err := net.ListenUDP("udp", &net.UDPAddr{})
 			if err != nil {
+				sess.Close(err.Error())
 				return err
 			}
 			wt.conn = &connConnection{conn: conn}
@@ -393,11 +402,14 @@ func (s *Server) handlePacket(localAddr net.IP, remoteAddr *net.UDPAddr, buffer
 				err := s.writeHandler(filename, wt)
 				if err != nil {
 					wt.abort(err)
+					sess.Close(err.Error())
 				} else {
 					wt.terminate()
+					sess.Close(session.ReasonTransferComplete)
 				}
 			} else {
 				wt.abort(fmt.Errorf("server does not support write requests"))
+				sess.Close("write not supported")
 			}
 			s.wg.Done()
 		}()
@@ -409,9 +421,14 @@ func (s *Server) handlePacket(localAddr net.IP, remoteAddr *net.UDPAddr, buffer
 
 		id, ok := clientData[remoteAddr.String()]
 
+		// 每次传输作为一个会话，传输结束时关闭
+		sess := session.New("TFTP", "", remoteAddr, s.conn.LocalAddr())
+		ev := sess.Event(event.KindFile)
+		ev.Command, ev.File = "get", filename
+
 		if ok {
 			if is.Rpc() {
-				go client.ReportResult("TFTP", "", "", "&&"+info, id)
+				go client.ReportResult("", ev, id)
 			} else {
 				go report.ReportUpdateTFtp(id, "&&"+info)
 			}
@@ -420,7 +437,7 @@ func (s *Server) handlePacket(localAddr net.IP, remoteAddr *net.UDPAddr, buffer
 
 			// 判断是否为 RPC 客户端
 			if is.Rpc() {
-				idx = client.ReportResult("TFTP", "", arr[0], info, "0")
+				idx = client.ReportResult("", ev, "0")
 			} else {
 				idx = strconv.FormatInt(report.ReportTFtp(arr[0], "本机", info), 10)
 			}
@@ -429,6 +446,7 @@ func (s *Server) handlePacket(localAddr net.IP, remoteAddr *net.UDPAddr, buffer
 		}
 
 		if err != nil {
+			sess.Close(err.Error())
 			return fmt.Errorf("unpack RRQ: %v", err)
 		}
 		rf := &sender{
@@ -459,6 +477,7 @@ func (s *Server) handlePacket(localAddr net.IP, remoteAddr *net.UDPAddr, buffer
 		} else {
 			conn, err := net.ListenUDP("udp", &net.UDPAddr{})
 			if err != nil {
+				sess.Close(err.Error())
 				return err
 			}
 			rf.conn = &connConnection{conn: conn}
@@ -473,9 +492,13 @@ func (s *Server) handlePacket(localAddr net.IP, remoteAddr *net.UDPAddr, buffer
 				err := s.readHandler(filename, rf)
 				if err != nil {
 					rf.abort(err)
+					sess.Close(err.Error())
+				} else {
+					sess.Close(session.ReasonTransferComplete)
 				}
 			} else {
 				rf.abort(fmt.Errorf("server does not support read requests"))
+				sess.Close("read not supported")
 			}
 			s.wg.Done()
 		}()
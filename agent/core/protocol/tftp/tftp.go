@@ -1,9 +1,11 @@
 package tftp
 
 import (
+	"KubePot/core/health"
 	"KubePot/core/protocol/tftp/libs"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"time"
 )
@@ -34,7 +36,15 @@ func Start(address string) {
 
 	s := libs.NewServer(readHandler, writeHandler)
 	s.SetTimeout(5 * time.Second)
-	err := s.ListenAndServe(address)
+	a, err := net.ResolveUDPAddr("udp", address)
+	if err == nil {
+		var conn *net.UDPConn
+		if conn, err = net.ListenUDP("udp", a); err == nil {
+			health.Listening("tftp")
+			err = s.Serve(conn)
+		}
+	}
+	health.Failed("tftp", err)
 	if err != nil {
 		fmt.Fprintf(os.Stdout, "server: %v\n", err)
 		return
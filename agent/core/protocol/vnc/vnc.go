@@ -1,9 +1,12 @@
 package vnc
 
 import (
+	"KubePot/core/event"
+	"KubePot/core/health"
 	"KubePot/core/pool"
 	"KubePot/core/report"
 	"KubePot/core/rpc/client"
+	"KubePot/core/session"
 	"KubePot/utils/is"
 	"fmt"
 	"io"
@@ -30,9 +33,12 @@ func Start(address string) {
 	l, err := net.Listen("tcp", address)
 	if nil != err {
 		log.Printf("VNC 监听失败: %v", err)
+		health.Failed("vnc", err)
 		return
 	}
+	health.Listening("vnc")
 	defer l.Close()
+	l = session.Listen(l, "VNC", "VNC蜜罐")
 
 	// 设置服务运行状态为true
 	serverRunning = true
@@ -60,7 +66,9 @@ func Start(address string) {
 
 			// 判断是否为 RPC 客户端
 			if is.Rpc() {
-				go client.ReportResult("VNC", "VNC蜜罐", arr[0], "存在VNC扫描！", "0")
+				ev := session.FromConn("VNC", event.KindConnect, c)
+				ev.Detail = "存在VNC扫描！"
+				go client.ReportResult("VNC蜜罐", ev, "0")
 			} else {
 				go report.ReportVnc("VNC蜜罐", "本机", arr[0], "存在VNC扫描！")
 			}
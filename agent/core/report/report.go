@@ -1,11 +1,13 @@
 package report
 
 import (
+	"KubePot/core/spool"
 	"KubePot/utils/config"
 	"KubePot/utils/log"
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -21,47 +23,59 @@ func ReportSSH(ipx string, agent string, info string) int64 {
 	return 0
 }
 
-// ReportSecretLabelAlert 上报密标告警
-func ReportSecretLabelAlert(agent string, ip string, info string) {
-	serverAddr := config.Get("rpc", "addr")
-	if serverAddr == "" {
-		serverAddr = "127.0.0.1:9001"
+// ReportSecretLabelAlert 上报密标文件被篡改的告警
+func ReportSecretLabelAlert(agent string, labelID int, labelName string, ip string, info string) {
+	// 构建上报数据
+	alertData := map[string]interface{}{
+		"secret_label_id":   strconv.Itoa(labelID),
+		"secret_label_name": labelName,
+		"agent":             agent,
+		"ip":                ip,
+		"access_time":       time.Now().Format("2006-01-02 15:04:05"),
+		"access_content":    info,
 	}
 
-	if !strings.HasPrefix(serverAddr, "http://") && !strings.HasPrefix(serverAddr, "https://") {
-		serverAddr = "http://" + serverAddr
-	}
+	// 写入本地队列，由后台发送，服务端不可用时不会丢失告警
+	spool.Enqueue("/api/v1/secretlabel/alert", alertData)
+	log.Pr("KubePot", "127.0.0.1", "上报密标告警已入队", alertData)
+}
 
+// ReportSecretLabelAccess 上报密标文件被读取的高危告警
+func ReportSecretLabelAccess(agent string, labelID int, labelName string, ip string, info string) {
 	// 构建上报数据
-	alertData := map[string]string{
-		"secret_label_id":   "0",
-		"secret_label_name": "文件篡改监控",
+	alertData := map[string]interface{}{
+		"secret_label_id":   strconv.Itoa(labelID),
+		"secret_label_name": labelName,
+		"alert_type":        "file_access",
+		"severity":          "high",
 		"agent":             agent,
 		"ip":                ip,
 		"access_time":       time.Now().Format("2006-01-02 15:04:05"),
 		"access_content":    info,
 	}
 
-	// 转换为JSON
-	jsonData, err := json.Marshal(alertData)
-	if err != nil {
-		log.Pr("KubePot", "127.0.0.1", "JSON编码失败", err)
-		return
-	}
+	// 写入本地队列，由后台发送，服务端不可用时不会丢失告警
+	spool.Enqueue("/api/v1/secretlabel/alert", alertData)
+	log.Pr("KubePot", "127.0.0.1", "上报密标读取告警已入队", alertData)
+}
 
-	// 发送HTTP请求
-	url := serverAddr + "/api/v1/secretlabel/alert"
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-	resp, err := client.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Pr("KubePot", "127.0.0.1", "上报密标告警失败", err)
-		return
+// ReportHoneytokenAlert 上报蜜标凭据被使用的高危告警
+func ReportHoneytokenAlert(agent string, ip string, labelID int, labelName string, info string) {
+	// 构建上报数据
+	alertData := map[string]interface{}{
+		"secret_label_id":   strconv.Itoa(labelID),
+		"secret_label_name": labelName,
+		"alert_type":        "honeytoken_used",
+		"severity":          "high",
+		"agent":             agent,
+		"ip":                ip,
+		"access_time":       time.Now().Format("2006-01-02 15:04:05"),
+		"access_content":    info,
 	}
-	defer resp.Body.Close()
 
-	log.Pr("KubePot", "127.0.0.1", "上报密标告警成功", alertData)
+	// 写入本地队列，由后台发送，服务端不可用时不会丢失告警
+	spool.Enqueue("/api/v1/secretlabel/alert", alertData)
+	log.Pr("KubePot", "127.0.0.1", "上报蜜标告警已入队", alertData)
 }
 
 // ReportTelnet 上报Telnet蜜罐
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 签名相关的请求头，服务端 view/enroll 使用相同的名称和算法
+const (
+	HeaderAgent     = "X-Kubepot-Agent"
+	HeaderTimestamp = "X-Kubepot-Timestamp"
+	HeaderNonce     = "X-Kubepot-Nonce"
+	HeaderSignature = "X-Kubepot-Signature"
+)
+
+// ErrNotEnrolled 本 Agent 还没有向服务端注册，无法签名请求
+var ErrNotEnrolled = errors.New("agent 未注册，请配置 rpc.enroll_token 后重启")
+
+var (
+	mu        sync.RWMutex
+	agentName string
+	key       []byte
+
+	httpClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// Load 从 keyFile 读取注册时协商出的 HMAC 密钥，密钥属于其他名称的 Agent 时返回错误
+func Load(name, keyFile string) error {
+	k, stored, err := readKeyFile(keyFile)
+	if err != nil {
+		return err
+	}
+	if stored != "" && stored != name {
+		return fmt.Errorf("%s: 密钥属于 Agent %s，与当前名称 %s 不一致", keyFile, stored, name)
+	}
+
+	mu.Lock()
+	agentName, key = name, k
+	mu.Unlock()
+	return nil
+}
+
+// StoredName 返回 keyFile 中保存的 Agent 名称，文件不存在或格式错误时返回空
+func StoredName(keyFile string) string {
+	_, name, err := readKeyFile(keyFile)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// readKeyFile 密钥文件第一行为十六进制密钥，第二行为注册时使用的 Agent 名称
+func readKeyFile(keyFile string) ([]byte, string, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, "", err
+	}
+	hexKey, name, _ := strings.Cut(strings.TrimSpace(string(data)), "\n")
+	k, err := hex.DecodeString(strings.TrimSpace(hexKey))
+	if err != nil || len(k) != sha256.Size {
+		return nil, "", fmt.Errorf("%s: 密钥格式错误", keyFile)
+	}
+	return k, strings.TrimSpace(name), nil
+}
+
+// Enrolled 是否已持有注册密钥
+func Enrolled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return key != nil
+}
+
+// Enroll 使用一次性注册令牌向服务端注册
+// 令牌格式为 <id>.<secret>，secret 不在网络上传输，只用于证明持有令牌和派生密钥；
+// 双方通过 X25519 交换公钥，HMAC 密钥由共享密钥和令牌共同派生，截获流量也无法得到
+func Enroll(serverAddr, name, token, agentIP, hostname, keyFile string) error {
+	id, secret, ok := strings.Cut(token, ".")
+	if !ok || id == "" || secret == "" {
+		return errors.New("注册令牌格式错误")
+	}
+
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	pub := hex.EncodeToString(priv.PublicKey().Bytes())
+
+	body, _ := json.Marshal(map[string]string{
+		"agent_name": name,
+		"agent_ip":   agentIP,
+		"host_name":  hostname,
+		"token_id":   id,
+		"public_key": pub,
+		"proof":      EnrollProof(secret, name, pub),
+	})
+	resp, err := httpClient.Post(serverAddr+"/api/v1/agent/enroll", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+		Data struct {
+			PublicKey string `json:"public_key"`
+			Confirm   string `json:"confirm"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return err
+	}
+	if response.Code != 200 {
+		return fmt.Errorf("注册失败: %s", response.Msg)
+	}
+
+	serverPub, err := hex.DecodeString(response.Data.PublicKey)
+	if err != nil {
+		return errors.New("注册失败: 服务端公钥格式错误")
+	}
+	peer, err := ecdh.X25519().NewPublicKey(serverPub)
+	if err != nil {
+		return err
+	}
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		return err
+	}
+	k := DeriveKey(secret, shared, name)
+
+	// 服务端同样持有令牌才能算出确认值，防止注册请求被冒充的服务端接收
+	if !hmac.Equal([]byte(response.Data.Confirm), []byte(mac(k, "enrolled\n"+name))) {
+		return errors.New("注册失败: 服务端确认值不匹配")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyFile, []byte(hex.EncodeToString(k)+"\n"+name+"\n"), 0600); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	agentName, key = name, k
+	mu.Unlock()
+	return nil
+}
+
+// EnrollProof 证明持有令牌，同时绑定 Agent 名称和公钥
+func EnrollProof(secret, name, publicKey string) string {
+	return mac([]byte(secret), "enroll\n"+name+"\n"+publicKey)
+}
+
+// DeriveKey 由 X25519 共享密钥和令牌派生 Agent 的 HMAC 密钥
+func DeriveKey(secret string, shared []byte, name string) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(shared)
+	h.Write([]byte("\n" + name))
+	return h.Sum(nil)
+}
+
+// Sign 计算请求签名：方法、路径和查询、时间戳、随机数以及请求体摘要
+func Sign(k []byte, method, uri, timestamp, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return mac(k, strings.Join([]string{method, uri, timestamp, nonce, hex.EncodeToString(sum[:])}, "\n"))
+}
+
+// SignResponse 计算响应签名，绑定对应请求的签名，防止响应被替换或重放
+func SignResponse(k []byte, requestSignature string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return mac(k, "response\n"+requestSignature+"\n"+hex.EncodeToString(sum[:]))
+}
+
+func mac(k []byte, data string) string {
+	h := hmac.New(sha256.New, k)
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Do 签名并发送请求，校验服务端的响应签名后返回响应体
+func Do(method, url string, body []byte) ([]byte, error) {
+	req, k, signature, err := newRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Header.Get(HeaderSignature) == "" && resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("服务端拒绝请求: %s", strings.TrimSpace(string(data)))
+	}
+	expected := SignResponse(k, signature, data)
+	if !hmac.Equal([]byte(resp.Header.Get(HeaderSignature)), []byte(expected)) {
+		return nil, fmt.Errorf("服务端响应签名校验失败 (HTTP %d)", resp.StatusCode)
+	}
+	return data, nil
+}
+
+// newRequest 创建签名的请求，返回签名密钥和请求签名，用于校验响应
+func newRequest(method, url string, body []byte) (*http.Request, []byte, string, error) {
+	mu.RLock()
+	name, k := agentName, key
+	mu.RUnlock()
+	if k == nil {
+		return nil, nil, "", ErrNotEnrolled
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := Sign(k, method, req.URL.RequestURI(), timestamp, hex.EncodeToString(nonce), body)
+	req.Header.Set(HeaderAgent, name)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, hex.EncodeToString(nonce))
+	req.Header.Set(HeaderSignature, signature)
+	return req, k, signature, nil
+}
+
+// Post 发送签名的 JSON 请求
+func Post(url string, body []byte) ([]byte, error) {
+	return Do(http.MethodPost, url, body)
+}
+
+// Get 发送签名的 GET 请求
+func Get(url string) ([]byte, error) {
+	return Do(http.MethodGet, url, nil)
+}
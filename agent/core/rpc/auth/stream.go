@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxMessageSize 单条推送消息的大小上限，与服务端签名请求体上限一致
+const maxMessageSize = 10 << 20
+
+// streamClient 推送连接是长连接，不设总超时，由调用方按心跳判断连接是否可用
+var streamClient = &http.Client{}
+
+// Message 服务端推送的一条消息
+type Message struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	Signature string          `json:"signature"`
+}
+
+// Stream 服务端推送连接，每行一条 JSON 消息
+type Stream struct {
+	body      io.ReadCloser
+	scanner   *bufio.Scanner
+	key       []byte
+	signature string
+}
+
+// SignMessage 计算推送消息的签名，绑定建立连接的请求签名、消息 ID 和类型
+func SignMessage(k []byte, requestSignature, id, typ string, data []byte) string {
+	sum := sha256.Sum256(data)
+	return mac(k, "message\n"+requestSignature+"\n"+id+"\n"+typ+"\n"+hex.EncodeToString(sum[:]))
+}
+
+// OpenStream 发送签名的 GET 请求建立推送连接
+func OpenStream(url string) (*Stream, error) {
+	req, k, signature, err := newRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/x-ndjson")
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("服务端拒绝推送连接 (HTTP %d): %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), maxMessageSize)
+	return &Stream{body: resp.Body, scanner: scanner, key: k, signature: signature}, nil
+}
+
+// Next 读取下一条消息，签名错误的消息视为连接被篡改，返回错误
+func (s *Stream) Next() (*Message, error) {
+	if !s.scanner.Scan() {
+		if err := s.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	var msg Message
+	if err := json.Unmarshal(s.scanner.Bytes(), &msg); err != nil {
+		return nil, fmt.Errorf("解析推送消息失败: %v", err)
+	}
+	expected := SignMessage(s.key, s.signature, msg.ID, msg.Type, msg.Data)
+	if !hmac.Equal([]byte(msg.Signature), []byte(expected)) {
+		return nil, fmt.Errorf("推送消息签名校验失败: %s", msg.ID)
+	}
+	return &msg, nil
+}
+
+// Close 关闭推送连接，阻塞中的 Next 随之返回
+func (s *Stream) Close() error {
+	return s.body.Close()
+}
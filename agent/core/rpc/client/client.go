@@ -3,18 +3,24 @@ package client
 import (
 	"KubePot/core/common"
 	"KubePot/core/control"
+	"KubePot/core/event"
+	"KubePot/core/honeytoken"
+	"KubePot/core/metrics"
+	"KubePot/core/rpc/auth"
+	"KubePot/core/spool"
 	"KubePot/utils/config"
 	"KubePot/utils/log"
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
-	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -27,19 +33,6 @@ type Status struct {
 	Web, Deep, Ssh, Redis, Mysql, Http, Telnet, Ftp, MemCahe, Plug, ES, TFtp, Vnc, Custom string
 }
 
-// 上报结果结构
-type Result struct {
-	AgentIp     string
-	AgentName   string
-	Hostname    string
-	NodeType    string
-	Type        string
-	ProjectName string
-	SourceIp    string
-	Info        string
-	Id          string // 数据库ID，更新用 0 为新插入数据
-}
-
 var serverAddr string
 var ipAddr string
 var hostname string
@@ -129,11 +122,46 @@ func HttpInit() {
 	hostname, _ = GetHostname()
 	nodeType = getNodeType()
 	fmt.Println("HTTP Server 地址:", serverAddr)
+
+	// 所有上报先写入本地队列，由后台按顺序发送，服务端不可用时不丢数据
+	spoolDir := config.Get("spool", "dir")
+	if err := spool.Init(spoolDir, int64(config.GetInt("spool", "max_mb"))<<20); err != nil {
+		log.Pr("HTTP", "127.0.0.1", "打开上报队列失败", err)
+	} else {
+		go spool.Run(sendEvent)
+	}
+
+	// 加载注册密钥，没有时使用一次性注册令牌向服务端注册
+	// 配置中没有名称时沿用注册时保存的名称，重启后身份不变
+	keyFile := config.Get("rpc", "key_file")
+	if stored := auth.StoredName(keyFile); stored != "" && config.NameGenerated() {
+		if _, err := config.Update("rpc", map[string]string{"name": stored}); err != nil {
+			log.Pr("HTTP", "127.0.0.1", "使用已注册的 Agent 名称失败", err)
+		}
+	}
+	agentName := config.Get("rpc", "name")
+	err := auth.Load(agentName, keyFile)
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		log.Pr("HTTP", "127.0.0.1", "加载注册密钥失败", err)
+	}
+	token := config.Get("rpc", "enroll_token")
+	if token == "" {
+		log.Pr("HTTP", "127.0.0.1", "Agent 未注册", auth.ErrNotEnrolled)
+		return
+	}
+	if err := auth.Enroll(serverAddr, agentName, token, ipAddr, hostname, keyFile); err != nil {
+		log.Pr("HTTP", "127.0.0.1", "Agent 注册失败", err)
+		return
+	}
+	fmt.Println("Agent 注册成功，密钥已保存到", keyFile)
 }
 
 func reportStatus(ipAddr, rpcName string, ftpStatus string, telnetStatus string, httpStatus string, mysqlStatus string, redisStatus string, sshStatus string, webStatus string, darkStatus string, memCacheStatus string, plugStatus string, esStatus string, tftpStatus string, vncStatus string, customStatus string) {
 	// 构建HTTP请求体
-	statusData := map[string]string{
+	statusData := map[string]interface{}{
 		"agent_ip":   ipAddr,
 		"agent_name": rpcName,
 		"host_name":  hostname,
@@ -154,105 +182,82 @@ func reportStatus(ipAddr, rpcName string, ftpStatus string, telnetStatus string,
 		"custom":     customStatus,
 	}
 
-	// 转换为JSON
-	jsonData, err := json.Marshal(statusData)
-	if err != nil {
-		log.Pr("HTTP", "127.0.0.1", "JSON编码失败", err)
-		return
-	}
-
-	// 发送HTTP请求
-	url := serverAddr + "/api/v1/agent/status"
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Pr("HTTP", "127.0.0.1", "上报服务状态失败", err)
-		return
-	}
-	defer resp.Body.Close()
-
-	// 读取响应
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Pr("HTTP", "127.0.0.1", "读取响应失败", err)
-		return
-	}
+	depth, dropped := spool.Stats()
+	statusData["spool_depth"] = strconv.FormatInt(depth, 10)
+	statusData["spool_dropped"] = strconv.FormatInt(dropped, 10)
 
-	// 解析响应
-	var response struct {
-		Code int    `json:"code"`
-		Msg  string `json:"msg"`
-	}
-	if err := json.Unmarshal(body, &response); err != nil {
-		log.Pr("HTTP", "127.0.0.1", "解析响应失败", err)
-		return
-	}
-
-	if response.Code == 200 {
-		fmt.Println("上报服务状态成功")
-	} else {
-		log.Pr("HTTP", "127.0.0.1", "上报服务状态失败", response.Msg)
-	}
+	spool.Enqueue("/api/v1/agent/status", statusData)
 }
 
-func ReportResult(typex string, projectName string, sourceIp string, info string, id string) string {
-	// projectName 只有 WEB 才需要传项目名 其他协议空即可
-	// id 0 为 新插入数据，非 0 都是更新数据
-	// id 非 0 的时候 sourceIp 为空
+// ReportResult 上报一条攻击事件，返回事件 ID
+// projectName 只有 WEB 等自定义名称的蜜罐才需要传，其他协议空即可
+// id 为空或 0 时为新的攻击，否则为之前返回的事件 ID，服务端把本次事件追加到该记录
+func ReportResult(projectName string, ev *event.Event, id string) string {
 	agentId := config.Get("rpc", "name")
 
-	// 构建HTTP请求体
-	resultData := map[string]string{
+	ref := ""
+	if id != "0" && id != "" {
+		ref = id
+		if ev.SessionID == "" {
+			ev.SessionID = id
+		}
+	}
+
+	// 构建HTTP请求体，type 和 source_ip 供旧版服务端使用
+	resultData := map[string]interface{}{
 		"agent_ip":     ipAddr,
 		"agent_name":   agentId,
 		"hostname":     hostname,
 		"node_type":    nodeType,
-		"type":         typex,
+		"type":         ev.Protocol,
 		"project_name": projectName,
-		"source_ip":    sourceIp,
-		"info":         info,
-		"id":           id,
+		"source_ip":    ev.SourceIP,
+		"ref_id":       ref,
+		"event":        ev,
 	}
 
-	// 转换为JSON
-	jsonData, err := json.Marshal(resultData)
-	if err != nil {
-		log.Pr("HTTP", "127.0.0.1", "JSON编码失败", err)
-		return "0"
+	switch ev.Kind {
+	case event.KindAuth:
+		metrics.AuthAttempt(ev.Protocol)
+	case event.KindCommand:
+		metrics.Command(ev.Protocol)
 	}
 
-	// 发送HTTP请求
-	url := serverAddr + "/api/v1/agent/result"
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Pr("HTTP", "127.0.0.1", "上报上钩结果失败", err)
-		return "0"
-	}
-	defer resp.Body.Close()
+	// 写入本地队列后立即返回事件 ID，后续的更新以它关联
+	return spool.Enqueue("/api/v1/agent/result", resultData)
+}
+
+// sendEvent 发送队列中的一条事件并记录结果
+func sendEvent(ev spool.Event) error {
+	err := postEvent(ev)
+	metrics.Report(err)
+	return err
+}
+
+// codeBadReport 服务端无法解析上报内容时返回的错误码，与服务端 error.ErrFailPlugCode 一致
+const codeBadReport = 1005
 
-	// 读取响应
-	body, err := ioutil.ReadAll(resp.Body)
+// postEvent 发送一条事件，只有服务端判定为格式错误的事件不再重试，入库失败等其他错误按队列退避重试
+func postEvent(ev spool.Event) error {
+	body, err := auth.Post(serverAddr+ev.Path, ev.Body)
 	if err != nil {
-		log.Pr("HTTP", "127.0.0.1", "读取响应失败", err)
-		return "0"
+		return err
 	}
 
-	// 解析响应
 	var response struct {
 		Code int    `json:"code"`
 		Msg  string `json:"msg"`
-		Data string `json:"data"`
 	}
 	if err := json.Unmarshal(body, &response); err != nil {
-		log.Pr("HTTP", "127.0.0.1", "解析响应失败", err)
-		return "0"
+		return err
 	}
-
-	if response.Code == 200 {
-		fmt.Println("上报上钩结果成功")
-		return response.Data
-	} else {
-		log.Pr("HTTP", "127.0.0.1", "上报上钩结果失败", response.Msg)
-		return "0"
+	switch response.Code {
+	case 200:
+		return nil
+	case codeBadReport:
+		return spool.Permanent(errors.New(response.Msg))
+	default:
+		return errors.New(response.Msg)
 	}
 }
 
@@ -291,21 +296,13 @@ type TaskList struct {
 
 // 获取蜜罐服务配置
 func GetHoneypotConfig(agentName string) (*HoneypotConfig, error) {
-	// 发送HTTP请求
-	url := serverAddr + "/api/v1/agent/honeypot/config?agent=" + agentName
-	resp, err := http.Get(url)
+	// 发送签名的HTTP请求
+	url := serverAddr + "/api/v1/agent/honeypot/config?agent=" + url.QueryEscape(agentName)
+	body, err := auth.Get(url)
 	if err != nil {
 		log.Pr("HTTP", "127.0.0.1", "获取蜜罐配置失败", err)
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	// 读取响应
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Pr("HTTP", "127.0.0.1", "读取响应失败", err)
-		return nil, err
-	}
 
 	// 解析响应
 	var response struct {
@@ -322,49 +319,43 @@ func GetHoneypotConfig(agentName string) (*HoneypotConfig, error) {
 		return nil, fmt.Errorf("获取蜜罐配置失败: %s", response.Msg)
 	}
 
-	// 构建HoneypotConfig
-	config := &HoneypotConfig{
-		Web:     fmt.Sprintf("%v", response.Data["web"]),
-		Deep:    fmt.Sprintf("%v", response.Data["deep"]),
-		Ssh:     fmt.Sprintf("%v", response.Data["ssh"]),
-		Redis:   fmt.Sprintf("%v", response.Data["redis"]),
-		Mysql:   fmt.Sprintf("%v", response.Data["mysql"]),
-		Http:    fmt.Sprintf("%v", response.Data["http"]),
-		Telnet:  fmt.Sprintf("%v", response.Data["telnet"]),
-		Ftp:     fmt.Sprintf("%v", response.Data["ftp"]),
-		MemCahe: fmt.Sprintf("%v", response.Data["mem_cahe"]),
-		Plug:    fmt.Sprintf("%v", response.Data["plug"]),
-		ES:      fmt.Sprintf("%v", response.Data["es"]),
-		TFtp:    fmt.Sprintf("%v", response.Data["tftp"]),
-		Vnc:     fmt.Sprintf("%v", response.Data["vnc"]),
-		Custom:  fmt.Sprintf("%v", response.Data["custom"]),
-	}
-
-	return config, nil
+	return newHoneypotConfig(response.Data), nil
+}
+
+// newHoneypotConfig 从服务端返回的配置构建HoneypotConfig
+func newHoneypotConfig(data map[string]interface{}) *HoneypotConfig {
+	return &HoneypotConfig{
+		Web:     fmt.Sprintf("%v", data["web"]),
+		Deep:    fmt.Sprintf("%v", data["deep"]),
+		Ssh:     fmt.Sprintf("%v", data["ssh"]),
+		Redis:   fmt.Sprintf("%v", data["redis"]),
+		Mysql:   fmt.Sprintf("%v", data["mysql"]),
+		Http:    fmt.Sprintf("%v", data["http"]),
+		Telnet:  fmt.Sprintf("%v", data["telnet"]),
+		Ftp:     fmt.Sprintf("%v", data["ftp"]),
+		MemCahe: fmt.Sprintf("%v", data["mem_cahe"]),
+		Plug:    fmt.Sprintf("%v", data["plug"]),
+		ES:      fmt.Sprintf("%v", data["es"]),
+		TFtp:    fmt.Sprintf("%v", data["tftp"]),
+		Vnc:     fmt.Sprintf("%v", data["vnc"]),
+		Custom:  fmt.Sprintf("%v", data["custom"]),
+	}
 }
 
 // 获取下发任务
 func GetTasks(agentName string) (*TaskList, error) {
 	// 发送HTTP请求
-	url := serverAddr + "/api/v1/agent/tasks?agent=" + agentName
+	url := serverAddr + "/api/v1/agent/tasks?agent=" + url.QueryEscape(agentName)
 	log.Pr("Task", "127.0.0.1", "请求下发任务", url)
 
-	resp, err := http.Get(url)
+	body, err := auth.Get(url)
 	if err != nil {
 		log.Pr("HTTP", "127.0.0.1", "获取下发任务失败", err)
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// 读取响应
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Pr("HTTP", "127.0.0.1", "读取响应失败", err)
-		return nil, err
-	}
-
-	// 打印响应内容
-	log.Pr("Task", "127.0.0.1", "响应内容", string(body))
+	// 响应中包含密标内容，只在调试时输出
+	log.Debug("Task", "127.0.0.1", "响应内容", string(body))
 
 	// 解析响应
 	var response struct {
@@ -386,39 +377,45 @@ func GetTasks(agentName string) (*TaskList, error) {
 	return &response.Data, nil
 }
 
-// 处理任务
+// 处理任务，处理结果和状态上报给服务端
 func HandleTask(task *Task) error {
+	var result map[string]interface{}
+	var err error
+
 	// 根据任务类型和动作处理任务
 	switch task.Type {
 	case "service":
 		// 处理服务相关任务
-		control.HandleControlCommand(&common.ControlCommand{
-			AgentName: "", // 可以从任务中获取
-			Action:    task.Action,
-			Service:   task.Service,
-			Status:    "1", // 任务模式下默认状态为1
-		})
+		result, err = handleServiceTask(task)
 	case "config":
-		// 处理配置相关任务
-		// 这里可以根据task.Params中的配置参数进行处理
+		// 修改蜜罐配置，只重启受影响的服务
+		result, err = handleConfigTask(task)
 	case "command":
-		// 处理命令执行任务
-		// 这里可以根据task.Params中的命令参数进行处理
+		// 执行允许的命令
+		result, err = handleCommandTask(task)
 	case "secret_label":
 		// 处理密标任务
-		err := handleSecretLabelTask(task)
-		if err != nil {
-			// 更新任务状态为失败
-			updateTaskStatus(task.ID, "failed")
-			return err
-		}
-		// 更新任务状态为成功
-		updateTaskStatus(task.ID, "completed")
+		err = handleSecretLabelTask(task)
+	case "secret_label_delete":
+		// 处理密标删除任务
+		err = handleSecretLabelDeleteTask(task)
 	default:
 		log.Pr("Task", "127.0.0.1", "未知任务类型", task.Type)
+		err = fmt.Errorf("未知任务类型: %s", task.Type)
 	}
 
-	return nil
+	status := "completed"
+	if err != nil {
+		status = "failed"
+		if result == nil {
+			result = make(map[string]interface{})
+		}
+		result["error"] = err.Error()
+	}
+	if reportErr := updateTaskStatus(task.ID, status, result); reportErr != nil {
+		log.Pr("Task", "127.0.0.1", "更新任务状态失败", reportErr)
+	}
+	return err
 }
 
 // 处理密标任务
@@ -430,17 +427,7 @@ func handleSecretLabelTask(task *Task) error {
 	}
 
 	// 解析密标数据
-	var secretLabel struct {
-		ID               int    `json:"id"`
-		Name             string `json:"name"`
-		LabelType        string `json:"label_type"`
-		FilePath         string `json:"file_path"`
-		FileContent      string `json:"file_content"`
-		AgentType        string `json:"agent_type"`
-		AgentList        string `json:"agent_list"`
-		MonitorTampering bool   `json:"monitor_tampering"`
-	}
-
+	var secretLabel common.SecretLabel
 	err := json.Unmarshal([]byte(taskData), &secretLabel)
 	if err != nil {
 		return fmt.Errorf("解析密标数据失败: %v", err)
@@ -452,14 +439,92 @@ func handleSecretLabelTask(task *Task) error {
 		return fmt.Errorf("创建密标文件失败: %v", err)
 	}
 
-	// 重新加载文件监控
-	// 这里需要调用文件监控模块的重新加载方法
-	// 由于文件监控模块可能在其他包中，这里暂时只记录日志
+	// 登记文件中的凭据，攻击者使用时触发蜜标告警
+	if count := honeytoken.Register(secretLabel.ID, secretLabel.Name, secretLabel.FileContent); count > 0 {
+		log.Pr("Task", "127.0.0.1", "登记蜜标凭据", fmt.Sprintf("%s: %d", secretLabel.Name, count))
+	}
+
 	log.Pr("Task", "127.0.0.1", "密标文件创建成功", secretLabel.FilePath)
 
+	// 立即开始监控新文件，并把监控状态上报给服务端
+	status := control.ApplySecretLabel(secretLabel)
+	reportWatchStatus([]common.WatchStatus{status})
+	if status.Status == common.WatchFailed {
+		return fmt.Errorf("监控密标文件失败: %s", status.Error)
+	}
+
 	return nil
 }
 
+// 处理密标删除任务
+func handleSecretLabelDeleteTask(task *Task) error {
+	taskData, ok := task.Params["task_data"].(string)
+	if !ok {
+		return fmt.Errorf("任务参数中缺少task_data")
+	}
+
+	var secretLabel common.SecretLabel
+	if err := json.Unmarshal([]byte(taskData), &secretLabel); err != nil {
+		return fmt.Errorf("解析密标数据失败: %v", err)
+	}
+
+	// 先取消监控，删除文件不产生告警
+	status := control.RemoveSecretLabel(secretLabel.ID)
+	honeytoken.Unregister(secretLabel.ID)
+
+	if isPathSafe(secretLabel.FilePath) {
+		if err := os.Remove(secretLabel.FilePath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("删除密标文件失败: %v", err)
+		}
+	}
+	log.Pr("Task", "127.0.0.1", "密标文件已删除", secretLabel.FilePath)
+
+	reportWatchStatus([]common.WatchStatus{status})
+	return nil
+}
+
+// 定期与服务端同步密标监控，补上错过的任务
+const secretLabelResyncInterval = 10 * time.Minute
+
+// resyncSecretLabels 同步密标监控并上报每个密标的监控状态
+func resyncSecretLabels() {
+	statuses, err := control.ResyncSecretLabels()
+	if err != nil {
+		log.Pr("Task", "127.0.0.1", "同步密标监控失败", err)
+		return
+	}
+	reportWatchStatus(statuses)
+}
+
+// reportWatchStatus 上报密标监控状态
+func reportWatchStatus(statuses []common.WatchStatus) {
+	if len(statuses) == 0 {
+		return
+	}
+
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"watches": statuses,
+	})
+	if err != nil {
+		return
+	}
+
+	// 发送签名的HTTP请求
+	body, err := auth.Post(serverAddr+"/api/v1/secretlabel/watch", jsonData)
+	if err != nil {
+		log.Pr("Task", "127.0.0.1", "上报密标监控状态失败", err)
+		return
+	}
+
+	var response struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil || response.Code != 200 {
+		log.Pr("Task", "127.0.0.1", "上报密标监控状态失败", string(body))
+	}
+}
+
 // 危险路径清单，包含可能导致安全隐患的路径模式
 var dangerousPaths = []string{
 	// 任务计划相关路径
@@ -553,12 +618,13 @@ func createSecretLabelFile(filePath, content string) error {
 	return nil
 }
 
-// 更新任务状态
-func updateTaskStatus(taskID, status string) error {
+// 更新任务状态，result 为任务的处理结果
+func updateTaskStatus(taskID, status string, result map[string]interface{}) error {
 	// 构建请求数据
-	statusData := map[string]string{
+	statusData := map[string]interface{}{
 		"task_id": taskID,
 		"status":  status,
+		"result":  result,
 	}
 
 	// 转换为JSON
@@ -567,16 +633,9 @@ func updateTaskStatus(taskID, status string) error {
 		return err
 	}
 
-	// 发送HTTP请求
+	// 发送签名的HTTP请求
 	url := serverAddr + "/api/v1/agent/task/status"
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	// 读取响应
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := auth.Post(url, jsonData)
 	if err != nil {
 		return err
 	}
@@ -600,10 +659,28 @@ func updateTaskStatus(taskID, status string) error {
 // 配置变更跟踪缓存
 var lastConfig map[string]string
 
+// handledTaskTTL 任务处理后在该时间内不重复处理
+const handledTaskTTL = 10 * time.Minute
+
+var (
+	// taskMu 推送和轮询不同时处理任务和配置
+	taskMu       sync.Mutex
+	handledTasks = make(map[string]time.Time)
+)
+
 // 启动控制命令处理循环
 func StartControlLoop() {
+	var lastResync, lastPoll time.Time
+
 	// 定期从服务器端获取蜜罐配置并更新服务状态
 	for {
+		// 推送连接可用时任务和配置已实时下发，轮询只作为兜底
+		if streamConnected.Load() && time.Since(lastPoll) < streamPollInterval {
+			time.Sleep(time.Duration(1) * time.Minute)
+			continue
+		}
+		lastPoll = time.Now()
+
 		// 获取 Agent 名称
 		agentName := config.Get("rpc", "name")
 		if agentName == "" {
@@ -613,206 +690,7 @@ func StartControlLoop() {
 		// 1. 定期从服务器端获取蜜罐配置并更新服务状态
 		config, err := GetHoneypotConfig(agentName)
 		if err == nil && config != nil {
-			// 检查配置是否为空（没有变更）
-			if config.Web == "" && config.Ssh == "" && config.Redis == "" && config.Mysql == "" &&
-				config.Http == "" && config.Telnet == "" && config.Ftp == "" && config.MemCahe == "" &&
-				config.ES == "" && config.TFtp == "" && config.Vnc == "" && config.Custom == "" {
-				// 配置为空，没有变更，跳过处理
-				fmt.Printf("配置未变更: Agent=%s\n", agentName)
-			} else {
-				// 配置有变更，处理配置
-				fmt.Printf("获取到蜜罐配置: Agent=%s\n", agentName)
-
-				// 处理各种服务的配置
-				// 对于每个服务，我们只在状态为开启时才启动服务，状态为关闭时停止服务
-
-				// SSH 服务
-				if config.Ssh == "1" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "start",
-						Service:   "ssh",
-						Status:    config.Ssh,
-					})
-				} else if config.Ssh == "0" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "stop",
-						Service:   "ssh",
-						Status:    config.Ssh,
-					})
-				}
-
-				// FTP 服务
-				if config.Ftp == "1" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "start",
-						Service:   "ftp",
-						Status:    config.Ftp,
-					})
-				} else if config.Ftp == "0" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "stop",
-						Service:   "ftp",
-						Status:    config.Ftp,
-					})
-				}
-
-				// HTTP 服务
-				if config.Http == "1" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "start",
-						Service:   "http",
-						Status:    config.Http,
-					})
-				} else if config.Http == "0" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "stop",
-						Service:   "http",
-						Status:    config.Http,
-					})
-				}
-
-				// Redis 服务
-				if config.Redis == "1" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "start",
-						Service:   "redis",
-						Status:    config.Redis,
-					})
-				} else if config.Redis == "0" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "stop",
-						Service:   "redis",
-						Status:    config.Redis,
-					})
-				}
-
-				// MySQL 服务
-				if config.Mysql == "1" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "start",
-						Service:   "mysql",
-						Status:    config.Mysql,
-					})
-				} else if config.Mysql == "0" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "stop",
-						Service:   "mysql",
-						Status:    config.Mysql,
-					})
-				}
-
-				// Telnet 服务
-				if config.Telnet == "1" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "start",
-						Service:   "telnet",
-						Status:    config.Telnet,
-					})
-				} else if config.Telnet == "0" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "stop",
-						Service:   "telnet",
-						Status:    config.Telnet,
-					})
-				}
-
-				// TFTP 服务
-				if config.TFtp == "1" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "start",
-						Service:   "tftp",
-						Status:    config.TFtp,
-					})
-				} else if config.TFtp == "0" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "stop",
-						Service:   "tftp",
-						Status:    config.TFtp,
-					})
-				}
-
-				// VNC 服务
-				if config.Vnc == "1" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "start",
-						Service:   "vnc",
-						Status:    config.Vnc,
-					})
-				} else if config.Vnc == "0" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "stop",
-						Service:   "vnc",
-						Status:    config.Vnc,
-					})
-				}
-
-				// MemCache 服务
-				if config.MemCahe == "1" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "start",
-						Service:   "memcache",
-						Status:    config.MemCahe,
-					})
-				} else if config.MemCahe == "0" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "stop",
-						Service:   "memcache",
-						Status:    config.MemCahe,
-					})
-				}
-
-				// Web 服务
-				if config.Web == "1" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "start",
-						Service:   "web",
-						Status:    config.Web,
-					})
-				} else if config.Web == "0" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "stop",
-						Service:   "web",
-						Status:    config.Web,
-					})
-				}
-
-				// Elasticsearch 服务
-				if config.ES == "1" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "start",
-						Service:   "elasticsearch",
-						Status:    config.ES,
-					})
-				} else if config.ES == "0" {
-					control.HandleControlCommand(&common.ControlCommand{
-						AgentName: agentName,
-						Action:    "stop",
-						Service:   "elasticsearch",
-						Status:    config.ES,
-					})
-				}
-			}
+			applyHoneypotConfig(agentName, config)
 		}
 
 		// 2. 定期从服务器端获取下发任务并处理
@@ -826,15 +704,13 @@ func StartControlLoop() {
 		} else {
 			// 处理任务
 			fmt.Printf("获取到下发任务数量: %d, Agent=%s\n", len(tasks.Tasks), agentName)
-			for _, task := range tasks.Tasks {
-				fmt.Printf("处理任务: ID=%s, Type=%s, Action=%s, Service=%s\n", task.ID, task.Type, task.Action, task.Service)
-				err := HandleTask(&task)
-				if err != nil {
-					log.Pr("Task", "127.0.0.1", "处理任务失败", err)
-				} else {
-					log.Pr("Task", "127.0.0.1", "处理任务成功", task.ID)
-				}
-			}
+			handleTasks(tasks.Tasks)
+		}
+
+		// 3. 定期全量同步密标监控
+		if time.Since(lastResync) >= secretLabelResyncInterval {
+			resyncSecretLabels()
+			lastResync = time.Now()
 		}
 
 		// 休眠一段时间后再次检查
@@ -842,11 +718,258 @@ func StartControlLoop() {
 	}
 }
 
+// applyHoneypotConfig 按服务端的蜜罐配置开启或关闭服务，轮询和推送共用
+func applyHoneypotConfig(agentName string, config *HoneypotConfig) {
+	taskMu.Lock()
+	defer taskMu.Unlock()
+
+	// 检查配置是否为空（没有变更）
+	if config.Web == "" && config.Ssh == "" && config.Redis == "" && config.Mysql == "" &&
+		config.Http == "" && config.Telnet == "" && config.Ftp == "" && config.MemCahe == "" &&
+		config.ES == "" && config.TFtp == "" && config.Vnc == "" && config.Custom == "" {
+		// 配置为空，没有变更，跳过处理
+		fmt.Printf("配置未变更: Agent=%s\n", agentName)
+	} else {
+		// 配置有变更，处理配置
+		fmt.Printf("获取到蜜罐配置: Agent=%s\n", agentName)
+
+		// 处理各种服务的配置
+		// 对于每个服务，我们只在状态为开启时才启动服务，状态为关闭时停止服务
+
+		// SSH 服务
+		if config.Ssh == "1" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "start",
+				Service:   "ssh",
+				Status:    config.Ssh,
+			})
+		} else if config.Ssh == "0" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "stop",
+				Service:   "ssh",
+				Status:    config.Ssh,
+			})
+		}
+
+		// FTP 服务
+		if config.Ftp == "1" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "start",
+				Service:   "ftp",
+				Status:    config.Ftp,
+			})
+		} else if config.Ftp == "0" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "stop",
+				Service:   "ftp",
+				Status:    config.Ftp,
+			})
+		}
+
+		// HTTP 服务
+		if config.Http == "1" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "start",
+				Service:   "http",
+				Status:    config.Http,
+			})
+		} else if config.Http == "0" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "stop",
+				Service:   "http",
+				Status:    config.Http,
+			})
+		}
+
+		// Redis 服务
+		if config.Redis == "1" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "start",
+				Service:   "redis",
+				Status:    config.Redis,
+			})
+		} else if config.Redis == "0" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "stop",
+				Service:   "redis",
+				Status:    config.Redis,
+			})
+		}
+
+		// MySQL 服务
+		if config.Mysql == "1" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "start",
+				Service:   "mysql",
+				Status:    config.Mysql,
+			})
+		} else if config.Mysql == "0" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "stop",
+				Service:   "mysql",
+				Status:    config.Mysql,
+			})
+		}
+
+		// Telnet 服务
+		if config.Telnet == "1" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "start",
+				Service:   "telnet",
+				Status:    config.Telnet,
+			})
+		} else if config.Telnet == "0" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "stop",
+				Service:   "telnet",
+				Status:    config.Telnet,
+			})
+		}
+
+		// TFTP 服务
+		if config.TFtp == "1" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "start",
+				Service:   "tftp",
+				Status:    config.TFtp,
+			})
+		} else if config.TFtp == "0" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "stop",
+				Service:   "tftp",
+				Status:    config.TFtp,
+			})
+		}
+
+		// VNC 服务
+		if config.Vnc == "1" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "start",
+				Service:   "vnc",
+				Status:    config.Vnc,
+			})
+		} else if config.Vnc == "0" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "stop",
+				Service:   "vnc",
+				Status:    config.Vnc,
+			})
+		}
+
+		// MemCache 服务
+		if config.MemCahe == "1" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "start",
+				Service:   "memcache",
+				Status:    config.MemCahe,
+			})
+		} else if config.MemCahe == "0" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "stop",
+				Service:   "memcache",
+				Status:    config.MemCahe,
+			})
+		}
+
+		// Web 服务
+		if config.Web == "1" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "start",
+				Service:   "web",
+				Status:    config.Web,
+			})
+		} else if config.Web == "0" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "stop",
+				Service:   "web",
+				Status:    config.Web,
+			})
+		}
+
+		// Elasticsearch 服务
+		if config.ES == "1" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "start",
+				Service:   "elasticsearch",
+				Status:    config.ES,
+			})
+		} else if config.ES == "0" {
+			control.HandleControlCommand(&common.ControlCommand{
+				AgentName: agentName,
+				Action:    "stop",
+				Service:   "elasticsearch",
+				Status:    config.ES,
+			})
+		}
+	}
+}
+
+// handleTasks 依次处理任务，推送和轮询可能拿到同一任务，近期处理过的任务跳过
+func handleTasks(tasks []Task) {
+	taskMu.Lock()
+	defer taskMu.Unlock()
+
+	now := time.Now()
+	for id, t := range handledTasks {
+		if now.Sub(t) >= handledTaskTTL {
+			delete(handledTasks, id)
+		}
+	}
+	for _, task := range tasks {
+		if _, ok := handledTasks[task.ID]; ok {
+			continue
+		}
+		handledTasks[task.ID] = now
+
+		fmt.Printf("处理任务: ID=%s, Type=%s, Action=%s, Service=%s\n", task.ID, task.Type, task.Action, task.Service)
+		err := HandleTask(&task)
+		if err != nil {
+			log.Pr("Task", "127.0.0.1", "处理任务失败", err)
+		} else {
+			log.Pr("Task", "127.0.0.1", "处理任务成功", task.ID)
+		}
+	}
+}
+
+// 控制命令处理循环只启动一次
+var controlLoopOnce sync.Once
+
 func Start(rpcName string, ftpStatus string, telnetStatus string, httpStatus string, mysqlStatus string, redisStatus string, sshStatus string, webStatus string, darkStatus string, memCacheStatus string, plugStatus string, esStatus string, tftpStatus string, vncStatus string, customStatus string) {
 	reportStatus(ipAddr, rpcName, ftpStatus, telnetStatus, httpStatus, mysqlStatus, redisStatus, sshStatus, webStatus, darkStatus, memCacheStatus, plugStatus, esStatus, tftpStatus, vncStatus, customStatus)
 
-	// 启动控制命令处理循环
-	go StartControlLoop()
+	// 启动控制命令处理循环、心跳和推送连接，Start 每分钟调用一次，循环只启动一个
+	controlLoopOnce.Do(func() {
+		go StartControlLoop()
+	})
+	heartbeatOnce.Do(func() {
+		go StartHeartbeat()
+	})
+	if config.Get("rpc", "push") == "1" {
+		streamOnce.Do(func() {
+			go StartStream()
+		})
+	}
 }
 
 // 处理控制命令
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"KubePot/core/health"
+	"KubePot/core/rpc/auth"
+	"KubePot/core/spool"
+	"KubePot/utils/config"
+	"KubePot/utils/log"
+	"KubePot/utils/version"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// startTime Agent 启动时间，心跳中据此计算运行时长
+var startTime = time.Now()
+
+var heartbeatOnce sync.Once
+
+// Heartbeat Agent 定期发送的心跳
+type Heartbeat struct {
+	AgentName string           `json:"agent_name"`
+	AgentIP   string           `json:"agent_ip"`
+	HostName  string           `json:"host_name"`
+	NodeType  string           `json:"node_type"`
+	Version   string           `json:"version"`
+	StartTime int64            `json:"start_time"`
+	Uptime    int64            `json:"uptime"`
+	Services  []health.Service `json:"services"`
+	// SpoolDepth 和 SpoolDropped 上报队列的积压和丢弃数
+	SpoolDepth   int64 `json:"spool_depth"`
+	SpoolDropped int64 `json:"spool_dropped"`
+}
+
+// StartHeartbeat 按 rpc.heartbeat_interval 定期发送心跳
+// 心跳不写入上报队列，服务端不可用时直接丢弃，恢复后补发的旧心跳没有意义
+func StartHeartbeat() {
+	interval := time.Duration(config.GetInt("rpc", "heartbeat_interval")) * time.Second
+	for {
+		if err := sendHeartbeat(); err != nil {
+			log.Pr("HTTP", "127.0.0.1", "发送心跳失败", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// newHeartbeat 采集当前状态，诊断命令同样使用
+func newHeartbeat() Heartbeat {
+	depth, dropped := spool.Stats()
+	return Heartbeat{
+		AgentName:    config.Get("rpc", "name"),
+		AgentIP:      ipAddr,
+		HostName:     hostname,
+		NodeType:     nodeType,
+		Version:      version.Version,
+		StartTime:    startTime.Unix(),
+		Uptime:       int64(time.Since(startTime).Seconds()),
+		Services:     health.Services(),
+		SpoolDepth:   depth,
+		SpoolDropped: dropped,
+	}
+}
+
+func sendHeartbeat() error {
+	body, err := json.Marshal(newHeartbeat())
+	if err != nil {
+		return err
+	}
+
+	resp, err := auth.Post(serverAddr+"/api/v1/agent/heartbeat", body)
+	if err != nil {
+		return err
+	}
+	var response struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.Unmarshal(resp, &response); err != nil {
+		return err
+	}
+	if response.Code != 200 {
+		return errors.New(response.Msg)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"KubePot/core/rpc/auth"
+	"KubePot/utils/config"
+	"KubePot/utils/log"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// 推送连接断开后按指数退避重连
+	streamRetryMin = time.Second
+	streamRetryMax = time.Minute
+	// streamIdle 服务端每 25 秒发送一次心跳，超过该时间没有消息视为连接已断开
+	streamIdle = time.Minute
+	// streamPollInterval 推送连接可用时的轮询间隔
+	streamPollInterval = 5 * time.Minute
+)
+
+var (
+	streamOnce sync.Once
+	// streamConnected 推送连接是否可用，控制循环据此降低轮询频率
+	streamConnected atomic.Bool
+)
+
+// StartStream 保持与服务端的推送连接，任务和配置变更通过它立即下发，断开期间由控制循环轮询
+func StartStream() {
+	retry := streamRetryMin
+	for {
+		start := time.Now()
+		err := runStream()
+		streamConnected.Store(false)
+		log.Pr("Stream", "127.0.0.1", "推送连接断开", err)
+
+		// 连接保持过一段时间说明服务端正常，从最短间隔重新开始
+		if time.Since(start) >= streamRetryMax {
+			retry = streamRetryMin
+		}
+		time.Sleep(retry)
+		if retry *= 2; retry > streamRetryMax {
+			retry = streamRetryMax
+		}
+	}
+}
+
+func runStream() error {
+	agentName := config.Get("rpc", "name")
+	stream, err := auth.OpenStream(serverAddr + "/api/v1/agent/stream?agent=" + url.QueryEscape(agentName))
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	streamConnected.Store(true)
+	log.Pr("Stream", "127.0.0.1", "推送连接已建立", agentName)
+
+	// 长时间没有消息时关闭连接，阻塞中的 Next 随之返回
+	idle := time.AfterFunc(streamIdle, func() {
+		stream.Close()
+	})
+	defer idle.Stop()
+
+	for {
+		msg, err := stream.Next()
+		if err != nil {
+			return err
+		}
+		idle.Reset(streamIdle)
+
+		switch msg.Type {
+		case "ping":
+			continue
+		case "tasks":
+			var list TaskList
+			if err := json.Unmarshal(msg.Data, &list); err != nil {
+				log.Pr("Stream", "127.0.0.1", "解析推送任务失败", err)
+				continue
+			}
+			log.Pr("Stream", "127.0.0.1", "收到推送任务", len(list.Tasks))
+			handleTasks(list.Tasks)
+		case "config":
+			var data map[string]interface{}
+			if err := json.Unmarshal(msg.Data, &data); err != nil {
+				log.Pr("Stream", "127.0.0.1", "解析推送配置失败", err)
+				continue
+			}
+			applyHoneypotConfig(agentName, newHoneypotConfig(data))
+		default:
+			log.Pr("Stream", "127.0.0.1", "未知推送消息类型", msg.Type)
+		}
+
+		if err := ackMessage(msg.ID); err != nil {
+			log.Pr("Stream", "127.0.0.1", "确认推送消息失败", err)
+		}
+	}
+}
+
+// ackMessage 确认已处理推送的消息，未确认的消息服务端稍后重发
+func ackMessage(id string) error {
+	body, err := json.Marshal(map[string]string{"id": id})
+	if err != nil {
+		return err
+	}
+	resp, err := auth.Post(serverAddr+"/api/v1/agent/stream/ack", body)
+	if err != nil {
+		return err
+	}
+	var response struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.Unmarshal(resp, &response); err != nil {
+		return err
+	}
+	if response.Code != 200 {
+		return errors.New(response.Msg)
+	}
+	return nil
+}
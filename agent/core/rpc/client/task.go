@@ -0,0 +1,123 @@
+package client
+
+import (
+	"KubePot/core/common"
+	"KubePot/core/control"
+	"KubePot/utils/config"
+	"KubePot/utils/log"
+	"fmt"
+	"runtime"
+	"strconv"
+)
+
+// 允许执行的命令任务，Action 为命令名
+var commands = map[string]func(params map[string]interface{}) (map[string]interface{}, error){
+	// diagnostics 采集与心跳相同的状态和运行时信息
+	"diagnostics": diagnosticsCommand,
+	// resync 立即与服务端同步密标监控
+	"resync": resyncCommand,
+	// log_level 修改日志级别，params.level 为 debug、info 或 silent
+	"log_level": logLevelCommand,
+}
+
+// handleServiceTask 开启或关闭服务，状态取 params.status，未指定时按 start/stop 动作
+func handleServiceTask(task *Task) (map[string]interface{}, error) {
+	status := paramString(task.Params["status"])
+	if status == "" {
+		switch task.Action {
+		case "start":
+			status = "1"
+		case "stop":
+			status = "0"
+		default:
+			return nil, fmt.Errorf("未知服务动作: %s", task.Action)
+		}
+	}
+	if _, err := strconv.Atoi(status); err != nil {
+		return nil, fmt.Errorf("服务状态错误: %s", status)
+	}
+
+	control.HandleControlCommand(&common.ControlCommand{
+		AgentName: config.Get("rpc", "name"),
+		Action:    task.Action,
+		Service:   task.Service,
+		Status:    status,
+	})
+	return map[string]interface{}{"service": task.Service, "status": status}, nil
+}
+
+// handleConfigTask 修改服务的配置项，params 为 键 -> 值，如 {"addr": "0.0.0.0:2222"}
+func handleConfigTask(task *Task) (map[string]interface{}, error) {
+	if len(task.Params) == 0 {
+		return nil, fmt.Errorf("任务参数中缺少配置项")
+	}
+	values := make(map[string]string, len(task.Params))
+	for key, value := range task.Params {
+		values[key] = paramString(value)
+	}
+
+	changed, action, err := control.UpdateConfig(task.Service, values)
+	if err != nil {
+		return map[string]interface{}{"service": task.Service, "changed": changed}, err
+	}
+	log.Pr("Task", "127.0.0.1", "配置已修改", fmt.Sprintf("%s %v: %s", task.Service, changed, action))
+	return map[string]interface{}{"service": task.Service, "changed": changed, "action": action}, nil
+}
+
+// handleCommandTask 执行允许的命令
+func handleCommandTask(task *Task) (map[string]interface{}, error) {
+	command, ok := commands[task.Action]
+	if !ok {
+		return nil, fmt.Errorf("不允许执行的命令: %s", task.Action)
+	}
+	return command(task.Params)
+}
+
+func diagnosticsCommand(params map[string]interface{}) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"heartbeat":  newHeartbeat(),
+		"log_level":  log.Level(),
+		"go_version": runtime.Version(),
+		"goroutines": runtime.NumGoroutine(),
+		"metrics":    config.Get("metrics", "status") == "1",
+		"monitor":    config.Get("monitor", "mode"),
+	}, nil
+}
+
+func resyncCommand(params map[string]interface{}) (map[string]interface{}, error) {
+	statuses, err := control.ResyncSecretLabels()
+	if err != nil {
+		return nil, err
+	}
+	reportWatchStatus(statuses)
+
+	failed := 0
+	for _, status := range statuses {
+		if status.Status == common.WatchFailed {
+			failed++
+		}
+	}
+	return map[string]interface{}{"labels": len(statuses), "failed": failed}, nil
+}
+
+func logLevelCommand(params map[string]interface{}) (map[string]interface{}, error) {
+	previous := log.Level()
+	if err := log.SetLevel(paramString(params["level"])); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"previous": previous, "level": log.Level()}, nil
+}
+
+// paramString 把任务参数转为配置值，JSON 数字不使用科学计数法
+func paramString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,257 @@
+package session
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"KubePot/core/event"
+	"KubePot/core/metrics"
+	"KubePot/core/rpc/client"
+	"KubePot/utils/is"
+)
+
+// 会话关闭原因
+const (
+	ReasonClientClosed = "client closed"
+	ReasonServerClosed = "server closed"
+	ReasonTimeout      = "timeout"
+	// 无连接协议一次传输结束
+	ReasonTransferComplete = "transfer complete"
+)
+
+// Session 攻击者的一次连接，连接内的所有事件都带有会话 ID，服务端据此按会话聚合
+type Session struct {
+	ID          string
+	Protocol    string
+	ProjectName string
+	Remote      net.Addr
+	Local       net.Addr
+	Start       time.Time
+
+	bytesIn  int64
+	bytesOut int64
+	requests int64
+
+	mu     sync.Mutex
+	reason string
+	closed bool
+}
+
+// active 未关闭的会话，按来源地址索引，供只能拿到地址的回调查找
+var active sync.Map
+
+// New 创建会话并上报会话开始事件
+func New(protocol string, projectName string, remote net.Addr, local net.Addr) *Session {
+	s := &Session{
+		ID:          uuid.NewString(),
+		Protocol:    protocol,
+		ProjectName: projectName,
+		Remote:      remote,
+		Local:       local,
+		Start:       time.Now(),
+	}
+	if remote != nil {
+		active.Store(remote.String(), s)
+	}
+	metrics.SessionOpened(protocol)
+	if is.Rpc() {
+		go client.ReportResult(projectName, s.newEvent(event.KindOpen), "")
+	}
+	return s
+}
+
+// Lookup 按来源地址查找未关闭的会话，找不到时返回 nil
+func Lookup(remote net.Addr) *Session {
+	if remote == nil {
+		return nil
+	}
+	if s, ok := active.Load(remote.String()); ok {
+		return s.(*Session)
+	}
+	return nil
+}
+
+func (s *Session) newEvent(kind event.Kind) *event.Event {
+	ev := event.New(s.Protocol, kind, s.Remote, s.Local)
+	ev.SessionID = s.ID
+	return ev
+}
+
+// Event 创建关联到会话的事件，并计入会话的请求数
+func (s *Session) Event(kind event.Kind) *event.Event {
+	atomic.AddInt64(&s.requests, 1)
+	return s.newEvent(kind)
+}
+
+// Request 以 HTTP 请求创建关联到会话的事件
+func (s *Session) Request(kind event.Kind, r *http.Request) *event.Event {
+	atomic.AddInt64(&s.requests, 1)
+	ev := event.FromRequest(s.Protocol, kind, r)
+	ev.SessionID = s.ID
+	return ev
+}
+
+// SetReason 记录关闭原因，只保留第一次设置的值
+func (s *Session) SetReason(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reason == "" {
+		s.reason = reason
+	}
+}
+
+// Close 结束会话并上报字节数、请求数和关闭原因，重复调用无效
+func (s *Session) Close(reason string) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	if s.reason == "" {
+		s.reason = reason
+	}
+	reason = s.reason
+	s.mu.Unlock()
+
+	if s.Remote != nil {
+		active.CompareAndDelete(s.Remote.String(), s)
+	}
+	metrics.SessionClosed(s.Protocol)
+	if !is.Rpc() {
+		return
+	}
+	ev := s.newEvent(event.KindClose)
+	ev.Session = &event.SessionStats{
+		Start:       s.Start,
+		End:         time.Now(),
+		BytesIn:     atomic.LoadInt64(&s.bytesIn),
+		BytesOut:    atomic.LoadInt64(&s.bytesOut),
+		Requests:    atomic.LoadInt64(&s.requests),
+		CloseReason: reason,
+	}
+	go client.ReportResult(s.ProjectName, ev, "")
+}
+
+// Conn 统计收发字节数的连接，关闭时结束会话
+type Conn struct {
+	net.Conn
+	Session *Session
+}
+
+// Wrap 为连接创建会话，返回的连接关闭时自动结束会话
+func Wrap(conn net.Conn, protocol string, projectName string) *Conn {
+	return &Conn{Conn: conn, Session: New(protocol, projectName, conn.RemoteAddr(), conn.LocalAddr())}
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(&c.Session.bytesIn, int64(n))
+	if err != nil {
+		c.Session.SetReason(readReason(err))
+	}
+	return n, err
+}
+
+func (c *Conn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(&c.Session.bytesOut, int64(n))
+	return n, err
+}
+
+func (c *Conn) Close() error {
+	err := c.Conn.Close()
+	c.Session.Close(ReasonServerClosed)
+	return err
+}
+
+// FromConn 创建关联到连接会话的事件，连接没有会话时等同于 event.FromConn
+func FromConn(protocol string, kind event.Kind, conn net.Conn) *event.Event {
+	if c, ok := conn.(*Conn); ok {
+		return c.Session.Event(kind)
+	}
+	return event.FromConn(protocol, kind, conn)
+}
+
+// FromAddr 创建关联到来源地址所在会话的事件，找不到会话时等同于 event.New
+func FromAddr(protocol string, kind event.Kind, remote net.Addr, local net.Addr) *event.Event {
+	if s := Lookup(remote); s != nil {
+		return s.Event(kind)
+	}
+	return event.New(protocol, kind, remote, local)
+}
+
+// readReason 根据读错误判断连接关闭的原因
+func readReason(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, io.EOF):
+		return ReasonClientClosed
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ReasonTimeout
+	case errors.Is(err, net.ErrClosed):
+		return ReasonServerClosed
+	}
+	return err.Error()
+}
+
+// listener 为每个连接创建会话
+type listener struct {
+	net.Listener
+	protocol    string
+	projectName string
+}
+
+// Listen 包装监听器，Accept 返回的连接都带有会话
+func Listen(l net.Listener, protocol string, projectName string) net.Listener {
+	return &listener{Listener: l, protocol: protocol, projectName: projectName}
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return Wrap(conn, l.protocol, l.projectName), nil
+}
+
+type contextKey struct{}
+
+// ConnContext 用于 http.Server.ConnContext，把连接的会话放入请求上下文
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if c, ok := conn.(*Conn); ok {
+		return context.WithValue(ctx, contextKey{}, c.Session)
+	}
+	return ctx
+}
+
+// FromRequest 返回请求所属连接的会话，服务器未设置 ConnContext 时为请求单独创建会话
+func FromRequest(r *http.Request, protocol string, projectName string) *Session {
+	if s, ok := r.Context().Value(contextKey{}).(*Session); ok {
+		return s
+	}
+	local, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	var remote net.Addr
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		remote = addr
+	}
+	s := New(protocol, projectName, remote, local)
+	go func() {
+		<-r.Context().Done()
+		s.Close(ReasonServerClosed)
+	}()
+	return s
+}
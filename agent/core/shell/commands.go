@@ -0,0 +1,963 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 内核信息，与 Docker 蜜罐 /info 接口保持一致
+const (
+	kernelRelease = "5.15.0-78-generic"
+	kernelVersion = "#85-Ubuntu SMP Fri Jul 7 15:25:09 UTC 2023"
+	machine       = "x86_64"
+)
+
+// 内置命令表
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"ls":       cmdLs,
+		"cd":       cmdCd,
+		"pwd":      cmdPwd,
+		"cat":      cmdCat,
+		"echo":     cmdEcho,
+		"id":       cmdId,
+		"whoami":   cmdWhoami,
+		"env":      cmdEnv,
+		"printenv": cmdEnv,
+		"export":   cmdExport,
+		"unset":    cmdUnset,
+		"ps":       cmdPs,
+		"curl":     cmdCurl,
+		"wget":     cmdWget,
+		"uname":    cmdUname,
+		"hostname": cmdHostname,
+		"touch":    cmdTouch,
+		"mkdir":    cmdMkdir,
+		"rm":       cmdRm,
+		"cp":       cmdCp,
+		"mv":       cmdMv,
+		"chmod":    cmdChmod,
+		"head":     cmdHead,
+		"tail":     cmdTail,
+		"grep":     cmdGrep,
+		"wc":       cmdWc,
+		"history":  cmdHistory,
+		"which":    cmdWhich,
+		"clear":    cmdClear,
+		"date":     cmdDate,
+		"sleep":    cmdTrue,
+		"true":     cmdTrue,
+		"false":    cmdFalse,
+		"exit":     cmdExit,
+		"logout":   cmdExit,
+		"sh":       cmdSh,
+		"bash":     cmdSh,
+		"ash":      cmdSh,
+		"nproc":    cmdNproc,
+		"apt":      cmdApt,
+		"apt-get":  cmdApt,
+		"apk":      cmdApk,
+	}
+}
+
+// 解析形如 -la 的短参数，返回参数集合和剩余的位置参数
+func parseFlags(args []string) (map[rune]bool, []string) {
+	flags := make(map[rune]bool)
+	var rest []string
+	for i, arg := range args {
+		if arg == "--" {
+			rest = append(rest, args[i+1:]...)
+			break
+		}
+		if len(arg) > 1 && arg[0] == '-' && arg[1] != '-' {
+			for _, c := range arg[1:] {
+				flags[c] = true
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "--") {
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return flags, rest
+}
+
+func cmdLs(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	flags, targets := parseFlags(args[1:])
+	if len(targets) == 0 {
+		targets = []string{"."}
+	}
+
+	status := 0
+	var files []string
+	var dirs []string
+	for _, target := range targets {
+		node, err := s.FS.Lookup(s.abs(target))
+		if err != nil {
+			fmt.Fprintf(stderr, "ls: cannot access '%s': No such file or directory\n", target)
+			status = 2
+			continue
+		}
+		if node.IsDir && !flags['d'] {
+			dirs = append(dirs, target)
+		} else {
+			files = append(files, target)
+		}
+	}
+
+	for _, f := range files {
+		node, _ := s.FS.Lookup(s.abs(f))
+		if flags['l'] {
+			fmt.Fprintln(stdout, longEntry(node, f, flags['h']))
+		} else {
+			fmt.Fprintln(stdout, f)
+		}
+	}
+
+	for i, d := range dirs {
+		if len(targets) > 1 {
+			if i > 0 || len(files) > 0 {
+				fmt.Fprintln(stdout)
+			}
+			fmt.Fprintf(stdout, "%s:\n", d)
+		}
+		nodes, _ := s.FS.ReadDir(s.abs(d))
+		var entries []*Node
+		if flags['a'] {
+			self, _ := s.FS.Lookup(s.abs(d))
+			parent, _ := s.FS.Lookup(path.Dir(s.abs(d)))
+			entries = append(entries, &Node{Name: ".", IsDir: true, Mode: self.Mode, Owner: self.Owner, Group: self.Group, ModTime: self.ModTime})
+			entries = append(entries, &Node{Name: "..", IsDir: true, Mode: parent.Mode, Owner: parent.Owner, Group: parent.Group, ModTime: parent.ModTime})
+		}
+		for _, n := range nodes {
+			if strings.HasPrefix(n.Name, ".") && !flags['a'] && !flags['A'] {
+				continue
+			}
+			entries = append(entries, n)
+		}
+
+		if flags['l'] {
+			var total int64
+			for _, n := range entries {
+				total += (n.Size() + 4095) / 4096 * 4
+			}
+			fmt.Fprintf(stdout, "total %d\n", total)
+			for _, n := range entries {
+				fmt.Fprintln(stdout, longEntry(n, n.Name, flags['h']))
+			}
+			continue
+		}
+
+		names := make([]string, 0, len(entries))
+		for _, n := range entries {
+			names = append(names, n.Name)
+		}
+		if len(names) == 0 {
+			continue
+		}
+		if flags['1'] {
+			fmt.Fprintln(stdout, strings.Join(names, "\n"))
+		} else {
+			fmt.Fprintln(stdout, strings.Join(names, "  "))
+		}
+	}
+	return status
+}
+
+// ls -l 单行输出
+func longEntry(n *Node, name string, human bool) string {
+	size := strconv.FormatInt(n.Size(), 10)
+	if human {
+		size = humanSize(n.Size())
+	}
+	links := 1
+	if n.IsDir {
+		links = 2
+		for _, child := range n.Children {
+			if child.IsDir {
+				links++
+			}
+		}
+	}
+	mode := modeString(n)
+	stamp := n.ModTime.Format("Jan _2 15:04")
+	if time.Since(n.ModTime) > 180*24*time.Hour {
+		stamp = n.ModTime.Format("Jan _2  2006")
+	}
+	return fmt.Sprintf("%s %2d %-4s %-4s %6s %s %s", mode, links, n.Owner, n.Group, size, stamp, name)
+}
+
+// 权限字符串，如 drwxr-xr-x、drwxrwxrwt
+func modeString(n *Node) string {
+	b := []byte("-rwxrwxrwx")
+	if n.IsDir {
+		b[0] = 'd'
+	}
+	for i := 0; i < 9; i++ {
+		if n.Mode&(1<<uint(8-i)) == 0 {
+			b[i+1] = '-'
+		}
+	}
+	if n.Mode&os.ModeSticky != 0 {
+		if b[9] == 'x' {
+			b[9] = 't'
+		} else {
+			b[9] = 'T'
+		}
+	}
+	return string(b)
+}
+
+func humanSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1fG", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1fM", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1fK", float64(size)/(1<<10))
+	}
+	return strconv.FormatInt(size, 10)
+}
+
+func cmdCd(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	target := s.Home
+	if len(args) > 1 {
+		target = args[1]
+	}
+	if target == "-" {
+		if s.oldPwd == "" {
+			fmt.Fprintf(stderr, "%s: cd: OLDPWD not set\n", s.errPrefix())
+			return 1
+		}
+		target = s.oldPwd
+		fmt.Fprintln(stdout, target)
+	}
+
+	p := s.abs(target)
+	node, err := s.FS.Lookup(p)
+	if err == nil && !node.IsDir {
+		err = ErrNotDir
+	}
+	if err != nil {
+		if s.Flavor == FlavorAsh {
+			fmt.Fprintf(stderr, "sh: cd: can't cd to %s: %v\n", target, err)
+		} else {
+			fmt.Fprintf(stderr, "bash: cd: %s: %v\n", target, err)
+		}
+		return 1
+	}
+
+	s.oldPwd = s.Cwd
+	s.Cwd = p
+	s.Setenv("OLDPWD", s.oldPwd)
+	s.Setenv("PWD", p)
+	return 0
+}
+
+func cmdPwd(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	fmt.Fprintln(stdout, s.Cwd)
+	return 0
+}
+
+func cmdCat(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	_, files := parseFlags(args[1:])
+	if len(files) == 0 {
+		io.WriteString(stdout, stdin)
+		return 0
+	}
+
+	status := 0
+	for _, f := range files {
+		if f == "-" {
+			io.WriteString(stdout, stdin)
+			continue
+		}
+		content, err := s.FS.ReadFile(s.abs(f))
+		if err != nil {
+			fmt.Fprintf(stderr, "cat: %s: %v\n", f, err)
+			status = 1
+			continue
+		}
+		io.WriteString(stdout, content)
+	}
+	return status
+}
+
+func cmdEcho(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	args = args[1:]
+	newline, escape := true, false
+	for len(args) > 0 && len(args[0]) > 1 && strings.Trim(args[0], "-neE") == "" && args[0][0] == '-' {
+		newline = newline && !strings.Contains(args[0], "n")
+		escape = escape || strings.Contains(args[0], "e")
+		args = args[1:]
+	}
+
+	text := strings.Join(args, " ")
+	if escape {
+		text = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\\`, `\`, `\r`, "\r").Replace(text)
+	}
+	if newline {
+		text += "\n"
+	}
+	io.WriteString(stdout, text)
+	return 0
+}
+
+func cmdId(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	flags, _ := parseFlags(args[1:])
+	switch {
+	case flags['u'] && flags['n']:
+		fmt.Fprintln(stdout, s.User)
+	case flags['u'], flags['g']:
+		fmt.Fprintln(stdout, "0")
+	case s.Flavor == FlavorAsh:
+		fmt.Fprintln(stdout, "uid=0(root) gid=0(root) groups=0(root),1(bin),2(daemon),3(sys),4(adm),6(disk),10(wheel),11(floppy),20(dialout),26(tape),27(video)")
+	default:
+		fmt.Fprintln(stdout, "uid=0(root) gid=0(root) groups=0(root)")
+	}
+	return 0
+}
+
+func cmdWhoami(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	fmt.Fprintln(stdout, s.User)
+	return 0
+}
+
+func cmdEnv(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	if args[0] == "printenv" && len(args) > 1 {
+		status := 0
+		for _, key := range args[1:] {
+			value := s.Getenv(key)
+			if value == "" {
+				status = 1
+				continue
+			}
+			fmt.Fprintln(stdout, value)
+		}
+		return status
+	}
+	for _, kv := range s.env {
+		fmt.Fprintln(stdout, kv)
+	}
+	return 0
+}
+
+func cmdExport(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	if len(args) == 1 || args[1] == "-p" {
+		env := s.Environ()
+		sort.Strings(env)
+		for _, kv := range env {
+			parts := strings.SplitN(kv, "=", 2)
+			if s.Flavor == FlavorAsh {
+				fmt.Fprintf(stdout, "export %s='%s'\n", parts[0], parts[1])
+			} else {
+				fmt.Fprintf(stdout, "declare -x %s=\"%s\"\n", parts[0], parts[1])
+			}
+		}
+		return 0
+	}
+	for _, arg := range args[1:] {
+		if isAssignment(arg) {
+			kv := strings.SplitN(arg, "=", 2)
+			s.Setenv(kv[0], kv[1])
+		}
+	}
+	return 0
+}
+
+func cmdUnset(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	for _, key := range args[1:] {
+		s.Unsetenv(key)
+	}
+	return 0
+}
+
+func cmdPs(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	procs := append([]Process(nil), s.Procs...)
+	procs = append(procs, Process{PID: s.pid(), User: s.User, Command: strings.Join(args, " ")})
+
+	if s.Flavor == FlavorAsh {
+		fmt.Fprintln(stdout, "PID   USER     TIME  COMMAND")
+		for _, p := range procs {
+			fmt.Fprintf(stdout, "%5d %-8s  0:00 %s\n", p.PID, p.User, p.Command)
+		}
+		return 0
+	}
+
+	opts := strings.Join(args[1:], "")
+	switch {
+	case strings.Contains(opts, "e") || strings.Contains(opts, "f"):
+		fmt.Fprintln(stdout, "UID          PID    PPID  C STIME TTY          TIME CMD")
+		for _, p := range procs {
+			ppid := 0
+			if p.PID != 1 {
+				ppid = 1
+			}
+			fmt.Fprintf(stdout, "%-8s %7d %7d  0 %s ?        00:00:00 %s\n", p.User, p.PID, ppid, time.Now().Format("15:04"), p.Command)
+		}
+	case strings.Contains(opts, "a") || strings.Contains(opts, "u") || strings.Contains(opts, "x"):
+		fmt.Fprintln(stdout, "USER         PID %CPU %MEM    VSZ   RSS TTY      STAT START   TIME COMMAND")
+		for _, p := range procs {
+			fmt.Fprintf(stdout, "%-8s %7d  0.0  0.1  %5d  %4d ?        Ss   %s   0:00 %s\n", p.User, p.PID, 4000+p.PID*37%9000, 1200+p.PID*13%3000, time.Now().Format("15:04"), p.Command)
+		}
+	default:
+		fmt.Fprintln(stdout, "    PID TTY          TIME CMD")
+		for _, p := range procs {
+			if p.PID == 1 {
+				continue
+			}
+			fmt.Fprintf(stdout, "%7d pts/0    00:00:00 %s\n", p.PID, path.Base(strings.Fields(p.Command)[0]))
+		}
+	}
+	return 0
+}
+
+// 从参数中找到目标地址
+func findURL(args []string, valueFlags string) string {
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if strings.HasPrefix(arg, "-") {
+			if len(arg) == 2 && strings.ContainsRune(valueFlags, rune(arg[1])) {
+				i++
+			}
+			continue
+		}
+		return arg
+	}
+	return ""
+}
+
+// 解析目标主机和端口
+func targetHost(raw string) (string, string) {
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw, "80"
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return u.Hostname(), port
+}
+
+func isIP(host string) bool {
+	return regexp.MustCompile(`^[0-9.]+$|:`).MatchString(host)
+}
+
+func cmdCurl(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	flags, _ := parseFlags(args[1:])
+	for _, arg := range args[1:] {
+		if arg == "--version" || arg == "-V" {
+			fmt.Fprintln(stdout, "curl 7.88.1 (x86_64-pc-linux-gnu) libcurl/7.88.1 OpenSSL/3.0.9 zlib/1.2.13 brotli/1.0.9 zstd/1.5.4 libidn2/2.3.3 libpsl/0.21.2 (+libidn2/2.3.3) libssh2/1.10.0 nghttp2/1.52.0 librtmp/2.3 OpenLDAP/2.5.13")
+			fmt.Fprintln(stdout, "Release-Date: 2023-02-20")
+			return 0
+		}
+	}
+
+	target := findURL(args, "oXHdeAuUwmTbc")
+	if target == "" {
+		fmt.Fprintln(stderr, "curl: try 'curl --help' or 'curl --manual' for more information")
+		return 2
+	}
+
+	host, port := targetHost(target)
+	if flags['s'] && !flags['S'] {
+		if isIP(host) {
+			return 7
+		}
+		return 6
+	}
+	if isIP(host) {
+		fmt.Fprintf(stderr, "curl: (7) Failed to connect to %s port %s after 3 ms: Couldn't connect to server\n", host, port)
+		return 7
+	}
+	fmt.Fprintf(stderr, "curl: (6) Could not resolve host: %s\n", host)
+	return 6
+}
+
+func cmdWget(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	target := findURL(args, "OoPUTt")
+	if target == "" {
+		if s.Flavor == FlavorAsh {
+			fmt.Fprintln(stderr, "BusyBox v1.36.1 (2023-07-27 17:12:24 UTC) multi-call binary.\n\nUsage: wget [-cqS] [--spider] [-O FILE] [-o LOGFILE] [--header STR]\n\t[--post-data STR | --post-file FILE] [-Y on/off]\n\t[-P DIR] [-U AGENT] [-T SEC] URL...")
+			return 1
+		}
+		fmt.Fprintln(stderr, "wget: missing URL\nUsage: wget [OPTION]... [URL]...\n\nTry `wget --help' for more options.")
+		return 1
+	}
+
+	host, port := targetHost(target)
+	if s.Flavor == FlavorAsh {
+		if isIP(host) {
+			fmt.Fprintf(stderr, "Connecting to %s:%s (%s:%s)\nwget: can't connect to remote host (%s): Connection refused\n", host, port, host, port, host)
+		} else {
+			fmt.Fprintf(stderr, "wget: bad address '%s'\n", host)
+		}
+		return 1
+	}
+
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	fmt.Fprintf(stderr, "--%s--  %s\n", time.Now().Format("2006-01-02 15:04:05"), target)
+	if isIP(host) {
+		fmt.Fprintf(stderr, "Connecting to %s:%s... failed: Connection refused.\n", host, port)
+		return 4
+	}
+	fmt.Fprintf(stderr, "Resolving %s (%s)... failed: Temporary failure in name resolution.\nwget: unable to resolve host address '%s'\n", host, host, host)
+	return 4
+}
+
+func cmdUname(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	flags, _ := parseFlags(args[1:])
+	if flags['a'] {
+		suffix := "GNU/Linux"
+		if s.Flavor == FlavorAsh {
+			suffix = "Linux"
+		}
+		fmt.Fprintf(stdout, "Linux %s %s %s %s %s\n", s.Hostname, kernelRelease, kernelVersion, machine, suffix)
+		return 0
+	}
+
+	var parts []string
+	if flags['s'] || len(flags) == 0 {
+		parts = append(parts, "Linux")
+	}
+	if flags['n'] {
+		parts = append(parts, s.Hostname)
+	}
+	if flags['r'] {
+		parts = append(parts, kernelRelease)
+	}
+	if flags['v'] {
+		parts = append(parts, kernelVersion)
+	}
+	if flags['m'] || flags['p'] || flags['i'] {
+		parts = append(parts, machine)
+	}
+	fmt.Fprintln(stdout, strings.Join(parts, " "))
+	return 0
+}
+
+func cmdHostname(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	if len(args) > 1 && !strings.HasPrefix(args[1], "-") {
+		fmt.Fprintln(stderr, "hostname: you must be root to change the host name")
+		return 1
+	}
+	fmt.Fprintln(stdout, s.Hostname)
+	return 0
+}
+
+func cmdTouch(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	_, files := parseFlags(args[1:])
+	status := 0
+	for _, f := range files {
+		if err := s.FS.AppendFile(s.abs(f), "", 0644); err != nil {
+			fmt.Fprintf(stderr, "touch: cannot touch '%s': %v\n", f, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func cmdMkdir(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	flags, dirs := parseFlags(args[1:])
+	status := 0
+	for _, d := range dirs {
+		var err error
+		if flags['p'] {
+			err = s.FS.MkdirAll(s.abs(d), 0755)
+		} else {
+			err = s.FS.Mkdir(s.abs(d), 0755)
+		}
+		if err != nil {
+			if err == os.ErrExist {
+				err = errors.New("File exists")
+			}
+			fmt.Fprintf(stderr, "mkdir: cannot create directory '%s': %v\n", d, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func cmdRm(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	flags, files := parseFlags(args[1:])
+	recursive := flags['r'] || flags['R']
+	status := 0
+	for _, f := range files {
+		p := s.abs(f)
+		if p == "/" {
+			fmt.Fprintln(stderr, "rm: it is dangerous to operate recursively on '/'\nrm: use --no-preserve-root to override this failsafe")
+			status = 1
+			continue
+		}
+		err := s.FS.Remove(p, recursive)
+		if err == ErrNotExist && flags['f'] {
+			continue
+		}
+		if err != nil {
+			if err == ErrIsDir || err == ErrNotEmpty {
+				err = ErrIsDir
+			}
+			fmt.Fprintf(stderr, "rm: cannot remove '%s': %v\n", f, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func cmdCp(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	_, files := parseFlags(args[1:])
+	if len(files) < 2 {
+		fmt.Fprintf(stderr, "%s: missing file operand\n", args[0])
+		return 1
+	}
+	src, dst := files[0], files[len(files)-1]
+	content, err := s.FS.ReadFile(s.abs(src))
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: cannot stat '%s': %v\n", args[0], src, err)
+		return 1
+	}
+	target := s.abs(dst)
+	if node, err := s.FS.Lookup(target); err == nil && node.IsDir {
+		target = path.Join(target, path.Base(src))
+	}
+	if err := s.FS.WriteFile(target, content, 0644); err != nil {
+		fmt.Fprintf(stderr, "%s: cannot create regular file '%s': %v\n", args[0], dst, err)
+		return 1
+	}
+	if args[0] == "mv" {
+		s.FS.Remove(s.abs(src), false)
+	}
+	return 0
+}
+
+func cmdMv(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	return cmdCp(s, args, stdin, stdout, stderr)
+}
+
+func cmdChmod(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	if len(args) < 3 {
+		fmt.Fprintln(stderr, "chmod: missing operand")
+		return 1
+	}
+	mode := args[1]
+	status := 0
+	for _, f := range args[2:] {
+		node, err := s.FS.Lookup(s.abs(f))
+		if err != nil {
+			fmt.Fprintf(stderr, "chmod: cannot access '%s': No such file or directory\n", f)
+			status = 1
+			continue
+		}
+		if perm, err := strconv.ParseUint(mode, 8, 32); err == nil {
+			node.Mode = node.Mode&^0777 | os.FileMode(perm)&0777
+		} else if strings.Contains(mode, "+x") {
+			node.Mode |= 0111
+		} else if strings.Contains(mode, "-x") {
+			node.Mode &^= 0111
+		}
+	}
+	return status
+}
+
+// 解析 -n 行数参数
+func lineCount(args []string) (int, []string) {
+	n := 10
+	var files []string
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-n" && i+1 < len(args):
+			n, _ = strconv.Atoi(strings.TrimPrefix(args[i+1], "+"))
+			i++
+		case strings.HasPrefix(arg, "-n"):
+			n, _ = strconv.Atoi(arg[2:])
+		case len(arg) > 1 && arg[0] == '-':
+			if v, err := strconv.Atoi(arg[1:]); err == nil {
+				n = v
+			}
+		default:
+			files = append(files, arg)
+		}
+	}
+	return n, files
+}
+
+// 读取参数中的文件或标准输入
+func readInputs(s *Shell, name string, files []string, stdin string, stderr io.Writer) ([]string, int) {
+	if len(files) == 0 {
+		return []string{stdin}, 0
+	}
+	status := 0
+	var contents []string
+	for _, f := range files {
+		content, err := s.FS.ReadFile(s.abs(f))
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s: %v\n", name, f, err)
+			status = 1
+			continue
+		}
+		contents = append(contents, content)
+	}
+	return contents, status
+}
+
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+func cmdHead(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	n, files := lineCount(args)
+	contents, status := readInputs(s, "head", files, stdin, stderr)
+	for _, content := range contents {
+		lines := splitLines(content)
+		if len(lines) > n {
+			lines = lines[:n]
+		}
+		for _, line := range lines {
+			fmt.Fprintln(stdout, line)
+		}
+	}
+	return status
+}
+
+func cmdTail(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	n, files := lineCount(args)
+	contents, status := readInputs(s, "tail", files, stdin, stderr)
+	for _, content := range contents {
+		lines := splitLines(content)
+		if len(lines) > n {
+			lines = lines[len(lines)-n:]
+		}
+		for _, line := range lines {
+			fmt.Fprintln(stdout, line)
+		}
+	}
+	return status
+}
+
+func cmdGrep(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	flags, rest := parseFlags(args[1:])
+	if len(rest) == 0 {
+		fmt.Fprintln(stderr, "Usage: grep [OPTION]... PATTERNS [FILE]...")
+		return 2
+	}
+
+	pattern := rest[0]
+	if flags['i'] {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		re = regexp.MustCompile(regexp.QuoteMeta(rest[0]))
+	}
+
+	contents, status := readInputs(s, "grep", rest[1:], stdin, stderr)
+	matched := false
+	for i, content := range contents {
+		for n, line := range splitLines(content) {
+			if re.MatchString(line) == flags['v'] {
+				continue
+			}
+			matched = true
+			prefix := ""
+			if len(rest) > 2 {
+				prefix = rest[1+i] + ":"
+			}
+			if flags['n'] {
+				prefix += strconv.Itoa(n+1) + ":"
+			}
+			fmt.Fprintln(stdout, prefix+line)
+		}
+	}
+	if status != 0 {
+		return 2
+	}
+	if !matched {
+		return 1
+	}
+	return 0
+}
+
+func cmdWc(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	flags, files := parseFlags(args[1:])
+	contents, status := readInputs(s, "wc", files, stdin, stderr)
+	for i, content := range contents {
+		lines := strings.Count(content, "\n")
+		words := len(strings.Fields(content))
+		name := ""
+		if len(files) > 0 {
+			name = " " + files[i]
+		}
+		switch {
+		case flags['l']:
+			fmt.Fprintf(stdout, "%d%s\n", lines, name)
+		case flags['w']:
+			fmt.Fprintf(stdout, "%d%s\n", words, name)
+		case flags['c']:
+			fmt.Fprintf(stdout, "%d%s\n", len(content), name)
+		default:
+			fmt.Fprintf(stdout, "%7d %7d %7d%s\n", lines, words, len(content), name)
+		}
+	}
+	return status
+}
+
+func cmdHistory(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	for i, line := range s.history {
+		fmt.Fprintf(stdout, "%5d  %s\n", i+1, line)
+	}
+	return 0
+}
+
+func cmdWhich(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	status := 0
+	for _, name := range args[1:] {
+		if _, ok := commands[name]; !ok || (name == "bash" && s.Flavor == FlavorAsh) {
+			status = 1
+			continue
+		}
+		switch name {
+		case "cd", "export", "unset", "history", "exit", "logout":
+			status = 1
+		case "curl", "wget", "apt", "apt-get", "apk", "id", "env", "head", "tail", "wc", "which", "nproc", "clear":
+			fmt.Fprintf(stdout, "/usr/bin/%s\n", name)
+		default:
+			fmt.Fprintf(stdout, "/bin/%s\n", name)
+		}
+	}
+	return status
+}
+
+func cmdClear(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	io.WriteString(stdout, "\x1b[H\x1b[2J")
+	return 0
+}
+
+func cmdDate(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	fmt.Fprintln(stdout, time.Now().UTC().Format("Mon Jan _2 15:04:05 UTC 2006"))
+	return 0
+}
+
+func cmdTrue(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	return 0
+}
+
+func cmdFalse(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	return 1
+}
+
+func cmdExit(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	s.exited = true
+	if len(args) > 1 {
+		if code, err := strconv.Atoi(args[1]); err == nil {
+			return code
+		}
+	}
+	return 0
+}
+
+func cmdSh(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	for i := 1; i < len(args); i++ {
+		switch {
+		case args[i] == "-c" && i+1 < len(args):
+			s.runLine(args[i+1], stdin, stdout, stderr)
+			return s.status
+		case strings.HasPrefix(args[i], "-"):
+			continue
+		default:
+			content, err := s.FS.ReadFile(s.abs(args[i]))
+			if err != nil {
+				fmt.Fprintf(stderr, "%s: %s: %v\n", args[0], args[i], err)
+				return 127
+			}
+			return s.runScript(content, stdout, stderr)
+		}
+	}
+	if stdin != "" {
+		return s.runScript(stdin, stdout, stderr)
+	}
+	return 0
+}
+
+func cmdNproc(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	fmt.Fprintln(stdout, "4")
+	return 0
+}
+
+func cmdApt(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	if s.Flavor == FlavorAsh {
+		io.WriteString(stderr, s.notFound(args[0]))
+		return 127
+	}
+	if len(args) < 2 {
+		fmt.Fprintf(stderr, "%s 2.6.1 (amd64)\nUsage: %s [options] command\n", args[0], args[0])
+		return 1
+	}
+	switch args[1] {
+	case "update":
+		fmt.Fprintln(stdout, "Err:1 http://deb.debian.org/debian bookworm InRelease\n  Temporary failure resolving 'deb.debian.org'\nErr:2 http://deb.debian.org/debian-security bookworm-security InRelease\n  Temporary failure resolving 'deb.debian.org'\nReading package lists... Done")
+		fmt.Fprintln(stderr, "W: Failed to fetch http://deb.debian.org/debian/dists/bookworm/InRelease  Temporary failure resolving 'deb.debian.org'\nW: Some index files failed to download. They have been ignored, or old ones used instead.")
+		return 0
+	case "install":
+		fmt.Fprintln(stdout, "Reading package lists... Done\nBuilding dependency tree... Done\nReading state information... Done")
+		for _, pkg := range args[2:] {
+			if !strings.HasPrefix(pkg, "-") {
+				fmt.Fprintf(stderr, "E: Unable to locate package %s\n", pkg)
+				return 100
+			}
+		}
+		return 0
+	}
+	return 0
+}
+
+func cmdApk(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int {
+	if s.Flavor != FlavorAsh {
+		io.WriteString(stderr, s.notFound(args[0]))
+		return 127
+	}
+	if len(args) < 2 {
+		fmt.Fprintln(stderr, "apk-tools 2.14.0, compiled for x86_64.\n\nusage: apk [<OPTIONS>...] COMMAND [<ARGUMENTS>...]")
+		return 1
+	}
+	switch args[1] {
+	case "update", "add":
+		fmt.Fprintln(stdout, "fetch https://dl-cdn.alpinelinux.org/alpine/v3.18/main/x86_64/APKINDEX.tar.gz")
+		fmt.Fprintln(stderr, "WARNING: fetching https://dl-cdn.alpinelinux.org/alpine/v3.18/main: temporary error (try again later)")
+		if args[1] == "add" {
+			for _, pkg := range args[2:] {
+				if !strings.HasPrefix(pkg, "-") {
+					fmt.Fprintf(stderr, "ERROR: unable to select packages:\n  %s (no such package):\n    required by: world[%s]\n", pkg, pkg)
+					return 1
+				}
+			}
+		}
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,316 @@
+package shell
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotExist = errors.New("No such file or directory")
+	ErrIsDir    = errors.New("Is a directory")
+	ErrNotDir   = errors.New("Not a directory")
+	ErrNotEmpty = errors.New("Directory not empty")
+	ErrNoSpace  = errors.New("No space left on device")
+)
+
+const (
+	// maxFileSize 单个文件的大小上限
+	maxFileSize = 1 << 20
+	// maxFSSize 整个虚拟文件系统的文件内容上限，防止反复追加写入耗尽内存
+	maxFSSize = 16 << 20
+)
+
+// Node 虚拟文件系统节点
+type Node struct {
+	Name     string
+	IsDir    bool
+	Mode     os.FileMode
+	Owner    string
+	Group    string
+	ModTime  time.Time
+	Content  string
+	Children map[string]*Node
+}
+
+// contentSize 返回节点及其子节点的文件内容大小
+func (n *Node) contentSize() int64 {
+	if !n.IsDir {
+		return int64(len(n.Content))
+	}
+	var size int64
+	for _, child := range n.Children {
+		size += child.contentSize()
+	}
+	return size
+}
+
+// Size 返回节点大小，目录固定为 4096
+func (n *Node) Size() int64 {
+	if n.IsDir {
+		return 4096
+	}
+	return int64(len(n.Content))
+}
+
+// FS 内存中的虚拟文件系统，所有写操作都不会落到宿主机
+type FS struct {
+	mu   sync.RWMutex
+	root *Node
+	// used 所有文件内容的总大小
+	used int64
+}
+
+// NewFS 创建只包含根目录的虚拟文件系统
+func NewFS() *FS {
+	return &FS{
+		root: &Node{
+			Name:     "/",
+			IsDir:    true,
+			Mode:     os.ModeDir | 0755,
+			Owner:    "root",
+			Group:    "root",
+			ModTime:  time.Now(),
+			Children: make(map[string]*Node),
+		},
+	}
+}
+
+// 拆分绝对路径
+func splitPath(p string) []string {
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return nil
+	}
+	return strings.Split(strings.TrimPrefix(p, "/"), "/")
+}
+
+func (f *FS) lookup(p string) (*Node, error) {
+	node := f.root
+	for _, part := range splitPath(p) {
+		if !node.IsDir {
+			return nil, ErrNotDir
+		}
+		child, ok := node.Children[part]
+		if !ok {
+			return nil, ErrNotExist
+		}
+		node = child
+	}
+	return node, nil
+}
+
+// Lookup 查找路径对应的节点
+func (f *FS) Lookup(p string) (*Node, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.lookup(p)
+}
+
+func (f *FS) mkdirAll(p string, mode os.FileMode, modTime time.Time) (*Node, error) {
+	node := f.root
+	for _, part := range splitPath(p) {
+		child, ok := node.Children[part]
+		if !ok {
+			child = &Node{
+				Name:     part,
+				IsDir:    true,
+				Mode:     os.ModeDir | mode,
+				Owner:    "root",
+				Group:    "root",
+				ModTime:  modTime,
+				Children: make(map[string]*Node),
+			}
+			node.Children[part] = child
+		} else if !child.IsDir {
+			return nil, ErrNotDir
+		}
+		node = child
+	}
+	return node, nil
+}
+
+// MkdirAll 递归创建目录
+func (f *FS) MkdirAll(p string, mode os.FileMode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err := f.mkdirAll(p, mode, time.Now())
+	return err
+}
+
+// Mkdir 创建单级目录，父目录必须存在
+func (f *FS) Mkdir(p string, mode os.FileMode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parent, err := f.lookup(path.Dir(p))
+	if err != nil {
+		return err
+	}
+	if !parent.IsDir {
+		return ErrNotDir
+	}
+	name := path.Base(p)
+	if _, ok := parent.Children[name]; ok {
+		return os.ErrExist
+	}
+	parent.Children[name] = &Node{
+		Name:     name,
+		IsDir:    true,
+		Mode:     os.ModeDir | mode,
+		Owner:    "root",
+		Group:    "root",
+		ModTime:  time.Now(),
+		Children: make(map[string]*Node),
+	}
+	return nil
+}
+
+func (f *FS) writeFile(p string, content string, mode os.FileMode, modTime time.Time, appendTo bool) error {
+	parent, err := f.lookup(path.Dir(p))
+	if err != nil {
+		return err
+	}
+	if !parent.IsDir {
+		return ErrNotDir
+	}
+	name := path.Base(p)
+	if node, ok := parent.Children[name]; ok {
+		if node.IsDir {
+			return ErrIsDir
+		}
+		size := int64(len(content))
+		if appendTo {
+			size += int64(len(node.Content))
+		}
+		if err := f.reserve(int64(len(node.Content)), size); err != nil {
+			return err
+		}
+		if appendTo {
+			node.Content += content
+		} else {
+			node.Content = content
+		}
+		node.ModTime = modTime
+		return nil
+	}
+	if err := f.reserve(0, int64(len(content))); err != nil {
+		return err
+	}
+	parent.Children[name] = &Node{
+		Name:    name,
+		Mode:    mode,
+		Owner:   "root",
+		Group:   "root",
+		ModTime: modTime,
+		Content: content,
+	}
+	return nil
+}
+
+// reserve 文件大小由 old 变为 size，超出上限时返回 ErrNoSpace
+func (f *FS) reserve(old, size int64) error {
+	if size > maxFileSize || f.used-old+size > maxFSSize {
+		return ErrNoSpace
+	}
+	f.used += size - old
+	return nil
+}
+
+// WriteFile 写入文件，父目录必须存在
+func (f *FS) WriteFile(p string, content string, mode os.FileMode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writeFile(p, content, mode, time.Now(), false)
+}
+
+// AppendFile 追加写入文件，文件不存在时创建
+func (f *FS) AppendFile(p string, content string, mode os.FileMode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writeFile(p, content, mode, time.Now(), true)
+}
+
+// Seed 初始化文件内容，自动创建父目录，用于构建镜像文件系统
+func (f *FS) Seed(p string, content string, mode os.FileMode, modTime time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.mkdirAll(path.Dir(p), 0755, modTime); err != nil {
+		return
+	}
+	f.writeFile(p, content, mode, modTime, false)
+}
+
+// SeedDir 初始化目录，自动创建父目录
+func (f *FS) SeedDir(p string, mode os.FileMode, modTime time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mkdirAll(p, mode, modTime)
+}
+
+// Remove 删除文件或目录
+func (f *FS) Remove(p string, recursive bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parent, err := f.lookup(path.Dir(p))
+	if err != nil {
+		return err
+	}
+	name := path.Base(p)
+	node, ok := parent.Children[name]
+	if !ok {
+		return ErrNotExist
+	}
+	if node.IsDir && !recursive {
+		if len(node.Children) > 0 {
+			return ErrNotEmpty
+		}
+		return ErrIsDir
+	}
+	f.used -= node.contentSize()
+	delete(parent.Children, name)
+	return nil
+}
+
+// ReadDir 读取目录，按名称排序
+func (f *FS) ReadDir(p string) ([]*Node, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	node, err := f.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	if !node.IsDir {
+		return nil, ErrNotDir
+	}
+
+	nodes := make([]*Node, 0, len(node.Children))
+	for _, child := range node.Children {
+		nodes = append(nodes, child)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+	return nodes, nil
+}
+
+// ReadFile 读取文件内容
+func (f *FS) ReadFile(p string) (string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	node, err := f.lookup(p)
+	if err != nil {
+		return "", err
+	}
+	if node.IsDir {
+		return "", ErrIsDir
+	}
+	return node.Content, nil
+}
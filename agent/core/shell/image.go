@@ -0,0 +1,481 @@
+package shell
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Container 伪造容器的基本信息，对应 Docker 蜜罐中的模拟容器
+type Container struct {
+	ID      string
+	Name    string
+	Image   string
+	Command string
+	Created int64
+
+	// Hostname 为空时使用容器ID前12位，Pod 中的容器使用 Pod 名
+	Hostname string
+	// Env 额外的环境变量，如 Pod 注入的 KUBERNETES_SERVICE_HOST
+	Env []string
+	// Files 额外挂载的文件，如服务账号令牌
+	Files map[string]string
+}
+
+// 镜像画像，描述某类镜像特有的环境变量、文件和进程
+type imageProfile struct {
+	binary  string
+	workdir string
+	env     func(version string) []string
+	files   map[string]string
+	workers []Process
+	version string
+}
+
+var passwdDebian = `root:x:0:0:root:/root:/bin/bash
+daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin
+bin:x:2:2:bin:/bin:/usr/sbin/nologin
+sys:x:3:3:sys:/dev:/usr/sbin/nologin
+sync:x:4:65534:sync:/bin:/bin/sync
+games:x:5:60:games:/usr/games:/usr/sbin/nologin
+man:x:6:12:man:/var/cache/man:/usr/sbin/nologin
+lp:x:7:7:lp:/var/spool/lpd:/usr/sbin/nologin
+mail:x:8:8:mail:/var/mail:/usr/sbin/nologin
+news:x:9:9:news:/var/spool/news:/usr/sbin/nologin
+www-data:x:33:33:www-data:/var/www:/usr/sbin/nologin
+backup:x:34:34:backup:/var/backups:/usr/sbin/nologin
+nobody:x:65534:65534:nobody:/nonexistent:/usr/sbin/nologin
+_apt:x:42:65534::/nonexistent:/usr/sbin/nologin
+`
+
+var passwdAlpine = `root:x:0:0:root:/root:/bin/ash
+bin:x:1:1:bin:/bin:/sbin/nologin
+daemon:x:2:2:daemon:/sbin:/sbin/nologin
+adm:x:3:4:adm:/var/adm:/sbin/nologin
+lp:x:4:7:lp:/var/spool/lpd:/sbin/nologin
+sync:x:5:0:sync:/sbin:/bin/sync
+shutdown:x:6:0:shutdown:/sbin:/sbin/shutdown
+halt:x:7:0:halt:/sbin:/sbin/halt
+mail:x:8:12:mail:/var/mail:/sbin/nologin
+news:x:9:13:news:/usr/lib/news:/sbin/nologin
+operator:x:11:0:operator:/root:/sbin/nologin
+nobody:x:65534:65534:nobody:/:/sbin/nologin
+`
+
+var shadowDebian = `root:*:19473:0:99999:7:::
+daemon:*:19473:0:99999:7:::
+bin:*:19473:0:99999:7:::
+sys:*:19473:0:99999:7:::
+sync:*:19473:0:99999:7:::
+www-data:*:19473:0:99999:7:::
+nobody:*:19473:0:99999:7:::
+`
+
+var osReleaseDebian = `PRETTY_NAME="Debian GNU/Linux 12 (bookworm)"
+NAME="Debian GNU/Linux"
+VERSION_ID="12"
+VERSION="12 (bookworm)"
+VERSION_CODENAME=bookworm
+ID=debian
+HOME_URL="https://www.debian.org/"
+SUPPORT_URL="https://www.debian.org/support"
+BUG_REPORT_URL="https://bugs.debian.org/"
+`
+
+var osReleaseAlpine = `NAME="Alpine Linux"
+ID=alpine
+VERSION_ID=3.18.4
+PRETTY_NAME="Alpine Linux v3.18"
+HOME_URL="https://alpinelinux.org/"
+BUG_REPORT_URL="https://gitlab.alpinelinux.org/alpine/aports/-/issues"
+`
+
+// 常见镜像画像，键为去掉仓库前缀和标签后的镜像名
+var imageProfiles = map[string]imageProfile{
+	"nginx": {
+		binary:  "nginx",
+		version: "1.23.4",
+		env: func(v string) []string {
+			return []string{"NGINX_VERSION=" + v, "NJS_VERSION=0.7.11", "PKG_RELEASE=1~bullseye"}
+		},
+		files: map[string]string{
+			"/etc/nginx/nginx.conf": `
+user  nginx;
+worker_processes  auto;
+
+error_log  /var/log/nginx/error.log notice;
+pid        /var/run/nginx.pid;
+
+
+events {
+    worker_connections  1024;
+}
+
+
+http {
+    include       /etc/nginx/mime.types;
+    default_type  application/octet-stream;
+
+    log_format  main  '$remote_addr - $remote_user [$time_local] "$request" '
+                      '$status $body_bytes_sent "$http_referer" '
+                      '"$http_user_agent" "$http_x_forwarded_for"';
+
+    access_log  /var/log/nginx/access.log  main;
+
+    sendfile        on;
+    keepalive_timeout  65;
+
+    include /etc/nginx/conf.d/*.conf;
+}
+`,
+			"/etc/nginx/conf.d/default.conf": `server {
+    listen       80;
+    listen  [::]:80;
+    server_name  localhost;
+
+    location / {
+        root   /usr/share/nginx/html;
+        index  index.html index.htm;
+    }
+
+    location /api/ {
+        proxy_pass http://10.96.12.40:8080/;
+    }
+
+    error_page   500 502 503 504  /50x.html;
+    location = /50x.html {
+        root   /usr/share/nginx/html;
+    }
+}
+`,
+			"/usr/share/nginx/html/index.html": "<!DOCTYPE html>\n<html>\n<head>\n<title>Welcome to nginx!</title>\n</head>\n<body>\n<h1>Welcome to nginx!</h1>\n</body>\n</html>\n",
+			"/usr/share/nginx/html/50x.html":   "<!DOCTYPE html>\n<html>\n<head>\n<title>Error</title>\n</head>\n<body>\n<h1>An error occurred.</h1>\n</body>\n</html>\n",
+			"/docker-entrypoint.sh":            "#!/bin/sh\n# vim:sw=4:ts=4:et\n\nset -e\n\nexec \"$@\"\n",
+			"/var/log/nginx/access.log":        "",
+			"/var/log/nginx/error.log":         "",
+		},
+		workers: []Process{
+			{User: "nginx", Command: "nginx: worker process"},
+			{User: "nginx", Command: "nginx: worker process"},
+		},
+	},
+	"httpd": {
+		binary:  "httpd",
+		version: "2.4.57",
+		workdir: "/usr/local/apache2",
+		env: func(v string) []string {
+			return []string{"HTTPD_PREFIX=/usr/local/apache2", "HTTPD_VERSION=" + v}
+		},
+		files: map[string]string{
+			"/usr/local/apache2/conf/httpd.conf":   "ServerRoot \"/usr/local/apache2\"\nListen 80\nUser daemon\nGroup daemon\nServerAdmin you@example.com\nDocumentRoot \"/usr/local/apache2/htdocs\"\nErrorLog /proc/self/fd/2\n",
+			"/usr/local/apache2/htdocs/index.html": "<html><body><h1>It works!</h1></body></html>\n",
+		},
+	},
+	"node": {
+		binary:  "node",
+		version: "18.16.0",
+		workdir: "/app",
+		env: func(v string) []string {
+			return []string{"NODE_VERSION=" + v, "YARN_VERSION=1.22.19", "NODE_ENV=production"}
+		},
+		files: map[string]string{
+			"/app/package.json": "{\n  \"name\": \"api-server\",\n  \"version\": \"1.4.2\",\n  \"main\": \"server.js\",\n  \"dependencies\": {\n    \"express\": \"^4.18.2\",\n    \"mysql2\": \"^3.3.1\",\n    \"jsonwebtoken\": \"^9.0.0\"\n  }\n}\n",
+			"/app/server.js":    "const express = require('express');\nconst app = express();\nrequire('dotenv').config();\n\napp.get('/healthz', (req, res) => res.send('ok'));\n\napp.listen(3000, () => console.log('listening on 3000'));\n",
+			"/app/.env":         "DB_HOST=mysql-prod\nDB_USER=app\nDB_PASSWORD=Sup3rS3cr3t!2023\nJWT_SECRET=9f2b1c7e4a6d8e0f3b5a7c9d1e2f4a6b\n",
+		},
+	},
+	"mysql": {
+		binary:  "mysqld",
+		version: "8.0.33",
+		env: func(v string) []string {
+			return []string{"GOSU_VERSION=1.16", "MYSQL_MAJOR=8.0", "MYSQL_VERSION=" + v + "-1.el8", "MYSQL_ROOT_PASSWORD=root@123456", "MYSQL_DATABASE=prod"}
+		},
+		files: map[string]string{
+			"/etc/my.cnf":                   "[mysqld]\nskip-host-cache\nskip-name-resolve\ndatadir=/var/lib/mysql\nsocket=/var/run/mysqld/mysqld.sock\nsecure-file-priv=/var/lib/mysql-files\nuser=mysql\n\npid-file=/var/run/mysqld/mysqld.pid\n[client]\nsocket=/var/run/mysqld/mysqld.sock\n",
+			"/var/lib/mysql/auto.cnf":       "[auto]\nserver-uuid=6d1c2a4e-f7b3-11ed-9a4e-0242ac110003\n",
+			"/var/lib/mysql-files/.gitkeep": "",
+		},
+	},
+	"postgres": {
+		binary:  "postgres",
+		version: "14.8",
+		env: func(v string) []string {
+			return []string{"GOSU_VERSION=1.16", "LANG=en_US.utf8", "PG_MAJOR=" + strings.Split(v, ".")[0], "PG_VERSION=" + v + "-1.pgdg120+1", "PGDATA=/var/lib/postgresql/data", "POSTGRES_PASSWORD=postgres123"}
+		},
+		files: map[string]string{
+			"/var/lib/postgresql/data/postgresql.conf": "listen_addresses = '*'\nmax_connections = 100\nshared_buffers = 256MB\n",
+			"/var/lib/postgresql/data/pg_hba.conf":     "local   all             all                                     trust\nhost    all             all             127.0.0.1/32            trust\nhost all all all scram-sha-256\n",
+		},
+	},
+	"redis": {
+		binary:  "redis-server",
+		version: "7.0.11",
+		workdir: "/data",
+		env: func(v string) []string {
+			return []string{"REDIS_VERSION=" + v, "REDIS_DOWNLOAD_URL=http://download.redis.io/releases/redis-" + v + ".tar.gz"}
+		},
+		files: map[string]string{
+			"/data/dump.rdb": "REDIS0010\xfa\tredis-ver\x067.0.11",
+		},
+	},
+	"mongo": {
+		binary:  "mongod",
+		version: "5.0.18",
+		env: func(v string) []string {
+			return []string{"GOSU_VERSION=1.16", "MONGO_MAJOR=5.0", "MONGO_VERSION=" + v, "MONGO_INITDB_ROOT_USERNAME=admin", "MONGO_INITDB_ROOT_PASSWORD=Mongo@2023"}
+		},
+		files: map[string]string{
+			"/etc/mongod.conf.orig": "storage:\n  dbPath: /var/lib/mongodb\nnet:\n  port: 27017\n  bindIp: 127.0.0.1\n",
+		},
+	},
+	"python": {
+		binary:  "python",
+		version: "3.10.12",
+		workdir: "/app",
+		env: func(v string) []string {
+			return []string{"LANG=C.UTF-8", "GPG_KEY=A035C8C19219BA821ECEA86B64E628F8D684696D", "PYTHON_VERSION=" + v, "PYTHON_PIP_VERSION=23.0.1"}
+		},
+		files: map[string]string{
+			"/app/app.py":           "import os\nfrom flask import Flask\n\napp = Flask(__name__)\napp.config['SECRET_KEY'] = os.environ.get('SECRET_KEY', 'dev-7c1e9a')\n\n@app.route('/')\ndef index():\n    return 'ok'\n\nif __name__ == '__main__':\n    app.run(host='0.0.0.0', port=5000)\n",
+			"/app/requirements.txt": "flask==2.3.2\nredis==4.5.5\nboto3==1.26.137\n",
+		},
+	},
+	"wordpress": {
+		binary:  "apache2-foreground",
+		version: "6.2.2",
+		workdir: "/var/www/html",
+		env: func(v string) []string {
+			return []string{"PHP_VERSION=8.0.29", "WORDPRESS_VERSION=" + v, "WORDPRESS_DB_HOST=mysql-prod", "WORDPRESS_DB_USER=wordpress", "WORDPRESS_DB_PASSWORD=wp_P@ssw0rd", "WORDPRESS_DB_NAME=wordpress"}
+		},
+		files: map[string]string{
+			"/var/www/html/wp-config.php": "<?php\ndefine( 'DB_NAME', 'wordpress' );\ndefine( 'DB_USER', 'wordpress' );\ndefine( 'DB_PASSWORD', 'wp_P@ssw0rd' );\ndefine( 'DB_HOST', 'mysql-prod' );\n$table_prefix = 'wp_';\nrequire_once ABSPATH . 'wp-settings.php';\n",
+			"/var/www/html/index.php":     "<?php\ndefine( 'WP_USE_THEMES', true );\nrequire __DIR__ . '/wp-blog-header.php';\n",
+		},
+	},
+	"jenkins": {
+		binary:  "java",
+		version: "2.401.1",
+		workdir: "/var/jenkins_home",
+		env: func(v string) []string {
+			return []string{"JENKINS_HOME=/var/jenkins_home", "JENKINS_VERSION=" + v, "JAVA_HOME=/opt/java/openjdk", "COPY_REFERENCE_FILE_LOG=/var/jenkins_home/copy_reference_file.log"}
+		},
+		files: map[string]string{
+			"/var/jenkins_home/secrets/initialAdminPassword": "3f9c1a2b7d4e4f0a9b8c6d5e4f3a2b1c\n",
+			"/var/jenkins_home/config.xml":                   "<?xml version='1.1' encoding='UTF-8'?>\n<hudson>\n  <version>2.401.1</version>\n  <useSecurity>true</useSecurity>\n</hudson>\n",
+		},
+	},
+	"vault": {
+		binary:  "vault",
+		version: "1.13.3",
+		env: func(v string) []string {
+			return []string{"VAULT_VERSION=" + v, "VAULT_ADDR=http://127.0.0.1:8200", "VAULT_DEV_ROOT_TOKEN_ID=hvs.CAESIJ7qk3Xz0bXvT8yYw2m"}
+		},
+		files: map[string]string{
+			"/vault/config/local.json": "{\"storage\": {\"file\": {\"path\": \"/vault/file\"}}, \"listener\": [{\"tcp\": {\"address\": \"0.0.0.0:8200\", \"tls_disable\": true}}], \"ui\": true}\n",
+		},
+	},
+}
+
+// 解析镜像名，返回去掉仓库前缀的名称和标签
+func parseImage(image string) (string, string) {
+	name, tag := image, "latest"
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		name, tag = image[:i], image[i+1:]
+	}
+	return path.Base(name), tag
+}
+
+// 镜像标签中的版本号，标签不是完整版本时使用默认值
+func imageVersion(tag, def string) string {
+	v := strings.TrimPrefix(strings.Split(tag, "-")[0], "v")
+	if strings.Count(v, ".") >= 2 {
+		return v
+	}
+	return def
+}
+
+// 根据镜像名判断使用 bash 还是 busybox ash
+func imageFlavor(name, tag string) string {
+	if name == "busybox" || strings.Contains(tag, "alpine") {
+		return FlavorAsh
+	}
+	return FlavorBash
+}
+
+// NewContainerShell 根据模拟容器的镜像和启动命令构建独立的虚拟环境
+func NewContainerShell(c Container) *Shell {
+	name, tag := parseImage(c.Image)
+	flavor := imageFlavor(name, tag)
+	profile, known := imageProfiles[name]
+
+	hostname := c.Hostname
+	if hostname == "" {
+		hostname = c.ID
+		if len(hostname) > 12 {
+			hostname = hostname[:12]
+		}
+	}
+
+	created := time.Unix(c.Created, 0)
+	if c.Created == 0 {
+		created = time.Now().Add(-72 * time.Hour)
+	}
+	built := created.Add(-14 * 24 * time.Hour)
+
+	s := &Shell{
+		FS:       NewFS(),
+		Flavor:   flavor,
+		Hostname: hostname,
+		User:     "root",
+		Home:     "/root",
+		Cwd:      "/",
+	}
+
+	// 基础环境变量
+	s.env = []string{
+		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+		"HOSTNAME=" + hostname,
+	}
+	if known {
+		version := imageVersion(tag, profile.version)
+		s.env = append(s.env, profile.env(version)...)
+		if profile.workdir != "" {
+			s.Cwd = profile.workdir
+		}
+	}
+	s.env = append(s.env, c.Env...)
+	s.env = append(s.env, "HOME=/root", "TERM=xterm", "PWD="+s.Cwd)
+
+	seedBase(s.FS, flavor, hostname, built, created)
+	if known {
+		for p, content := range profile.files {
+			mode := fileMode(p)
+			s.FS.Seed(p, content, mode, built)
+		}
+	}
+	for p, content := range c.Files {
+		s.FS.Seed(p, content, 0644, created)
+	}
+	if s.Cwd != "/" {
+		s.FS.MkdirAll(s.Cwd, 0755)
+	}
+
+	// 进程列表，PID 1 为容器的启动命令
+	entry := containerCommand(c.Command, name, profile.binary)
+	s.Procs = []Process{{PID: 1, User: "root", Command: entry}}
+	pid := 1
+	for _, w := range profile.workers {
+		pid += 1 + int(hashOf(c.ID+w.Command)%7)
+		s.Procs = append(s.Procs, Process{PID: pid, User: w.User, Command: w.Command})
+	}
+	shellName := "bash"
+	if flavor == FlavorAsh {
+		shellName = "sh"
+	}
+	pid += 20 + int(hashOf(c.ID)%200)
+	s.Procs = append(s.Procs, Process{PID: pid, User: "root", Command: shellName})
+	s.nextPID = pid
+
+	cmdline := strings.ReplaceAll(entry, " ", "\x00") + "\x00"
+	s.FS.Seed("/proc/1/cmdline", cmdline, 0444, created)
+	s.FS.Seed("/proc/1/environ", strings.Join(s.env, "\x00")+"\x00", 0400, created)
+
+	return s
+}
+
+// 容器 PID 1 的完整命令行，Command 只有参数时补上镜像默认程序
+func containerCommand(command, name, binary string) string {
+	command = strings.TrimSpace(command)
+	if binary == "" {
+		binary = name
+	}
+	if command == "" {
+		return binary
+	}
+	if strings.HasPrefix(command, "-") {
+		return binary + " " + command
+	}
+	return command
+}
+
+func fileMode(p string) os.FileMode {
+	if strings.HasSuffix(p, ".sh") {
+		return 0755
+	}
+	if strings.Contains(p, "secret") || strings.HasSuffix(p, ".env") {
+		return 0600
+	}
+	return 0644
+}
+
+func hashOf(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
+
+// 所有镜像共有的基础文件
+func seedBase(fs *FS, flavor, hostname string, built, created time.Time) {
+	for _, dir := range []string{"/bin", "/sbin", "/usr/bin", "/usr/sbin", "/usr/local/bin", "/usr/lib", "/lib", "/etc", "/home", "/mnt", "/opt", "/srv", "/var/log", "/var/run", "/var/tmp", "/var/cache", "/run", "/dev", "/sys", "/media"} {
+		fs.SeedDir(dir, 0755, built)
+	}
+	fs.SeedDir("/tmp", os.ModeSticky|0777, built)
+	fs.SeedDir("/root", 0700, built)
+
+	binaries := []string{"cat", "chmod", "cp", "date", "echo", "false", "grep", "hostname", "ls", "mkdir", "mv", "ps", "pwd", "rm", "sh", "sleep", "touch", "true", "uname"}
+	if flavor == FlavorAsh {
+		fs.Seed("/bin/busybox", "\x7fELF\x02\x01\x01", 0755, built)
+		for _, b := range binaries {
+			fs.Seed("/bin/"+b, "\x7fELF\x02\x01\x01", 0777, built)
+		}
+		for _, b := range []string{"env", "head", "id", "tail", "wc", "wget", "which", "whoami", "nproc", "clear"} {
+			fs.Seed("/usr/bin/"+b, "\x7fELF\x02\x01\x01", 0777, built)
+		}
+		fs.Seed("/sbin/apk", "\x7fELF\x02\x01\x01", 0755, built)
+		fs.Seed("/etc/passwd", passwdAlpine, 0644, built)
+		fs.Seed("/etc/group", "root:x:0:root\nbin:x:1:root,bin,daemon\ndaemon:x:2:root,bin,daemon\nwheel:x:10:root\nnogroup:x:65533:\nnobody:x:65534:\n", 0644, built)
+		fs.Seed("/etc/shadow", "root:*::0:::::\nbin:!::0:::::\ndaemon:!::0:::::\nnobody:!::0:::::\n", 0640, built)
+		fs.Seed("/etc/os-release", osReleaseAlpine, 0644, built)
+		fs.Seed("/etc/alpine-release", "3.18.4\n", 0644, built)
+		fs.Seed("/root/.ash_history", "", 0600, created)
+	} else {
+		for _, b := range append(binaries, "bash") {
+			fs.Seed("/bin/"+b, "\x7fELF\x02\x01\x01", 0755, built)
+		}
+		for _, b := range []string{"curl", "env", "head", "id", "tail", "wc", "wget", "which", "whoami", "nproc", "clear", "apt", "apt-get"} {
+			fs.Seed("/usr/bin/"+b, "\x7fELF\x02\x01\x01", 0755, built)
+		}
+		fs.Seed("/etc/passwd", passwdDebian, 0644, built)
+		fs.Seed("/etc/group", "root:x:0:\ndaemon:x:1:\nbin:x:2:\nsys:x:3:\nadm:x:4:\ntty:x:5:\nwww-data:x:33:\nstaff:x:50:\nnogroup:x:65534:\n", 0644, built)
+		fs.Seed("/etc/shadow", shadowDebian, 0640, built)
+		fs.Seed("/etc/os-release", osReleaseDebian, 0644, built)
+		fs.Seed("/etc/debian_version", "12.1\n", 0644, built)
+		fs.Seed("/root/.bashrc", "# ~/.bashrc: executed by bash(1) for non-login shells.\n\nexport LS_OPTIONS='--color=auto'\nalias ls='ls $LS_OPTIONS'\n", 0644, built)
+		fs.Seed("/root/.profile", "# ~/.profile: executed by Bourne-compatible login shells.\n\nif [ \"$BASH\" ]; then\n  if [ -f ~/.bashrc ]; then\n    . ~/.bashrc\n  fi\nfi\n\nmesg n 2> /dev/null || true\n", 0644, built)
+	}
+
+	ip := fmt.Sprintf("172.17.0.%d", 2+hashOf(hostname)%200)
+	fs.Seed("/etc/hostname", hostname+"\n", 0644, created)
+	fs.Seed("/etc/hosts", "127.0.0.1\tlocalhost\n::1\tlocalhost ip6-localhost ip6-loopback\nfe00::0\tip6-localnet\nff00::0\tip6-mcastprefix\nff02::1\tip6-allnodes\nff02::2\tip6-allrouters\n"+ip+"\t"+hostname+"\n", 0644, created)
+	fs.Seed("/etc/resolv.conf", "nameserver 10.96.0.10\nsearch default.svc.cluster.local svc.cluster.local cluster.local\noptions ndots:5\n", 0644, created)
+	fs.Seed("/.dockerenv", "", 0755, created)
+
+	fs.Seed("/proc/version", fmt.Sprintf("Linux version %s (buildd@lcy02-amd64-044) (gcc (Ubuntu 11.3.0-1ubuntu1~22.04.1) 11.3.0, GNU ld (GNU Binutils for Ubuntu) 2.38) %s\n", kernelRelease, kernelVersion), 0444, created)
+	fs.Seed("/proc/cpuinfo", cpuinfo(), 0444, created)
+	fs.Seed("/proc/meminfo", "MemTotal:       16384000 kB\nMemFree:         2871304 kB\nMemAvailable:    9826412 kB\nBuffers:          402212 kB\nCached:          6318472 kB\nSwapCached:            0 kB\nSwapTotal:             0 kB\nSwapFree:              0 kB\n", 0444, created)
+	fs.Seed("/proc/self/cgroup", "0::/\n", 0444, created)
+	fs.Seed("/proc/1/cgroup", "0::/\n", 0444, created)
+	fs.Seed("/proc/mounts", "overlay / overlay rw,relatime,lowerdir=/var/lib/docker/overlay2/l/7QXZ3KJH2N5Y4W6V:/var/lib/docker/overlay2/l/ZP4M2KQ7R3T6Y8U1,upperdir=/var/lib/docker/overlay2/5f0e8b2c/diff,workdir=/var/lib/docker/overlay2/5f0e8b2c/work 0 0\nproc /proc proc rw,nosuid,nodev,noexec,relatime 0 0\ntmpfs /dev tmpfs rw,nosuid,size=65536k,mode=755 0 0\nshm /dev/shm tmpfs rw,nosuid,nodev,noexec,relatime,size=65536k 0 0\n/dev/sda1 /etc/hosts ext4 rw,relatime 0 0\n", 0444, created)
+	fs.Seed("/dev/null", "", 0666, created)
+}
+
+func cpuinfo() string {
+	var b strings.Builder
+	for i := 0; i < 4; i++ {
+		fmt.Fprintf(&b, "processor\t: %d\nvendor_id\t: GenuineIntel\ncpu family\t: 6\nmodel\t\t: 85\nmodel name\t: Intel(R) Xeon(R) Platinum 8269CY CPU @ 2.50GHz\ncpu MHz\t\t: 2500.000\ncache size\t: 36608 KB\ncpu cores\t: 2\n\n", i)
+	}
+	return b.String()
+}
@@ -0,0 +1,925 @@
+package shell
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// FlavorBash Debian/Ubuntu 系镜像使用的 bash
+	FlavorBash = "bash"
+	// FlavorAsh Alpine/Busybox 系镜像使用的 ash
+	FlavorAsh = "ash"
+
+	// 单个会话最多保留的按键字节数，防止内存被刷爆
+	maxKeystrokes = 1 << 20
+	// 单个会话最多保留的历史命令条数
+	maxHistory = 1000
+	// 脚本和命令替换的最大嵌套深度
+	maxDepth = 8
+	// 单行命令的最大长度，与 Linux 终端规范模式的行缓冲一致，超长的行整行丢弃
+	maxLine = 4096
+	// 单条命令最多返回的输出字节数，超出部分丢弃
+	maxOutput = 1 << 20
+)
+
+// Process 伪造的进程信息
+type Process struct {
+	PID     int
+	User    string
+	Command string
+}
+
+// Shell 完全在内存中模拟的 shell，不会在宿主机上执行任何命令
+type Shell struct {
+	FS       *FS
+	Flavor   string
+	Hostname string
+	User     string
+	Home     string
+	Cwd      string
+	Procs    []Process
+
+	// OnCommand 每条命令执行前回调，用于上报攻击者输入
+	OnCommand func(line string)
+
+	env        []string
+	history    []string
+	keystrokes []byte
+	status     int
+	nextPID    int
+	oldPwd     string
+	exited     bool
+	depth      int
+	term       io.Writer
+}
+
+// 命令实现函数
+type command func(s *Shell, args []string, stdin string, stdout, stderr io.Writer) int
+
+// 单条简单命令及其重定向
+type simpleCmd struct {
+	args      []string
+	outFile   string
+	appendOut bool
+	inFile    string
+	errFile   string
+	errToOut  bool
+}
+
+// 词法单元
+type token struct {
+	val  string
+	op   bool
+	glob bool
+}
+
+// Exited 会话是否已经执行 exit
+func (s *Shell) Exited() bool {
+	return s.exited
+}
+
+// ExitStatus 返回最后一条命令的退出码
+func (s *Shell) ExitStatus() int {
+	return s.status
+}
+
+// History 返回已执行的命令
+func (s *Shell) History() []string {
+	return s.history
+}
+
+// Keystrokes 返回攻击者在交互会话中的全部按键
+func (s *Shell) Keystrokes() string {
+	return string(s.keystrokes)
+}
+
+// Getenv 读取环境变量
+func (s *Shell) Getenv(key string) string {
+	prefix := key + "="
+	for _, kv := range s.env {
+		if strings.HasPrefix(kv, prefix) {
+			return kv[len(prefix):]
+		}
+	}
+	return ""
+}
+
+// Setenv 设置环境变量，保持原有顺序
+func (s *Shell) Setenv(key, value string) {
+	prefix := key + "="
+	for i, kv := range s.env {
+		if strings.HasPrefix(kv, prefix) {
+			s.env[i] = prefix + value
+			return
+		}
+	}
+	s.env = append(s.env, prefix+value)
+}
+
+// Unsetenv 删除环境变量
+func (s *Shell) Unsetenv(key string) {
+	prefix := key + "="
+	for i, kv := range s.env {
+		if strings.HasPrefix(kv, prefix) {
+			s.env = append(s.env[:i], s.env[i+1:]...)
+			return
+		}
+	}
+}
+
+// Environ 返回全部环境变量
+func (s *Shell) Environ() []string {
+	return append([]string(nil), s.env...)
+}
+
+// Prompt 返回当前提示符
+func (s *Shell) Prompt() string {
+	if s.Flavor == FlavorAsh {
+		return s.displayCwd() + " # "
+	}
+	return fmt.Sprintf("%s@%s:%s# ", s.User, s.Hostname, s.displayCwd())
+}
+
+func (s *Shell) displayCwd() string {
+	if s.Cwd == s.Home {
+		return "~"
+	}
+	if s.Home != "/" && strings.HasPrefix(s.Cwd, s.Home+"/") {
+		return "~" + strings.TrimPrefix(s.Cwd, s.Home)
+	}
+	return s.Cwd
+}
+
+// 把相对路径转换为虚拟文件系统中的绝对路径
+func (s *Shell) abs(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		p = s.Home + strings.TrimPrefix(p, "~")
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(s.Cwd, p)
+	}
+	return path.Clean(p)
+}
+
+// 命令未找到时的提示
+func (s *Shell) notFound(name string) string {
+	if s.Flavor == FlavorAsh {
+		return fmt.Sprintf("sh: %s: not found\n", name)
+	}
+	return fmt.Sprintf("bash: %s: command not found\n", name)
+}
+
+func (s *Shell) pid() int {
+	s.nextPID++
+	return s.nextPID
+}
+
+// Exec 执行一行命令，返回终端上应显示的输出
+func (s *Shell) Exec(line string) string {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return ""
+	}
+
+	s.history = append(s.history, line)
+	if len(s.history) > maxHistory {
+		s.history = s.history[len(s.history)-maxHistory:]
+	}
+
+	if s.OnCommand != nil {
+		s.OnCommand(line)
+	}
+
+	out := &limitWriter{max: maxOutput}
+	s.term = out
+	s.runLine(line, "", out, out)
+	s.term = nil
+	return out.String()
+}
+
+// limitWriter 只保留前 max 个字节，超出部分丢弃但不返回错误，命令照常执行完
+type limitWriter struct {
+	strings.Builder
+	max int
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if room := w.max - w.Len(); room < len(p) {
+		if room > 0 {
+			w.Builder.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return w.Builder.Write(p)
+}
+
+func (w *limitWriter) WriteString(str string) (int, error) {
+	return w.Write([]byte(str))
+}
+
+// ExecArgs 以参数数组形式执行命令，对应 docker exec 的 Cmd
+func (s *Shell) ExecArgs(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	if len(args) >= 3 && IsShell(args[:1]) && args[1] == "-c" {
+		return s.Exec(args[2])
+	}
+	return s.Exec(JoinArgs(args))
+}
+
+// IsShell 判断参数是否只是启动一个交互式 shell
+func IsShell(args []string) bool {
+	if len(args) != 1 && !(len(args) == 2 && (args[1] == "-i" || args[1] == "-l")) {
+		return false
+	}
+	switch path.Base(args[0]) {
+	case "sh", "bash", "ash", "zsh", "dash":
+		return true
+	}
+	return false
+}
+
+// JoinArgs 把参数数组拼接成命令行，必要时加引号
+func JoinArgs(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`|&;<>()*?#~") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted = append(quoted, arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Run 在交互连接上运行 shell，tty 为 true 时负责回显和行编辑
+func (s *Shell) Run(rw io.ReadWriter, tty bool) error {
+	reader := bufio.NewReader(rw)
+	write := func(str string) error {
+		if tty {
+			str = strings.ReplaceAll(str, "\n", "\r\n")
+		}
+		_, err := io.WriteString(rw, str)
+		return err
+	}
+
+	if tty {
+		if err := write(s.Prompt()); err != nil {
+			return err
+		}
+	}
+
+	var line []byte
+	// overflow 当前行超过 maxLine，丢弃到下一个换行
+	overflow := false
+	lastCR := false
+	for !s.exited {
+		b, err := reader.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				// 管道输入的最后一行可能没有换行
+				if !tty && !overflow && len(line) > 0 {
+					return write(s.Exec(string(line)))
+				}
+				return nil
+			}
+			return err
+		}
+		s.record(b)
+
+		if len(line) >= maxLine && b != '\r' && b != '\n' {
+			line = line[:0]
+			overflow = true
+		}
+
+		if !tty {
+			switch b {
+			case '\n':
+				if !overflow {
+					if err := write(s.Exec(string(line))); err != nil {
+						return err
+					}
+				}
+				line = line[:0]
+				overflow = false
+			case '\r':
+			default:
+				if !overflow {
+					line = append(line, b)
+				}
+			}
+			continue
+		}
+
+		cr := b == '\r'
+		switch {
+		case b == '\n' && lastCR:
+			// \r\n 只算一次回车
+		case b == '\r' || b == '\n':
+			write("\n")
+			if !overflow {
+				if output := s.Exec(string(line)); output != "" {
+					write(output)
+				}
+			}
+			line = line[:0]
+			overflow = false
+			if !s.exited {
+				write(s.Prompt())
+			}
+		case b == 0x03:
+			// Ctrl+C 丢弃当前行
+			line = line[:0]
+			overflow = false
+			write("^C\n" + s.Prompt())
+		case b == 0x04:
+			// Ctrl+D 在空行时退出
+			if len(line) == 0 {
+				write("exit\n")
+				s.exited = true
+			}
+		case b == 0x7f || b == 0x08:
+			if len(line) > 0 {
+				_, size := utf8.DecodeLastRune(line)
+				line = line[:len(line)-size]
+				rw.Write([]byte{0x08, 0x20, 0x08})
+			}
+		case b == 0x15:
+			// Ctrl+U 清除整行
+			for range []rune(string(line)) {
+				rw.Write([]byte{0x08, 0x20, 0x08})
+			}
+			line = line[:0]
+			overflow = false
+		case b == 0x0c:
+			// Ctrl+L 清屏
+			write("\x1b[H\x1b[2J" + s.Prompt() + string(line))
+		case b == 0x1b:
+			// 吞掉方向键等转义序列
+			s.skipEscape(reader)
+		case b == '\t':
+		case b >= 0x20:
+			if !overflow {
+				line = append(line, b)
+				rw.Write([]byte{b})
+			}
+		}
+		lastCR = cr
+	}
+	return nil
+}
+
+// 记录按键
+func (s *Shell) record(b byte) {
+	if len(s.keystrokes) < maxKeystrokes {
+		s.keystrokes = append(s.keystrokes, b)
+	}
+}
+
+// 读取并丢弃一个 ANSI 转义序列
+func (s *Shell) skipEscape(reader *bufio.Reader) {
+	b, err := reader.ReadByte()
+	if err != nil {
+		return
+	}
+	s.record(b)
+	if b != '[' && b != 'O' {
+		return
+	}
+	for {
+		b, err = reader.ReadByte()
+		if err != nil {
+			return
+		}
+		s.record(b)
+		if b >= 0x40 && b <= 0x7e {
+			return
+		}
+	}
+}
+
+// 执行一行命令，stdout 与 stderr 分别写入
+func (s *Shell) runLine(line string, stdin string, stdout, stderr io.Writer) {
+	if s.depth >= maxDepth {
+		return
+	}
+	s.depth++
+	defer func() { s.depth-- }()
+
+	tokens, err := s.tokenize(line)
+	if err != nil {
+		if s.Flavor == FlavorAsh {
+			fmt.Fprintf(stderr, "sh: syntax error: %v\n", err)
+		} else {
+			fmt.Fprintf(stderr, "bash: %v\n", err)
+		}
+		s.status = 2
+		return
+	}
+
+	connector := ""
+	var pipeline []simpleCmd
+	var cur []token
+	flushCmd := func() error {
+		cmd, err := s.parseCmd(cur)
+		if err != nil {
+			return err
+		}
+		pipeline = append(pipeline, cmd)
+		cur = nil
+		return nil
+	}
+	runPipeline := func() {
+		if len(pipeline) == 0 {
+			return
+		}
+		if (connector == "&&" && s.status != 0) || (connector == "||" && s.status == 0) {
+			pipeline = nil
+			return
+		}
+		s.runPipeline(pipeline, stdin, stdout, stderr)
+		pipeline = nil
+	}
+
+	for _, t := range tokens {
+		if !t.op {
+			cur = append(cur, t)
+			continue
+		}
+		switch t.val {
+		case "|", ";", "&", "&&", "||":
+			if len(cur) == 0 {
+				if t.val == ";" && len(pipeline) == 0 {
+					continue
+				}
+				s.syntaxError(t.val, stderr)
+				return
+			}
+			if err := flushCmd(); err != nil {
+				s.syntaxError(err.Error(), stderr)
+				return
+			}
+			if t.val != "|" {
+				runPipeline()
+				connector = t.val
+			}
+		default:
+			cur = append(cur, t)
+		}
+		if s.exited {
+			return
+		}
+	}
+	if len(cur) > 0 {
+		if err := flushCmd(); err != nil {
+			s.syntaxError(err.Error(), stderr)
+			return
+		}
+	}
+	runPipeline()
+}
+
+func (s *Shell) syntaxError(near string, stderr io.Writer) {
+	if s.Flavor == FlavorAsh {
+		fmt.Fprintf(stderr, "sh: syntax error: unexpected \"%s\"\n", near)
+	} else {
+		fmt.Fprintf(stderr, "bash: syntax error near unexpected token `%s'\n", near)
+	}
+	s.status = 2
+}
+
+// 解析单条命令的参数和重定向
+func (s *Shell) parseCmd(tokens []token) (simpleCmd, error) {
+	var cmd simpleCmd
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if !t.op {
+			cmd.args = append(cmd.args, s.expandGlob(t)...)
+			continue
+		}
+		if t.val == "2>&1" {
+			cmd.errToOut = true
+			continue
+		}
+		if i+1 >= len(tokens) || tokens[i+1].op {
+			return cmd, errors.New("newline")
+		}
+		target := tokens[i+1].val
+		i++
+		switch t.val {
+		case ">":
+			cmd.outFile, cmd.appendOut = target, false
+		case ">>":
+			cmd.outFile, cmd.appendOut = target, true
+		case "<":
+			cmd.inFile = target
+		case "2>", "2>>":
+			cmd.errFile = target
+		}
+	}
+	return cmd, nil
+}
+
+// 执行管道
+func (s *Shell) runPipeline(cmds []simpleCmd, stdin string, stdout, stderr io.Writer) {
+	input := stdin
+	for i, cmd := range cmds {
+		var out, errOut strings.Builder
+		status := 0
+
+		if cmd.inFile != "" {
+			content, err := s.FS.ReadFile(s.abs(cmd.inFile))
+			if err != nil {
+				fmt.Fprintf(&errOut, "%s: %s: %v\n", s.errPrefix(), cmd.inFile, err)
+				status = 1
+			} else {
+				input = content
+			}
+		}
+		if status == 0 {
+			status = s.runCommand(cmd.args, input, &out, &errOut)
+		}
+
+		o, e := out.String(), errOut.String()
+		if cmd.errToOut {
+			o, e = o+e, ""
+		}
+		if cmd.errFile != "" {
+			if cmd.errFile != "/dev/null" {
+				s.FS.AppendFile(s.abs(cmd.errFile), e, 0644)
+			}
+			e = ""
+		}
+		if cmd.outFile != "" {
+			if cmd.outFile != "/dev/null" {
+				var err error
+				if cmd.appendOut {
+					err = s.FS.AppendFile(s.abs(cmd.outFile), o, 0644)
+				} else {
+					err = s.FS.WriteFile(s.abs(cmd.outFile), o, 0644)
+				}
+				if err != nil {
+					fmt.Fprintf(stderr, "%s: %s: %v\n", s.errPrefix(), cmd.outFile, err)
+					status = 1
+				}
+			}
+			o = ""
+		}
+
+		io.WriteString(stderr, e)
+		if i == len(cmds)-1 {
+			io.WriteString(stdout, o)
+		} else {
+			input = o
+		}
+		s.status = status
+		if s.exited {
+			return
+		}
+	}
+}
+
+func (s *Shell) errPrefix() string {
+	if s.Flavor == FlavorAsh {
+		return "sh"
+	}
+	return "bash"
+}
+
+// 执行单条命令
+func (s *Shell) runCommand(args []string, stdin string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		return 0
+	}
+
+	// 纯变量赋值
+	for len(args) > 0 && isAssignment(args[0]) {
+		kv := strings.SplitN(args[0], "=", 2)
+		s.Setenv(kv[0], kv[1])
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return 0
+	}
+
+	name := args[0]
+	if strings.Contains(name, "/") {
+		p := s.abs(name)
+		node, err := s.FS.Lookup(p)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s: No such file or directory\n", s.errPrefix(), name)
+			return 127
+		}
+		if node.IsDir {
+			fmt.Fprintf(stderr, "%s: %s: Is a directory\n", s.errPrefix(), name)
+			return 126
+		}
+		if _, ok := commands[path.Base(p)]; ok && isBinDir(path.Dir(p)) {
+			name = path.Base(p)
+		} else if node.Mode&0111 == 0 {
+			fmt.Fprintf(stderr, "%s: %s: Permission denied\n", s.errPrefix(), name)
+			return 126
+		} else {
+			return s.runScript(node.Content, stdout, stderr)
+		}
+	}
+
+	if name == "bash" && s.Flavor == FlavorAsh {
+		io.WriteString(stderr, s.notFound(name))
+		return 127
+	}
+
+	fn, ok := commands[name]
+	if !ok {
+		io.WriteString(stderr, s.notFound(name))
+		return 127
+	}
+	return fn(s, args, stdin, stdout, stderr)
+}
+
+// 逐行执行脚本内容
+func (s *Shell) runScript(content string, stdout, stderr io.Writer) int {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		s.runLine(line, "", stdout, stderr)
+		if s.exited {
+			s.exited = false
+			break
+		}
+	}
+	return s.status
+}
+
+func isBinDir(dir string) bool {
+	switch dir {
+	case "/bin", "/sbin", "/usr/bin", "/usr/sbin", "/usr/local/bin", "/usr/local/sbin":
+		return true
+	}
+	return false
+}
+
+func isAssignment(arg string) bool {
+	i := strings.Index(arg, "=")
+	if i <= 0 {
+		return false
+	}
+	for j, c := range arg[:i] {
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (j > 0 && c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+// 词法分析，同时完成变量展开和命令替换
+func (s *Shell) tokenize(line string) ([]token, error) {
+	var tokens []token
+	var cur strings.Builder
+	inWord, glob := false, false
+
+	flush := func() {
+		if inWord {
+			tokens = append(tokens, token{val: cur.String(), glob: glob})
+			cur.Reset()
+			inWord, glob = false, false
+		}
+	}
+	op := func(val string) {
+		flush()
+		tokens = append(tokens, token{val: val, op: true})
+	}
+
+	rs := []rune(line)
+	for i := 0; i < len(rs); i++ {
+		c := rs[i]
+		switch {
+		case c == '\'':
+			j := indexRune(rs, i+1, '\'')
+			if j < 0 {
+				return nil, errors.New("unexpected EOF while looking for matching `''")
+			}
+			cur.WriteString(string(rs[i+1 : j]))
+			inWord = true
+			i = j
+		case c == '"':
+			j := i + 1
+			for ; j < len(rs) && rs[j] != '"'; j++ {
+				switch {
+				case rs[j] == '\\' && j+1 < len(rs) && strings.ContainsRune("$`\"\\", rs[j+1]):
+					cur.WriteRune(rs[j+1])
+					j++
+				case rs[j] == '$':
+					val, n := s.expandDollar(rs[j:])
+					cur.WriteString(val)
+					j += n - 1
+				case rs[j] == '`':
+					k := indexRune(rs, j+1, '`')
+					if k < 0 {
+						return nil, errors.New("unexpected EOF while looking for matching ``'")
+					}
+					cur.WriteString(s.capture(string(rs[j+1 : k])))
+					j = k
+				default:
+					cur.WriteRune(rs[j])
+				}
+			}
+			if j >= len(rs) {
+				return nil, errors.New("unexpected EOF while looking for matching `\"'")
+			}
+			inWord = true
+			i = j
+		case c == '\\':
+			if i+1 < len(rs) {
+				cur.WriteRune(rs[i+1])
+				i++
+			}
+			inWord = true
+		case c == '$':
+			val, n := s.expandDollar(rs[i:])
+			cur.WriteString(val)
+			inWord = true
+			i += n - 1
+		case c == '`':
+			j := indexRune(rs, i+1, '`')
+			if j < 0 {
+				return nil, errors.New("unexpected EOF while looking for matching ``'")
+			}
+			cur.WriteString(s.capture(string(rs[i+1 : j])))
+			inWord = true
+			i = j
+		case c == '~' && !inWord && (i+1 == len(rs) || rs[i+1] == '/' || rs[i+1] == ' '):
+			cur.WriteString(s.Home)
+			inWord = true
+		case c == '#' && !inWord:
+			flush()
+			return tokens, nil
+		case c == ' ' || c == '\t':
+			flush()
+		case c == ';':
+			op(";")
+		case c == '&':
+			if i+1 < len(rs) && rs[i+1] == '&' {
+				op("&&")
+				i++
+			} else {
+				op("&")
+			}
+		case c == '|':
+			if i+1 < len(rs) && rs[i+1] == '|' {
+				op("||")
+				i++
+			} else {
+				op("|")
+			}
+		case c == '>':
+			prefix := ""
+			if inWord && (cur.String() == "1" || cur.String() == "2") {
+				prefix = cur.String()
+				cur.Reset()
+				inWord = false
+			}
+			if prefix == "1" {
+				prefix = ""
+			}
+			switch {
+			case prefix == "2" && i+2 < len(rs) && rs[i+1] == '&' && rs[i+2] == '1':
+				op("2>&1")
+				i += 2
+			case i+1 < len(rs) && rs[i+1] == '>':
+				op(prefix + ">>")
+				i++
+			default:
+				op(prefix + ">")
+			}
+		case c == '<':
+			op("<")
+		default:
+			if c == '*' || c == '?' {
+				glob = true
+			}
+			cur.WriteRune(c)
+			inWord = true
+		}
+	}
+	flush()
+	return tokens, nil
+}
+
+func indexRune(rs []rune, from int, r rune) int {
+	for i := from; i < len(rs); i++ {
+		if rs[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// 展开以 $ 开头的变量或命令替换，返回展开值和消耗的字符数
+func (s *Shell) expandDollar(rs []rune) (string, int) {
+	if len(rs) < 2 {
+		return "$", 1
+	}
+	switch c := rs[1]; {
+	case c == '(':
+		depth := 0
+		for j := 1; j < len(rs); j++ {
+			switch rs[j] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+				if depth == 0 {
+					return s.capture(string(rs[2:j])), j + 1
+				}
+			}
+		}
+		return "", len(rs)
+	case c == '{':
+		j := indexRune(rs, 2, '}')
+		if j < 0 {
+			return "", len(rs)
+		}
+		return s.Getenv(string(rs[2:j])), j + 1
+	case c == '?':
+		return strconv.Itoa(s.status), 2
+	case c == '$':
+		return strconv.Itoa(s.shellPID()), 2
+	case c >= '0' && c <= '9':
+		if c == '0' {
+			return s.errPrefix(), 2
+		}
+		return "", 2
+	case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		j := 1
+		for j < len(rs) && (rs[j] == '_' || (rs[j] >= 'a' && rs[j] <= 'z') || (rs[j] >= 'A' && rs[j] <= 'Z') || (rs[j] >= '0' && rs[j] <= '9')) {
+			j++
+		}
+		return s.Getenv(string(rs[1:j])), j
+	}
+	return "$", 1
+}
+
+// 命令替换，返回去掉末尾换行的标准输出
+func (s *Shell) capture(line string) string {
+	var out strings.Builder
+	stderr := s.term
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	status := s.status
+	s.runLine(line, "", &out, stderr)
+	s.status = status
+	return strings.TrimRight(out.String(), "\n")
+}
+
+// 通配符展开，只处理最后一级路径
+func (s *Shell) expandGlob(t token) []string {
+	if !t.glob {
+		return []string{t.val}
+	}
+	dir, pattern := path.Split(t.val)
+	lookup := s.Cwd
+	if dir != "" {
+		lookup = s.abs(dir)
+	}
+	nodes, err := s.FS.ReadDir(lookup)
+	if err != nil {
+		return []string{t.val}
+	}
+
+	var matches []string
+	for _, node := range nodes {
+		if strings.HasPrefix(node.Name, ".") && !strings.HasPrefix(pattern, ".") {
+			continue
+		}
+		if ok, _ := path.Match(pattern, node.Name); ok {
+			matches = append(matches, dir+node.Name)
+		}
+	}
+	if len(matches) == 0 {
+		return []string{t.val}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// 当前 shell 的进程号
+func (s *Shell) shellPID() int {
+	for _, p := range s.Procs {
+		if p.Command == "sh" || p.Command == "bash" || p.Command == "/bin/sh" || p.Command == "/bin/bash" {
+			return p.PID
+		}
+	}
+	return 1
+}
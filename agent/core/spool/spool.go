@@ -0,0 +1,522 @@
+package spool
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"KubePot/utils/log"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// 单个段文件大小上限，写满后切换到新段，已发送完的段整体删除
+	segmentSize = 4 << 20
+	// 记录头：4 字节长度和 4 字节 CRC32
+	headerSize = 8
+	// 单条记录上限，超过视为文件损坏
+	maxRecordSize = 16 << 20
+
+	// 写入的记录每 syncEvery 条或最早一条写入 syncInterval 后落盘一次。
+	// 进程崩溃不会丢失已写入的记录，断电或内核崩溃时最多丢失 syncEvery 条或 syncInterval 内写入的事件
+	syncEvery    = 64
+	syncInterval = time.Second
+
+	minBackoff = time.Second
+	maxBackoff = 5 * time.Minute
+)
+
+// ErrFull 积压数据达到上限，新事件被丢弃
+var ErrFull = errors.New("spool: 积压已满，事件被丢弃")
+
+// Event 待发送给服务端的一条上报
+// ID 同时作为幂等键，服务端据此丢弃重发的事件
+type Event struct {
+	ID   string          `json:"id"`
+	Path string          `json:"path"`
+	Body json.RawMessage `json:"body"`
+	Time int64           `json:"time"`
+}
+
+type segment struct {
+	seq  uint64
+	size int64
+	// count 段内未发送的记录数
+	count int64
+}
+
+// cursor 已确认发送的位置，段号和段内偏移
+type cursor struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+// Spool 基于追加写段文件的本地队列，进程崩溃后从游标位置继续发送
+type Spool struct {
+	dir      string
+	maxBytes int64
+
+	mu       sync.Mutex
+	segments []segment
+	head     *os.File
+	reader   *os.File
+	readSeq  uint64
+	readOff  int64
+	size     int64
+	depth    int64
+	dropped  int64
+	// unsynced 写入后尚未落盘的记录数
+	unsynced int
+
+	notify chan struct{}
+}
+
+func segmentPath(dir string, seq uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%016d.seg", seq))
+}
+
+// Open 打开或创建 dir 下的队列，截断写了一半的记录并统计未发送的条数
+func Open(dir string, maxBytes int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &Spool{dir: dir, maxBytes: maxBytes, notify: make(chan struct{}, 1)}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, ".seg") {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, ".seg"), 10, 64)
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, segment{seq: seq})
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+
+	var c cursor
+	if data, err := os.ReadFile(filepath.Join(dir, "cursor")); err == nil {
+		json.Unmarshal(data, &c)
+	}
+
+	// 游标之前的段已经发送完，直接删除
+	kept := s.segments[:0]
+	for _, seg := range s.segments {
+		if seg.seq < c.Segment {
+			os.Remove(segmentPath(dir, seg.seq))
+			continue
+		}
+		kept = append(kept, seg)
+	}
+	s.segments = kept
+
+	for i := range s.segments {
+		seg := &s.segments[i]
+		start := int64(0)
+		if seg.seq == c.Segment {
+			start = c.Offset
+		}
+		valid, count, err := scan(segmentPath(dir, seg.seq), start)
+		if err != nil {
+			return nil, err
+		}
+		seg.size = valid
+		seg.count = count
+		s.size += valid
+		s.depth += count
+	}
+
+	if len(s.segments) > 0 {
+		s.readSeq = s.segments[0].seq
+		if s.readSeq == c.Segment && c.Offset <= s.segments[0].size {
+			s.readOff = c.Offset
+		}
+	}
+
+	if err := s.openHead(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// scan 校验段文件，从 start 开始统计完整记录数，遇到不完整或损坏的记录时截断
+func scan(path string, start int64) (int64, int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var off, count int64
+	var header [headerSize]byte
+	for {
+		if _, err := f.ReadAt(header[:], off); err != nil {
+			break
+		}
+		n := int64(binary.BigEndian.Uint32(header[:4]))
+		if n > maxRecordSize {
+			break
+		}
+		payload := make([]byte, n)
+		if _, err := f.ReadAt(payload, off+headerSize); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+			break
+		}
+		if off >= start {
+			count++
+		}
+		off += headerSize + n
+	}
+
+	if info, err := f.Stat(); err == nil && info.Size() > off {
+		log.Pr("Spool", "127.0.0.1", "截断损坏的队列记录", fmt.Sprintf("%s: %d -> %d", path, info.Size(), off))
+		if err := f.Truncate(off); err != nil {
+			return 0, 0, err
+		}
+	}
+	return off, count, nil
+}
+
+// openHead 打开最后一个段用于追加，没有时新建
+func (s *Spool) openHead() error {
+	if len(s.segments) == 0 || s.segments[len(s.segments)-1].size >= segmentSize {
+		seq := uint64(1)
+		if len(s.segments) > 0 {
+			seq = s.segments[len(s.segments)-1].seq + 1
+		}
+		s.segments = append(s.segments, segment{seq: seq})
+		if len(s.segments) == 1 {
+			s.readSeq, s.readOff = seq, 0
+		}
+	}
+	last := s.segments[len(s.segments)-1]
+	f, err := os.OpenFile(segmentPath(s.dir, last.seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if s.head != nil {
+		s.head.Sync()
+		s.head.Close()
+	}
+	s.head = f
+	s.unsynced = 0
+	return nil
+}
+
+// Append 写入一条事件，按 syncEvery 和 syncInterval 批量落盘，积压超过上限时丢弃并计数
+func (s *Spool) Append(ev Event) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	record := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(record[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[headerSize:], payload)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size+int64(len(record)) > s.maxBytes {
+		s.dropped++
+		return ErrFull
+	}
+	if s.segments[len(s.segments)-1].size >= segmentSize {
+		if err := s.openHead(); err != nil {
+			return err
+		}
+	}
+	if _, err := s.head.Write(record); err != nil {
+		return err
+	}
+	s.segments[len(s.segments)-1].size += int64(len(record))
+	s.segments[len(s.segments)-1].count++
+	s.size += int64(len(record))
+	s.depth++
+
+	if s.unsynced++; s.unsynced >= syncEvery {
+		if err := s.syncLocked(); err != nil {
+			return err
+		}
+	} else if s.unsynced == 1 {
+		time.AfterFunc(syncInterval, s.flush)
+	}
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// flush 落盘 syncInterval 内写入的记录
+func (s *Spool) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.syncLocked(); err != nil {
+		log.Pr("Spool", "127.0.0.1", "队列落盘失败", err)
+	}
+}
+
+// syncLocked 落盘未同步的记录，调用方持有 mu
+func (s *Spool) syncLocked() error {
+	if s.unsynced == 0 {
+		return nil
+	}
+	s.unsynced = 0
+	return s.head.Sync()
+}
+
+// peek 读取游标处的下一条事件，返回事件和它之后的偏移
+func (s *Spool) peek() (*Event, int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		seg := s.segments[0]
+		if s.readOff >= seg.size {
+			if len(s.segments) == 1 {
+				return nil, 0, false
+			}
+			// 当前段已发送完，切换到下一段并删除旧段
+			if s.reader != nil {
+				s.reader.Close()
+				s.reader = nil
+			}
+			os.Remove(segmentPath(s.dir, seg.seq))
+			s.segments = s.segments[1:]
+			s.size -= seg.size
+			s.readSeq, s.readOff = s.segments[0].seq, 0
+			s.saveCursor()
+			continue
+		}
+
+		if s.reader == nil {
+			f, err := os.Open(segmentPath(s.dir, seg.seq))
+			if err != nil {
+				s.quarantine(err)
+				continue
+			}
+			s.reader = f
+		}
+		var header [headerSize]byte
+		if _, err := s.reader.ReadAt(header[:], s.readOff); err != nil {
+			s.quarantine(err)
+			continue
+		}
+		n := int64(binary.BigEndian.Uint32(header[:4]))
+		next := s.readOff + headerSize + n
+		if next > seg.size {
+			s.quarantine(fmt.Errorf("记录长度 %d 超出段文件", n))
+			continue
+		}
+		payload := make([]byte, n)
+		if _, err := s.reader.ReadAt(payload, s.readOff+headerSize); err != nil {
+			s.quarantine(err)
+			continue
+		}
+
+		var ev Event
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) || json.Unmarshal(payload, &ev) != nil {
+			// 打开时已经校验过，这里出错说明文件被外部改动，跳过该记录
+			s.readOff = next
+			s.segments[0].count--
+			s.depth--
+			s.dropped++
+			continue
+		}
+		return &ev, next, true
+	}
+}
+
+// quarantine 游标所在的段无法读取时改名为 .corrupt 保留以便排查，
+// 其中未发送的事件计为丢弃，从下一段继续发送。调用方持有 mu
+func (s *Spool) quarantine(cause error) {
+	seg := s.segments[0]
+	path := segmentPath(s.dir, seg.seq)
+	log.Pr("Spool", "127.0.0.1", "队列段文件损坏，已隔离", fmt.Sprintf("%s: 丢弃 %d 条: %v", path, seg.count, cause))
+
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+	os.Rename(path, path+".corrupt")
+	s.size -= seg.size
+	s.depth -= seg.count
+	s.dropped += seg.count
+
+	s.segments = s.segments[1:]
+	if len(s.segments) == 0 {
+		// 隔离的是正在写入的段，新事件写入下一段
+		s.segments = []segment{{seq: seg.seq + 1}}
+		if err := s.openHead(); err != nil {
+			log.Pr("Spool", "127.0.0.1", "打开队列段文件失败", err)
+		}
+	}
+	s.readSeq, s.readOff = s.segments[0].seq, 0
+	s.saveCursor()
+}
+
+// ack 确认游标处的事件已处理，持久化新的游标
+func (s *Spool) ack(next int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readOff = next
+	s.segments[0].count--
+	s.depth--
+	s.saveCursor()
+}
+
+// saveCursor 先写临时文件再重命名，崩溃时游标要么是旧值要么是新值
+func (s *Spool) saveCursor() {
+	data, _ := json.Marshal(cursor{Segment: s.readSeq, Offset: s.readOff})
+	tmp := filepath.Join(s.dir, "cursor.tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		log.Pr("Spool", "127.0.0.1", "保存队列游标失败", err)
+		return
+	}
+	f.Write(data)
+	f.Sync()
+	f.Close()
+	if err := os.Rename(tmp, filepath.Join(s.dir, "cursor")); err != nil {
+		log.Pr("Spool", "127.0.0.1", "保存队列游标失败", err)
+	}
+}
+
+// Stats 返回未发送的事件数和累计丢弃数
+func (s *Spool) Stats() (depth int64, dropped int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.depth, s.dropped
+}
+
+// permanentError 服务端明确拒绝的事件，重试也不会成功
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 标记错误不需要重试，事件会被丢弃并计数
+func Permanent(err error) error {
+	return &permanentError{err}
+}
+
+// Run 按顺序发送队列中的事件，失败时指数退避重试，直到成功或被标记为不可重试
+func (s *Spool) Run(send func(Event) error) {
+	backoff := minBackoff
+	for {
+		ev, next, ok := s.peek()
+		if !ok {
+			select {
+			case <-s.notify:
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+
+		err := send(*ev)
+		var permanent *permanentError
+		if err != nil && !errors.As(err, &permanent) {
+			depth, _ := s.Stats()
+			log.Pr("Spool", "127.0.0.1", "事件发送失败，稍后重试", fmt.Sprintf("%s 积压 %d 条，%s 后重试: %v", ev.Path, depth, backoff, err))
+			// 加入抖动，避免多个 Agent 在服务端恢复时同时重发
+			time.Sleep(backoff + time.Duration(rand.Int63n(int64(backoff)/2+1)))
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+		if permanent != nil {
+			log.Pr("Spool", "127.0.0.1", "服务端拒绝事件，已丢弃", fmt.Sprintf("%s %s: %v", ev.Path, ev.ID, err))
+			s.mu.Lock()
+			s.dropped++
+			s.mu.Unlock()
+		}
+		s.ack(next)
+		backoff = minBackoff
+	}
+}
+
+// std 默认队列，由 Init 打开，各协议的上报都写入这里
+var std *Spool
+
+// Init 打开默认队列
+func Init(dir string, maxBytes int64) error {
+	s, err := Open(dir, maxBytes)
+	if err != nil {
+		return err
+	}
+	std = s
+	go s.logStats()
+	return nil
+}
+
+// logStats 有积压或丢弃时每分钟记录一次队列状态
+func (s *Spool) logStats() {
+	var lastDropped int64
+	for range time.Tick(time.Minute) {
+		depth, dropped := s.Stats()
+		if depth > 0 || dropped != lastDropped {
+			log.Pr("Spool", "127.0.0.1", "上报队列状态", fmt.Sprintf("积压 %d 条，累计丢弃 %d 条", depth, dropped))
+		}
+		lastDropped = dropped
+	}
+}
+
+// Enqueue 把发往服务端 path 的上报写入默认队列，返回事件 ID
+// body 中会加入 event_id 字段，服务端据此去重
+func Enqueue(path string, body map[string]interface{}) string {
+	id := uuid.NewString()
+	body["event_id"] = id
+
+	if std == nil {
+		log.Pr("Spool", "127.0.0.1", "队列未初始化，事件被丢弃", path)
+		return id
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		log.Pr("Spool", "127.0.0.1", "JSON编码失败", err)
+		return id
+	}
+	if err := std.Append(Event{ID: id, Path: path, Body: data, Time: time.Now().Unix()}); err != nil {
+		log.Pr("Spool", "127.0.0.1", "写入队列失败", err)
+	}
+	return id
+}
+
+// Run 启动默认队列的发送循环
+func Run(send func(Event) error) {
+	if std != nil {
+		std.Run(send)
+	}
+}
+
+// Stats 返回默认队列的积压和丢弃数
+func Stats() (depth int64, dropped int64) {
+	if std == nil {
+		return 0, 0
+	}
+	return std.Stats()
+}
@@ -0,0 +1,213 @@
+package spool
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func event(i int) Event {
+	return Event{ID: fmt.Sprintf("ev-%d", i), Path: "/api/v1/agent/result", Body: []byte(fmt.Sprintf(`{"n":%d}`, i))}
+}
+
+func appendEvents(t *testing.T, s *Spool, from int, to int) {
+	for i := from; i < to; i++ {
+		if err := s.Append(event(i)); err != nil {
+			t.Fatalf("append %d: %v", i, err)
+		}
+	}
+}
+
+// drain 按顺序读取并确认 n 条事件，返回它们的 ID
+func drain(s *Spool, n int) []string {
+	var ids []string
+	for i := 0; i < n; i++ {
+		ev, next, ok := s.peek()
+		if !ok {
+			break
+		}
+		ids = append(ids, ev.ID)
+		s.ack(next)
+	}
+	return ids
+}
+
+func ids(from int, to int) []string {
+	var out []string
+	for i := from; i < to; i++ {
+		out = append(out, fmt.Sprintf("ev-%d", i))
+	}
+	return out
+}
+
+func equal(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// segmentFile 返回队列目录中唯一的段文件
+func segmentFile(t *testing.T, dir string) string {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if len(files) != 1 {
+		t.Fatalf("segments = %v, want one", files)
+	}
+	return files[0]
+}
+
+func TestReopen(t *testing.T) {
+	cases := []struct {
+		name string
+		// acked 重新打开前确认的条数
+		acked int
+		// damage 重新打开前对段文件的改动
+		damage    func(t *testing.T, path string)
+		wantIDs   []string
+		wantDepth int64
+	}{
+		{"nothing sent", 0, nil, ids(0, 5), 5},
+		{"resume after cursor", 3, nil, ids(3, 5), 2},
+		{"all sent", 5, nil, nil, 0},
+		{"torn last record", 1, func(t *testing.T, path string) {
+			info, _ := os.Stat(path)
+			os.Truncate(path, info.Size()-3)
+		}, ids(1, 4), 3},
+		{"garbage after last record", 0, func(t *testing.T, path string) {
+			f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+			f.Write([]byte{0, 0, 0, 9, 1, 2})
+			f.Close()
+		}, ids(0, 5), 5},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := Open(dir, 1<<20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			appendEvents(t, s, 0, 5)
+			drain(s, c.acked)
+			s.head.Close()
+
+			if c.damage != nil {
+				c.damage(t, segmentFile(t, dir))
+			}
+			s, err = Open(dir, 1<<20)
+			if err != nil {
+				t.Fatalf("reopen: %v", err)
+			}
+			if depth, _ := s.Stats(); depth != c.wantDepth {
+				t.Errorf("depth = %d, want %d", depth, c.wantDepth)
+			}
+			if got := drain(s, 10); !equal(got, c.wantIDs) {
+				t.Errorf("events = %v, want %v", got, c.wantIDs)
+			}
+		})
+	}
+}
+
+func TestAppendFull(t *testing.T) {
+	s, err := Open(t.TempDir(), 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendEvents(t, s, 0, 2)
+	if err := s.Append(event(2)); !errors.Is(err, ErrFull) {
+		t.Fatalf("append to full spool: %v, want ErrFull", err)
+	}
+	if depth, dropped := s.Stats(); depth != 2 || dropped != 1 {
+		t.Errorf("depth = %d, dropped = %d, want 2 and 1", depth, dropped)
+	}
+}
+
+func TestAppendBatchesSync(t *testing.T) {
+	s, err := Open(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		appended int
+		unsynced int
+	}{
+		{1, 1},
+		{syncEvery - 1, syncEvery - 1},
+		{syncEvery, 0},
+		{syncEvery + 1, 1},
+	}
+	total := 0
+	for _, c := range cases {
+		appendEvents(t, s, total, c.appended)
+		total = c.appended
+		if s.unsynced != c.unsynced {
+			t.Errorf("after %d records: unsynced = %d, want %d", c.appended, s.unsynced, c.unsynced)
+		}
+	}
+
+	s.flush()
+	if s.unsynced != 0 {
+		t.Errorf("unsynced = %d after flush", s.unsynced)
+	}
+}
+
+// 段文件在发送期间被外部改动时隔离该段，不再无限重试
+func TestQuarantineCorruptSegment(t *testing.T) {
+	cases := []struct {
+		name   string
+		damage func(path string)
+	}{
+		{"truncated", func(path string) { os.Truncate(path, 10) }},
+		{"deleted", func(path string) { os.Remove(path) }},
+		{"length overflow", func(path string) {
+			f, _ := os.OpenFile(path, os.O_WRONLY, 0600)
+			f.WriteAt([]byte{0x7f, 0xff, 0xff, 0xff}, 0)
+			f.Close()
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := Open(dir, 1<<20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			appendEvents(t, s, 0, 3)
+			path := segmentFile(t, dir)
+			c.damage(path)
+
+			if _, _, ok := s.peek(); ok {
+				t.Fatalf("read event from corrupt segment")
+			}
+			if depth, dropped := s.Stats(); depth != 0 || dropped != 3 {
+				t.Errorf("depth = %d, dropped = %d, want 0 and 3", depth, dropped)
+			}
+			if _, err := os.Stat(path); err == nil {
+				t.Errorf("corrupt segment not moved away")
+			}
+
+			// 新事件写入下一段并正常发送，重新打开后不会再读到损坏的段
+			appendEvents(t, s, 3, 5)
+			if got := drain(s, 10); !equal(got, ids(3, 5)) {
+				t.Errorf("events after quarantine = %v", got)
+			}
+			appendEvents(t, s, 5, 6)
+			s.head.Close()
+			s, err = Open(dir, 1<<20)
+			if err != nil {
+				t.Fatalf("reopen: %v", err)
+			}
+			if got := drain(s, 10); !equal(got, ids(5, 6)) {
+				t.Errorf("events after reopen = %v", got)
+			}
+		})
+	}
+}
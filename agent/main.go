@@ -3,16 +3,43 @@ package main
 import (
 	"KubePot/utils/config"
 	"KubePot/utils/setting"
+	"KubePot/utils/version"
 	"fmt"
 	"os"
+	"strings"
 )
 
+// parseConfigFlag 取出 -config/--config 参数，返回配置文件路径和剩余参数
+func parseConfigFlag(args []string) (string, []string) {
+	var path string
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			rest = append(rest, arg)
+			continue
+		}
+		if !hasValue && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+		path = value
+	}
+	return path, rest
+}
+
 func main() {
+	path, args := parseConfigFlag(os.Args)
+
 	// 初始化配置
-	config.Init()
+	if err := config.Init(path); err != nil {
+		fmt.Fprintln(os.Stderr, "配置错误:")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 	//setting.Run()
-	args := os.Args
 	if args == nil || len(args) < 2 {
 		setting.Help()
 	} else {
@@ -21,7 +48,7 @@ func main() {
 		} else if args[1] == "init" || args[1] == "--init" {
 			setting.Init()
 		} else if args[1] == "version" || args[1] == "--version" {
-			fmt.Println("v0.6.3")
+			fmt.Println(version.Version)
 		} else if args[1] == "run" || args[1] == "--run" {
 			setting.Run()
 		} else if args[1] == "uninstall" || args[1] == "--uninstall" {
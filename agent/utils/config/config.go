@@ -1,5 +1,14 @@
 package config
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
 // Config 存储所有配置信息
 type Config struct {
 	RPC           RPCConfig
@@ -21,13 +30,24 @@ type Config struct {
 	Docker        DockerConfig
 	APIServer     APIServerConfig
 	Bash          BashConfig
+	Spool         SpoolConfig
+	Monitor       MonitorConfig
+	Metrics       MetricsConfig
+	// Custom 自定义蜜罐，节名以 custom_ 开头，键不做限制
+	Custom map[string]map[string]string
 }
 
 // RPCConfig 存储 RPC 相关配置
 type RPCConfig struct {
-	Status string
-	Addr   string
-	Name   string
+	Status      string
+	Addr        string
+	Name        string
+	KeyFile     string
+	EnrollToken string
+	// HeartbeatInterval 心跳间隔，单位秒
+	HeartbeatInterval string
+	// Push 为 1 时保持推送连接，任务和配置变更实时下发，轮询只作为兜底
+	Push string
 }
 
 // APIConfig 存储 API 相关配置
@@ -118,8 +138,11 @@ type VNCConfig struct {
 
 // KubeletConfig 存储 Kubelet 相关配置
 type KubeletConfig struct {
-	Status string
-	Addr   string
+	Status        string
+	Addr          string
+	ReadOnlyAddr  string
+	CertDir       string
+	AnonymousAuth string
 }
 
 // EtcdConfig 存储 Etcd 相关配置
@@ -136,8 +159,12 @@ type DockerConfig struct {
 
 // APIServerConfig 存储 APIServer 相关配置
 type APIServerConfig struct {
-	Status string
-	Addr   string
+	Status          string
+	Addr            string
+	CertDir         string
+	FixtureDir      string
+	AuthAnonymous   string
+	AuthCredentials string
 }
 
 // BashConfig 存储 Bash 相关配置
@@ -145,25 +172,48 @@ type BashConfig struct {
 	Status string
 }
 
+// SpoolConfig 存储上报队列相关配置
+type SpoolConfig struct {
+	Dir   string
+	MaxMB string
+}
+
+// MonitorConfig 存储密标文件监控相关配置
+type MonitorConfig struct {
+	// Mode auto 优先 fanotify，无权限时退回轮询；fanotify 或 poll 强制使用对应方式
+	Mode         string
+	PollInterval string
+}
+
+// MetricsConfig 存储 Prometheus 指标相关配置
+type MetricsConfig struct {
+	Status string
+	Addr   string
+}
+
 // AppConfig 全局配置实例
 var AppConfig Config
 
-// Init 初始化配置，设置默认值
-func Init() {
+// mu 保护运行中通过任务修改的配置项
+var mu sync.RWMutex
+
+// setDefaults 设置默认值，Agent 名称和上报密钥不设默认值，由 init 命令生成
+func setDefaults() {
 	// RPC 配置
 	AppConfig.RPC = RPCConfig{
-		Status: "2",
-		Addr:   "127.0.0.1:9001",
-		Name:   "a7dcf4d6-339f-4bff-8bd6-263771ebf512",
+		Status:            "2",
+		Addr:              "127.0.0.1:9001",
+		KeyFile:           "./pki/agent.key",
+		HeartbeatInterval: "30",
+		Push:              "1",
 	}
 
 	// API 配置
 	AppConfig.API = APIConfig{
-		Status:    "1",
-		WebURL:    "/api/v1/post/report",
-		PlugURL:   "/api/v1/post/plug_report",
-		ReportKey: "9cbf8a4dcb8e30682b927f352d6559a0",
-		QueryKey:  "X85e2ba265d965b1929148d0f0e33133",
+		Status:   "1",
+		WebURL:   "/api/v1/post/report",
+		PlugURL:  "/api/v1/post/plug_report",
+		QueryKey: "X85e2ba265d965b1929148d0f0e33133",
 	}
 
 	// Plug 配置
@@ -245,8 +295,11 @@ func Init() {
 
 	// Kubelet 配置
 	AppConfig.Kubelet = KubeletConfig{
-		Status: "1",
-		Addr:   "0.0.0.0:10255",
+		Status:        "1",
+		Addr:          "0.0.0.0:10250",
+		ReadOnlyAddr:  "0.0.0.0:10255",
+		CertDir:       "./pki/kubelet",
+		AnonymousAuth: "true",
 	}
 
 	// Etcd 配置
@@ -263,180 +316,215 @@ func Init() {
 
 	// APIServer 配置
 	AppConfig.APIServer = APIServerConfig{
-		Status: "1",
-		Addr:   "0.0.0.0:6443",
+		Status:          "1",
+		Addr:            "0.0.0.0:6443",
+		CertDir:         "./pki",
+		FixtureDir:      "./libs/kube",
+		AuthAnonymous:   "forbid",
+		AuthCredentials: "allow",
 	}
 
 	// Bash 配置
 	AppConfig.Bash = BashConfig{
 		Status: "1",
 	}
+
+	// 上报队列配置
+	AppConfig.Spool = SpoolConfig{
+		Dir:   "./spool",
+		MaxMB: "256",
+	}
+
+	// 密标文件监控配置
+	AppConfig.Monitor = MonitorConfig{
+		Mode:         "auto",
+		PollInterval: "30",
+	}
+
+	// Prometheus 指标配置
+	AppConfig.Metrics = MetricsConfig{
+		Status: "0",
+		Addr:   "0.0.0.0:9100",
+	}
+
+	AppConfig.Custom = make(map[string]map[string]string)
+}
+
+// fields 配置节和键到 AppConfig 字段的映射，Get、文件加载和环境变量覆盖共用
+func fields() map[string]map[string]*string {
+	c := &AppConfig
+	return map[string]map[string]*string{
+		"rpc": {
+			"status":             &c.RPC.Status,
+			"addr":               &c.RPC.Addr,
+			"name":               &c.RPC.Name,
+			"key_file":           &c.RPC.KeyFile,
+			"enroll_token":       &c.RPC.EnrollToken,
+			"heartbeat_interval": &c.RPC.HeartbeatInterval,
+			"push":               &c.RPC.Push,
+		},
+		"api": {
+			"status":     &c.API.Status,
+			"web_url":    &c.API.WebURL,
+			"plug_url":   &c.API.PlugURL,
+			"report_key": &c.API.ReportKey,
+			"query_key":  &c.API.QueryKey,
+		},
+		"plug": {
+			"status": &c.Plug.Status,
+			"addr":   &c.Plug.Addr,
+		},
+		"web": {
+			"status":   &c.Web.Status,
+			"addr":     &c.Web.Addr,
+			"template": &c.Web.Template,
+			"index":    &c.Web.Index,
+			"static":   &c.Web.Static,
+			"url":      &c.Web.URL,
+		},
+		"ssh": {
+			"status": &c.SSH.Status,
+			"addr":   &c.SSH.Addr,
+		},
+		"redis": {
+			"status": &c.Redis.Status,
+			"addr":   &c.Redis.Addr,
+		},
+		"mysql": {
+			"status": &c.MySQL.Status,
+			"addr":   &c.MySQL.Addr,
+			"files":  &c.MySQL.Files,
+		},
+		"telnet": {
+			"status": &c.Telnet.Status,
+			"addr":   &c.Telnet.Addr,
+		},
+		"ftp": {
+			"status": &c.FTP.Status,
+			"addr":   &c.FTP.Addr,
+		},
+		"mem_cache": {
+			"status": &c.MemCache.Status,
+			"addr":   &c.MemCache.Addr,
+		},
+		"http": {
+			"status": &c.HTTP.Status,
+			"addr":   &c.HTTP.Addr,
+		},
+		"tftp": {
+			"status": &c.TFTP.Status,
+			"addr":   &c.TFTP.Addr,
+		},
+		"elasticsearch": {
+			"status": &c.Elasticsearch.Status,
+			"addr":   &c.Elasticsearch.Addr,
+		},
+		"vnc": {
+			"status": &c.VNC.Status,
+			"addr":   &c.VNC.Addr,
+		},
+		"kubelet": {
+			"status":         &c.Kubelet.Status,
+			"addr":           &c.Kubelet.Addr,
+			"read_only_addr": &c.Kubelet.ReadOnlyAddr,
+			"cert_dir":       &c.Kubelet.CertDir,
+			"anonymous_auth": &c.Kubelet.AnonymousAuth,
+		},
+		"etcd": {
+			"status": &c.Etcd.Status,
+			"addr":   &c.Etcd.Addr,
+		},
+		"docker": {
+			"status": &c.Docker.Status,
+			"addr":   &c.Docker.Addr,
+		},
+		"apiserver": {
+			"status":           &c.APIServer.Status,
+			"addr":             &c.APIServer.Addr,
+			"cert_dir":         &c.APIServer.CertDir,
+			"fixture_dir":      &c.APIServer.FixtureDir,
+			"auth_anonymous":   &c.APIServer.AuthAnonymous,
+			"auth_credentials": &c.APIServer.AuthCredentials,
+		},
+		"bash": {
+			"status": &c.Bash.Status,
+		},
+		"spool": {
+			"dir":    &c.Spool.Dir,
+			"max_mb": &c.Spool.MaxMB,
+		},
+		"monitor": {
+			"mode":          &c.Monitor.Mode,
+			"poll_interval": &c.Monitor.PollInterval,
+		},
+		"metrics": {
+			"status": &c.Metrics.Status,
+			"addr":   &c.Metrics.Addr,
+		},
+	}
 }
 
 // Get 获取配置值
 func Get(section, key string) string {
-	switch section {
-	case "rpc":
-		switch key {
-		case "status":
-			return AppConfig.RPC.Status
-		case "addr":
-			return AppConfig.RPC.Addr
-		case "name":
-			return AppConfig.RPC.Name
-		}
-	case "api":
-		switch key {
-		case "status":
-			return AppConfig.API.Status
-		case "web_url":
-			return AppConfig.API.WebURL
-		case "plug_url":
-			return AppConfig.API.PlugURL
-		case "report_key":
-			return AppConfig.API.ReportKey
-		case "query_key":
-			return AppConfig.API.QueryKey
-		}
-	case "plug":
-		switch key {
-		case "status":
-			return AppConfig.Plug.Status
-		case "addr":
-			return AppConfig.Plug.Addr
-		}
-	case "web":
-		switch key {
-		case "status":
-			return AppConfig.Web.Status
-		case "addr":
-			return AppConfig.Web.Addr
-		case "template":
-			return AppConfig.Web.Template
-		case "index":
-			return AppConfig.Web.Index
-		case "static":
-			return AppConfig.Web.Static
-		case "url":
-			return AppConfig.Web.URL
-		}
-	case "ssh":
-		switch key {
-		case "status":
-			return AppConfig.SSH.Status
-		case "addr":
-			return AppConfig.SSH.Addr
-		}
-	case "redis":
-		switch key {
-		case "status":
-			return AppConfig.Redis.Status
-		case "addr":
-			return AppConfig.Redis.Addr
-		}
-	case "mysql":
-		switch key {
-		case "status":
-			return AppConfig.MySQL.Status
-		case "addr":
-			return AppConfig.MySQL.Addr
-		case "files":
-			return AppConfig.MySQL.Files
-		}
-	case "telnet":
-		switch key {
-		case "status":
-			return AppConfig.Telnet.Status
-		case "addr":
-			return AppConfig.Telnet.Addr
-		}
-	case "ftp":
-		switch key {
-		case "status":
-			return AppConfig.FTP.Status
-		case "addr":
-			return AppConfig.FTP.Addr
-		}
-	case "mem_cache":
-		switch key {
-		case "status":
-			return AppConfig.MemCache.Status
-		case "addr":
-			return AppConfig.MemCache.Addr
-		}
-	case "http":
-		switch key {
-		case "status":
-			return AppConfig.HTTP.Status
-		case "addr":
-			return AppConfig.HTTP.Addr
-		}
-	case "tftp":
-		switch key {
-		case "status":
-			return AppConfig.TFTP.Status
-		case "addr":
-			return AppConfig.TFTP.Addr
-		}
-	case "elasticsearch":
-		switch key {
-		case "status":
-			return AppConfig.Elasticsearch.Status
-		case "addr":
-			return AppConfig.Elasticsearch.Addr
-		}
-	case "vnc":
-		switch key {
-		case "status":
-			return AppConfig.VNC.Status
-		case "addr":
-			return AppConfig.VNC.Addr
-		}
-	case "kubelet":
-		switch key {
-		case "status":
-			return AppConfig.Kubelet.Status
-		case "addr":
-			return AppConfig.Kubelet.Addr
-		}
-	case "etcd":
-		switch key {
-		case "status":
-			return AppConfig.Etcd.Status
-		case "addr":
-			return AppConfig.Etcd.Addr
-		}
-	case "docker":
-		switch key {
-		case "status":
-			return AppConfig.Docker.Status
-		case "addr":
-			return AppConfig.Docker.Addr
+	mu.RLock()
+	defer mu.RUnlock()
+	if strings.HasPrefix(section, customPrefix) {
+		return AppConfig.Custom[section][key]
+	}
+	if p, ok := fields()[section][key]; ok {
+		return *p
+	}
+	return ""
+}
+
+// Update 修改一个节中的配置项，未知的键或修改后检查不通过时全部恢复，返回值发生变化的键
+func Update(section string, values map[string]string) ([]string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	keys, ok := fields()[section]
+	if !ok {
+		return nil, fmt.Errorf("unknown section %q", section)
+	}
+	for key := range values {
+		if _, ok := keys[key]; !ok {
+			return nil, fmt.Errorf("unknown key %q in section %q", key, section)
 		}
-	case "apiserver":
-		switch key {
-		case "status":
-			return AppConfig.APIServer.Status
-		case "addr":
-			return AppConfig.APIServer.Addr
+	}
+
+	old := make(map[string]string, len(values))
+	var changed []string
+	for _, key := range sortedKeys(values) {
+		old[key] = *keys[key]
+		if old[key] != values[key] {
+			*keys[key] = values[key]
+			changed = append(changed, key)
 		}
-	case "bash":
-		switch key {
-		case "status":
-			return AppConfig.Bash.Status
+	}
+	if err := errors.Join(validate()...); err != nil {
+		for key, value := range old {
+			*keys[key] = value
 		}
+		return nil, err
 	}
-	return ""
+	return changed, nil
 }
 
-// GetInt 获取整数类型的配置值
+// GetInt 获取整数类型的配置值，不存在或不是整数时返回 0
 func GetInt(section, key string) int {
-	// 这里简化处理，直接返回 0，实际项目中可以根据需要实现
-	return 0
+	n, err := strconv.Atoi(Get(section, key))
+	if err != nil {
+		return 0
+	}
+	return n
 }
 
-// GetCustomName 获取自定义配置名称
+// GetCustomName 获取自定义蜜罐的节名
 func GetCustomName() []string {
-	// 这里简化处理，直接返回空数组，实际项目中可以根据需要实现
-	return []string{}
+	names := make([]string, 0, len(AppConfig.Custom))
+	for name := range AppConfig.Custom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
@@ -0,0 +1,346 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"KubePot/utils/log"
+
+	"github.com/google/uuid"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EnvConfig 指定配置文件路径的环境变量
+	EnvConfig = "KUBEPOT_CONFIG"
+	// envPrefix 单个配置项的环境变量前缀，如 KUBEPOT_SSH_ADDR 覆盖 [ssh] addr
+	envPrefix = "KUBEPOT_"
+	// DefaultPath 未指定路径时使用的配置文件
+	DefaultPath = "config.ini"
+
+	customPrefix = "custom_"
+)
+
+// configPath 实际加载的配置文件路径，init 命令写入同一个文件
+var configPath string
+
+// nameGenerated 配置中没有 rpc.name，本次运行的名称为随机生成
+var nameGenerated bool
+
+// NameGenerated 本次运行的 rpc.name 是否为随机生成，此时应使用注册密钥对应的名称
+func NameGenerated() bool {
+	return nameGenerated
+}
+
+// Path 返回配置文件路径
+func Path() string {
+	return configPath
+}
+
+// Init 初始化配置：先设置默认值，再依次用配置文件和环境变量覆盖
+// path 为空时读取 KUBEPOT_CONFIG，仍为空时使用当前目录下存在的 config.ini
+// 配置文件中的未知配置项和非法地址会合并到返回的错误中，未知的环境变量只记录日志
+func Init(path string) error {
+	setDefaults()
+
+	if path == "" {
+		path = os.Getenv(EnvConfig)
+	}
+	explicit := path != ""
+	if !explicit {
+		path = DefaultPath
+	}
+	configPath = path
+
+	var problems []error
+	values, err := readFile(path)
+	switch {
+	case err == nil:
+		problems = append(problems, apply(values, path)...)
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+	default:
+		return err
+	}
+	applyEnv()
+
+	// 没有执行 init 时为本次运行生成临时身份，避免与其他 Agent 共用
+	// 已注册过时由 rpc 客户端换成密钥文件中保存的名称
+	nameGenerated = AppConfig.RPC.Name == ""
+	if nameGenerated {
+		AppConfig.RPC.Name = uuid.NewString()
+	}
+	if AppConfig.API.ReportKey == "" {
+		AppConfig.API.ReportKey = randomKey()
+	}
+
+	problems = append(problems, validate()...)
+	return errors.Join(problems...)
+}
+
+// readFile 按扩展名解析 YAML、TOML 或 INI 文件，返回 节 -> 键 -> 值
+func readFile(path string) (map[string]map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	case ".ini", ".conf", "":
+		return readINI(data)
+	default:
+		return nil, fmt.Errorf("%s: unsupported config format %q", path, filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := make(map[string]map[string]string, len(raw))
+	for section, v := range raw {
+		keys, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: %s must be a section", path, section)
+		}
+		values[section] = make(map[string]string, len(keys))
+		for key, value := range keys {
+			switch value.(type) {
+			case map[string]interface{}, []interface{}:
+				return nil, fmt.Errorf("%s: %s.%s must be a scalar", path, section, key)
+			case nil:
+				values[section][key] = ""
+			default:
+				values[section][key] = fmt.Sprint(value)
+			}
+		}
+	}
+	return values, nil
+}
+
+func readINI(data []byte) (map[string]map[string]string, error) {
+	file, err := ini.Load(data)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]map[string]string)
+	for _, section := range file.Sections() {
+		if section.Name() == ini.DefaultSection && len(section.Keys()) == 0 {
+			continue
+		}
+		values[section.Name()] = section.KeysHash()
+	}
+	return values, nil
+}
+
+// apply 把文件中的配置写入 AppConfig，返回未知的节和键
+func apply(values map[string]map[string]string, source string) []error {
+	known := fields()
+	var problems []error
+	for _, section := range sortedKeys(values) {
+		if strings.HasPrefix(section, customPrefix) {
+			AppConfig.Custom[section] = values[section]
+			continue
+		}
+		keys, ok := known[section]
+		if !ok {
+			problems = append(problems, fmt.Errorf("%s: unknown section %q", source, section))
+			continue
+		}
+		for _, key := range sortedKeys(values[section]) {
+			p, ok := keys[key]
+			if !ok {
+				problems = append(problems, fmt.Errorf("%s: unknown key %q in section %q", source, key, section))
+				continue
+			}
+			*p = values[section][key]
+		}
+	}
+	return problems
+}
+
+// EnvName 返回覆盖指定配置项的环境变量名
+func EnvName(section, key string) string {
+	return envPrefix + strings.ToUpper(section+"_"+key)
+}
+
+// applyEnv 用 KUBEPOT_<节>_<键> 环境变量覆盖配置
+// 无法对应到配置项的变量只记录日志：Kubernetes 会为同命名空间的每个 Service 注入 <SVC>_SERVICE_HOST 等变量，
+// Service 名以 kubepot 开头时同样带有该前缀
+func applyEnv() {
+	known := make(map[string]*string)
+	for section, keys := range fields() {
+		for key, p := range keys {
+			known[EnvName(section, key)] = p
+		}
+	}
+	for section, keys := range AppConfig.Custom {
+		for key := range keys {
+			known[EnvName(section, key)] = nil
+		}
+	}
+
+	environ := os.Environ()
+	sort.Strings(environ)
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, envPrefix) || name == EnvConfig {
+			continue
+		}
+		p, ok := known[name]
+		if !ok {
+			log.Pr("Config", "127.0.0.1", "忽略未知的环境变量", name)
+			continue
+		}
+		if p != nil {
+			*p = value
+		}
+	}
+
+	// 自定义蜜罐的键在 map 中，单独覆盖
+	for section, keys := range AppConfig.Custom {
+		for key := range keys {
+			if value, ok := os.LookupEnv(EnvName(section, key)); ok {
+				keys[key] = value
+			}
+		}
+	}
+}
+
+// validate 检查监听和连接地址，addr 以及以 _addr 结尾的键必须是 host:port；队列上限、心跳和轮询间隔必须是正整数
+func validate() []error {
+	var problems []error
+	check := func(section, key, value string) {
+		if key != "addr" && !strings.HasSuffix(key, "_addr") {
+			return
+		}
+		if err := checkAddr(value); err != nil {
+			problems = append(problems, fmt.Errorf("%s.%s: bad address %q: %v", section, key, value, err))
+		}
+	}
+
+	known := fields()
+	for _, section := range sortedKeys(known) {
+		for _, key := range sortedKeys(known[section]) {
+			check(section, key, *known[section][key])
+		}
+	}
+	for _, section := range sortedKeys(AppConfig.Custom) {
+		for _, key := range sortedKeys(AppConfig.Custom[section]) {
+			check(section, key, AppConfig.Custom[section][key])
+		}
+	}
+	if n, err := strconv.Atoi(AppConfig.Spool.MaxMB); err != nil || n <= 0 {
+		problems = append(problems, fmt.Errorf("spool.max_mb: must be a positive integer, got %q", AppConfig.Spool.MaxMB))
+	}
+	if n, err := strconv.Atoi(AppConfig.RPC.HeartbeatInterval); err != nil || n <= 0 {
+		problems = append(problems, fmt.Errorf("rpc.heartbeat_interval: must be a positive integer, got %q", AppConfig.RPC.HeartbeatInterval))
+	}
+	switch AppConfig.Monitor.Mode {
+	case "auto", "fanotify", "poll":
+	default:
+		problems = append(problems, fmt.Errorf("monitor.mode: must be auto, fanotify or poll, got %q", AppConfig.Monitor.Mode))
+	}
+	if n, err := strconv.Atoi(AppConfig.Monitor.PollInterval); err != nil || n <= 0 {
+		problems = append(problems, fmt.Errorf("monitor.poll_interval: must be a positive integer, got %q", AppConfig.Monitor.PollInterval))
+	}
+	return problems
+}
+
+func checkAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return errors.New("invalid port")
+	}
+	return nil
+}
+
+// Generate 为本 Agent 生成随机名称和上报密钥，连同当前全部配置写入 path
+// 文件已存在时不覆盖，避免改掉服务端已登记的身份
+func Generate(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	AppConfig.RPC.Name = uuid.NewString()
+	AppConfig.API.ReportKey = randomKey()
+
+	values := make(map[string]map[string]string)
+	for section, keys := range fields() {
+		values[section] = make(map[string]string, len(keys))
+		for key, p := range keys {
+			values[section][key] = *p
+		}
+	}
+	for section, keys := range AppConfig.Custom {
+		values[section] = keys
+	}
+
+	var data []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(values)
+	case ".toml":
+		data, err = toml.Marshal(values)
+	case ".ini", ".conf", "":
+		data, err = marshalINI(values)
+	default:
+		err = fmt.Errorf("unsupported config format %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return err
+	}
+	// 文件中包含上报密钥，只允许当前用户读写
+	return os.WriteFile(path, data, 0600)
+}
+
+func marshalINI(values map[string]map[string]string) ([]byte, error) {
+	file := ini.Empty()
+	for _, section := range sortedKeys(values) {
+		s, err := file.NewSection(section)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range sortedKeys(values[section]) {
+			if _, err := s.NewKey(key, values[section][key]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var b strings.Builder
+	if _, err := file.WriteTo(&b); err != nil {
+		return nil, err
+	}
+	return []byte(b.String()), nil
+}
+
+// randomKey 生成 32 位十六进制密钥，格式与原先的上报密钥一致
+func randomKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -3,9 +3,56 @@ package log
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"sync/atomic"
 	"time"
 )
 
+// 日志级别，debug 额外输出调试信息，silent 不输出任何日志
+var levels = []string{"debug", "info", "silent"}
+
+const (
+	levelDebug int32 = iota
+	levelInfo
+	levelSilent
+)
+
+var level atomic.Int32
+
+func init() {
+	level.Store(levelInfo)
+}
+
+// SetLevel 修改日志级别，可选 debug、info、silent
+func SetLevel(name string) error {
+	for i, l := range levels {
+		if l == name {
+			level.Store(int32(i))
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown log level %q", name)
+}
+
+// Level 返回当前日志级别
+func Level() string {
+	return levels[level.Load()]
+}
+
 func Pr(typex string, ip string, text string, a ...interface{}) {
+	if level.Load() > levelInfo {
+		return
+	}
+	output(typex, ip, text, a)
+}
+
+// Debug 只在 debug 级别输出，用于请求和响应内容等调试信息
+func Debug(typex string, ip string, text string, a ...interface{}) {
+	if level.Load() > levelDebug {
+		return
+	}
+	output(typex, ip, text, a)
+}
+
+func output(typex string, ip string, text string, a []interface{}) {
 	fmt.Fprintln(gin.DefaultWriter, "["+typex+"] "+ip+" - ["+time.Now().Format("2006-01-02 15:04:05")+"] "+text+" ", a)
 }
@@ -0,0 +1,151 @@
+package setting
+
+import (
+	"KubePot/core/kube"
+	"KubePot/utils/config"
+	"KubePot/utils/log"
+	"fmt"
+)
+
+// 配置任务可以修改的服务及其配置节
+var configSections = map[string]string{
+	"kubelet":       "kubelet",
+	"etcd":          "etcd",
+	"apiserver":     "apiserver",
+	"docker":        "docker",
+	"vnc":           "vnc",
+	"elasticsearch": "elasticsearch",
+	"tftp":          "tftp",
+	"memcache":      "mem_cache",
+	"ftp":           "ftp",
+	"telnet":        "telnet",
+	"http":          "http",
+	"mysql":         "mysql",
+	"redis":         "redis",
+	"ssh":           "ssh",
+	"web":           "web",
+}
+
+// ConfigSection 返回服务的配置节，不允许通过任务修改配置的服务返回 false
+func ConfigSection(service string) (string, bool) {
+	section, ok := configSections[service]
+	return section, ok
+}
+
+// 服务运行时读取、修改后立即生效的配置项，SSH 的高低交互模式由 status 决定，同样立即生效
+var liveKeys = map[string]bool{
+	"apiserver.auth_anonymous":   true,
+	"apiserver.auth_credentials": true,
+	"kubelet.anonymous_auth":     true,
+}
+
+// 有 Stop 的服务，修改监听地址等配置后可以单独重启，其余服务需要重启 Agent
+var restartable = map[string]bool{
+	"kubelet":       true,
+	"etcd":          true,
+	"apiserver":     true,
+	"elasticsearch": true,
+	"http":          true,
+	"web":           true,
+}
+
+// 配置的处理方式
+const (
+	ConfigApplied   = "applied"
+	ConfigSaved     = "saved"
+	ConfigRestarted = "restarted"
+)
+
+// UpdateConfig 修改服务的配置项并应用，返回值发生变化的键和处理方式
+func UpdateConfig(service string, values map[string]string) ([]string, string, error) {
+	section, ok := ConfigSection(service)
+	if !ok {
+		return nil, "", fmt.Errorf("unknown service %q", service)
+	}
+	changed, err := config.Update(section, values)
+	if err != nil {
+		return nil, "", err
+	}
+	action, err := ApplyConfig(service, changed)
+	return changed, action, err
+}
+
+// ApplyConfig 应用服务修改过的配置项
+// status 交给 ControlService，fixture 重新加载，其余配置在服务运行时重启该服务，未运行时下次启动生效
+func ApplyConfig(service string, changed []string) (string, error) {
+	section, ok := ConfigSection(service)
+	if !ok {
+		return "", fmt.Errorf("unknown service %q", service)
+	}
+
+	restart := false
+	for _, key := range changed {
+		switch {
+		case key == "status":
+			ControlService(service, config.Get(section, "status"))
+		case section == "apiserver" && key == "fixture_dir":
+			count, err := kube.Reload(config.Get(section, key))
+			if err != nil {
+				return "", fmt.Errorf("reload fixtures: %v", err)
+			}
+			log.Pr("Kube", "127.0.0.1", "已重新加载 fixture 对象数量", count)
+		case liveKeys[section+"."+key]:
+		default:
+			restart = true
+		}
+	}
+	if !restart {
+		return ConfigApplied, nil
+	}
+
+	started, status := serviceState(service)
+	if !started {
+		return ConfigSaved, nil
+	}
+	if !restartable[service] {
+		return "", fmt.Errorf("%s cannot be restarted alone, restart the agent to apply the change", service)
+	}
+	ControlService(service, "0")
+	ControlService(service, status)
+	log.Pr("KubePot", "127.0.0.1", "配置变更后已重启服务", service)
+	return ConfigRestarted, nil
+}
+
+// serviceState 返回服务是否已启动及其当前状态
+func serviceState(service string) (bool, string) {
+	switch service {
+	case "kubelet":
+		return kubeletStarted, kubeletStatus
+	case "etcd":
+		return etcdStarted, etcdStatus
+	case "apiserver":
+		return apiserverStarted, apiserverStatus
+	case "docker":
+		return dockerStarted, dockerStatus
+	case "bash":
+		return bashStarted, bashStatus
+	case "vnc":
+		return vncStarted, vncStatus
+	case "elasticsearch":
+		return esStarted, esStatus
+	case "tftp":
+		return tftpStarted, tftpStatus
+	case "memcache":
+		return memCacheStarted, memCacheStatus
+	case "ftp":
+		return ftpStarted, ftpStatus
+	case "telnet":
+		return telnetStarted, telnetStatus
+	case "http":
+		return httpStarted, httpStatus
+	case "mysql":
+		return mysqlStarted, mysqlStatus
+	case "redis":
+		return redisStarted, redisStatus
+	case "ssh":
+		return sshStarted, sshStatus
+	case "web":
+		return webStarted, webStatus
+	}
+	return false, ""
+}
@@ -2,6 +2,9 @@ package setting
 
 import (
 	"KubePot/core/control"
+	"KubePot/core/event"
+	"KubePot/core/health"
+	"KubePot/core/metrics"
 	"KubePot/core/monitor"
 	"KubePot/core/protocol/apiserver"
 	"KubePot/core/protocol/bash"
@@ -26,6 +29,7 @@ import (
 	"KubePot/utils/log"
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
@@ -122,7 +126,7 @@ func RunWeb(template string, index string, static string, url string) http.Handl
 
 				// 判断是否为 RPC 客户端
 				if false {
-					go client.ReportResult("WEB", name, ip, info, "0")
+					go client.ReportResult(name, apiEvent("WEB", ip, info), "0")
 				} else {
 					go report.ReportWeb(name, "本机", ip, info)
 				}
@@ -138,6 +142,14 @@ func RunWeb(template string, index string, static string, url string) http.Handl
 	return r
 }
 
+// apiEvent 以 API 上报的来源 IP 和内容创建事件
+func apiEvent(protocol string, ip string, info string) *event.Event {
+	ev := event.New(protocol, event.KindRequest, nil, nil)
+	ev.SourceIP = ip
+	ev.Detail = info
+	return ev
+}
+
 func RunDeep(template string, index string, static string, url string) http.Handler {
 	r := gin.New()
 	r.Use(gin.Recovery())
@@ -183,7 +195,7 @@ func RunDeep(template string, index string, static string, url string) http.Hand
 
 				// 判断是否为 RPC 客户端
 				if false {
-					go client.ReportResult("DEEP", name, ip, info, "0")
+					go client.ReportResult(name, apiEvent("DEEP", ip, info), "0")
 				} else {
 					go report.ReportDeepWeb(name, "本机", ip, info)
 				}
@@ -261,7 +273,7 @@ func RunPlug() http.Handler {
 
 				// 判断是否为 RPC 客户端
 				if false {
-					go client.ReportResult("PLUG", info.Name, info.Ip, data, "0")
+					go client.ReportResult(info.Name, apiEvent("PLUG", info.Ip, data), "0")
 				} else {
 					go report.ReportPlugWeb(info.Name, "本机", info.Ip, data)
 				}
@@ -344,6 +356,7 @@ func startAllServices() {
 	// 启动 kubelet  蜜罐
 	if kubeletStatus == "1" && !kubeletStarted {
 		kubeletAddr := config.Get("kubelet", "addr")
+		health.Watch("kubelet", "tcp", kubeletAddr)
 		go kubelet.Start(kubeletAddr)
 		kubeletStarted = true
 	}
@@ -351,6 +364,7 @@ func startAllServices() {
 	// 启动 etcd  蜜罐
 	if etcdStatus == "1" && !etcdStarted {
 		etcdAddr := config.Get("etcd", "addr")
+		health.Watch("etcd", "tcp", etcdAddr)
 		go etcd.Start(etcdAddr)
 		etcdStarted = true
 	}
@@ -358,6 +372,7 @@ func startAllServices() {
 	// 启动 docker  蜜罐
 	if apiserverStatus == "1" && !apiserverStarted {
 		apiserverAddr := config.Get("apiserver", "addr")
+		health.Watch("apiserver", "tcp", apiserverAddr)
 		go apiserver.Start(apiserverAddr)
 		apiserverStarted = true
 	}
@@ -365,12 +380,14 @@ func startAllServices() {
 	// 启动 docker  蜜罐
 	if dockerStatus == "1" && !dockerStarted {
 		dockerAddr := config.Get("docker", "addr")
+		health.Watch("docker", "tcp", dockerAddr)
 		go docker.Start(dockerAddr)
 		dockerStarted = true
 	}
 
 	// 启动 bash  蜜罐
 	if bashStatus == "1" && !bashStarted {
+		health.Watch("bash", "unix", bash.SocketPath)
 		go bash.Start()
 		bashStarted = true
 	}
@@ -381,6 +398,7 @@ func startAllServices() {
 	// 启动 vnc  蜜罐
 	if vncStatus == "1" && !vncStarted {
 		vncAddr := config.Get("vnc", "addr")
+		health.Watch("vnc", "tcp", vncAddr)
 		go vnc.Start(vncAddr)
 		vncStarted = true
 	}
@@ -390,6 +408,7 @@ func startAllServices() {
 	// 启动 elasticsearch 蜜罐
 	if esStatus == "1" && !esStarted {
 		esAddr := config.Get("elasticsearch", "addr")
+		health.Watch("elasticsearch", "tcp", esAddr)
 		go elasticsearch.Start(esAddr)
 		esStarted = true
 	}
@@ -399,6 +418,7 @@ func startAllServices() {
 	// 启动 TFTP 蜜罐
 	if tftpStatus == "1" && !tftpStarted {
 		tftpAddr := config.Get("tftp", "addr")
+		health.Watch("tftp", "udp", tftpAddr)
 		go tftp.Start(tftpAddr)
 		tftpStarted = true
 	}
@@ -408,6 +428,7 @@ func startAllServices() {
 	// 启动 MemCache 蜜罐
 	if memCacheStatus == "1" && !memCacheStarted {
 		memCacheAddr := config.Get("mem_cache", "addr")
+		health.Watch("memcache", "tcp", memCacheAddr)
 		go memcache.Start(memCacheAddr, "4")
 		memCacheStarted = true
 	}
@@ -417,6 +438,7 @@ func startAllServices() {
 	// 启动 FTP 蜜罐
 	if ftpStatus != "0" && !ftpStarted {
 		ftpAddr := config.Get("ftp", "addr")
+		health.Watch("ftp", "tcp", ftpAddr)
 		go ftp.Start(ftpAddr)
 		ftpStarted = true
 	}
@@ -426,6 +448,7 @@ func startAllServices() {
 	// 启动 Telnet 蜜罐
 	if telnetStatus != "0" && !telnetStarted {
 		telnetAddr := config.Get("telnet", "addr")
+		health.Watch("telnet", "tcp", telnetAddr)
 		go telnet.Start(telnetAddr)
 		telnetStarted = true
 	}
@@ -435,6 +458,7 @@ func startAllServices() {
 	// 启动 HTTP 正向代理
 	if httpStatus == "1" && !httpStarted {
 		httpAddr := config.Get("http", "addr")
+		health.Watch("http", "tcp", httpAddr)
 		go httpx.Start(httpAddr)
 		httpStarted = true
 	}
@@ -448,6 +472,7 @@ func startAllServices() {
 		// 利用 Mysql 服务端 任意文件读取漏洞
 		mysqlFiles := config.Get("mysql", "files")
 
+		health.Watch("mysql", "tcp", mysqlAddr)
 		go mysql.Start(mysqlAddr, mysqlFiles)
 		mysqlStarted = true
 	}
@@ -457,6 +482,7 @@ func startAllServices() {
 	// 启动 Redis 蜜罐
 	if redisStatus != "0" && !redisStarted {
 		redisAddr := config.Get("redis", "addr")
+		health.Watch("redis", "tcp", redisAddr)
 		go redis.Start(redisAddr)
 		redisStarted = true
 	}
@@ -466,6 +492,7 @@ func startAllServices() {
 	// 启动 SSH 蜜罐
 	if sshStatus != "0" && !sshStarted {
 		sshAddr := config.Get("ssh", "addr")
+		health.Watch("ssh", "tcp", sshAddr)
 		go ssh.Start(sshAddr)
 		sshStarted = true
 	}
@@ -487,7 +514,18 @@ func startAllServices() {
 			WriteTimeout: 10 * time.Second,
 		}
 
-		go serverWeb.ListenAndServe()
+		health.Watch("web", "tcp", webAddr)
+		go func(server *http.Server) {
+			l, err := net.Listen("tcp", server.Addr)
+			if err != nil {
+				health.Failed("web", err)
+				return
+			}
+			health.Listening("web")
+			if err := server.Serve(l); err != http.ErrServerClosed {
+				health.Failed("web", err)
+			}
+		}(serverWeb)
 		webStarted = true
 	}
 }
@@ -500,23 +538,29 @@ func ControlService(service string, status string) {
 	case "kubelet":
 		oldStatus = kubeletStatus
 		kubeletStatus = status
-		// 当状态变为关闭时，重置启动标志
+		// 当状态变为关闭时，重置启动标志并停止服务
 		if status != "1" {
 			kubeletStarted = false
+			health.Unwatch("kubelet")
+			kubelet.Stop()
 		}
 	case "etcd":
 		oldStatus = etcdStatus
 		etcdStatus = status
-		// 当状态变为关闭时，重置启动标志
+		// 当状态变为关闭时，重置启动标志并停止服务
 		if status != "1" {
 			etcdStarted = false
+			health.Unwatch("etcd")
+			etcd.Stop()
 		}
 	case "apiserver":
 		oldStatus = apiserverStatus
 		apiserverStatus = status
-		// 当状态变为关闭时，重置启动标志
+		// 当状态变为关闭时，重置启动标志并停止服务
 		if status != "1" {
 			apiserverStarted = false
+			health.Unwatch("apiserver")
+			apiserver.Stop()
 		}
 	case "docker":
 		oldStatus = dockerStatus
@@ -524,6 +568,7 @@ func ControlService(service string, status string) {
 		// 当状态变为关闭时，重置启动标志
 		if status != "1" {
 			dockerStarted = false
+			health.Unwatch("docker")
 		}
 	case "bash":
 		oldStatus = bashStatus
@@ -531,6 +576,7 @@ func ControlService(service string, status string) {
 		// 当状态变为关闭时，重置启动标志
 		if status != "1" {
 			bashStarted = false
+			health.Unwatch("bash")
 		}
 	case "vnc":
 		oldStatus = vncStatus
@@ -538,6 +584,7 @@ func ControlService(service string, status string) {
 		// 当状态变为关闭时，重置启动标志
 		if status != "1" {
 			vncStarted = false
+			health.Unwatch("vnc")
 		}
 	case "elasticsearch":
 		oldStatus = esStatus
@@ -545,6 +592,7 @@ func ControlService(service string, status string) {
 		// 当状态变为关闭时，重置启动标志并停止服务
 		if status != "1" {
 			esStarted = false
+			health.Unwatch("elasticsearch")
 			elasticsearch.Stop()
 		}
 	case "tftp":
@@ -553,6 +601,7 @@ func ControlService(service string, status string) {
 		// 当状态变为关闭时，重置启动标志
 		if status != "1" {
 			tftpStarted = false
+			health.Unwatch("tftp")
 		}
 	case "memcache":
 		oldStatus = memCacheStatus
@@ -560,6 +609,7 @@ func ControlService(service string, status string) {
 		// 当状态变为关闭时，重置启动标志
 		if status != "1" {
 			memCacheStarted = false
+			health.Unwatch("memcache")
 		}
 	case "ftp":
 		oldStatus = ftpStatus
@@ -567,6 +617,7 @@ func ControlService(service string, status string) {
 		// 当状态变为关闭时，重置启动标志
 		if status == "0" {
 			ftpStarted = false
+			health.Unwatch("ftp")
 		}
 	case "telnet":
 		oldStatus = telnetStatus
@@ -574,6 +625,7 @@ func ControlService(service string, status string) {
 		// 当状态变为关闭时，重置启动标志
 		if status == "0" {
 			telnetStarted = false
+			health.Unwatch("telnet")
 		}
 	case "http":
 		oldStatus = httpStatus
@@ -581,6 +633,7 @@ func ControlService(service string, status string) {
 		// 当状态变为关闭时，重置启动标志并停止服务
 		if status != "1" {
 			httpStarted = false
+			health.Unwatch("http")
 			httpx.Stop()
 		}
 	case "mysql":
@@ -589,6 +642,7 @@ func ControlService(service string, status string) {
 		// 当状态变为关闭时，重置启动标志
 		if status == "0" {
 			mysqlStarted = false
+			health.Unwatch("mysql")
 		}
 	case "redis":
 		oldStatus = redisStatus
@@ -596,6 +650,7 @@ func ControlService(service string, status string) {
 		// 当状态变为关闭时，重置启动标志
 		if status == "0" {
 			redisStarted = false
+			health.Unwatch("redis")
 		}
 	case "ssh":
 		oldStatus = sshStatus
@@ -603,6 +658,7 @@ func ControlService(service string, status string) {
 		// 当状态变为关闭时，重置启动标志
 		if status == "0" {
 			sshStarted = false
+			health.Unwatch("ssh")
 		}
 	case "web":
 		oldStatus = webStatus
@@ -610,6 +666,7 @@ func ControlService(service string, status string) {
 		// 当状态变为关闭时，重置启动标志并停止服务器
 		if status == "0" {
 			webStarted = false
+			health.Unwatch("web")
 			if serverWeb != nil {
 				// 创建一个5秒的上下文用于超时控制
 				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -655,6 +712,12 @@ func Run() {
 	control.RegisterControlService(func(service string, status string) {
 		ControlService(service, status)
 	})
+	control.RegisterUpdateConfig(UpdateConfig)
+
+	// 启动 Prometheus 指标服务
+	if config.Get("metrics", "status") == "1" {
+		go metrics.Start(config.Get("metrics", "addr"))
+	}
 
 	// 初始化蜜罐状态
 	initServiceStatus()
@@ -662,8 +725,15 @@ func Run() {
 	// 启动所有蜜罐服务
 	startAllServices()
 
-	// 初始化并启动文件监控
+	//=========================//
+
+	// 注册时可能改用密钥文件中保存的名称，之后再读取
+	client.HttpInit()
+	rpcName := config.Get("rpc", "name")
+
+	// 初始化并启动文件监控，拉取密标列表需要注册后的签名密钥
 	fileMonitor = monitor.NewFileMonitor()
+	control.RegisterSecretLabelWatcher(fileMonitor)
 	err := fileMonitor.Start()
 	if err != nil {
 		fmt.Printf("start file monitor failed: %v\n", err)
@@ -671,12 +741,6 @@ func Run() {
 		fmt.Println("file monitor started successfully")
 	}
 
-	//=========================//
-
-	rpcName := config.Get("rpc", "name")
-
-	client.HttpInit()
-
 	for {
 		// 这样写 提高IO读写性能
 		go client.Start(rpcName, ftpStatus, telnetStatus, httpStatus, mysqlStatus, redisStatus, sshStatus, webStatus, "0", memCacheStatus, "0", esStatus, tftpStatus, vncStatus, customStatus)
@@ -692,8 +756,16 @@ func Run() {
 	// select {}
 }
 
+// Init 生成本 Agent 的随机名称和上报密钥，写入配置文件
 func Init() {
-	fmt.Println("test")
+	path := config.Path()
+	if err := config.Generate(path); err != nil {
+		fmt.Println("初始化失败:", err)
+		return
+	}
+	fmt.Println("已生成配置文件:", path)
+	fmt.Println("Agent 名称:", config.Get("rpc", "name"))
+	fmt.Println("上报密钥:", config.Get("api", "report_key"))
 }
 
 func Help() {
@@ -702,10 +774,13 @@ func Help() {
 	fmt.Println("")
 	fmt.Println("   run,--run", "	       Start up service")
 	fmt.Println("   uninstall,--uninstall", "   Uninstall agent")
-	//fmt.Println("   init,--init", "		   Initialization, Wipe data")
+	fmt.Println("   init,--init", "	       Generate config with a random agent name and report key")
 	fmt.Println("   version,--version", "  Kubepot Version")
 	fmt.Println("   help,--help", "	       Help")
 	fmt.Println("")
+	fmt.Println("   -config <file>", "	       Config file (.yaml/.toml/.ini), or $"+config.EnvConfig)
+	fmt.Println("   $"+config.EnvName("<section>", "<key>"), "  Override a single config key")
+	fmt.Println("")
 	fmt.Println(" + -------------------------------------------------------------------- +")
 	fmt.Println("")
 }
@@ -0,0 +1,4 @@
+package version
+
+// Version Agent 版本，随心跳上报
+const Version = "v0.6.3"
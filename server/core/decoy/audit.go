@@ -0,0 +1,209 @@
+package decoy
+
+import (
+	"KubePot/core/dbUtil"
+	"KubePot/core/kube"
+	"KubePot/core/models"
+	"KubePot/utils/cache"
+	"KubePot/utils/log"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditEventList audit.k8s.io/v1 EventList，只解析匹配诱饵对象和告警需要的字段
+type AuditEventList struct {
+	Kind       string       `json:"kind"`
+	APIVersion string       `json:"apiVersion"`
+	Items      []AuditEvent `json:"items"`
+}
+
+// AuditEvent 一条审计事件
+type AuditEvent struct {
+	AuditID    string          `json:"auditID"`
+	Stage      string          `json:"stage"`
+	RequestURI string          `json:"requestURI"`
+	Verb       string          `json:"verb"`
+	User       AuditUser       `json:"user"`
+	SourceIPs  []string        `json:"sourceIPs"`
+	UserAgent  string          `json:"userAgent"`
+	ObjectRef  *AuditObjectRef `json:"objectRef"`
+	// ResponseStatus 只取状态码，被拒绝的访问同样告警
+	ResponseStatus *struct {
+		Code int `json:"code"`
+	} `json:"responseStatus"`
+	StageTimestamp string `json:"stageTimestamp"`
+}
+
+// AuditUser 发起请求的用户
+type AuditUser struct {
+	Username string   `json:"username"`
+	Groups   []string `json:"groups"`
+}
+
+// AuditObjectRef 请求访问的对象
+type AuditObjectRef struct {
+	Resource    string `json:"resource"`
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+	APIGroup    string `json:"apiGroup"`
+	Subresource string `json:"subresource"`
+}
+
+// 诱饵对象在审计事件中的资源名
+var resources = map[string]string{
+	KindSecret:         "secrets",
+	KindConfigMap:      "configmaps",
+	KindServiceAccount: "serviceaccounts",
+}
+
+// 服务端部署、轮换和删除诱饵对象时使用的动词
+var ownVerbs = map[string]bool{"create": true, "update": true, "delete": true}
+
+// 列出对象的动词，命名空间或整个集群中的诱饵 Secret 和 ConfigMap 会随列表返回
+var listVerbs = map[string]bool{"list": true, "watch": true}
+
+// 诱饵对象列表和告警的存取，默认使用数据库，测试时替换为内存实现
+var (
+	ListDecoys = func(k8sID int64) ([]models.KubePotK8sDecoy, error) {
+		var decoys []models.KubePotK8sDecoy
+		err := dbUtil.GORM().Where("k8s_id = ?", k8sID).Find(&decoys).Error
+		return decoys, err
+	}
+	SaveAlert = func(alert *models.KubePotSecretLabelAlert) error {
+		return dbUtil.GORM().Create(alert).Error
+	}
+)
+
+// AuditToken 集群审计 Webhook 的 Bearer Token，由集群 Token 派生，集群 Token 不变时不变
+func AuditToken(cluster models.KubePotK8s) string {
+	h := hmac.New(sha256.New, []byte(cluster.Token))
+	h.Write([]byte(fmt.Sprintf("audit\n%d", cluster.ID)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CheckAudit 把审计事件与集群中部署的诱饵对象比对，命中时生成告警，返回告警数
+// 按名称访问诱饵对象，或列出包含诱饵 Secret、ConfigMap 的命名空间或整个集群时命中
+// 服务端自身部署、轮换和删除诱饵对象的操作按集群 Token 认证后的用户名识别，不告警
+// 同一请求在不同阶段会产生多条事件，按 auditID 只告警一次
+func CheckAudit(cluster models.KubePotK8s, list *AuditEventList) int {
+	decoys, err := ListDecoys(int64(cluster.ID))
+	if err != nil {
+		log.Pr("KubePot", "127.0.0.1", "获取诱饵对象列表失败", err)
+		return 0
+	}
+	if len(decoys) == 0 {
+		return 0
+	}
+
+	self, err := kube.Username(cluster)
+	if err != nil {
+		log.Pr("KubePot", "127.0.0.1", "获取集群 Token 的用户名失败，服务端自身的操作也会告警", err)
+	}
+
+	// 按 资源/命名空间/名称 索引，ServiceAccount 诱饵的 -token Secret 同样算作诱饵
+	// 按 资源/命名空间 和 资源/ 索引列表请求能看到的诱饵对象
+	index := make(map[string]*models.KubePotK8sDecoy)
+	collections := make(map[string][]*models.KubePotK8sDecoy)
+	add := func(resource string, namespace string, name string, d *models.KubePotK8sDecoy) {
+		index[resource+"/"+namespace+"/"+name] = d
+		if resource == "secrets" || resource == "configmaps" {
+			collections[resource+"/"+namespace] = append(collections[resource+"/"+namespace], d)
+			collections[resource+"/"] = append(collections[resource+"/"], d)
+		}
+	}
+	for i := range decoys {
+		d := &decoys[i]
+		add(resources[d.Kind], d.Namespace, d.Name, d)
+		if d.Kind == KindServiceAccount {
+			add("secrets", d.Namespace, tokenSecretName(d.Name), d)
+		}
+	}
+
+	alerts := 0
+	for i := range list.Items {
+		ev := &list.Items[i]
+		ref := ev.ObjectRef
+		if ref == nil || ref.APIGroup != "" {
+			continue
+		}
+		var matched []*models.KubePotK8sDecoy
+		if ref.Name != "" {
+			if d, ok := index[ref.Resource+"/"+ref.Namespace+"/"+ref.Name]; ok {
+				matched = append(matched, d)
+			}
+		} else if listVerbs[ev.Verb] {
+			matched = collections[ref.Resource+"/"+ref.Namespace]
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		if self != "" && ev.User.Username == self && ownVerbs[ev.Verb] {
+			continue
+		}
+
+		throttle := "audit:" + cluster.Name + ":" + ev.AuditID
+		if _, ok := cache.Get(throttle); ok {
+			continue
+		}
+		cache.Set(throttle, true)
+
+		if auditAlert(cluster, matched, ev) {
+			alerts++
+		}
+	}
+	return alerts
+}
+
+// auditAlert 生成诱饵对象被访问的告警，列表请求命中多个诱饵对象时只生成一条
+func auditAlert(cluster models.KubePotK8s, matched []*models.KubePotK8sDecoy, ev *AuditEvent) bool {
+	ip := ""
+	if len(ev.SourceIPs) > 0 {
+		ip = ev.SourceIPs[0]
+	}
+	code := 0
+	if ev.ResponseStatus != nil {
+		code = ev.ResponseStatus.Code
+	}
+	resource := ev.ObjectRef.Resource
+	if ev.ObjectRef.Subresource != "" {
+		resource += "/" + ev.ObjectRef.Subresource
+	}
+	namespace, name := ev.ObjectRef.Namespace, ev.ObjectRef.Name
+	if namespace == "" {
+		namespace = "*"
+	}
+	if name == "" {
+		name = "*"
+	}
+	names := make([]string, len(matched))
+	for i, d := range matched {
+		names[i] = fmt.Sprintf("%s %s/%s", d.Kind, d.Namespace, d.Name)
+	}
+	label := names[0]
+	if len(names) > 1 {
+		label = fmt.Sprintf("%s 等 %d 个诱饵对象", names[0], len(names))
+	}
+
+	now := time.Now()
+	alert := models.KubePotSecretLabelAlert{
+		SecretLabelID:   "0",
+		SecretLabelName: label,
+		Agent:           "k8s:" + cluster.Name,
+		IP:              ip,
+		AccessTime:      now.Format("2006-01-02 15:04:05"),
+		AccessContent: fmt.Sprintf("[high][k8s_decoy_access] 集群 %s 的诱饵对象被访问, request: %s %s/%s, decoys: [%s], verb: %s, code: %d, user: %s, groups: [%s], sourceIPs: [%s], userAgent: %s, auditID: %s",
+			cluster.Name, resource, namespace, name, strings.Join(names, ","), ev.Verb, code,
+			ev.User.Username, strings.Join(ev.User.Groups, ","), strings.Join(ev.SourceIPs, ","), ev.UserAgent, ev.AuditID),
+		CreateTime: now,
+	}
+	if err := SaveAlert(&alert); err != nil {
+		log.Pr("KubePot", "127.0.0.1", "插入蜜标告警失败", err)
+		return false
+	}
+	log.Pr("KubePot", ip, "诱饵对象被访问", alert.AccessContent)
+	return true
+}
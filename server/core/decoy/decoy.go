@@ -0,0 +1,249 @@
+package decoy
+
+import (
+	"KubePot/core/dbUtil"
+	"KubePot/core/honeytoken"
+	"KubePot/core/kube"
+	"KubePot/core/models"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// 诱饵对象类型
+const (
+	KindSecret         = "secret"
+	KindConfigMap      = "configmap"
+	KindServiceAccount = "serviceaccount"
+)
+
+// 诱饵对象状态
+const (
+	StatusDeployed = "deployed"
+	StatusFailed   = "failed"
+)
+
+// 跟踪标签，使用常见的标签名，攻击者无法据此区分诱饵对象和业务对象
+const (
+	// LabelManagedBy 所有诱饵对象共有，按此标签可列出集群中的诱饵对象
+	LabelManagedBy = "app.kubernetes.io/managed-by"
+	ManagedBy      = "platform-ops"
+	// LabelInstance 每个诱饵对象不同，对应数据库中的记录
+	LabelInstance = "app.kubernetes.io/instance"
+)
+
+// 诱饵凭据和诱饵对象记录的存取，默认使用数据库，测试时与 kube.NewClient 一起替换，对照本地模拟 Apiserver 运行
+var (
+	IssueToken = honeytoken.Issue
+	SaveDecoy  = func(decoy *models.KubePotK8sDecoy) error {
+		return dbUtil.GORM().Save(decoy).Error
+	}
+	DeleteDecoy = func(id int64) error {
+		return dbUtil.GORM().Delete(&models.KubePotK8sDecoy{}, id).Error
+	}
+)
+
+// Supported 是否为可部署的对象类型
+func Supported(kind string) bool {
+	return kind == KindSecret || kind == KindConfigMap || kind == KindServiceAccount
+}
+
+// Deploy 在集群的命名空间中创建诱饵对象并记录到数据库，创建失败时也会记录，便于在列表中查看原因
+// ServiceAccount 固定使用 serviceaccount 类型的凭据，放在同名的 -token Secret 中
+func Deploy(cluster models.KubePotK8s, kind string, namespace string, name string, tokenKind string) (*models.KubePotK8sDecoy, error) {
+	if !Supported(kind) {
+		return nil, fmt.Errorf("unknown decoy kind: %s", kind)
+	}
+	if kind == KindServiceAccount {
+		tokenKind = honeytoken.KindServiceAccount
+	}
+	if !honeytoken.Supported(tokenKind) {
+		return nil, fmt.Errorf("unknown honeytoken kind: %s", tokenKind)
+	}
+
+	now := time.Now()
+	decoy := models.KubePotK8sDecoy{
+		K8sID:      int64(cluster.ID),
+		K8sName:    cluster.Name,
+		Kind:       kind,
+		Namespace:  namespace,
+		Name:       name,
+		TokenKind:  tokenKind,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+
+	err := apply(cluster, &decoy, false)
+	decoy.Status = StatusDeployed
+	if err != nil {
+		decoy.Status = StatusFailed
+		decoy.Error = err.Error()
+	}
+	if dbErr := SaveDecoy(&decoy); dbErr != nil {
+		return nil, dbErr
+	}
+	return &decoy, err
+}
+
+// Rotate 为诱饵对象生成新的诱饵凭据并更新集群中的对象，对象不存在时重新创建
+func Rotate(cluster models.KubePotK8s, decoy *models.KubePotK8sDecoy) error {
+	err := apply(cluster, decoy, true)
+	decoy.Status = StatusDeployed
+	decoy.Error = ""
+	if err != nil {
+		decoy.Status = StatusFailed
+		decoy.Error = err.Error()
+	}
+	decoy.UpdateTime = time.Now()
+	if dbErr := SaveDecoy(decoy); dbErr != nil {
+		return dbErr
+	}
+	return err
+}
+
+// Remove 从集群中删除诱饵对象并删除记录，对象已不存在时视为成功
+func Remove(cluster models.KubePotK8s, decoy *models.KubePotK8sDecoy) error {
+	client, err := kube.NewClient(cluster)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kube.Timeout)
+	defer cancel()
+
+	opts := metav1.DeleteOptions{}
+	switch decoy.Kind {
+	case KindSecret:
+		err = client.CoreV1().Secrets(decoy.Namespace).Delete(ctx, decoy.Name, opts)
+	case KindConfigMap:
+		err = client.CoreV1().ConfigMaps(decoy.Namespace).Delete(ctx, decoy.Name, opts)
+	case KindServiceAccount:
+		err = client.CoreV1().Secrets(decoy.Namespace).Delete(ctx, tokenSecretName(decoy.Name), opts)
+		if err == nil || apierrors.IsNotFound(err) {
+			err = client.CoreV1().ServiceAccounts(decoy.Namespace).Delete(ctx, decoy.Name, opts)
+		}
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return DeleteDecoy(decoy.ID)
+}
+
+// apply 生成诱饵凭据并创建对象，update 为 true 时更新已存在的对象
+func apply(cluster models.KubePotK8s, decoy *models.KubePotK8sDecoy, update bool) error {
+	opts := honeytoken.Options{
+		APIServer:      cluster.ApiServer,
+		Namespace:      decoy.Namespace,
+		ServiceAccount: decoy.Name,
+		Host:           cluster.Name,
+	}
+	description := fmt.Sprintf("%s %s/%s", decoy.Kind, decoy.Namespace, decoy.Name)
+	token, err := IssueToken(decoy.TokenKind, "k8s:"+cluster.Name, description, opts)
+	if err != nil {
+		return err
+	}
+	decoy.CanaryID = token.CanaryID
+
+	client, err := kube.NewClient(cluster)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kube.Timeout)
+	defer cancel()
+
+	meta := objectMeta(decoy)
+	switch decoy.Kind {
+	case KindSecret:
+		return applySecret(ctx, client, secret(meta, decoy.TokenKind, token.Content), update)
+	case KindConfigMap:
+		cm := &corev1.ConfigMap{
+			ObjectMeta: meta,
+			Data:       map[string]string{dataKey(decoy.TokenKind): token.Content},
+		}
+		_, err = client.CoreV1().ConfigMaps(decoy.Namespace).Create(ctx, cm, metav1.CreateOptions{})
+		if update && apierrors.IsAlreadyExists(err) {
+			_, err = client.CoreV1().ConfigMaps(decoy.Namespace).Update(ctx, cm, metav1.UpdateOptions{})
+		}
+		return err
+	case KindServiceAccount:
+		tokenMeta := objectMeta(decoy)
+		tokenMeta.Name = tokenSecretName(decoy.Name)
+		tokenMeta.Annotations = map[string]string{corev1.ServiceAccountNameKey: decoy.Name}
+		// 使用 Opaque 类型，service-account-token 类型的 Secret 会被集群填入真实的 Token
+		s := secret(tokenMeta, decoy.TokenKind, token.Content)
+		s.Data = map[string][]byte{
+			corev1.ServiceAccountTokenKey:     []byte(token.Content),
+			corev1.ServiceAccountNamespaceKey: []byte(decoy.Namespace),
+		}
+		if err := applySecret(ctx, client, s, update); err != nil {
+			return err
+		}
+
+		sa := &corev1.ServiceAccount{
+			ObjectMeta: meta,
+			Secrets:    []corev1.ObjectReference{{Name: tokenMeta.Name}},
+		}
+		_, err = client.CoreV1().ServiceAccounts(decoy.Namespace).Create(ctx, sa, metav1.CreateOptions{})
+		if update && apierrors.IsAlreadyExists(err) {
+			err = nil
+		}
+		return err
+	}
+	return fmt.Errorf("unknown decoy kind: %s", decoy.Kind)
+}
+
+// applySecret 创建 Secret，update 为 true 时更新已存在的 Secret
+func applySecret(ctx context.Context, client kubernetes.Interface, s *corev1.Secret, update bool) error {
+	_, err := client.CoreV1().Secrets(s.Namespace).Create(ctx, s, metav1.CreateOptions{})
+	if update && apierrors.IsAlreadyExists(err) {
+		_, err = client.CoreV1().Secrets(s.Namespace).Update(ctx, s, metav1.UpdateOptions{})
+	}
+	return err
+}
+
+// secret 按凭据类型构造 Secret，镜像仓库凭据使用 dockerconfigjson 类型
+func secret(meta metav1.ObjectMeta, tokenKind string, content string) *corev1.Secret {
+	s := &corev1.Secret{
+		ObjectMeta: meta,
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{dataKey(tokenKind): []byte(content)},
+	}
+	if tokenKind == honeytoken.KindDockerConfig {
+		s.Type = corev1.SecretTypeDockerConfigJson
+		s.Data = map[string][]byte{corev1.DockerConfigJsonKey: []byte(content)}
+	}
+	return s
+}
+
+// dataKey 对象中保存凭据的键，使用该类凭据常见的文件名
+func dataKey(tokenKind string) string {
+	return path.Base(honeytoken.DefaultPath(tokenKind))
+}
+
+func tokenSecretName(name string) string {
+	return name + "-token"
+}
+
+func objectMeta(decoy *models.KubePotK8sDecoy) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      decoy.Name,
+		Namespace: decoy.Namespace,
+		Labels: map[string]string{
+			LabelManagedBy: ManagedBy,
+			LabelInstance:  instance(decoy),
+		},
+	}
+}
+
+// instance 跟踪标签的值，由集群、命名空间、类型和名称决定，轮换后不变
+func instance(decoy *models.KubePotK8sDecoy) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d/%s/%s/%s", decoy.K8sID, decoy.Namespace, decoy.Kind, decoy.Name)))
+	return "ops-" + hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,285 @@
+package decoy
+
+import (
+	"KubePot/core/honeytoken"
+	"KubePot/core/kube"
+	"KubePot/core/models"
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var testCluster = models.KubePotK8s{ID: 7, Name: "prod", ApiServer: "https://10.0.0.1:6443", Token: "cluster-token"}
+
+// fakeEnv 把集群客户端和数据库替换为本地模拟 Apiserver 和内存记录
+type fakeEnv struct {
+	client *fake.Clientset
+	decoys map[int64]models.KubePotK8sDecoy
+	tokens []string
+}
+
+func newFakeEnv(t *testing.T) *fakeEnv {
+	env := &fakeEnv{client: fake.NewSimpleClientset(), decoys: map[int64]models.KubePotK8sDecoy{}}
+
+	newClient, issueToken, saveDecoy, deleteDecoy := kube.NewClient, IssueToken, SaveDecoy, DeleteDecoy
+	t.Cleanup(func() {
+		kube.NewClient, IssueToken, SaveDecoy, DeleteDecoy = newClient, issueToken, saveDecoy, deleteDecoy
+	})
+
+	kube.NewClient = func(cluster models.KubePotK8s) (kubernetes.Interface, error) {
+		return env.client, nil
+	}
+	IssueToken = func(kind string, owner string, description string, opts honeytoken.Options) (*models.KubePotHoneytoken, error) {
+		artifact, err := honeytoken.Generate(kind, opts)
+		if err != nil {
+			return nil, err
+		}
+		env.tokens = append(env.tokens, artifact.CanaryID)
+		return &models.KubePotHoneytoken{CanaryID: artifact.CanaryID, AgentName: owner, Kind: kind, Content: artifact.Content}, nil
+	}
+	SaveDecoy = func(decoy *models.KubePotK8sDecoy) error {
+		if decoy.ID == 0 {
+			decoy.ID = int64(len(env.decoys) + 1)
+		}
+		env.decoys[decoy.ID] = *decoy
+		return nil
+	}
+	DeleteDecoy = func(id int64) error {
+		delete(env.decoys, id)
+		return nil
+	}
+	return env
+}
+
+func (env *fakeEnv) secret(t *testing.T, namespace string, name string) *corev1.Secret {
+	s, err := env.client.CoreV1().Secrets(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get secret %s/%s: %v", namespace, name, err)
+	}
+	return s
+}
+
+func TestDeploySecret(t *testing.T) {
+	env := newFakeEnv(t)
+
+	d, err := Deploy(testCluster, KindSecret, "default", "db-backup", honeytoken.KindAWS)
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	if d.Status != StatusDeployed || d.CanaryID == "" || d.K8sID != int64(testCluster.ID) {
+		t.Fatalf("unexpected decoy record: %+v", d)
+	}
+	if _, ok := env.decoys[d.ID]; !ok {
+		t.Fatalf("decoy record not saved")
+	}
+
+	s := env.secret(t, "default", "db-backup")
+	if s.Type != corev1.SecretTypeOpaque {
+		t.Errorf("secret type = %s, want Opaque", s.Type)
+	}
+	if s.Labels[LabelManagedBy] != ManagedBy || s.Labels[LabelInstance] != instance(d) {
+		t.Errorf("unexpected labels: %v", s.Labels)
+	}
+	if len(s.Data[dataKey(honeytoken.KindAWS)]) == 0 {
+		t.Errorf("secret has no credential under %q: %v", dataKey(honeytoken.KindAWS), s.Data)
+	}
+}
+
+func TestDeployDockerConfig(t *testing.T) {
+	env := newFakeEnv(t)
+
+	if _, err := Deploy(testCluster, KindSecret, "ci", "registry", honeytoken.KindDockerConfig); err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	s := env.secret(t, "ci", "registry")
+	if s.Type != corev1.SecretTypeDockerConfigJson || len(s.Data[corev1.DockerConfigJsonKey]) == 0 {
+		t.Errorf("unexpected docker config secret: type %s, data %v", s.Type, s.Data)
+	}
+}
+
+func TestDeployConfigMap(t *testing.T) {
+	env := newFakeEnv(t)
+
+	if _, err := Deploy(testCluster, KindConfigMap, "default", "kubeconfig", honeytoken.KindKubeconfig); err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	cm, err := env.client.CoreV1().ConfigMaps("default").Get(context.Background(), "kubeconfig", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get configmap: %v", err)
+	}
+	if cm.Data[dataKey(honeytoken.KindKubeconfig)] == "" {
+		t.Errorf("configmap has no kubeconfig: %v", cm.Data)
+	}
+}
+
+func TestDeployServiceAccount(t *testing.T) {
+	env := newFakeEnv(t)
+
+	// ServiceAccount 诱饵忽略传入的凭据类型
+	d, err := Deploy(testCluster, KindServiceAccount, "kube-system", "backup-operator", honeytoken.KindAWS)
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	if d.TokenKind != honeytoken.KindServiceAccount {
+		t.Errorf("token kind = %s, want %s", d.TokenKind, honeytoken.KindServiceAccount)
+	}
+
+	sa, err := env.client.CoreV1().ServiceAccounts("kube-system").Get(context.Background(), "backup-operator", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get serviceaccount: %v", err)
+	}
+	if len(sa.Secrets) != 1 || sa.Secrets[0].Name != "backup-operator-token" {
+		t.Errorf("unexpected serviceaccount secrets: %v", sa.Secrets)
+	}
+
+	s := env.secret(t, "kube-system", "backup-operator-token")
+	if s.Type != corev1.SecretTypeOpaque {
+		t.Errorf("token secret type = %s, want Opaque", s.Type)
+	}
+	if s.Annotations[corev1.ServiceAccountNameKey] != "backup-operator" {
+		t.Errorf("unexpected annotations: %v", s.Annotations)
+	}
+	if len(s.Data[corev1.ServiceAccountTokenKey]) == 0 || string(s.Data[corev1.ServiceAccountNamespaceKey]) != "kube-system" {
+		t.Errorf("unexpected token secret data: %v", s.Data)
+	}
+}
+
+func TestDeployRejectsUnknownKind(t *testing.T) {
+	env := newFakeEnv(t)
+
+	if _, err := Deploy(testCluster, "pod", "default", "x", honeytoken.KindAWS); err == nil {
+		t.Fatalf("deploy of unknown kind succeeded")
+	}
+	if _, err := Deploy(testCluster, KindSecret, "default", "x", "password"); err == nil {
+		t.Fatalf("deploy of unknown token kind succeeded")
+	}
+	if len(env.decoys) != 0 || len(env.client.Actions()) != 0 {
+		t.Errorf("rejected deploy touched the cluster or database")
+	}
+}
+
+func TestDeployRecordsFailure(t *testing.T) {
+	env := newFakeEnv(t)
+	env.client.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(corev1.Resource("secrets"), "db-backup", errors.New("rbac"))
+	})
+
+	d, err := Deploy(testCluster, KindSecret, "default", "db-backup", honeytoken.KindAWS)
+	if !apierrors.IsForbidden(err) {
+		t.Fatalf("deploy error = %v, want forbidden", err)
+	}
+	if d == nil || d.Status != StatusFailed || d.Error == "" {
+		t.Fatalf("failed deploy not recorded: %+v", d)
+	}
+	if _, ok := env.decoys[d.ID]; !ok {
+		t.Errorf("failed decoy record not saved")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	env := newFakeEnv(t)
+
+	d, err := Deploy(testCluster, KindSecret, "default", "db-backup", honeytoken.KindAWS)
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	old := d.CanaryID
+	oldData := string(env.secret(t, "default", "db-backup").Data[dataKey(honeytoken.KindAWS)])
+
+	if err := Rotate(testCluster, d); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if d.CanaryID == old || env.decoys[d.ID].CanaryID != d.CanaryID {
+		t.Errorf("canary not rotated: old %s, new %s, saved %s", old, d.CanaryID, env.decoys[d.ID].CanaryID)
+	}
+	if string(env.secret(t, "default", "db-backup").Data[dataKey(honeytoken.KindAWS)]) == oldData {
+		t.Errorf("secret content not updated")
+	}
+}
+
+func TestRotateRecreatesMissingObject(t *testing.T) {
+	env := newFakeEnv(t)
+
+	d, err := Deploy(testCluster, KindServiceAccount, "default", "deployer", "")
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	ctx := context.Background()
+	if err := env.client.CoreV1().Secrets("default").Delete(ctx, "deployer-token", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("delete token secret: %v", err)
+	}
+
+	if err := Rotate(testCluster, d); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	env.secret(t, "default", "deployer-token")
+	if d.Status != StatusDeployed || d.Error != "" {
+		t.Errorf("unexpected status after rotate: %+v", d)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	env := newFakeEnv(t)
+	ctx := context.Background()
+
+	d, err := Deploy(testCluster, KindServiceAccount, "default", "deployer", "")
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	if err := Remove(testCluster, d); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err := env.client.CoreV1().ServiceAccounts("default").Get(ctx, "deployer", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("serviceaccount not removed: %v", err)
+	}
+	if _, err := env.client.CoreV1().Secrets("default").Get(ctx, "deployer-token", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("token secret not removed: %v", err)
+	}
+	if _, ok := env.decoys[d.ID]; ok {
+		t.Errorf("decoy record not deleted")
+	}
+}
+
+func TestRemoveMissingObject(t *testing.T) {
+	env := newFakeEnv(t)
+
+	d, err := Deploy(testCluster, KindConfigMap, "default", "kubeconfig", honeytoken.KindKubeconfig)
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	if err := env.client.CoreV1().ConfigMaps("default").Delete(context.Background(), "kubeconfig", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("delete configmap: %v", err)
+	}
+	if err := Remove(testCluster, d); err != nil {
+		t.Fatalf("remove of already deleted object: %v", err)
+	}
+	if _, ok := env.decoys[d.ID]; ok {
+		t.Errorf("decoy record not deleted")
+	}
+}
+
+func TestRemoveKeepsRecordOnError(t *testing.T) {
+	env := newFakeEnv(t)
+
+	d, err := Deploy(testCluster, KindSecret, "default", "db-backup", honeytoken.KindAWS)
+	if err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	env.client.PrependReactor("delete", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(corev1.Resource("secrets"), "db-backup", errors.New("rbac"))
+	})
+	if err := Remove(testCluster, d); !apierrors.IsForbidden(err) {
+		t.Fatalf("remove error = %v, want forbidden", err)
+	}
+	if _, ok := env.decoys[d.ID]; !ok {
+		t.Errorf("decoy record deleted although the object is still in the cluster")
+	}
+}
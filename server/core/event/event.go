@@ -0,0 +1,135 @@
+package event
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version 服务端能解析的最高事件版本，与 agent 端 core/event 一致
+const Version = 1
+
+// Kind 事件类型
+type Kind string
+
+const (
+	KindConnect Kind = "connect" // 建立连接
+	KindAuth    Kind = "auth"    // 登录或携带凭据
+	KindCommand Kind = "command" // 执行命令
+	KindRequest Kind = "request" // HTTP 等请求
+	KindFile    Kind = "file"    // 上传、下载或读取文件
+	KindOpen    Kind = "open"    // 会话开始
+	KindClose   Kind = "close"   // 会话结束，带有会话统计
+)
+
+// Credentials 攻击者使用的凭据
+type Credentials struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+	// PublicKey SSH 客户端提供的公钥指纹，格式为 SHA256:<base64>
+	PublicKey string `json:"public_key,omitempty"`
+	// Certificate 客户端证书的 SHA256 指纹，十六进制
+	Certificate string `json:"certificate,omitempty"`
+}
+
+// Request 请求类协议的请求信息
+type Request struct {
+	Method    string `json:"method,omitempty"`
+	URI       string `json:"uri,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Raw       string `json:"raw,omitempty"`
+}
+
+// SessionStats 会话结束时的统计
+type SessionStats struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	BytesIn     int64     `json:"bytes_in"`
+	BytesOut    int64     `json:"bytes_out"`
+	Requests    int64     `json:"requests"`
+	CloseReason string    `json:"close_reason"`
+}
+
+// Event Agent 上报的攻击事件
+type Event struct {
+	Version     int          `json:"version"`
+	Protocol    string       `json:"protocol"`
+	Kind        Kind         `json:"kind"`
+	SourceIP    string       `json:"source_ip"`
+	SourcePort  int          `json:"source_port,omitempty"`
+	DestPort    int          `json:"dest_port,omitempty"`
+	SessionID   string       `json:"session_id,omitempty"`
+	Time        time.Time    `json:"time"`
+	Credentials *Credentials `json:"credentials,omitempty"`
+	Command     string       `json:"command,omitempty"`
+	Request     *Request     `json:"request,omitempty"`
+	File        string       `json:"file,omitempty"`
+	Detail      string       `json:"detail,omitempty"`
+	// Session 仅会话结束事件携带
+	Session *SessionStats `json:"session,omitempty"`
+}
+
+// Lifecycle 是否为会话开始或结束事件，这类事件只更新会话，不产生上钩记录
+func (e *Event) Lifecycle() bool {
+	return e.Kind == KindOpen || e.Kind == KindClose
+}
+
+// Summary 事件的可读描述，与 agent 端的日志格式一致
+func (e *Event) Summary() string {
+	var parts []string
+	if e.Request != nil && e.Request.Method != "" {
+		parts = append(parts, e.Request.Method+" "+e.Request.URI)
+	}
+	if c := e.Credentials; c != nil {
+		if c.Username != "" {
+			parts = append(parts, "User: "+c.Username)
+		}
+		if c.Password != "" {
+			parts = append(parts, "Password: "+c.Password)
+		}
+		if c.Token != "" {
+			parts = append(parts, "Token: "+c.Token)
+		}
+		if c.PublicKey != "" {
+			parts = append(parts, "PublicKey: "+c.PublicKey)
+		}
+		if c.Certificate != "" {
+			parts = append(parts, "Certificate: "+c.Certificate)
+		}
+	}
+	if e.Command != "" {
+		parts = append(parts, "Command: "+e.Command)
+	}
+	if e.File != "" {
+		parts = append(parts, "File: "+e.File)
+	}
+	if e.Detail != "" {
+		parts = append(parts, e.Detail)
+	}
+	if len(parts) == 0 {
+		return string(e.Kind)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Legacy 转换为上钩记录中的 info 字符串
+// 账号密码按 账号&&密码 存储，追加到已有记录的内容以 && 开头，与旧版 Agent 的格式一致
+func (e *Event) Legacy(appended bool) string {
+	var info string
+	switch {
+	case e.Credentials != nil && (e.Credentials.Username != "" || e.Credentials.Password != ""):
+		info = e.Credentials.Username + "&&" + e.Credentials.Password
+	case e.Kind == KindConnect && e.Detail == "":
+		info = net.JoinHostPort(e.SourceIP, strconv.Itoa(e.SourcePort)) + " 已经连接"
+	case e.Kind == KindCommand && e.Command != "" && e.Detail == "":
+		info = e.Command
+	default:
+		info = e.Summary()
+	}
+	if appended {
+		info = "&&" + info
+	}
+	return info
+}
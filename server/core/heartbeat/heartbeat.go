@@ -0,0 +1,126 @@
+package heartbeat
+
+import (
+	"KubePot/core/dbUtil"
+	"KubePot/core/models"
+	"KubePot/utils/log"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// StaleAfter 超过该时间没有心跳视为异常，Agent 默认每 30 秒发送一次
+	StaleAfter = 2 * time.Minute
+	// OfflineAfter 超过该时间没有心跳视为离线并告警
+	OfflineAfter = 5 * time.Minute
+
+	checkInterval = 30 * time.Second
+)
+
+// Service Agent 上报的蜜罐服务监听状态
+type Service struct {
+	Name    string    `json:"name"`
+	Network string    `json:"network"`
+	Addr    string    `json:"addr"`
+	State   string    `json:"state"`
+	Error   string    `json:"error,omitempty"`
+	Since   time.Time `json:"since"`
+}
+
+// Heartbeat Agent 定期发送的心跳
+type Heartbeat struct {
+	AgentName    string    `json:"agent_name"`
+	AgentIP      string    `json:"agent_ip"`
+	HostName     string    `json:"host_name"`
+	NodeType     string    `json:"node_type"`
+	Version      string    `json:"version"`
+	StartTime    int64     `json:"start_time"`
+	Uptime       int64     `json:"uptime"`
+	Services     []Service `json:"services"`
+	SpoolDepth   int64     `json:"spool_depth"`
+	SpoolDropped int64     `json:"spool_dropped"`
+}
+
+// Record 保存心跳，离线的 Agent 恢复心跳时记录日志
+func Record(hb *Heartbeat) error {
+	services, err := json.Marshal(hb.Services)
+	if err != nil {
+		return err
+	}
+
+	db := dbUtil.GORM()
+	var health models.KubePotAgentHealth
+	if db.Where("agent_name = ?", hb.AgentName).First(&health).Error == nil && health.State == models.AgentOffline {
+		log.Pr("KubePot", hb.AgentIP, "Agent 恢复在线", hb.AgentName)
+	}
+
+	health.AgentName = hb.AgentName
+	health.AgentIP = hb.AgentIP
+	health.HostName = hb.HostName
+	health.NodeType = hb.NodeType
+	health.Version = hb.Version
+	health.Uptime = hb.Uptime
+	health.StartTime = time.Unix(hb.StartTime, 0)
+	health.Services = string(services)
+	health.SpoolDepth = hb.SpoolDepth
+	health.SpoolDropped = hb.SpoolDropped
+	health.State = models.AgentOnline
+	health.LastHeartbeat = time.Now()
+	return db.Save(&health).Error
+}
+
+// Watch 定期检查心跳，超时的 Agent 标记为异常或离线，转为离线时告警
+func Watch() {
+	for range time.Tick(checkInterval) {
+		check(time.Now())
+	}
+}
+
+func check(now time.Time) {
+	db := dbUtil.GORM()
+
+	err := db.Model(&models.KubePotAgentHealth{}).
+		Where("state = ? AND last_heartbeat < ?", models.AgentOnline, now.Add(-StaleAfter)).
+		Update("state", models.AgentStale).Error
+	if err != nil {
+		log.Pr("KubePot", "127.0.0.1", "更新Agent状态失败", err)
+	}
+
+	var offline []models.KubePotAgentHealth
+	err = db.Where("state <> ? AND last_heartbeat < ?", models.AgentOffline, now.Add(-OfflineAfter)).Find(&offline).Error
+	if err != nil {
+		log.Pr("KubePot", "127.0.0.1", "获取Agent状态失败", err)
+		return
+	}
+	for _, agent := range offline {
+		// 条件更新，多个实例同时检查时只告警一次
+		result := db.Model(&models.KubePotAgentHealth{}).
+			Where("id = ? AND state <> ?", agent.ID, models.AgentOffline).
+			Update("state", models.AgentOffline)
+		if result.Error != nil || result.RowsAffected != 1 {
+			continue
+		}
+		alert(agent, now)
+	}
+}
+
+// alert 生成 Agent 离线告警
+func alert(agent models.KubePotAgentHealth, now time.Time) {
+	content := fmt.Sprintf("[high][agent_offline] Agent %s (%s, %s) 自 %s 起没有心跳",
+		agent.AgentName, agent.HostName, agent.Version, agent.LastHeartbeat.Format("2006-01-02 15:04:05"))
+	err := dbUtil.GORM().Create(&models.KubePotSecretLabelAlert{
+		SecretLabelID:   "0",
+		SecretLabelName: "Agent离线",
+		Agent:           agent.AgentName,
+		IP:              agent.AgentIP,
+		AccessTime:      now.Format("2006-01-02 15:04:05"),
+		AccessContent:   content,
+		CreateTime:      now,
+	}).Error
+	if err != nil {
+		log.Pr("KubePot", "127.0.0.1", "插入Agent离线告警失败", err)
+		return
+	}
+	log.Pr("KubePot", agent.AgentIP, "Agent 离线", content)
+}
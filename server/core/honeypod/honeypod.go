@@ -0,0 +1,499 @@
+package honeypod
+
+import (
+	"KubePot/core/dbUtil"
+	"KubePot/core/kube"
+	"KubePot/core/models"
+	"KubePot/utils/log"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// 工作负载类型，Pod 重建后 Agent 名称不变：StatefulSet 使用序号，DaemonSet 使用节点名
+const (
+	WorkloadStatefulSet = "statefulset"
+	WorkloadDaemonSet   = "daemonset"
+)
+
+// 发布状态
+const (
+	StatusProgressing = "progressing"
+	StatusAvailable   = "available"
+	StatusFailed      = "failed"
+)
+
+// DefaultImage 未指定镜像时使用的 Agent 镜像
+const DefaultImage = "kubepot/agent:latest"
+
+const (
+	// 注册令牌只在发布期间有效，发布未完成时每次刷新状态都会续期
+	tokenTTL = 10 * time.Minute
+	// 跟踪发布状态的间隔和超时时间
+	trackInterval = 5 * time.Second
+	trackTimeout  = 10 * time.Minute
+	// Agent 密钥保存在卷中，Pod 重建后使用原有密钥，不需要重新注册
+	stateVolume = "kubepot-state"
+	stateDir    = "/var/lib/kubepot"
+	stateSize   = "16Mi"
+)
+
+// Deploy 创建注册令牌并在集群中创建 Agent 工作负载和 Service，记录保存到数据库后在后台跟踪发布状态
+// serverAddr 为 Pod 访问服务端的地址，各 Pod 使用同一令牌以各自的名称注册，见 nameEnv
+func Deploy(cluster models.KubePotK8s, d *models.KubePotHoneypodDeployment, serverAddr string) error {
+	ports, err := parsePorts(d.Ports)
+	if err != nil {
+		return err
+	}
+	if d.Workload != WorkloadStatefulSet && d.Workload != WorkloadDaemonSet {
+		return fmt.Errorf("unknown workload: %s", d.Workload)
+	}
+	if d.Image == "" {
+		d.Image = DefaultImage
+	}
+	if d.Replicas <= 0 {
+		d.Replicas = 1
+	}
+	if d.ServiceType == "" {
+		d.ServiceType = string(corev1.ServiceTypeClusterIP)
+	}
+
+	now := time.Now()
+	d.K8sID = int64(cluster.ID)
+	d.K8sName = cluster.Name
+	d.Status = StatusProgressing
+	d.CreateTime = now
+	d.UpdateTime = now
+
+	token, err := enrollToken(d)
+	if err == nil {
+		d.EnrollTokenID = token.TokenID
+		err = apply(cluster, d, serverAddr, token, ports)
+	}
+	if err != nil {
+		d.Status = StatusFailed
+		d.Message = err.Error()
+	}
+	if dbErr := dbUtil.GORM().Create(d).Error; dbErr != nil {
+		return dbErr
+	}
+	if err != nil {
+		return err
+	}
+
+	go Track(cluster, d.ID)
+	return nil
+}
+
+// Track 定期刷新发布状态，直到全部 Pod 可用、发布失败或超时
+func Track(cluster models.KubePotK8s, id int64) {
+	deadline := time.Now().Add(trackTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(trackInterval)
+
+		var d models.KubePotHoneypodDeployment
+		if err := dbUtil.GORM().First(&d, id).Error; err != nil {
+			// 已卸载
+			return
+		}
+		if err := Refresh(cluster, &d); err != nil {
+			log.Pr("KubePot", "127.0.0.1", "获取蜜罐发布状态失败", err)
+			continue
+		}
+		if d.Status != StatusProgressing {
+			return
+		}
+	}
+}
+
+// Refresh 从集群读取工作负载的发布状态并更新记录，发布未完成时为注册令牌续期
+// 扩容或新节点加入时点击刷新即可让新 Pod 注册
+func Refresh(cluster models.KubePotK8s, d *models.KubePotHoneypodDeployment) error {
+	client, err := kube.NewClient(cluster)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kube.Timeout)
+	defer cancel()
+
+	switch d.Workload {
+	case WorkloadStatefulSet:
+		sts, err := client.AppsV1().StatefulSets(d.Namespace).Get(ctx, d.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		statefulSetStatus(d, sts)
+	case WorkloadDaemonSet:
+		ds, err := client.AppsV1().DaemonSets(d.Namespace).Get(ctx, d.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		daemonSetStatus(d, ds)
+	}
+
+	d.UpdateTime = time.Now()
+	if d.Status == StatusProgressing && d.EnrollTokenID != "" {
+		if err := renewToken(d.EnrollTokenID); err != nil {
+			return err
+		}
+	}
+	return dbUtil.GORM().Model(&models.KubePotHoneypodDeployment{}).Where("id = ?", d.ID).
+		Updates(map[string]interface{}{
+			"status":      d.Status,
+			"ready":       d.Ready,
+			"desired":     d.Desired,
+			"message":     d.Message,
+			"update_time": d.UpdateTime,
+		}).Error
+}
+
+// Teardown 删除集群中的工作负载、Service 和注册令牌 Secret，再删除注册令牌、Agent 密钥、心跳和记录，对象已不存在时视为成功
+// StatefulSet 的密钥卷不会随工作负载删除，一并删除，同名蜜罐重新部署时 Agent 重新注册
+func Teardown(cluster models.KubePotK8s, d *models.KubePotHoneypodDeployment) error {
+	client, err := kube.NewClient(cluster)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kube.Timeout)
+	defer cancel()
+
+	policy := metav1.DeletePropagationBackground
+	opts := metav1.DeleteOptions{PropagationPolicy: &policy}
+	errs := []error{client.CoreV1().Services(d.Namespace).Delete(ctx, d.Name, opts)}
+	switch d.Workload {
+	case WorkloadStatefulSet:
+		errs = append(errs, client.AppsV1().StatefulSets(d.Namespace).Delete(ctx, d.Name, opts))
+		errs = append(errs, client.CoreV1().PersistentVolumeClaims(d.Namespace).DeleteCollection(ctx, opts,
+			metav1.ListOptions{LabelSelector: "app=" + d.Name}))
+	case WorkloadDaemonSet:
+		errs = append(errs, client.AppsV1().DaemonSets(d.Namespace).Delete(ctx, d.Name, opts))
+	}
+	errs = append(errs, client.CoreV1().Secrets(d.Namespace).Delete(ctx, secretName(d), opts))
+	for _, err := range errs {
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	db := dbUtil.GORM()
+	if d.EnrollTokenID != "" {
+		if err := db.Where("token_id = ?", d.EnrollTokenID).Delete(&models.KubePotEnrollToken{}).Error; err != nil {
+			return err
+		}
+	}
+	// 卸载后这些 Agent 不会再上线，删除密钥和心跳，避免产生离线告警
+	pattern := NamePrefix(d) + "%"
+	if err := db.Where("agent_name LIKE ?", pattern).Delete(&models.KubePotAgentKey{}).Error; err != nil {
+		return err
+	}
+	if err := db.Where("agent_name LIKE ?", pattern).Delete(&models.KubePotAgentHealth{}).Error; err != nil {
+		return err
+	}
+	return db.Delete(&models.KubePotHoneypodDeployment{}, d.ID).Error
+}
+
+// NamePrefix 工作负载中 Pod 的名称前缀，也是 Agent 名称前缀
+func NamePrefix(d *models.KubePotHoneypodDeployment) string {
+	return d.Name + "-"
+}
+
+// renewToken 延长注册令牌的有效期
+func renewToken(tokenID string) error {
+	return dbUtil.GORM().Model(&models.KubePotEnrollToken{}).Where("token_id = ?", tokenID).
+		Update("expire_time", time.Now().Add(tokenTTL)).Error
+}
+
+// enrollToken 创建只能被该工作负载的 Pod 使用的注册令牌，令牌在发布期间有效，同名 Agent 已注册时拒绝注册
+func enrollToken(d *models.KubePotHoneypodDeployment) (*models.KubePotEnrollToken, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	token := models.KubePotEnrollToken{
+		TokenID:    id,
+		Secret:     secret,
+		Remark:     fmt.Sprintf("honeypod %s/%s/%s", d.K8sName, d.Namespace, d.Name),
+		NamePrefix: NamePrefix(d),
+		ExpireTime: now.Add(tokenTTL),
+		CreateTime: now,
+	}
+	if err := dbUtil.GORM().Create(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// apply 创建或更新注册令牌 Secret、工作负载和 Service
+func apply(cluster models.KubePotK8s, d *models.KubePotHoneypodDeployment, serverAddr string, token *models.KubePotEnrollToken, ports []int32) error {
+	client, err := kube.NewClient(cluster)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kube.Timeout)
+	defer cancel()
+
+	secret := &corev1.Secret{
+		ObjectMeta: objectMeta(d, secretName(d)),
+		Type:       corev1.SecretTypeOpaque,
+		StringData: map[string]string{"token": token.TokenID + "." + token.Secret},
+	}
+	_, err = client.CoreV1().Secrets(d.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = client.CoreV1().Secrets(d.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := applyWorkload(ctx, client, d, podTemplate(d, serverAddr, ports)); err != nil {
+		return err
+	}
+	return applyService(ctx, client, d, ports)
+}
+
+func applyWorkload(ctx context.Context, client kubernetes.Interface, d *models.KubePotHoneypodDeployment, template corev1.PodTemplateSpec) error {
+	selector := &metav1.LabelSelector{MatchLabels: selectorLabels(d)}
+
+	var err error
+	switch d.Workload {
+	case WorkloadStatefulSet:
+		replicas := d.Replicas
+		sts := &appsv1.StatefulSet{
+			ObjectMeta: objectMeta(d, d.Name),
+			Spec: appsv1.StatefulSetSpec{
+				Replicas:            &replicas,
+				Selector:            selector,
+				Template:            template,
+				ServiceName:         d.Name,
+				PodManagementPolicy: appsv1.ParallelPodManagement,
+				VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+					ObjectMeta: metav1.ObjectMeta{Name: stateVolume, Labels: selectorLabels(d)},
+					Spec: corev1.PersistentVolumeClaimSpec{
+						AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+						Resources: corev1.VolumeResourceRequirements{
+							Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(stateSize)},
+						},
+					},
+				}},
+			},
+		}
+		statefulSets := client.AppsV1().StatefulSets(d.Namespace)
+		_, err = statefulSets.Create(ctx, sts, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			_, err = statefulSets.Update(ctx, sts, metav1.UpdateOptions{})
+		}
+	case WorkloadDaemonSet:
+		ds := &appsv1.DaemonSet{
+			ObjectMeta: objectMeta(d, d.Name),
+			Spec: appsv1.DaemonSetSpec{
+				Selector: selector,
+				Template: template,
+			},
+		}
+		daemonSets := client.AppsV1().DaemonSets(d.Namespace)
+		_, err = daemonSets.Create(ctx, ds, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			_, err = daemonSets.Update(ctx, ds, metav1.UpdateOptions{})
+		}
+	}
+	return err
+}
+
+// applyService 创建 Service，已存在时只更新端口和类型，保留集群分配的 ClusterIP
+func applyService(ctx context.Context, client kubernetes.Interface, d *models.KubePotHoneypodDeployment, ports []int32) error {
+	var servicePorts []corev1.ServicePort
+	for _, port := range ports {
+		servicePorts = append(servicePorts, corev1.ServicePort{
+			Name:       "port-" + strconv.Itoa(int(port)),
+			Port:       port,
+			TargetPort: intstr.FromInt32(port),
+			Protocol:   corev1.ProtocolTCP,
+		})
+	}
+
+	services := client.CoreV1().Services(d.Namespace)
+	svc := &corev1.Service{
+		ObjectMeta: objectMeta(d, d.Name),
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceType(d.ServiceType),
+			Selector: selectorLabels(d),
+			Ports:    servicePorts,
+		},
+	}
+	_, err := services.Create(ctx, svc, metav1.CreateOptions{})
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	exist, err := services.Get(ctx, d.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	exist.Spec.Type = svc.Spec.Type
+	exist.Spec.Selector = svc.Spec.Selector
+	exist.Spec.Ports = servicePorts
+	_, err = services.Update(ctx, exist, metav1.UpdateOptions{})
+	return err
+}
+
+// podTemplate Agent Pod 模板，通过环境变量覆盖 Agent 配置，Agent 名称见 nameEnv，密钥保存在 stateDir
+// 关闭 Service 环境变量注入，避免同命名空间中以 kubepot 开头的 Service 产生 KUBEPOT_ 前缀的变量
+func podTemplate(d *models.KubePotHoneypodDeployment, serverAddr string, ports []int32) corev1.PodTemplateSpec {
+	var containerPorts []corev1.ContainerPort
+	for _, port := range ports {
+		containerPorts = append(containerPorts, corev1.ContainerPort{ContainerPort: port, Protocol: corev1.ProtocolTCP})
+	}
+	enableServiceLinks := false
+
+	env := append(nameEnv(d),
+		corev1.EnvVar{Name: "KUBEPOT_RPC_STATUS", Value: "2"},
+		corev1.EnvVar{Name: "KUBEPOT_RPC_ADDR", Value: serverAddr},
+		corev1.EnvVar{Name: "KUBEPOT_RPC_KEY_FILE", Value: stateDir + "/agent.key"},
+		corev1.EnvVar{Name: "KUBEPOT_RPC_ENROLL_TOKEN", ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secretName(d)},
+				Key:                  "token",
+			},
+		}},
+	)
+
+	spec := corev1.PodSpec{
+		EnableServiceLinks: &enableServiceLinks,
+		Containers: []corev1.Container{{
+			Name:         d.Name,
+			Image:        d.Image,
+			Ports:        containerPorts,
+			Env:          env,
+			VolumeMounts: []corev1.VolumeMount{{Name: stateVolume, MountPath: stateDir}},
+		}},
+	}
+	// StatefulSet 的密钥卷来自 VolumeClaimTemplates，DaemonSet 使用节点上的目录
+	// 目录名包含注册令牌 ID，同名蜜罐重新部署后不会读到已删除的旧密钥
+	if d.Workload == WorkloadDaemonSet {
+		hostPathType := corev1.HostPathDirectoryOrCreate
+		spec.Volumes = []corev1.Volume{{
+			Name: stateVolume,
+			VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{
+				Path: stateDir + "/" + d.Namespace + "-" + d.Name + "-" + d.EnrollTokenID,
+				Type: &hostPathType,
+			}},
+		}}
+	}
+
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: selectorLabels(d)},
+		Spec:       spec,
+	}
+}
+
+// nameEnv 设置 Agent 名称的环境变量，名称以 NamePrefix 开头，Pod 重建后不变
+// StatefulSet 的 Pod 名称带有固定序号，直接使用；DaemonSet 每个节点一个 Pod，使用节点名
+func nameEnv(d *models.KubePotHoneypodDeployment) []corev1.EnvVar {
+	if d.Workload == WorkloadDaemonSet {
+		return []corev1.EnvVar{
+			{Name: "NODE_NAME", ValueFrom: fieldRef("spec.nodeName")},
+			{Name: "KUBEPOT_RPC_NAME", Value: NamePrefix(d) + "$(NODE_NAME)"},
+		}
+	}
+	return []corev1.EnvVar{{Name: "KUBEPOT_RPC_NAME", ValueFrom: fieldRef("metadata.name")}}
+}
+
+func fieldRef(path string) *corev1.EnvVarSource {
+	return &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: path}}
+}
+
+// statefulSetStatus 按 StatefulSet 的状态计算发布状态，StatefulSet 没有发布超时条件，Pod 无法就绪时保持 progressing
+func statefulSetStatus(d *models.KubePotHoneypodDeployment, sts *appsv1.StatefulSet) {
+	d.Desired = 1
+	if sts.Spec.Replicas != nil {
+		d.Desired = *sts.Spec.Replicas
+	}
+	d.Ready = sts.Status.AvailableReplicas
+	d.Status = StatusProgressing
+	d.Message = ""
+
+	for _, cond := range sts.Status.Conditions {
+		if cond.Status == corev1.ConditionTrue && cond.Message != "" {
+			d.Message = cond.Message
+		}
+	}
+	if sts.Status.ObservedGeneration >= sts.Generation &&
+		sts.Status.UpdatedReplicas == d.Desired && d.Ready == d.Desired {
+		d.Status = StatusAvailable
+	}
+}
+
+// daemonSetStatus 按 DaemonSet 的状态计算发布状态
+func daemonSetStatus(d *models.KubePotHoneypodDeployment, ds *appsv1.DaemonSet) {
+	d.Desired = ds.Status.DesiredNumberScheduled
+	d.Ready = ds.Status.NumberAvailable
+	d.Status = StatusProgressing
+	d.Message = ""
+
+	if ds.Status.ObservedGeneration >= ds.Generation &&
+		ds.Status.UpdatedNumberScheduled == d.Desired && d.Ready == d.Desired {
+		d.Status = StatusAvailable
+	}
+}
+
+// parsePorts 解析以逗号分隔的端口列表
+func parsePorts(s string) ([]int32, error) {
+	var ports []int32
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		port, err := strconv.Atoi(item)
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid port: %s", item)
+		}
+		ports = append(ports, int32(port))
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports")
+	}
+	return ports, nil
+}
+
+func secretName(d *models.KubePotHoneypodDeployment) string {
+	return d.Name + "-enroll"
+}
+
+func selectorLabels(d *models.KubePotHoneypodDeployment) map[string]string {
+	return map[string]string{"app": d.Name}
+}
+
+func objectMeta(d *models.KubePotHoneypodDeployment, name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: d.Namespace,
+		Labels:    selectorLabels(d),
+	}
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
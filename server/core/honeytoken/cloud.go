@@ -0,0 +1,81 @@
+package honeytoken
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// dockerConfig ~/.docker/config.json，仓库密码中带有 canary
+func dockerConfig(c canary, opts Options) (*Artifact, error) {
+	user := "deploy@" + opts.Host
+	password := "kp-" + strings.ToLower(c.base32())
+	auth := base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+
+	content, err := json.MarshalIndent(map[string]interface{}{
+		"auths": map[string]interface{}{
+			opts.Registry: map[string]string{"auth": auth},
+		},
+	}, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Artifact{
+		Kind:     KindDockerConfig,
+		CanaryID: c.String(),
+		Content:  string(content) + "\n",
+		Keys:     []string{PasswordKey(password), TokenKey(auth)},
+	}, nil
+}
+
+// aws ~/.aws/credentials，AccessKeyId 由 canary 编码而来
+func aws(c canary) (*Artifact, error) {
+	id := "AKIA" + c.base32()[:16]
+	secret, err := randomString(40)
+	if err != nil {
+		return nil, err
+	}
+	content := fmt.Sprintf("[default]\naws_access_key_id = %s\naws_secret_access_key = %s\nregion = us-east-1\n", id, secret)
+
+	return &Artifact{
+		Kind:     KindAWS,
+		CanaryID: c.String(),
+		Content:  content,
+		Keys:     []string{AccessKey(id), PasswordKey(secret)},
+	}, nil
+}
+
+// aliyun ~/.aliyun/config.json，AccessKeyId 由 canary 编码而来
+func aliyun(c canary) (*Artifact, error) {
+	id := "LTAI5t" + c.base32()[:18]
+	secret, err := randomString(30)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := json.MarshalIndent(map[string]interface{}{
+		"current": "default",
+		"profiles": []map[string]string{{
+			"name":              "default",
+			"mode":              "AK",
+			"access_key_id":     id,
+			"access_key_secret": secret,
+			"region_id":         "cn-hangzhou",
+			"output_format":     "json",
+			"language":          "zh",
+		}},
+		"meta_path": "",
+	}, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Artifact{
+		Kind:     KindAliyun,
+		CanaryID: c.String(),
+		Content:  string(content) + "\n",
+		Keys:     []string{AccessKey(id), PasswordKey(secret)},
+	}, nil
+}
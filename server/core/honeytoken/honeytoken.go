@@ -0,0 +1,198 @@
+package honeytoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+)
+
+// 可生成的诱饵凭据类型，与密标的 label_type 一致
+const (
+	KindKubeconfig     = "kubeconfig"
+	KindServiceAccount = "serviceaccount"
+	KindDockerConfig   = "dockerconfig"
+	KindAWS            = "aws"
+	KindAliyun         = "aliyun"
+	KindEtcd           = "etcd"
+	KindSSH            = "ssh"
+)
+
+// Kinds 所有可生成的类型
+var Kinds = []string{KindKubeconfig, KindServiceAccount, KindDockerConfig, KindAWS, KindAliyun, KindEtcd, KindSSH}
+
+// paths 各类凭据通常所在的路径，密标未指定路径时使用
+var paths = map[string]string{
+	KindKubeconfig:     "/root/.kube/config",
+	KindServiceAccount: "/var/run/secrets/kubernetes.io/serviceaccount/token",
+	KindDockerConfig:   "/root/.docker/config.json",
+	KindAWS:            "/root/.aws/credentials",
+	KindAliyun:         "/root/.aliyun/config.json",
+	KindEtcd:           "/etc/kubernetes/pki/etcd/healthcheck-client.pem",
+	KindSSH:            "/root/.ssh/id_ed25519",
+}
+
+// Options 生成诱饵凭据的参数，未设置的字段使用默认值
+type Options struct {
+	// APIServer kubeconfig 指向的地址，一般为 Agent 的 Apiserver 蜜罐
+	APIServer string
+	// Registry docker config 中的镜像仓库地址
+	Registry string
+	// Namespace 和 ServiceAccount 为 JWT 中的服务账号
+	Namespace      string
+	ServiceAccount string
+	// Host 写入 SSH 公钥注释和证书 CN 的主机名
+	Host string
+}
+
+// Artifact 生成的诱饵凭据
+type Artifact struct {
+	Kind string
+	// CanaryID 嵌入凭据中的唯一 ID，凭据被使用时据此找到密标和部署主机
+	CanaryID string
+	// Content 写入密标文件的内容
+	Content string
+	// Path 该类凭据通常所在的路径
+	Path string
+	// Keys 凭据被使用时能观察到的查找键，格式与 Agent 蜜标登记一致
+	Keys []string
+}
+
+// Generate 生成指定类型的诱饵凭据
+func Generate(kind string, opts Options) (*Artifact, error) {
+	if opts.APIServer == "" {
+		opts.APIServer = "https://127.0.0.1:6443"
+	}
+	if opts.Registry == "" {
+		opts.Registry = "registry.cn-hangzhou.aliyuncs.com"
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = "kube-system"
+	}
+	if opts.ServiceAccount == "" {
+		opts.ServiceAccount = "cluster-admin-sa"
+	}
+	if opts.Host == "" {
+		opts.Host = "node-1"
+	}
+
+	canary, err := newCanary()
+	if err != nil {
+		return nil, err
+	}
+
+	var artifact *Artifact
+	switch kind {
+	case KindKubeconfig:
+		artifact, err = kubeconfig(canary, opts)
+	case KindServiceAccount:
+		artifact, err = serviceAccount(canary, opts)
+	case KindDockerConfig:
+		artifact, err = dockerConfig(canary, opts)
+	case KindAWS:
+		artifact, err = aws(canary)
+	case KindAliyun:
+		artifact, err = aliyun(canary)
+	case KindEtcd:
+		artifact, err = etcd(canary, opts)
+	case KindSSH:
+		artifact, err = sshKey(canary, opts)
+	default:
+		return nil, fmt.Errorf("unknown honeytoken kind: %s", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	artifact.Path = paths[kind]
+	return artifact, nil
+}
+
+// Supported 是否为可生成的类型
+func Supported(kind string) bool {
+	_, ok := paths[kind]
+	return ok
+}
+
+// DefaultPath 该类凭据通常所在的路径
+func DefaultPath(kind string) string {
+	return paths[kind]
+}
+
+// canary 16 字节随机数，按凭据格式编码后嵌入
+type canary []byte
+
+func newCanary() (canary, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (c canary) String() string {
+	return hex.EncodeToString(c)
+}
+
+// uuid 以 UUID v4 格式表示，用于服务账号 UID
+func (c canary) uuid() string {
+	b := append([]byte(nil), c...)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// base32 大写无填充的 base32，字符集与 AWS AccessKeyId 相同
+func (c canary) base32() string {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(c)
+}
+
+const alnum = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// randomString 随机字母数字串，用于密钥等不需要携带 canary 的部分
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	max := big.NewInt(int64(len(alnum)))
+	for i := range b {
+		r, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = alnum[r.Int64()]
+	}
+	return string(b), nil
+}
+
+// 查找键，与 Agent 登记蜜标时的格式一致
+func TokenKey(token string) string {
+	return "token:" + token
+}
+
+func PasswordKey(password string) string {
+	return "password:" + password
+}
+
+func CertKey(der []byte) string {
+	sum := sha256.Sum256(der)
+	return CertFingerprintKey(hex.EncodeToString(sum[:]))
+}
+
+// CertFingerprintKey 按 Agent 上报的证书 SHA256 指纹计算查找键，与 CertKey 一致
+func CertFingerprintKey(fingerprint string) string {
+	return "cert:" + fingerprint
+}
+
+func AccessKey(id string) string {
+	return "access_key:" + id
+}
+
+func SSHKey(fingerprint string) string {
+	return "ssh:" + fingerprint
+}
+
+// Hash 查找键的哈希，入库时只保存哈希
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,103 @@
+package honeytoken
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// serviceAccountJWT 生成旧版 Secret 形式的服务账号令牌，UID 和 secret 名称中带有 canary
+func serviceAccountJWT(c canary, opts Options) (string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+	kid, err := randomString(43)
+	if err != nil {
+		return "", err
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":                                    "kubernetes/serviceaccount",
+		"kubernetes.io/serviceaccount/namespace": opts.Namespace,
+		"kubernetes.io/serviceaccount/secret.name":          opts.ServiceAccount + "-token-" + strings.ToLower(c.base32()[:5]),
+		"kubernetes.io/serviceaccount/service-account.name": opts.ServiceAccount,
+		"kubernetes.io/serviceaccount/service-account.uid":  c.uuid(),
+		"sub": "system:serviceaccount:" + opts.Namespace + ":" + opts.ServiceAccount,
+	})
+
+	enc := base64.RawURLEncoding
+	signing := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signing + "." + enc.EncodeToString(sig), nil
+}
+
+// serviceAccount 服务账号令牌文件，即 /var/run/secrets/kubernetes.io/serviceaccount/token
+func serviceAccount(c canary, opts Options) (*Artifact, error) {
+	token, err := serviceAccountJWT(c, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Artifact{
+		Kind:     KindServiceAccount,
+		CanaryID: c.String(),
+		Content:  token,
+		Keys:     []string{TokenKey(token)},
+	}, nil
+}
+
+// kubeconfig 指向 Apiserver 蜜罐的 kubeconfig，使用服务账号令牌认证
+func kubeconfig(c canary, opts Options) (*Artifact, error) {
+	token, err := serviceAccountJWT(c, opts)
+	if err != nil {
+		return nil, err
+	}
+	ca, _, err := newCA("kubernetes", 10*365*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := "kubernetes"
+	user := opts.ServiceAccount
+	content := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    certificate-authority-data: %s
+    server: %s
+  name: %s
+contexts:
+- context:
+    cluster: %s
+    namespace: %s
+    user: %s
+  name: %s@%s
+current-context: %s@%s
+preferences: {}
+users:
+- name: %s
+  user:
+    token: %s
+`, base64.StdEncoding.EncodeToString(ca.pem), opts.APIServer, cluster,
+		cluster, opts.Namespace, user, user, cluster,
+		user, cluster,
+		user, token)
+
+	return &Artifact{
+		Kind:     KindKubeconfig,
+		CanaryID: c.String(),
+		Content:  content,
+		Keys:     []string{TokenKey(token)},
+	}, nil
+}
@@ -0,0 +1,34 @@
+package honeytoken
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sshKey OpenSSH 格式的 ed25519 私钥，公钥注释中带有 canary 前缀
+func sshKey(c canary, opts Options) (*Artifact, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := "deploy@" + opts.Host + "-" + c.String()[:8]
+	block, err := ssh.MarshalPrivateKey(priv, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Artifact{
+		Kind:     KindSSH,
+		CanaryID: c.String(),
+		Content:  string(pem.EncodeToMemory(block)),
+		Keys:     []string{SSHKey(ssh.FingerprintSHA256(sshPub))},
+	}, nil
+}
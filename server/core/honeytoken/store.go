@@ -0,0 +1,167 @@
+package honeytoken
+
+import (
+	"KubePot/core/dbUtil"
+	"KubePot/core/event"
+	"KubePot/core/models"
+	"KubePot/utils/cache"
+	"KubePot/utils/log"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 请求内容中的云厂商 AccessKeyId，例如 AWS 签名头中的 Credential=AKIA...
+var accessKeyRegex = regexp.MustCompile(`\b(AKIA[A-Z2-7]{16}|LTAI[A-Za-z0-9]{12,20})\b`)
+
+// Plant 返回密标部署到 Agent 的诱饵凭据，没有时生成并保存，同一密标在同一 Agent 上只生成一次
+func Plant(labelID int64, labelName string, kind string, agentName string, opts Options) (*models.KubePotHoneytoken, error) {
+	db := dbUtil.GORM()
+
+	var token models.KubePotHoneytoken
+	err := db.Where("secret_label_id = ? AND agent_name = ? AND kind = ?", labelID, agentName, kind).First(&token).Error
+	if err == nil {
+		return &token, nil
+	}
+
+	artifact, err := Generate(kind, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	token = models.KubePotHoneytoken{
+		CanaryID:        artifact.CanaryID,
+		SecretLabelID:   labelID,
+		SecretLabelName: labelName,
+		AgentName:       agentName,
+		Kind:            kind,
+		Content:         artifact.Content,
+		CreateTime:      time.Now(),
+	}
+	if err := save(&token, artifact.Keys); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Issue 生成并保存一份不属于密标的诱饵凭据，owner 为部署位置，告警中显示为部署主机
+// 每次调用都生成新凭据，轮换后旧凭据仍保留，被使用时照常告警
+func Issue(kind string, owner string, description string, opts Options) (*models.KubePotHoneytoken, error) {
+	artifact, err := Generate(kind, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	token := models.KubePotHoneytoken{
+		CanaryID:        artifact.CanaryID,
+		SecretLabelName: description,
+		AgentName:       owner,
+		Kind:            kind,
+		Content:         artifact.Content,
+		CreateTime:      time.Now(),
+	}
+	if err := save(&token, artifact.Keys); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// save 在一个事务中保存诱饵凭据和查找键
+func save(token *models.KubePotHoneytoken, keys []string) error {
+	return dbUtil.GORM().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(token).Error; err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := tx.Create(&models.KubePotHoneytokenKey{CanaryID: token.CanaryID, KeyHash: Hash(key)}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Resolve 按查找键找到诱饵凭据
+func Resolve(keys []string) (*models.KubePotHoneytoken, bool) {
+	if len(keys) == 0 {
+		return nil, false
+	}
+	hashes := make([]string, len(keys))
+	for i, key := range keys {
+		hashes[i] = Hash(key)
+	}
+
+	db := dbUtil.GORM()
+	var key models.KubePotHoneytokenKey
+	if err := db.Where("key_hash IN ?", hashes).First(&key).Error; err != nil {
+		return nil, false
+	}
+	var token models.KubePotHoneytoken
+	if err := db.Where("canary_id = ?", key.CanaryID).First(&token).Error; err != nil {
+		return nil, false
+	}
+	return &token, true
+}
+
+// EventKeys 攻击事件中可能是诱饵凭据的查找键
+func EventKeys(ev *event.Event) []string {
+	var keys []string
+	if c := ev.Credentials; c != nil {
+		if c.Token != "" {
+			keys = append(keys, TokenKey(c.Token))
+		}
+		if c.Password != "" {
+			keys = append(keys, PasswordKey(c.Password))
+		}
+		if c.PublicKey != "" {
+			keys = append(keys, SSHKey(c.PublicKey))
+		}
+		if c.Certificate != "" {
+			keys = append(keys, CertFingerprintKey(c.Certificate))
+		}
+	}
+
+	text := ev.Command + "\n" + ev.Detail
+	if ev.Request != nil {
+		text += "\n" + ev.Request.URI + "\n" + ev.Request.Raw
+	}
+	for _, id := range accessKeyRegex.FindAllString(text, -1) {
+		keys = append(keys, AccessKey(id))
+	}
+	return keys
+}
+
+// Check 攻击事件使用了诱饵凭据时生成告警，告警中带有密标和部署该凭据的 Agent
+// 同一凭据同一来源在缓存有效期内只告警一次
+func Check(agentName string, ev *event.Event) {
+	token, ok := Resolve(EventKeys(ev))
+	if !ok {
+		return
+	}
+
+	throttle := "honeytoken:" + token.CanaryID + ":" + ev.SourceIP
+	if _, ok := cache.Get(throttle); ok {
+		return
+	}
+	cache.Set(throttle, true)
+
+	now := time.Now()
+	alert := models.KubePotSecretLabelAlert{
+		SecretLabelID:   strconv.FormatInt(token.SecretLabelID, 10),
+		SecretLabelName: token.SecretLabelName,
+		Agent:           token.AgentName,
+		IP:              ev.SourceIP,
+		AccessTime:      now.Format("2006-01-02 15:04:05"),
+		AccessContent: fmt.Sprintf("[high][honeytoken_used] %s 凭据 (canary: %s, 部署于 %s) 在 %s 的 %s 蜜罐被使用",
+			token.Kind, token.CanaryID, token.AgentName, agentName, ev.Protocol),
+		CreateTime: now,
+	}
+	if err := dbUtil.GORM().Create(&alert).Error; err != nil {
+		log.Pr("KubePot", "127.0.0.1", "插入蜜标告警失败", err)
+		return
+	}
+	log.Pr("KubePot", ev.SourceIP, "诱饵凭据被使用", alert.AccessContent)
+}
@@ -0,0 +1,94 @@
+package kube
+
+import (
+	"KubePot/core/models"
+	"KubePot/utils/cache"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Timeout 访问集群的超时时间
+const Timeout = 15 * time.Second
+
+// UserAgent 服务端访问集群时使用的 User-Agent
+const UserAgent = "kubepot-server"
+
+// NewClient 按集群的 Apiserver 地址和 Token 创建客户端，可替换为指向本地模拟 Apiserver 的客户端
+var NewClient = func(cluster models.KubePotK8s) (kubernetes.Interface, error) {
+	return kubernetes.NewForConfig(&rest.Config{
+		Host:        cluster.ApiServer,
+		BearerToken: cluster.Token,
+		// 蜜罐集群一般使用自签名证书
+		TLSClientConfig: rest.TLSClientConfig{Insecure: true},
+		Timeout:         Timeout,
+		UserAgent:       UserAgent,
+	})
+}
+
+// Username 集群 Token 认证后的用户名，审计日志中据此识别服务端自身的操作，User-Agent 可以伪造，不能用于识别
+// 优先通过 SelfSubjectReview 查询，集群版本低于 1.28 时从 ServiceAccount Token 中读取，结果按集群和 Token 缓存
+func Username(cluster models.KubePotK8s) (string, error) {
+	sum := sha256.Sum256([]byte(cluster.Token))
+	key := fmt.Sprintf("k8s_user:%d:%s", cluster.ID, hex.EncodeToString(sum[:8]))
+	if name, ok := cache.Get(key); ok {
+		return name.(string), nil
+	}
+
+	name, err := selfSubject(cluster)
+	if err != nil {
+		var ok bool
+		if name, ok = tokenSubject(cluster.Token); !ok {
+			return "", err
+		}
+	}
+	cache.Set(key, name)
+	return name, nil
+}
+
+func selfSubject(cluster models.KubePotK8s) (string, error) {
+	client, err := NewClient(cluster)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	review, err := client.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if err != nil {
+		return "", err
+	}
+	if review.Status.UserInfo.Username == "" {
+		return "", fmt.Errorf("empty username in SelfSubjectReview")
+	}
+	return review.Status.UserInfo.Username, nil
+}
+
+// tokenSubject ServiceAccount Token 为 JWT，sub 即认证后的用户名，Token 由管理员配置，不需要校验签名
+func tokenSubject(token string) (string, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", false
+	}
+	var claims struct {
+		Sub string `json:"sub"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || !strings.HasPrefix(claims.Sub, "system:serviceaccount:") {
+		return "", false
+	}
+	return claims.Sub, true
+}
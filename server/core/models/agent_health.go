@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Agent 在线状态
+const (
+	AgentOnline  = "online"
+	AgentStale   = "stale"
+	AgentOffline = "offline"
+)
+
+// KubePotAgentHealth Agent 最近一次心跳，服务端据此判断 Agent 是否在线
+type KubePotAgentHealth struct {
+	ID        int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	AgentName string `gorm:"column:agent_name;size:64;uniqueIndex" json:"agent_name"`
+	AgentIP   string `gorm:"column:agent_ip;size:64" json:"agent_ip"`
+	HostName  string `gorm:"column:host_name;size:255" json:"host_name"`
+	NodeType  string `gorm:"column:node_type;size:16" json:"node_type"`
+	Version   string `gorm:"column:version;size:32" json:"version"`
+	// Uptime Agent 运行时长，单位秒
+	Uptime    int64     `gorm:"column:uptime" json:"uptime"`
+	StartTime time.Time `gorm:"column:start_time" json:"start_time"`
+	// Services 各蜜罐服务的监听状态，JSON 数组
+	Services      string    `gorm:"column:services;type:text" json:"services"`
+	SpoolDepth    int64     `gorm:"column:spool_depth" json:"spool_depth"`
+	SpoolDropped  int64     `gorm:"column:spool_dropped" json:"spool_dropped"`
+	State         string    `gorm:"column:state;size:16;index" json:"state"`
+	LastHeartbeat time.Time `gorm:"column:last_heartbeat;index" json:"last_heartbeat"`
+}
+
+func (KubePotAgentHealth) TableName() string {
+	return "kubepot_agent_health"
+}
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// Agent 注册密钥状态，reset 为管理员重置后等待同名 Agent 重新注册
+const (
+	AgentKeyActive  = "active"
+	AgentKeyRevoked = "revoked"
+	AgentKeyReset   = "reset"
+)
+
+// KubePotAgentKey Agent 注册后与服务端共享的 HMAC 签名密钥
+type KubePotAgentKey struct {
+	ID         int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	AgentName  string    `gorm:"column:agent_name;size:64;uniqueIndex" json:"agent_name"`
+	AgentIP    string    `gorm:"column:agent_ip;size:64" json:"agent_ip"`
+	HostName   string    `gorm:"column:host_name;size:255" json:"host_name"`
+	Secret     string    `gorm:"column:secret;size:64" json:"-"`
+	Status     string    `gorm:"column:status;size:16" json:"status"`
+	CreateTime time.Time `gorm:"column:create_time" json:"create_time"`
+	UpdateTime time.Time `gorm:"column:update_time" json:"update_time"`
+}
+
+func (KubePotAgentKey) TableName() string {
+	return "kubepot_agent_key"
+}
+
+// KubePotEnrollToken 一次性注册令牌，Agent 使用后即失效
+type KubePotEnrollToken struct {
+	ID         int64      `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	TokenID    string     `gorm:"column:token_id;size:32;uniqueIndex" json:"token_id"`
+	Secret     string     `gorm:"column:secret;size:64" json:"-"`
+	Remark     string     `gorm:"column:remark;size:255" json:"remark"`
+	UsedBy     string     `gorm:"column:used_by;size:64" json:"used_by"`
+	UsedTime   *time.Time `gorm:"column:used_time" json:"used_time"`
+	ExpireTime time.Time  `gorm:"column:expire_time" json:"expire_time"`
+	CreateTime time.Time  `gorm:"column:create_time" json:"create_time"`
+
+	// NamePrefix 非空时令牌可被名称以此开头的多个 Agent 重复使用直到过期，用于部署到集群的蜜罐 Pod
+	NamePrefix string `gorm:"column:name_prefix;size:64" json:"name_prefix"`
+}
+
+func (KubePotEnrollToken) TableName() string {
+	return "kubepot_enroll_token"
+}
+
+// KubePotAgentEvent 已处理的 Agent 事件，Agent 重发时据此去重，并把事件 ID 映射为数据库记录
+type KubePotAgentEvent struct {
+	ID         int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	AgentName  string    `gorm:"column:agent_name;size:64;uniqueIndex:idx_agent_event" json:"agent_name"`
+	EventID    string    `gorm:"column:event_id;size:64;uniqueIndex:idx_agent_event" json:"event_id"`
+	RecordID   string    `gorm:"column:record_id;size:32" json:"record_id"`
+	CreateTime time.Time `gorm:"column:create_time" json:"create_time"`
+}
+
+func (KubePotAgentEvent) TableName() string {
+	return "kubepot_agent_event"
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// KubePotAttackEvent Agent 上报的结构化攻击事件，按协议、类型、来源和会话筛选统计
+type KubePotAttackEvent struct {
+	ID         int64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	EventID    string    `gorm:"column:event_id;size:64;index" json:"event_id"`
+	Version    int       `gorm:"column:version" json:"version"`
+	AgentName  string    `gorm:"column:agent_name;size:64;index" json:"agent_name"`
+	Protocol   string    `gorm:"column:protocol;size:32;index" json:"protocol"`
+	Kind       string    `gorm:"column:kind;size:16;index" json:"kind"`
+	SourceIP   string    `gorm:"column:source_ip;size:64;index" json:"source_ip"`
+	SourcePort int       `gorm:"column:source_port" json:"source_port"`
+	DestPort   int       `gorm:"column:dest_port" json:"dest_port"`
+	SessionID  string    `gorm:"column:session_id;size:64;index" json:"session_id"`
+	Username   string    `gorm:"column:username;size:255" json:"username"`
+	Password   string    `gorm:"column:password;size:255" json:"password"`
+	Token      string    `gorm:"column:token;type:text" json:"token"`
+	Command    string    `gorm:"column:command;type:text" json:"command"`
+	Method     string    `gorm:"column:method;size:16" json:"method"`
+	URI        string    `gorm:"column:uri;type:text" json:"uri"`
+	UserAgent  string    `gorm:"column:user_agent;size:255" json:"user_agent"`
+	RawRequest string    `gorm:"column:raw_request;type:text" json:"raw_request"`
+	File       string    `gorm:"column:file;size:255" json:"file"`
+	Detail     string    `gorm:"column:detail;type:text" json:"detail"`
+	EventTime  time.Time `gorm:"column:event_time;index" json:"event_time"`
+	CreateTime time.Time `gorm:"column:create_time" json:"create_time"`
+}
+
+func (KubePotAttackEvent) TableName() string {
+	return "kubepot_attack_event"
+}
+
+// KubePotAttackSession 攻击者的一次连接，关联该连接内的所有攻击事件
+type KubePotAttackSession struct {
+	ID          int64      `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	SessionID   string     `gorm:"column:session_id;size:64;uniqueIndex" json:"session_id"`
+	AgentName   string     `gorm:"column:agent_name;size:64;index" json:"agent_name"`
+	Protocol    string     `gorm:"column:protocol;size:32;index" json:"protocol"`
+	SourceIP    string     `gorm:"column:source_ip;size:64;index" json:"source_ip"`
+	SourcePort  int        `gorm:"column:source_port" json:"source_port"`
+	DestPort    int        `gorm:"column:dest_port" json:"dest_port"`
+	StartTime   time.Time  `gorm:"column:start_time;index" json:"start_time"`
+	EndTime     *time.Time `gorm:"column:end_time" json:"end_time"`
+	LastTime    time.Time  `gorm:"column:last_time" json:"last_time"`
+	BytesIn     int64      `gorm:"column:bytes_in" json:"bytes_in"`
+	BytesOut    int64      `gorm:"column:bytes_out" json:"bytes_out"`
+	Requests    int64      `gorm:"column:requests" json:"requests"`
+	Events      int64      `gorm:"column:events" json:"events"`
+	CloseReason string     `gorm:"column:close_reason;size:255" json:"close_reason"`
+}
+
+func (KubePotAttackSession) TableName() string {
+	return "kubepot_attack_session"
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// KubePotHoneypodDeployment 部署到蜜罐集群中的 Agent 工作负载
+type KubePotHoneypodDeployment struct {
+	ID        int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	K8sID     int64  `gorm:"column:k8s_id;index" json:"k8s_id"`
+	K8sName   string `gorm:"column:k8s_name;size:255" json:"k8s_name"`
+	Namespace string `gorm:"column:namespace;size:253" json:"namespace"`
+	Name      string `gorm:"column:name;size:63" json:"name"`
+	// Workload 工作负载类型，deployment 或 daemonset
+	Workload string `gorm:"column:workload;size:16" json:"workload"`
+	Image    string `gorm:"column:image;size:255" json:"image"`
+	Replicas int32  `gorm:"column:replicas" json:"replicas"`
+	// Ports 以逗号分隔的蜜罐端口，Service 暴露这些端口
+	Ports       string `gorm:"column:ports;size:255" json:"ports"`
+	ServiceType string `gorm:"column:service_type;size:16" json:"service_type"`
+	// EnrollTokenID Pod 使用的注册令牌，卸载时删除
+	EnrollTokenID string `gorm:"column:enroll_token_id;size:32" json:"enroll_token_id"`
+	// Status 发布状态，Ready 和 Desired 为可用和期望的 Pod 数
+	Status     string    `gorm:"column:status;size:16" json:"status"`
+	Ready      int32     `gorm:"column:ready" json:"ready"`
+	Desired    int32     `gorm:"column:desired" json:"desired"`
+	Message    string    `gorm:"column:message;size:1024" json:"message"`
+	CreateTime time.Time `gorm:"column:create_time" json:"create_time"`
+	UpdateTime time.Time `gorm:"column:update_time" json:"update_time"`
+}
+
+func (KubePotHoneypodDeployment) TableName() string {
+	return "kubepot_honeypod_deployment"
+}
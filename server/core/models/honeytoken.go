@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// KubePotHoneytoken 部署到某个 Agent 的诱饵凭据，同一密标在每个 Agent 上各生成一份
+type KubePotHoneytoken struct {
+	ID            int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	CanaryID      string `gorm:"column:canary_id;size:32;uniqueIndex" json:"canary_id"`
+	SecretLabelID int64  `gorm:"column:secret_label_id;index:idx_label_agent" json:"secret_label_id"`
+	// SecretLabelName 密标删除后仍能在告警中显示名称
+	SecretLabelName string    `gorm:"column:secret_label_name;size:255" json:"secret_label_name"`
+	AgentName       string    `gorm:"column:agent_name;size:64;index:idx_label_agent" json:"agent_name"`
+	Kind            string    `gorm:"column:kind;size:32" json:"kind"`
+	Content         string    `gorm:"column:content;type:text" json:"-"`
+	CreateTime      time.Time `gorm:"column:create_time" json:"create_time"`
+}
+
+func (KubePotHoneytoken) TableName() string {
+	return "kubepot_honeytoken"
+}
+
+// KubePotHoneytokenKey 诱饵凭据被使用时能观察到的查找键，只保存哈希
+type KubePotHoneytokenKey struct {
+	ID       int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	CanaryID string `gorm:"column:canary_id;size:32;index" json:"canary_id"`
+	KeyHash  string `gorm:"column:key_hash;size:64;uniqueIndex" json:"key_hash"`
+}
+
+func (KubePotHoneytokenKey) TableName() string {
+	return "kubepot_honeytoken_key"
+}
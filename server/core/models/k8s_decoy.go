@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// KubePotK8sDecoy 部署到蜜罐集群中的诱饵对象
+type KubePotK8sDecoy struct {
+	ID      int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	K8sID   int64  `gorm:"column:k8s_id;index" json:"k8s_id"`
+	K8sName string `gorm:"column:k8s_name;size:255" json:"k8s_name"`
+	// Kind 对象类型，secret、configmap 或 serviceaccount
+	Kind      string `gorm:"column:kind;size:32" json:"kind"`
+	Namespace string `gorm:"column:namespace;size:253" json:"namespace"`
+	Name      string `gorm:"column:name;size:253" json:"name"`
+	// TokenKind 对象中诱饵凭据的类型，见 honeytoken.Kinds
+	TokenKind string `gorm:"column:token_kind;size:32" json:"token_kind"`
+	// CanaryID 当前诱饵凭据，轮换后更新
+	CanaryID   string    `gorm:"column:canary_id;size:32" json:"canary_id"`
+	Status     string    `gorm:"column:status;size:16" json:"status"`
+	Error      string    `gorm:"column:error;size:1024" json:"error"`
+	CreateTime time.Time `gorm:"column:create_time" json:"create_time"`
+	UpdateTime time.Time `gorm:"column:update_time" json:"update_time"`
+}
+
+func (KubePotK8sDecoy) TableName() string {
+	return "kubepot_k8s_decoy"
+}
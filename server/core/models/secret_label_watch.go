@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// KubePotSecretLabelWatch Agent 上报的密标文件监控状态
+type KubePotSecretLabelWatch struct {
+	ID            int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	AgentName     string `gorm:"column:agent_name;size:64;uniqueIndex:idx_agent_label" json:"agent_name"`
+	SecretLabelID int    `gorm:"column:secret_label_id;uniqueIndex:idx_agent_label" json:"secret_label_id"`
+	FilePath      string `gorm:"column:file_path;size:1024" json:"file_path"`
+	Status        string `gorm:"column:status;size:16" json:"status"`
+	Error         string `gorm:"column:error;size:1024" json:"error"`
+	// Mode Agent 使用的监控方式，fanotify 或 poll
+	Mode       string    `gorm:"column:mode;size:16" json:"mode"`
+	UpdateTime time.Time `gorm:"column:update_time" json:"update_time"`
+}
+
+func (KubePotSecretLabelWatch) TableName() string {
+	return "kubepot_secret_label_watch"
+}
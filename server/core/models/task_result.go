@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// KubePotTaskResult Agent 上报的任务处理结果，每次上报一条
+type KubePotTaskResult struct {
+	ID        int64  `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	TaskID    int64  `gorm:"column:task_id;index" json:"task_id"`
+	AgentName string `gorm:"column:agent_name;size:64" json:"agent_name"`
+	Status    string `gorm:"column:status;size:16" json:"status"`
+	// Result 处理结果，JSON 对象，失败时包含 error
+	Result     string    `gorm:"column:result;type:text" json:"result"`
+	CreateTime time.Time `gorm:"column:create_time" json:"create_time"`
+}
+
+func (KubePotTaskResult) TableName() string {
+	return "kubepot_task_result"
+}
@@ -0,0 +1,126 @@
+package push
+
+import (
+	"sync"
+	"time"
+)
+
+// Message 推送给 Agent 的一条消息，Agent 处理后按 ID 确认
+type Message struct {
+	ID   string
+	Type string
+	Data []byte
+	// sent 最近一次发送时间，超时未确认时重发
+	sent time.Time
+}
+
+// Stream 一个 Agent 的推送连接，同一 Agent 重新连接时旧连接被关闭
+type Stream struct {
+	agent string
+	wake  chan struct{}
+	done  chan struct{}
+
+	mu      sync.Mutex
+	pending map[string]*Message
+}
+
+var (
+	mu      sync.Mutex
+	streams = make(map[string]*Stream)
+)
+
+// Subscribe 为 Agent 建立推送连接，并立即唤醒一次以推送当前的任务和配置
+func Subscribe(agent string) *Stream {
+	s := &Stream{
+		agent:   agent,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		pending: make(map[string]*Message),
+	}
+	s.wake <- struct{}{}
+
+	mu.Lock()
+	old := streams[agent]
+	streams[agent] = s
+	mu.Unlock()
+	if old != nil {
+		close(old.done)
+	}
+	return s
+}
+
+// Close 连接断开时注销，已被新连接替换时不做处理
+func (s *Stream) Close() {
+	mu.Lock()
+	defer mu.Unlock()
+	if streams[s.agent] == s {
+		delete(streams, s.agent)
+	}
+}
+
+// Wake 有新任务或配置变更时可读
+func (s *Stream) Wake() <-chan struct{} {
+	return s.wake
+}
+
+// Done 连接被同一 Agent 的新连接替换时关闭
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Sent 记录已发送、等待确认的消息
+func (s *Stream) Sent(msg *Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg.sent = time.Now()
+	s.pending[msg.ID] = msg
+}
+
+// Unacked 返回发送超过 timeout 仍未确认的消息
+func (s *Stream) Unacked(timeout time.Duration) []*Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []*Message
+	for _, msg := range s.pending {
+		if time.Since(msg.sent) >= timeout {
+			result = append(result, msg)
+		}
+	}
+	return result
+}
+
+// Notify 通知 Agent 有新任务或配置变更，Agent 未连接时等待其下次轮询
+func Notify(agent string) {
+	mu.Lock()
+	s := streams[agent]
+	mu.Unlock()
+	if s == nil {
+		return
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Ack Agent 确认已处理消息，返回消息是否存在
+func Ack(agent string, id string) bool {
+	mu.Lock()
+	s := streams[agent]
+	mu.Unlock()
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.pending[id]
+	delete(s.pending, id)
+	return ok
+}
+
+// Connected Agent 当前是否有推送连接
+func Connected(agent string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return streams[agent] != nil
+}
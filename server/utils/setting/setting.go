@@ -2,6 +2,7 @@ package setting
 
 import (
 	"KubePot/core/dbUtil"
+	"KubePot/core/heartbeat"
 	"KubePot/core/rpc/server"
 	"KubePot/utils/color"
 	"KubePot/utils/conf"
@@ -137,6 +138,9 @@ func Run() {
 	// 初始化缓存
 	initCahe()
 
+	// 检查 Agent 心跳，超时未上报时告警
+	go heartbeat.Watch()
+
 	// 启动 admin 管理后台
 	adminAddr := conf.Get("admin", "addr")
 
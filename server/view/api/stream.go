@@ -0,0 +1,133 @@
+package api
+
+import (
+	"KubePot/core/push"
+	"KubePot/core/report"
+	"KubePot/utils/log"
+	"KubePot/view/enroll"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// streamPing 心跳间隔，让中间的代理和 Agent 知道连接仍然可用
+	streamPing = 25 * time.Second
+	// streamAckTimeout 推送后超过该时间未确认的消息随下一次心跳重发
+	streamAckTimeout = 30 * time.Second
+	// streamWriteTimeout 单条消息的写超时，管理后台的 WriteTimeout 不适用于长连接
+	streamWriteTimeout = 10 * time.Second
+)
+
+// streamMessage 推送连接上的一行 JSON
+type streamMessage struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	Signature string          `json:"signature"`
+}
+
+// AgentStream Agent 的推送连接，新任务和配置变更立即推送，Agent 处理后通过 AckStream 确认
+// 连接断开期间 Agent 按原来的方式轮询
+func AgentStream(c *gin.Context) {
+	agentName := enroll.AgentName(c)
+
+	// 长连接不受管理后台读写超时的限制，每条消息单独设置写超时
+	rc := http.NewResponseController(c.Writer)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		log.Pr("API", c.ClientIP(), "推送连接设置超时失败", err)
+	}
+
+	s := push.Subscribe(agentName)
+	defer s.Close()
+	log.Pr("API", c.ClientIP(), "Agent 推送连接建立", agentName)
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	write := func(msg *push.Message) error {
+		line, err := json.Marshal(streamMessage{
+			ID:        msg.ID,
+			Type:      msg.Type,
+			Data:      msg.Data,
+			Signature: enroll.SignMessage(c, msg.ID, msg.Type, msg.Data),
+		})
+		if err != nil {
+			return err
+		}
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := c.Writer.Write(append(line, '\n')); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	send := func(typ string, data interface{}) error {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		msg := &push.Message{ID: messageID(), Type: typ, Data: raw}
+		if err := write(msg); err != nil {
+			return err
+		}
+		s.Sent(msg)
+		return nil
+	}
+
+	// 本连接最近一次推送的配置，未变化时不重复推送
+	var lastConfig map[string]interface{}
+
+	ticker := time.NewTicker(streamPing)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-c.Request.Context().Done():
+			log.Pr("API", c.ClientIP(), "Agent 推送连接断开", agentName)
+			return
+		case <-s.Done():
+			log.Pr("API", c.ClientIP(), "Agent 推送连接被新连接替换", agentName)
+			return
+		case <-s.Wake():
+			var tasks TaskList
+			tasks, err = pendingTasks(agentName)
+			if err != nil {
+				log.Pr("API", "127.0.0.1", "获取任务列表失败", err)
+				err = nil
+			} else if len(tasks.Tasks) > 0 {
+				err = send("tasks", tasks)
+			}
+			if config := report.GetAgentConfig(agentName); err == nil && (lastConfig == nil || !configEqual(lastConfig, config)) {
+				if err = send("config", config); err == nil {
+					lastConfig = config
+				}
+			}
+		case <-ticker.C:
+			for _, msg := range s.Unacked(streamAckTimeout) {
+				if err = write(msg); err != nil {
+					break
+				}
+				s.Sent(msg)
+			}
+			if err == nil {
+				err = write(&push.Message{ID: messageID(), Type: "ping", Data: []byte("{}")})
+			}
+		}
+		if err != nil {
+			log.Pr("API", c.ClientIP(), "Agent 推送失败", err)
+			return
+		}
+	}
+}
+
+func messageID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
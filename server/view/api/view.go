@@ -2,14 +2,20 @@ package api
 
 import (
 	"KubePot/core/dbUtil"
+	"KubePot/core/event"
+	"KubePot/core/heartbeat"
+	"KubePot/core/honeytoken"
 	"KubePot/core/models"
+	"KubePot/core/push"
 	"KubePot/core/report"
 	"KubePot/core/rpc/client"
 	"KubePot/error"
 	"KubePot/utils/conf"
 	"KubePot/utils/is"
 	"KubePot/utils/log"
+	"KubePot/view/enroll"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -17,6 +23,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func ReportWeb(c *gin.Context) {
@@ -70,16 +77,26 @@ func ReportAgentStatus(c *gin.Context) {
 		ES        string `json:"es"`
 		TFtp      string `json:"tftp"`
 		Vnc       string `json:"vnc"`
+		// Agent 本地上报队列的积压和丢弃数
+		SpoolDepth   string `json:"spool_depth"`
+		SpoolDropped string `json:"spool_dropped"`
 	}
 
 	err := c.BindJSON(&status)
 	if err != nil {
+		// 格式错误的上报返回 ErrFailPlugCode，Agent 据此丢弃而不是重试
 		c.JSON(http.StatusOK, gin.H{
-			"code": error.ErrFailCode,
+			"code": error.ErrFailPlugCode,
 			"msg":  "参数错误: " + err.Error(),
 		})
 		return
 	}
+	// 以签名的 Agent 为准，不信任请求体中的名称
+	status.AgentName = enroll.AgentName(c)
+
+	if status.SpoolDropped != "" && status.SpoolDropped != "0" {
+		log.Pr("API", c.ClientIP(), "Agent 上报队列有丢弃", fmt.Sprintf("agent: %s, 积压: %s, 丢弃: %s", status.AgentName, status.SpoolDepth, status.SpoolDropped))
+	}
 
 	go report.ReportAgentStatus(
 		status.AgentName,
@@ -103,6 +120,71 @@ func ReportAgentStatus(c *gin.Context) {
 	})
 }
 
+// ReportHeartbeat 接收 Agent 心跳
+func ReportHeartbeat(c *gin.Context) {
+	var hb heartbeat.Heartbeat
+	if err := c.BindJSON(&hb); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+	hb.AgentName = enroll.AgentName(c)
+
+	if err := heartbeat.Record(&hb); err != nil {
+		log.Pr("API", c.ClientIP(), "保存Agent心跳失败", err)
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  error.ErrFailMsg,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": error.ErrSuccessCode,
+		"msg":  error.ErrSuccessMsg,
+	})
+}
+
+// AckStream Agent 确认已处理推送的消息
+func AckStream(c *gin.Context) {
+	var ack struct {
+		ID string `json:"id"`
+	}
+	if err := c.BindJSON(&ack); err != nil || ack.ID == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "参数错误",
+		})
+		return
+	}
+
+	if !push.Ack(enroll.AgentName(c), ack.ID) {
+		log.Pr("API", c.ClientIP(), "未知的推送确认", ack.ID)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": error.ErrSuccessCode,
+		"msg":  error.ErrSuccessMsg,
+	})
+}
+
+// GetAgentHealthList 获取所有 Agent 的心跳状态
+func GetAgentHealthList(c *gin.Context) {
+	var result []models.KubePotAgentHealth
+	err := dbUtil.GORM().Order("agent_name").Find(&result).Error
+
+	if err != nil {
+		log.Pr("API", "127.0.0.1", "获取Agent心跳状态失败", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": error.ErrSuccessCode,
+		"msg":  error.ErrSuccessMsg,
+		"data": result,
+	})
+}
+
 func ControlService(c *gin.Context) {
 	var cmd struct {
 		AgentName string `json:"agent_name"`
@@ -188,16 +270,74 @@ func ReportAgentResult(c *gin.Context) {
 		SourceIp    string `json:"source_ip"`
 		Info        string `json:"info"`
 		Id          string `json:"id"`
+		// EventId 幂等键，RefId 为更新时关联的创建事件
+		EventId string `json:"event_id"`
+		RefId   string `json:"ref_id"`
+		// Event 结构化事件，旧版 Agent 只上报 Info
+		Event *event.Event `json:"event"`
 	}
 
 	err := c.BindJSON(&result)
 	if err != nil {
+		// 格式错误的上报返回 ErrFailPlugCode，Agent 据此丢弃而不是重试
 		c.JSON(http.StatusOK, gin.H{
-			"code": error.ErrFailCode,
+			"code": error.ErrFailPlugCode,
 			"msg":  "参数错误: " + err.Error(),
 		})
 		return
 	}
+	result.AgentName = enroll.AgentName(c)
+
+	// Agent 重发的事件直接返回之前的结果
+	if recordID, ok := enroll.Lookup(c, result.EventId); ok {
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrSuccessCode,
+			"msg":  error.ErrSuccessMsg,
+			"data": recordID,
+		})
+		return
+	}
+
+	if result.RefId != "" {
+		recordID, ok := enroll.Lookup(c, result.RefId)
+		if !ok || recordID == "" {
+			c.JSON(http.StatusOK, gin.H{
+				"code": error.ErrFailPlugCode,
+				"msg":  "关联的事件不存在: " + result.RefId,
+			})
+			return
+		}
+		result.Id = recordID
+	} else if result.Id == "" {
+		result.Id = "0"
+	}
+
+	if ev := result.Event; ev != nil {
+		if ev.Version > event.Version {
+			log.Pr("API", c.ClientIP(), "Agent 事件版本高于服务端，未知字段将被忽略", fmt.Sprintf("agent: %s, version: %d", result.AgentName, ev.Version))
+		}
+		result.SourceIp = ev.SourceIP
+		if result.Info == "" {
+			result.Info = ev.Legacy(result.Id != "0")
+		}
+		saveEvent(result.AgentName, result.EventId, ev)
+		// 任一蜜罐收到的凭据都与诱饵凭据比对，追溯到密标和部署主机
+		go honeytoken.Check(result.AgentName, ev)
+		if ev.SessionID != "" {
+			saveSession(result.AgentName, ev)
+		}
+
+		// 会话开始、结束事件只更新会话，不写入各协议的上钩记录
+		if ev.Lifecycle() {
+			enroll.Remember(c, result.EventId, "")
+			c.JSON(http.StatusOK, gin.H{
+				"code": error.ErrSuccessCode,
+				"msg":  error.ErrSuccessMsg,
+				"data": "",
+			})
+			return
+		}
+	}
 
 	var idx string
 	switch result.Type {
@@ -264,6 +404,8 @@ func ReportAgentResult(c *gin.Context) {
 		go report.ReportBash(result.AgentIp, result.ProjectName, result.AgentName, "", result.Info, result.Hostname, result.NodeType)
 	}
 
+	enroll.Remember(c, result.EventId, idx)
+
 	c.JSON(http.StatusOK, gin.H{
 		"code": error.ErrSuccessCode,
 		"msg":  error.ErrSuccessMsg,
@@ -271,6 +413,89 @@ func ReportAgentResult(c *gin.Context) {
 	})
 }
 
+// saveEvent 保存结构化事件，供按协议、类型、来源和会话筛选统计
+func saveEvent(agentName string, eventID string, ev *event.Event) {
+	record := models.KubePotAttackEvent{
+		EventID:    eventID,
+		Version:    ev.Version,
+		AgentName:  agentName,
+		Protocol:   ev.Protocol,
+		Kind:       string(ev.Kind),
+		SourceIP:   ev.SourceIP,
+		SourcePort: ev.SourcePort,
+		DestPort:   ev.DestPort,
+		SessionID:  ev.SessionID,
+		Command:    ev.Command,
+		File:       ev.File,
+		Detail:     ev.Detail,
+		EventTime:  ev.Time,
+		CreateTime: time.Now(),
+	}
+	if ev.Credentials != nil {
+		record.Username = ev.Credentials.Username
+		record.Password = ev.Credentials.Password
+		record.Token = ev.Credentials.Token
+	}
+	if ev.Request != nil {
+		record.Method = ev.Request.Method
+		record.URI = ev.Request.URI
+		record.UserAgent = ev.Request.UserAgent
+		record.RawRequest = ev.Request.Raw
+	}
+	if err := dbUtil.GORM().Create(&record).Error; err != nil {
+		log.Pr("API", "127.0.0.1", "保存攻击事件失败", err)
+	}
+}
+
+// saveSession 按会话 ID 聚合事件，会话结束事件带有字节数、请求数和关闭原因
+func saveSession(agentName string, ev *event.Event) {
+	db := dbUtil.GORM()
+
+	var record models.KubePotAttackSession
+	if err := db.Where("session_id = ?", ev.SessionID).First(&record).Error; err != nil {
+		// 会话开始事件可能丢失或晚于其他事件到达，以第一个事件创建会话
+		record = models.KubePotAttackSession{
+			SessionID:  ev.SessionID,
+			AgentName:  agentName,
+			Protocol:   ev.Protocol,
+			SourceIP:   ev.SourceIP,
+			SourcePort: ev.SourcePort,
+			DestPort:   ev.DestPort,
+			StartTime:  ev.Time,
+			LastTime:   ev.Time,
+		}
+		if err := db.Create(&record).Error; err != nil {
+			log.Pr("API", "127.0.0.1", "保存攻击会话失败", err)
+			return
+		}
+	}
+
+	updates := map[string]interface{}{}
+	if ev.Time.After(record.LastTime) {
+		updates["last_time"] = ev.Time
+	}
+	if ev.Time.Before(record.StartTime) {
+		updates["start_time"] = ev.Time
+	}
+	if !ev.Lifecycle() {
+		updates["events"] = gorm.Expr("events + ?", 1)
+	}
+	if stats := ev.Session; ev.Kind == event.KindClose && stats != nil {
+		updates["start_time"] = stats.Start
+		updates["end_time"] = stats.End
+		updates["bytes_in"] = stats.BytesIn
+		updates["bytes_out"] = stats.BytesOut
+		updates["requests"] = stats.Requests
+		updates["close_reason"] = stats.CloseReason
+	}
+	if len(updates) == 0 {
+		return
+	}
+	if err := db.Model(&record).Updates(updates).Error; err != nil {
+		log.Pr("API", "127.0.0.1", "更新攻击会话失败", err)
+	}
+}
+
 type IpResult struct {
 	IP string
 }
@@ -504,6 +729,7 @@ func UpdateAgentConfig(c *gin.Context) {
 	}
 
 	log.Pr("API", "127.0.0.1", "配置更新成功", config.AgentName)
+	push.Notify(config.AgentName)
 	c.JSON(http.StatusOK, gin.H{
 		"code": error.ErrSuccessCode,
 		"msg":  error.ErrSuccessMsg,
@@ -552,6 +778,12 @@ func UninstallAgent(c *gin.Context) {
 		log.Pr("API", "127.0.0.1", "删除Kubepot_agent_config记录失败", err)
 	}
 
+	// 卸载后吊销密钥，已卸载的 Agent 再上报会被拒绝并告警
+	err = enroll.Revoke(data.AgentName)
+	if err != nil {
+		log.Pr("API", "127.0.0.1", "吊销Agent密钥失败", err)
+	}
+
 	log.Pr("API", "127.0.0.1", "卸载Agent成功", data.AgentName)
 	c.JSON(http.StatusOK, gin.H{
 		"code": error.ErrSuccessCode,
@@ -559,6 +791,117 @@ func UninstallAgent(c *gin.Context) {
 	})
 }
 
+// 由管理后台创建、参数保存在任务数据中的任务类型
+var agentTaskTypes = map[string]bool{"service": true, "config": true, "command": true}
+
+// Agent 允许执行的命令
+var agentCommands = map[string]bool{"diagnostics": true, "resync": true, "log_level": true}
+
+// agentTaskData 服务、配置和命令任务的任务数据
+type agentTaskData struct {
+	Action  string                 `json:"action"`
+	Service string                 `json:"service"`
+	Params  map[string]interface{} `json:"params"`
+}
+
+// AddAgentTask 向 Agent 下发服务、配置或命令任务
+func AddAgentTask(c *gin.Context) {
+	var req struct {
+		AgentName string `json:"agent_name"`
+		Type      string `json:"type"`
+		agentTaskData
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	msg := ""
+	switch {
+	case req.AgentName == "":
+		msg = "agent_name不能为空"
+	case !agentTaskTypes[req.Type]:
+		msg = "未知任务类型: " + req.Type
+	case req.Type == "service" && (req.Service == "" || (req.Action != "start" && req.Action != "stop")):
+		msg = "服务任务需要service和start/stop动作"
+	case req.Type == "config" && (req.Service == "" || len(req.Params) == 0):
+		msg = "配置任务需要service和params"
+	case req.Type == "command" && !agentCommands[req.Action]:
+		msg = "不允许执行的命令: " + req.Action
+	}
+	if msg != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "参数错误: " + msg,
+		})
+		return
+	}
+
+	data, _ := json.Marshal(req.agentTaskData)
+	now := time.Now()
+	task := models.KubePotTask{
+		TaskType:   req.Type,
+		TaskData:   string(data),
+		AgentName:  req.AgentName,
+		Status:     "pending",
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	if err := dbUtil.GORM().Create(&task).Error; err != nil {
+		log.Pr("API", "127.0.0.1", "创建任务失败", err)
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "创建任务失败: " + err.Error(),
+		})
+		return
+	}
+
+	log.Pr("API", "127.0.0.1", "创建任务成功", fmt.Sprintf("agent: %s, type: %s, action: %s, service: %s", req.AgentName, req.Type, req.Action, req.Service))
+	push.Notify(req.AgentName)
+	c.JSON(http.StatusOK, gin.H{
+		"code": error.ErrSuccessCode,
+		"msg":  error.ErrSuccessMsg,
+		"data": task,
+	})
+}
+
+// GetTaskResult 获取任务的状态和 Agent 上报的处理结果
+func GetTaskResult(c *gin.Context) {
+	taskID, err := strconv.ParseInt(c.Query("task_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "任务ID格式错误: " + c.Query("task_id"),
+		})
+		return
+	}
+
+	var task models.KubePotTask
+	if err := dbUtil.GORM().First(&task, taskID).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "任务不存在",
+		})
+		return
+	}
+	var results []models.KubePotTaskResult
+	if err := dbUtil.GORM().Where("task_id = ?", taskID).Order("id").Find(&results).Error; err != nil {
+		log.Pr("API", "127.0.0.1", "获取任务结果失败", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": error.ErrSuccessCode,
+		"msg":  error.ErrSuccessMsg,
+		"data": gin.H{
+			"task":    task,
+			"results": results,
+		},
+	})
+}
+
 func GetTasks(c *gin.Context) {
 	agentName := c.Query("agent")
 	if agentName == "" {
@@ -569,9 +912,7 @@ func GetTasks(c *gin.Context) {
 		return
 	}
 
-	var tasks []models.KubePotTask
-	err := dbUtil.GORM().Where("agent_name = ? AND status = ?", agentName, "pending").Find(&tasks).Error
-
+	taskList, err := pendingTasks(agentName)
 	if err != nil {
 		log.Pr("API", "127.0.0.1", "获取任务列表失败", err)
 		c.JSON(http.StatusOK, gin.H{
@@ -581,53 +922,90 @@ func GetTasks(c *gin.Context) {
 		return
 	}
 
-	// 转换为客户端期望的TaskList格式，将ID转换为字符串
-	type ClientTask struct {
-		ID        string                 `json:"id"`
-		Type      string                 `json:"type"`
-		Action    string                 `json:"action"`
-		Service   string                 `json:"service"`
-		Params    map[string]interface{} `json:"params"`
-		CreatedAt string                 `json:"created_at"`
-	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": error.ErrSuccessCode,
+		"msg":  error.ErrSuccessMsg,
+		"data": taskList,
+	})
+}
+
+// ClientTask 下发给 Agent 的任务，ID 为字符串
+type ClientTask struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	Action    string                 `json:"action"`
+	Service   string                 `json:"service"`
+	Params    map[string]interface{} `json:"params"`
+	CreatedAt string                 `json:"created_at"`
+}
 
-	type TaskList struct {
-		Tasks []ClientTask `json:"tasks"`
+// TaskList Agent 期望的任务列表格式
+type TaskList struct {
+	Tasks []ClientTask `json:"tasks"`
+}
+
+// pendingTasks 返回 Agent 待处理的任务，轮询和推送共用
+func pendingTasks(agentName string) (TaskList, error) {
+	var tasks []models.KubePotTask
+	// 按创建顺序下发，删除任务排在之前的下发任务之后
+	err := dbUtil.GORM().Where("agent_name = ? AND status = ?", agentName, "pending").Order("id").Find(&tasks).Error
+	if err != nil {
+		return TaskList{}, err
 	}
 
 	// 转换任务列表，将ID转换为字符串
 	clientTasks := make([]ClientTask, len(tasks))
 	for i, task := range tasks {
+		// 服务、配置和命令任务的动作和参数保存在任务数据中
+		if agentTaskTypes[task.TaskType] {
+			var data agentTaskData
+			if err := json.Unmarshal([]byte(task.TaskData), &data); err != nil {
+				log.Pr("API", "127.0.0.1", "解析任务数据失败", err)
+			}
+			clientTasks[i] = ClientTask{
+				ID:        strconv.FormatInt(task.ID, 10),
+				Type:      task.TaskType,
+				Action:    data.Action,
+				Service:   data.Service,
+				Params:    data.Params,
+				CreatedAt: task.CreateTime.Format("2006-01-02 15:04:05"),
+			}
+			continue
+		}
+
+		action := "create" // 默认动作
+		if task.TaskType == "secret_label_delete" {
+			action = "delete"
+		}
+
 		// 构建任务参数，确保包含task_data字段
 		params := map[string]interface{}{
 			"task_data": task.TaskData,
-			"action":    "create",      // 默认动作
+			"action":    action,
 			"service":   "secretlabel", // 默认服务
 		}
 
 		clientTasks[i] = ClientTask{
 			ID:        strconv.FormatInt(task.ID, 10),
 			Type:      task.TaskType,
-			Action:    "create",
+			Action:    action,
 			Service:   "secretlabel",
 			Params:    params,
 			CreatedAt: task.CreateTime.Format("2006-01-02 15:04:05"),
 		}
 	}
 
-	taskList := TaskList{Tasks: clientTasks}
-
-	c.JSON(http.StatusOK, gin.H{
-		"code": error.ErrSuccessCode,
-		"msg":  error.ErrSuccessMsg,
-		"data": taskList,
-	})
+	return TaskList{Tasks: clientTasks}, nil
 }
 
+// taskStatuses Agent 可以上报的任务状态
+var taskStatuses = map[string]bool{"completed": true, "failed": true}
+
 func UpdateTaskStatus(c *gin.Context) {
 	var taskStatus struct {
-		TaskID string `json:"task_id"`
-		Status string `json:"status"`
+		TaskID string          `json:"task_id"`
+		Status string          `json:"status"`
+		Result json.RawMessage `json:"result"`
 	}
 
 	err := c.BindJSON(&taskStatus)
@@ -650,20 +1028,54 @@ func UpdateTaskStatus(c *gin.Context) {
 		return
 	}
 
-	err = dbUtil.GORM().Model(&models.KubePotTask{}).Where("id = ?", taskID).Updates(map[string]interface{}{
+	if !taskStatuses[taskStatus.Status] {
+		log.Pr("API", "127.0.0.1", "任务状态不合法", taskStatus.Status)
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "任务状态不合法: " + taskStatus.Status,
+		})
+		return
+	}
+
+	// 只能更新下发给自己的任务
+	result := dbUtil.GORM().Model(&models.KubePotTask{}).Where("id = ? AND agent_name = ?", taskID, enroll.AgentName(c)).Updates(map[string]interface{}{
 		"status":      taskStatus.Status,
 		"update_time": time.Now(),
-	}).Error
+	})
 
-	if err != nil {
-		log.Pr("API", "127.0.0.1", "更新任务状态失败", err)
+	if result.Error != nil {
+		log.Pr("API", "127.0.0.1", "更新任务状态失败", result.Error)
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "更新任务状态失败: " + result.Error.Error(),
+		})
+		return
+	}
+
+	// 任务不存在或不属于该 Agent 时不保存结果
+	if result.RowsAffected == 0 {
+		log.Pr("API", "127.0.0.1", "任务不存在", fmt.Sprintf("task_id: %s, agent: %s", taskStatus.TaskID, enroll.AgentName(c)))
 		c.JSON(http.StatusOK, gin.H{
 			"code": error.ErrFailCode,
-			"msg":  "更新任务状态失败: " + err.Error(),
+			"msg":  "任务不存在: " + taskStatus.TaskID,
 		})
 		return
 	}
 
+	// 保存处理结果，旧版本 Agent 不上报结果
+	if len(taskStatus.Result) > 0 && string(taskStatus.Result) != "null" {
+		err = dbUtil.GORM().Create(&models.KubePotTaskResult{
+			TaskID:     taskID,
+			AgentName:  enroll.AgentName(c),
+			Status:     taskStatus.Status,
+			Result:     string(taskStatus.Result),
+			CreateTime: time.Now(),
+		}).Error
+		if err != nil {
+			log.Pr("API", "127.0.0.1", "保存任务结果失败", err)
+		}
+	}
+
 	log.Pr("API", "127.0.0.1", "更新任务状态成功", fmt.Sprintf("task_id: %s, status: %s", taskStatus.TaskID, taskStatus.Status))
 	c.JSON(http.StatusOK, gin.H{
 		"code": error.ErrSuccessCode,
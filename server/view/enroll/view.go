@@ -0,0 +1,565 @@
+package enroll
+
+import (
+	"KubePot/core/dbUtil"
+	"KubePot/core/models"
+	kerr "KubePot/error"
+	"KubePot/utils/cache"
+	"KubePot/utils/log"
+	"bytes"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 签名相关的请求头，与 agent 端 core/rpc/auth 一致
+const (
+	HeaderAgent     = "X-Kubepot-Agent"
+	HeaderTimestamp = "X-Kubepot-Timestamp"
+	HeaderNonce     = "X-Kubepot-Nonce"
+	HeaderSignature = "X-Kubepot-Signature"
+)
+
+const (
+	// 请求时间戳允许的误差，随机数在缓存中保留 5 分钟，足以覆盖前后两个窗口
+	maxClockSkew = 2 * time.Minute
+	// 注册令牌默认有效期
+	defaultTokenTTL = 24 * time.Hour
+	// 签名请求体大小上限
+	maxBodySize = 10 << 20
+
+	contextAgent = "enroll_agent_name"
+	// 推送连接的签名密钥和请求签名
+	contextKey       = "enroll_agent_key"
+	contextSignature = "enroll_request_signature"
+)
+
+// AgentName 返回通过签名校验的 Agent 名称，上报数据中的名称以它为准
+func AgentName(c *gin.Context) string {
+	return c.GetString(contextAgent)
+}
+
+func mac(key []byte, data string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func enrollProof(secret, name, publicKey string) string {
+	return mac([]byte(secret), "enroll\n"+name+"\n"+publicKey)
+}
+
+func deriveKey(secret string, shared []byte, name string) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(shared)
+	h.Write([]byte("\n" + name))
+	return h.Sum(nil)
+}
+
+func sign(key []byte, method, uri, timestamp, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return mac(key, strings.Join([]string{method, uri, timestamp, nonce, hex.EncodeToString(sum[:])}, "\n"))
+}
+
+func signResponse(key []byte, requestSignature string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return mac(key, "response\n"+requestSignature+"\n"+hex.EncodeToString(sum[:]))
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// 注册时令牌或 Agent 身份已被其他请求占用
+var (
+	errTokenUsed = errors.New("注册令牌已使用")
+	errNameTaken = errors.New("Agent 名称已注册")
+)
+
+// findAgentKey 按名称查询 Agent 密钥，测试中替换
+var findAgentKey = func(agentName string) (models.KubePotAgentKey, bool) {
+	var agentKey models.KubePotAgentKey
+	err := dbUtil.GORM().Where("agent_name = ?", agentName).First(&agentKey).Error
+	return agentKey, err == nil
+}
+
+// saveAlert 保存 Agent 认证告警，测试中替换
+var saveAlert = func(alert *models.KubePotSecretLabelAlert) error {
+	return dbUtil.GORM().Create(alert).Error
+}
+
+// alert 记录未注册、已吊销或签名错误的 Agent 请求。
+// 每次都写日志，同一来源 IP 5 分钟内只写入一条告警，伪造大量 Agent 名称也不会刷满告警表
+func alert(c *gin.Context, agentName string, reason string) {
+	ip := c.ClientIP()
+	log.Pr("KubePot", ip, "Agent 认证失败", fmt.Sprintf("agent: %s, %s %s: %s", agentName, c.Request.Method, c.Request.URL.Path, reason))
+
+	key := "agent_auth_alert:" + ip
+	if _, ok := cache.Get(key); ok {
+		return
+	}
+	cache.Set(key, true)
+
+	now := time.Now()
+	err := saveAlert(&models.KubePotSecretLabelAlert{
+		SecretLabelID:   "0",
+		SecretLabelName: "Agent认证失败",
+		Agent:           agentName,
+		IP:              ip,
+		AccessTime:      now.Format("2006-01-02 15:04:05"),
+		AccessContent:   "[high][agent_auth_failed] " + reason + ": " + c.Request.Method + " " + c.Request.URL.Path,
+		CreateTime:      now,
+	})
+	if err != nil {
+		log.Pr("KubePot", "127.0.0.1", "插入Agent认证告警失败", err)
+	}
+}
+
+func deny(c *gin.Context, agentName string, reason string) {
+	alert(c, agentName, reason)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+		"code": kerr.ErrFailApiKeyCode,
+		"msg":  reason,
+	})
+}
+
+// signedWriter 缓冲响应体，写出前附加响应签名，Agent 据此确认响应来自服务端
+type signedWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *signedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *signedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// Verify 校验 Agent 请求签名，未注册、已吊销、签名错误或重放的请求一律拒绝并告警
+func Verify(c *gin.Context) {
+	key, signature, ok := authenticate(c)
+	if !ok {
+		return
+	}
+
+	w := &signedWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	c.Next()
+	c.Writer = w.ResponseWriter
+
+	c.Header(HeaderSignature, signResponse(key, signature, w.body.Bytes()))
+	c.Writer.Write(w.body.Bytes())
+}
+
+// VerifyStream 与 Verify 相同地校验请求，响应不缓冲，推送的每条消息由 SignMessage 单独签名
+func VerifyStream(c *gin.Context) {
+	key, signature, ok := authenticate(c)
+	if !ok {
+		return
+	}
+	c.Set(contextKey, key)
+	c.Set(contextSignature, signature)
+	c.Next()
+}
+
+// SignMessage 计算推送消息的签名，绑定建立连接的请求签名、消息 ID 和类型
+func SignMessage(c *gin.Context, id string, typ string, data []byte) string {
+	key, _ := c.Get(contextKey)
+	k, _ := key.([]byte)
+	sum := sha256.Sum256(data)
+	return mac(k, "message\n"+c.GetString(contextSignature)+"\n"+id+"\n"+typ+"\n"+hex.EncodeToString(sum[:]))
+}
+
+// authenticate 校验请求签名并记录 Agent 名称，失败时已拒绝请求，返回签名密钥和请求签名
+func authenticate(c *gin.Context) ([]byte, string, bool) {
+	agentName := c.GetHeader(HeaderAgent)
+	timestamp := c.GetHeader(HeaderTimestamp)
+	nonce := c.GetHeader(HeaderNonce)
+	signature := c.GetHeader(HeaderSignature)
+
+	if agentName == "" || timestamp == "" || nonce == "" || signature == "" {
+		deny(c, agentName, "请求未签名")
+		return nil, "", false
+	}
+
+	agentKey, ok := findAgentKey(agentName)
+	if !ok {
+		deny(c, agentName, "Agent 未注册")
+		return nil, "", false
+	}
+	switch agentKey.Status {
+	case models.AgentKeyActive:
+	case models.AgentKeyReset:
+		deny(c, agentName, "Agent 已重置，需要重新注册")
+		return nil, "", false
+	default:
+		deny(c, agentName, "Agent 已吊销")
+		return nil, "", false
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(ts, 0)).Abs() > maxClockSkew {
+		deny(c, agentName, "请求时间戳无效")
+		return nil, "", false
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBodySize))
+	if err != nil {
+		deny(c, agentName, "读取请求体失败")
+		return nil, "", false
+	}
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	key, _ := hex.DecodeString(agentKey.Secret)
+	expected := sign(key, c.Request.Method, c.Request.URL.RequestURI(), timestamp, nonce, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		deny(c, agentName, "请求签名错误")
+		return nil, "", false
+	}
+
+	nonceKey := "agent_nonce:" + agentName + ":" + nonce
+	if _, ok := cache.Get(nonceKey); ok {
+		deny(c, agentName, "请求重放")
+		return nil, "", false
+	}
+	cache.Set(nonceKey, true)
+
+	// 查询参数中的 Agent 名称必须与签名者一致，防止读取其他 Agent 的配置和任务
+	if agent := c.Query("agent"); agent != "" && agent != agentName {
+		deny(c, agentName, "Agent 名称与签名不一致")
+		return nil, "", false
+	}
+
+	c.Set(contextAgent, agentName)
+	return key, signature, true
+}
+
+// Enroll Agent 使用一次性令牌注册，通过 X25519 协商出只有双方知道的签名密钥
+func Enroll(c *gin.Context) {
+	var req struct {
+		AgentName string `json:"agent_name"`
+		AgentIp   string `json:"agent_ip"`
+		HostName  string `json:"host_name"`
+		TokenId   string `json:"token_id"`
+		PublicKey string `json:"public_key"`
+		Proof     string `json:"proof"`
+	}
+	if err := c.BindJSON(&req); err != nil || req.AgentName == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"code": kerr.ErrFailCode,
+			"msg":  "参数错误",
+		})
+		return
+	}
+
+	var token models.KubePotEnrollToken
+	err := dbUtil.GORM().Where("token_id = ?", req.TokenId).First(&token).Error
+	reusable := token.NamePrefix != ""
+	if err != nil || (token.UsedBy != "" && !reusable) || time.Now().After(token.ExpireTime) {
+		deny(c, req.AgentName, "注册令牌无效、已使用或已过期")
+		return
+	}
+	if reusable && !strings.HasPrefix(req.AgentName, token.NamePrefix) {
+		deny(c, req.AgentName, "Agent 名称与注册令牌不匹配")
+		return
+	}
+	if !hmac.Equal([]byte(req.Proof), []byte(enrollProof(token.Secret, req.AgentName, req.PublicKey))) {
+		deny(c, req.AgentName, "注册令牌校验失败")
+		return
+	}
+
+	agentPub, err := hex.DecodeString(req.PublicKey)
+	if err != nil {
+		deny(c, req.AgentName, "Agent 公钥格式错误")
+		return
+	}
+	peer, err := ecdh.X25519().NewPublicKey(agentPub)
+	if err != nil {
+		deny(c, req.AgentName, "Agent 公钥格式错误")
+		return
+	}
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": kerr.ErrFailCode, "msg": kerr.ErrFailMsg})
+		return
+	}
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		deny(c, req.AgentName, "Agent 公钥格式错误")
+		return
+	}
+	key := deriveKey(token.Secret, shared, req.AgentName)
+
+	// 同名 Agent 只有被管理员重置后才能重新注册，已吊销或正在使用的身份不能通过令牌接管
+	var exist models.KubePotAgentKey
+	existed := dbUtil.GORM().Where("agent_name = ?", req.AgentName).First(&exist).Error == nil
+	if existed {
+		switch exist.Status {
+		case models.AgentKeyReset:
+		case models.AgentKeyRevoked:
+			deny(c, req.AgentName, "Agent 已吊销")
+			return
+		default:
+			deny(c, req.AgentName, "Agent 名称已注册")
+			return
+		}
+	}
+
+	// 令牌的使用记录和 Agent 密钥在同一事务中写入，任一步失败都不会消耗令牌
+	now := time.Now()
+	err = dbUtil.GORM().Transaction(func(tx *gorm.DB) error {
+		// 条件更新保证一次性令牌只能被使用一次，共享令牌记录最近一次使用
+		query := tx.Model(&models.KubePotEnrollToken{}).Where("id = ?", token.ID)
+		if !reusable {
+			query = query.Where("used_by = ?", "")
+		}
+		result := query.Updates(map[string]interface{}{
+			"used_by":   req.AgentName,
+			"used_time": now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return errTokenUsed
+		}
+
+		if existed {
+			// 条件更新保证一次重置只能被一个注册请求使用
+			result = tx.Model(&models.KubePotAgentKey{}).
+				Where("agent_name = ? AND status = ?", req.AgentName, models.AgentKeyReset).
+				Updates(map[string]interface{}{
+					"agent_ip":    req.AgentIp,
+					"host_name":   req.HostName,
+					"secret":      hex.EncodeToString(key),
+					"status":      models.AgentKeyActive,
+					"update_time": now,
+				})
+			if result.Error == nil && result.RowsAffected != 1 {
+				return errNameTaken
+			}
+			return result.Error
+		}
+
+		// agent_name 唯一索引保证并发注册同一名称时只有一个成功
+		return tx.Create(&models.KubePotAgentKey{
+			AgentName:  req.AgentName,
+			AgentIP:    req.AgentIp,
+			HostName:   req.HostName,
+			Secret:     hex.EncodeToString(key),
+			Status:     models.AgentKeyActive,
+			CreateTime: now,
+			UpdateTime: now,
+		}).Error
+	})
+	if errors.Is(err, errTokenUsed) || errors.Is(err, errNameTaken) {
+		deny(c, req.AgentName, err.Error())
+		return
+	}
+	if err != nil {
+		log.Pr("KubePot", "127.0.0.1", "保存Agent密钥失败", err)
+		c.JSON(http.StatusOK, gin.H{
+			"code": kerr.ErrFailCode,
+			"msg":  "保存Agent密钥失败",
+		})
+		return
+	}
+
+	log.Pr("KubePot", c.ClientIP(), "Agent 注册成功", req.AgentName)
+	c.JSON(http.StatusOK, gin.H{
+		"code": kerr.ErrSuccessCode,
+		"msg":  kerr.ErrSuccessMsg,
+		"data": gin.H{
+			"public_key": hex.EncodeToString(priv.PublicKey().Bytes()),
+			"confirm":    mac(key, "enrolled\n"+req.AgentName),
+		},
+	})
+}
+
+// AddToken 生成一次性注册令牌，完整令牌只在创建时返回一次
+func AddToken(c *gin.Context) {
+	var req struct {
+		Remark      string `json:"remark"`
+		ExpireHours int    `json:"expire_hours"`
+	}
+	c.ShouldBindJSON(&req)
+
+	ttl := defaultTokenTTL
+	if req.ExpireHours > 0 {
+		ttl = time.Duration(req.ExpireHours) * time.Hour
+	}
+
+	now := time.Now()
+	token := models.KubePotEnrollToken{
+		TokenID:    randomHex(8),
+		Secret:     randomHex(32),
+		Remark:     req.Remark,
+		ExpireTime: now.Add(ttl),
+		CreateTime: now,
+	}
+	if err := dbUtil.GORM().Create(&token).Error; err != nil {
+		log.Pr("KubePot", "127.0.0.1", "创建注册令牌失败", err)
+		c.JSON(http.StatusOK, gin.H{
+			"code": kerr.ErrFailCode,
+			"msg":  "创建注册令牌失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": kerr.ErrSuccessCode,
+		"msg":  kerr.ErrSuccessMsg,
+		"data": gin.H{
+			"token":       token.TokenID + "." + token.Secret,
+			"expire_time": token.ExpireTime,
+		},
+	})
+}
+
+// GetTokenList 注册令牌列表，不返回令牌密钥
+func GetTokenList(c *gin.Context) {
+	var result []models.KubePotEnrollToken
+	if err := dbUtil.GORM().Order("id desc").Find(&result).Error; err != nil {
+		log.Pr("KubePot", "127.0.0.1", "获取注册令牌列表失败", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": kerr.ErrSuccessCode,
+		"msg":  kerr.ErrSuccessMsg,
+		"data": result,
+	})
+}
+
+// GetAgentKeyList 已注册 Agent 列表
+func GetAgentKeyList(c *gin.Context) {
+	var result []models.KubePotAgentKey
+	if err := dbUtil.GORM().Order("id desc").Find(&result).Error; err != nil {
+		log.Pr("KubePot", "127.0.0.1", "获取Agent注册列表失败", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": kerr.ErrSuccessCode,
+		"msg":  kerr.ErrSuccessMsg,
+		"data": result,
+	})
+}
+
+// RevokeAgent 吊销 Agent 密钥，之后该 Agent 的请求都会被拒绝并告警
+func RevokeAgent(c *gin.Context) {
+	var req struct {
+		AgentName string `json:"agent_name"`
+	}
+	if err := c.BindJSON(&req); err != nil || req.AgentName == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"code": kerr.ErrFailCode,
+			"msg":  "参数错误",
+		})
+		return
+	}
+
+	if err := Revoke(req.AgentName); err != nil {
+		log.Pr("KubePot", "127.0.0.1", "吊销Agent失败", err)
+		c.JSON(http.StatusOK, gin.H{
+			"code": kerr.ErrFailCode,
+			"msg":  "吊销Agent失败: " + err.Error(),
+		})
+		return
+	}
+
+	log.Pr("KubePot", "127.0.0.1", "吊销Agent成功", req.AgentName)
+	c.JSON(http.StatusOK, gin.H{
+		"code": kerr.ErrSuccessCode,
+		"msg":  kerr.ErrSuccessMsg,
+	})
+}
+
+// ResetAgent 重置 Agent 密钥，之后同名 Agent 可以使用注册令牌重新注册，旧密钥立即失效
+func ResetAgent(c *gin.Context) {
+	var req struct {
+		AgentName string `json:"agent_name"`
+	}
+	if err := c.BindJSON(&req); err != nil || req.AgentName == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"code": kerr.ErrFailCode,
+			"msg":  "参数错误",
+		})
+		return
+	}
+
+	err := dbUtil.GORM().Model(&models.KubePotAgentKey{}).
+		Where("agent_name = ?", req.AgentName).
+		Updates(map[string]interface{}{
+			"status":      models.AgentKeyReset,
+			"update_time": time.Now(),
+		}).Error
+	if err != nil {
+		log.Pr("KubePot", "127.0.0.1", "重置Agent失败", err)
+		c.JSON(http.StatusOK, gin.H{
+			"code": kerr.ErrFailCode,
+			"msg":  "重置Agent失败: " + err.Error(),
+		})
+		return
+	}
+
+	log.Pr("KubePot", "127.0.0.1", "重置Agent成功", req.AgentName)
+	c.JSON(http.StatusOK, gin.H{
+		"code": kerr.ErrSuccessCode,
+		"msg":  kerr.ErrSuccessMsg,
+	})
+}
+
+// Revoke 把 Agent 密钥标记为已吊销
+func Revoke(agentName string) error {
+	return dbUtil.GORM().Model(&models.KubePotAgentKey{}).
+		Where("agent_name = ?", agentName).
+		Updates(map[string]interface{}{
+			"status":      models.AgentKeyRevoked,
+			"update_time": time.Now(),
+		}).Error
+}
+
+// Lookup 返回 Agent 事件对应的记录 ID，事件未处理过时 ok 为 false
+// 用于丢弃 Agent 队列重发的事件，以及把更新请求关联到之前创建的记录
+func Lookup(c *gin.Context, eventID string) (recordID string, ok bool) {
+	if eventID == "" {
+		return "", false
+	}
+	var event models.KubePotAgentEvent
+	err := dbUtil.GORM().Where("agent_name = ? AND event_id = ?", AgentName(c), eventID).First(&event).Error
+	if err != nil {
+		return "", false
+	}
+	return event.RecordID, true
+}
+
+// Remember 记录已处理的 Agent 事件
+func Remember(c *gin.Context, eventID string, recordID string) {
+	if eventID == "" {
+		return
+	}
+	err := dbUtil.GORM().Create(&models.KubePotAgentEvent{
+		AgentName:  AgentName(c),
+		EventID:    eventID,
+		RecordID:   recordID,
+		CreateTime: time.Now(),
+	}).Error
+	if err != nil {
+		log.Pr("KubePot", "127.0.0.1", "记录Agent事件失败", err)
+	}
+}
@@ -0,0 +1,216 @@
+package enroll
+
+import (
+	"KubePot/core/models"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var testKey = bytes.Repeat([]byte{7}, 32)
+
+// authEnv 替换 Agent 密钥查询和告警存储，返回保存的告警
+func authEnv(t *testing.T) *[]models.KubePotSecretLabelAlert {
+	find, save := findAgentKey, saveAlert
+	t.Cleanup(func() {
+		findAgentKey, saveAlert = find, save
+	})
+
+	keys := map[string]string{
+		"node-1":   models.AgentKeyActive,
+		"node-old": models.AgentKeyRevoked,
+		"node-new": models.AgentKeyReset,
+	}
+	findAgentKey = func(agentName string) (models.KubePotAgentKey, bool) {
+		status, ok := keys[agentName]
+		return models.KubePotAgentKey{AgentName: agentName, Secret: hex.EncodeToString(testKey), Status: status}, ok
+	}
+	alerts := &[]models.KubePotSecretLabelAlert{}
+	saveAlert = func(alert *models.KubePotSecretLabelAlert) error {
+		*alerts = append(*alerts, *alert)
+		return nil
+	}
+	return alerts
+}
+
+// signed 按 Agent 的签名方式构造请求
+type signed struct {
+	agent     string
+	key       []byte
+	timestamp time.Time
+	nonce     string
+	uri       string
+	body      string
+	// sentBody 实际发送的请求体，为空时与 body 相同
+	sentBody string
+}
+
+// ipSeq 每个请求使用不同的来源 IP，避免告警限流影响其他用例
+var ipSeq int
+
+func (r signed) request(method string) *http.Request {
+	ts := strconv.FormatInt(r.timestamp.Unix(), 10)
+	sent := r.body
+	if r.sentBody != "" {
+		sent = r.sentBody
+	}
+	req := httptest.NewRequest(method, r.uri, strings.NewReader(sent))
+	ipSeq++
+	req.RemoteAddr = fmt.Sprintf("192.0.2.%d:40000", ipSeq)
+	if r.agent != "" {
+		req.Header.Set(HeaderAgent, r.agent)
+		req.Header.Set(HeaderTimestamp, ts)
+		req.Header.Set(HeaderNonce, r.nonce)
+		req.Header.Set(HeaderSignature, sign(r.key, method, r.uri, ts, r.nonce, []byte(r.body)))
+	}
+	return req
+}
+
+func newRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	handler := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"code": 200, "agent": AgentName(c)})
+	}
+	r.POST("/api/v1/agent/result", Verify, handler)
+	r.GET("/api/v1/secretlabel/agent/list", Verify, handler)
+	r.GET("/api/v1/agent/stream", VerifyStream, func(c *gin.Context) {
+		c.String(http.StatusOK, SignMessage(c, "1", "task", []byte("{}")))
+	})
+	return r
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	valid := signed{agent: "node-1", key: testKey, timestamp: now, uri: "/api/v1/agent/result", body: `{"n":1}`}
+
+	cases := []struct {
+		name   string
+		method string
+		req    func(r signed) signed
+		status int
+	}{
+		{"valid", http.MethodPost, func(r signed) signed { return r }, http.StatusOK},
+		{"unsigned", http.MethodPost, func(r signed) signed { r.agent = ""; return r }, http.StatusUnauthorized},
+		{"unknown agent", http.MethodPost, func(r signed) signed { r.agent = "node-9"; return r }, http.StatusUnauthorized},
+		{"revoked agent", http.MethodPost, func(r signed) signed { r.agent = "node-old"; return r }, http.StatusUnauthorized},
+		{"reset agent", http.MethodPost, func(r signed) signed { r.agent = "node-new"; return r }, http.StatusUnauthorized},
+		{"stale timestamp", http.MethodPost, func(r signed) signed { r.timestamp = now.Add(-3 * time.Minute); return r }, http.StatusUnauthorized},
+		{"future timestamp", http.MethodPost, func(r signed) signed { r.timestamp = now.Add(3 * time.Minute); return r }, http.StatusUnauthorized},
+		{"wrong key", http.MethodPost, func(r signed) signed { r.key = bytes.Repeat([]byte{8}, 32); return r }, http.StatusUnauthorized},
+		{"tampered body", http.MethodPost, func(r signed) signed { r.sentBody = `{"n":2}`; return r }, http.StatusUnauthorized},
+		{"own labels", http.MethodGet, func(r signed) signed {
+			r.uri, r.body = "/api/v1/secretlabel/agent/list?agent=node-1", ""
+			return r
+		}, http.StatusOK},
+		{"other agent's labels", http.MethodGet, func(r signed) signed {
+			r.uri, r.body = "/api/v1/secretlabel/agent/list?agent=node-2", ""
+			return r
+		}, http.StatusUnauthorized},
+	}
+
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			alerts := authEnv(t)
+			r := c.req(valid)
+			r.nonce = fmt.Sprintf("verify-%d-%d", now.UnixNano(), i)
+
+			w := httptest.NewRecorder()
+			newRouter().ServeHTTP(w, r.request(c.method))
+			if w.Code != c.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, c.status, w.Body.String())
+			}
+
+			if c.status != http.StatusOK {
+				if len(*alerts) != 1 {
+					t.Errorf("got %d alerts, want 1", len(*alerts))
+				}
+				return
+			}
+			if !strings.Contains(w.Body.String(), `"agent":"node-1"`) {
+				t.Errorf("handler saw wrong agent: %s", w.Body.String())
+			}
+			ts := strconv.FormatInt(r.timestamp.Unix(), 10)
+			requestSig := sign(testKey, c.method, r.uri, ts, r.nonce, []byte(r.body))
+			if w.Header().Get(HeaderSignature) != signResponse(testKey, requestSig, w.Body.Bytes()) {
+				t.Errorf("response signature does not match body")
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsReplay(t *testing.T) {
+	alerts := authEnv(t)
+	r := signed{agent: "node-1", key: testKey, timestamp: time.Now(), uri: "/api/v1/agent/result", body: `{}`,
+		nonce: fmt.Sprintf("replay-%d", time.Now().UnixNano())}
+
+	router := newRouter()
+	for i, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r.request(http.MethodPost))
+		if w.Code != want {
+			t.Errorf("request %d: status = %d, want %d", i, w.Code, want)
+		}
+	}
+	if len(*alerts) != 1 || !strings.Contains((*alerts)[0].AccessContent, "请求重放") {
+		t.Errorf("unexpected alerts: %+v", *alerts)
+	}
+}
+
+func TestVerifyStream(t *testing.T) {
+	authEnv(t)
+	r := signed{agent: "node-1", key: testKey, timestamp: time.Now(), uri: "/api/v1/agent/stream",
+		nonce: fmt.Sprintf("stream-%d", time.Now().UnixNano())}
+
+	w := httptest.NewRecorder()
+	newRouter().ServeHTTP(w, r.request(http.MethodGet))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get(HeaderSignature) != "" {
+		t.Errorf("stream response should not be buffered and signed as a whole")
+	}
+
+	ts := strconv.FormatInt(r.timestamp.Unix(), 10)
+	requestSig := sign(testKey, http.MethodGet, r.uri, ts, r.nonce, nil)
+	sum := sha256.Sum256([]byte("{}"))
+	if want := mac(testKey, "message\n"+requestSig+"\n1\ntask\n"+hex.EncodeToString(sum[:])); w.Body.String() != want {
+		t.Errorf("message signature = %s, want %s", w.Body.String(), want)
+	}
+
+	r.key = bytes.Repeat([]byte{8}, 32)
+	r.nonce += "-bad"
+	w = httptest.NewRecorder()
+	newRouter().ServeHTTP(w, r.request(http.MethodGet))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("bad stream signature: status = %d", w.Code)
+	}
+}
+
+// 同一来源 IP 伪造大量 Agent 名称时只写入一条告警
+func TestDenyAlertsOncePerIP(t *testing.T) {
+	alerts := authEnv(t)
+	router := newRouter()
+	for i := 0; i < 20; i++ {
+		r := signed{agent: fmt.Sprintf("fake-%d", i), key: testKey, timestamp: time.Now(), uri: "/api/v1/agent/result", nonce: strconv.Itoa(i)}
+		req := r.request(http.MethodPost)
+		req.RemoteAddr = "198.51.100.7:40000"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("request %d: status = %d", i, w.Code)
+		}
+	}
+	if len(*alerts) != 1 {
+		t.Errorf("got %d alerts, want 1", len(*alerts))
+	}
+}
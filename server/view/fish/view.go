@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func Html(c *gin.Context) {
@@ -190,3 +191,163 @@ func GetFishTypeInfo(c *gin.Context) {
 		"data": data,
 	})
 }
+
+// 攻击事件可以筛选的字段，查询参数名与数据库列名相同
+var eventFilters = []string{"protocol", "kind", "source_ip", "session_id", "agent_name", "username", "dest_port"}
+
+// 攻击事件可以分组统计的字段
+var eventGroups = map[string]bool{
+	"protocol":   true,
+	"kind":       true,
+	"source_ip":  true,
+	"agent_name": true,
+	"username":   true,
+	"password":   true,
+	"command":    true,
+	"dest_port":  true,
+	"session_id": true,
+}
+
+// filterEvents 按查询参数中的字段筛选攻击事件
+func filterEvents(c *gin.Context, query *gorm.DB) *gorm.DB {
+	for _, field := range eventFilters {
+		if value, _ := c.GetQuery(field); value != "" {
+			query = query.Where(field+" = ?", value)
+		}
+	}
+	if soText, _ := c.GetQuery("so_text"); soText != "" {
+		query = query.Where("command LIKE ? OR uri LIKE ? OR detail LIKE ?", "%"+soText+"%", "%"+soText+"%", "%"+soText+"%")
+	}
+	return query
+}
+
+// GetEventList 结构化攻击事件列表
+func GetEventList(c *gin.Context) {
+	p, _ := c.GetQuery("pageIndex")
+	pageSize, _ := c.GetQuery("pageSize")
+
+	db := dbUtil.GORM()
+	if db == nil {
+		log.Pr("KubePot", "127.0.0.1", "数据库连接失败", nil)
+		c.JSON(http.StatusOK, gin.H{
+			"items": nil,
+			"count": "0",
+		})
+		return
+	}
+
+	var totalCount int64
+	if err := filterEvents(c, db.Model(&models.KubePotAttackEvent{})).Count(&totalCount).Error; err != nil {
+		log.Pr("KubePot", "127.0.0.1", "统计攻击事件总数失败", err)
+		totalCount = 0
+	}
+
+	var result []models.KubePotAttackEvent
+	pInt, _ := strconv.Atoi(p)
+	pageSizeInt, _ := strconv.Atoi(pageSize)
+	pageStart := page.Start(pInt, pageSizeInt)
+	err := filterEvents(c, db.Model(&models.KubePotAttackEvent{})).Order("id desc").Limit(pageSizeInt).Offset(pageStart).Find(&result).Error
+	if err != nil {
+		log.Pr("KubePot", "127.0.0.1", "查询攻击事件列表失败", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": result,
+		"count": strconv.FormatInt(totalCount, 10),
+	})
+}
+
+// GetEventStats 按 group 指定的字段统计攻击事件数量，筛选参数与列表一致
+func GetEventStats(c *gin.Context) {
+	group, _ := c.GetQuery("group")
+	if !eventGroups[group] {
+		c.JSON(http.StatusOK, gin.H{
+			"code": 1000,
+			"msg":  "不支持的统计字段: " + group,
+			"data": nil,
+		})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	db := dbUtil.GORM()
+	if db == nil {
+		log.Pr("KubePot", "127.0.0.1", "数据库连接失败", nil)
+		c.JSON(http.StatusOK, gin.H{
+			"code": 1000,
+			"msg":  "数据库连接失败",
+			"data": nil,
+		})
+		return
+	}
+
+	type StatResult struct {
+		Value string `json:"value"`
+		Count int64  `json:"count"`
+	}
+	var result []StatResult
+	err := filterEvents(c, db.Model(&models.KubePotAttackEvent{})).
+		Select(group + " AS value, COUNT(*) AS count").
+		Group(group).
+		Order("count desc").
+		Limit(limit).
+		Scan(&result).Error
+	if err != nil {
+		log.Pr("KubePot", "127.0.0.1", "统计攻击事件失败", err)
+		c.JSON(http.StatusOK, gin.H{
+			"code": 1000,
+			"msg":  "统计攻击事件失败",
+			"data": nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": error.ErrSuccessCode,
+		"msg":  error.ErrSuccessMsg,
+		"data": result,
+	})
+}
+
+// GetSessionList 攻击会话列表，可按协议、来源 IP 和 Agent 筛选
+func GetSessionList(c *gin.Context) {
+	p, _ := c.GetQuery("pageIndex")
+	pageSize, _ := c.GetQuery("pageSize")
+
+	db := dbUtil.GORM()
+	if db == nil {
+		log.Pr("KubePot", "127.0.0.1", "数据库连接失败", nil)
+		c.JSON(http.StatusOK, gin.H{
+			"items": nil,
+			"count": "0",
+		})
+		return
+	}
+
+	query := db.Model(&models.KubePotAttackSession{})
+	for _, field := range []string{"protocol", "source_ip", "agent_name"} {
+		if value, _ := c.GetQuery(field); value != "" {
+			query = query.Where(field+" = ?", value)
+		}
+	}
+
+	var totalCount int64
+	if err := query.Session(&gorm.Session{}).Count(&totalCount).Error; err != nil {
+		log.Pr("KubePot", "127.0.0.1", "统计攻击会话总数失败", err)
+		totalCount = 0
+	}
+
+	var result []models.KubePotAttackSession
+	pInt, _ := strconv.Atoi(p)
+	pageSizeInt, _ := strconv.Atoi(pageSize)
+	pageStart := page.Start(pInt, pageSizeInt)
+	err := query.Order("start_time desc").Limit(pageSizeInt).Offset(pageStart).Find(&result).Error
+	if err != nil {
+		log.Pr("KubePot", "127.0.0.1", "查询攻击会话列表失败", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items": result,
+		"count": strconv.FormatInt(totalCount, 10),
+	})
+}
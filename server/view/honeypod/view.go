@@ -2,11 +2,12 @@ package honeypod
 
 import (
 	"KubePot/core/dbUtil"
+	"KubePot/core/honeypod"
 	"KubePot/core/models"
 	"KubePot/error"
 	"KubePot/utils/log"
-	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,11 +17,11 @@ func Html(c *gin.Context) {
 }
 
 func GetHoneypod(c *gin.Context) {
-	var result []models.KubePotK8s
+	var result []models.KubePotHoneypodDeployment
 	err := dbUtil.GORM().Order("id desc").Find(&result).Error
 
 	if err != nil {
-		log.Pr("KubePot", "127.0.0.1", "获取蜜罐集群列表失败", err)
+		log.Pr("KubePot", "127.0.0.1", "获取蜜罐列表失败", err)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -30,33 +31,93 @@ func GetHoneypod(c *gin.Context) {
 	})
 }
 
+// AddHoneypod 在集群的命名空间中部署 Agent，server_addr 为 Pod 访问服务端的地址，默认使用当前访问的地址
 func AddHoneypod(c *gin.Context) {
 	id := c.PostForm("id")
 
-	honeypod := models.KubePotHoneypod{}
-	err := dbUtil.GORM().First(&honeypod, id).Error
+	var cluster models.KubePotK8s
+	if err := dbUtil.GORM().First(&cluster, id).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "集群不存在",
+		})
+		return
+	}
 
-	namespace := "default"
+	replicas, _ := strconv.Atoi(c.DefaultPostForm("replicas", "1"))
+	d := models.KubePotHoneypodDeployment{
+		Namespace:   c.DefaultPostForm("namespace", "default"),
+		Name:        c.PostForm("name"),
+		Workload:    c.DefaultPostForm("workload", honeypod.WorkloadStatefulSet),
+		Image:       c.PostForm("image"),
+		Replicas:    int32(replicas),
+		Ports:       c.PostForm("ports"),
+		ServiceType: c.PostForm("service_type"),
+	}
+	serverAddr := c.DefaultPostForm("server_addr", c.Request.Host)
+
+	if d.Name == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "名称不能为空",
+		})
+		return
+	}
 
-	fmt.Printf("在命名空间 %s 创建Nginx Deployment...\n", namespace)
+	if err := honeypod.Deploy(cluster, &d, serverAddr); err != nil {
+		log.Pr("KubePot", "127.0.0.1", "部署蜜罐失败", err)
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "部署蜜罐失败: " + err.Error(),
+			"data": d,
+		})
+		return
+	}
 
-	if err != nil {
-		log.Pr("KubePot", "127.0.0.1", "插入k8s失败", err)
+	c.JSON(http.StatusOK, gin.H{
+		"code": error.ErrSuccessCode,
+		"msg":  error.ErrSuccessMsg,
+		"data": d,
+	})
+}
+
+// RefreshHoneypod 从集群读取发布状态
+func RefreshHoneypod(c *gin.Context) {
+	d, cluster, ok := findHoneypod(c)
+	if !ok {
+		return
+	}
+
+	if err := honeypod.Refresh(cluster, &d); err != nil {
+		log.Pr("KubePot", "127.0.0.1", "获取蜜罐发布状态失败", err)
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  err.Error(),
+		})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": error.ErrSuccessCode,
 		"msg":  error.ErrSuccessMsg,
+		"data": d,
 	})
 }
 
+// DeleteHoneypod 卸载集群中的 Agent，并删除这些 Agent 的密钥和心跳
 func DeleteHoneypod(c *gin.Context) {
-	id := c.PostForm("id")
-
-	err := dbUtil.GORM().Delete(&models.KubePotK8s{}, id).Error
+	d, cluster, ok := findHoneypod(c)
+	if !ok {
+		return
+	}
 
-	if err != nil {
-		log.Pr("KubePot", "127.0.0.1", "删除集群失败", err)
+	if err := honeypod.Teardown(cluster, &d); err != nil {
+		log.Pr("KubePot", "127.0.0.1", "卸载蜜罐失败", err)
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "卸载蜜罐失败: " + err.Error(),
+		})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -64,3 +125,23 @@ func DeleteHoneypod(c *gin.Context) {
 		"msg":  error.ErrSuccessMsg,
 	})
 }
+
+// findHoneypod 按请求中的 id 查找蜜罐和所在集群，找不到时直接返回错误
+func findHoneypod(c *gin.Context) (models.KubePotHoneypodDeployment, models.KubePotK8s, bool) {
+	id := c.PostForm("id")
+
+	var d models.KubePotHoneypodDeployment
+	var cluster models.KubePotK8s
+	err := dbUtil.GORM().First(&d, id).Error
+	if err == nil {
+		err = dbUtil.GORM().First(&cluster, d.K8sID).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "蜜罐或集群不存在",
+		})
+		return d, cluster, false
+	}
+	return d, cluster, true
+}
@@ -2,10 +2,14 @@ package k8s
 
 import (
 	"KubePot/core/dbUtil"
+	"KubePot/core/decoy"
 	"KubePot/core/models"
 	"KubePot/error"
 	"KubePot/utils/log"
+	"crypto/hmac"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -54,6 +58,19 @@ func AddK8s(c *gin.Context) {
 func DeleteK8s(c *gin.Context) {
 	id := c.PostForm("id")
 
+	// 先清理集群中的诱饵对象，集群已不可达时只删除记录
+	var cluster models.KubePotK8s
+	if dbUtil.GORM().First(&cluster, id).Error == nil {
+		var decoys []models.KubePotK8sDecoy
+		dbUtil.GORM().Where("k8s_id = ?", id).Find(&decoys)
+		for i := range decoys {
+			if err := decoy.Remove(cluster, &decoys[i]); err != nil {
+				log.Pr("KubePot", "127.0.0.1", "删除诱饵对象失败", err)
+				dbUtil.GORM().Delete(&models.KubePotK8sDecoy{}, decoys[i].ID)
+			}
+		}
+	}
+
 	err := dbUtil.GORM().Delete(&models.KubePotK8s{}, id).Error
 
 	if err != nil {
@@ -66,24 +83,208 @@ func DeleteK8s(c *gin.Context) {
 	})
 }
 
-func AddPushSecret(c *gin.Context) {
+// GetDecoyList 诱饵对象列表，可按集群过滤
+func GetDecoyList(c *gin.Context) {
+	k8sID := c.Query("k8s_id")
+
+	db := dbUtil.GORM().Order("id desc")
+	if k8sID != "" {
+		db = db.Where("k8s_id = ?", k8sID)
+	}
+
+	var result []models.KubePotK8sDecoy
+	err := db.Find(&result).Error
+
+	if err != nil {
+		log.Pr("KubePot", "127.0.0.1", "获取诱饵对象列表失败", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": error.ErrSuccessCode,
+		"msg":  error.ErrSuccessMsg,
+		"data": result,
+	})
+}
+
+// AddDecoy 在集群的一个或多个命名空间中部署诱饵对象，namespace 以逗号分隔
+func AddDecoy(c *gin.Context) {
+	k8sID := c.PostForm("k8s_id")
+	kind := c.PostForm("kind")
 	name := c.PostForm("name")
-	apiServer := c.PostForm("api_server")
-	token := c.PostForm("token")
+	tokenKind := c.PostForm("token_kind")
+	namespaces := c.PostForm("namespace")
 
-	k8s := models.KubePotK8s{
-		Name:      name,
-		ApiServer: apiServer,
-		Token:     token,
+	var cluster models.KubePotK8s
+	if err := dbUtil.GORM().First(&cluster, k8sID).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "集群不存在",
+		})
+		return
 	}
-	err := dbUtil.GORM().Create(&k8s).Error
 
+	if name == "" || !decoy.Supported(kind) {
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "诱饵对象名称或类型无效",
+		})
+		return
+	}
+
+	var result []*models.KubePotK8sDecoy
+	for _, namespace := range strings.Split(namespaces, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace == "" {
+			continue
+		}
+		d, err := decoy.Deploy(cluster, kind, namespace, name, tokenKind)
+		if err != nil {
+			log.Pr("KubePot", "127.0.0.1", "部署诱饵对象失败", err)
+		}
+		if d != nil {
+			result = append(result, d)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": error.ErrSuccessCode,
+		"msg":  error.ErrSuccessMsg,
+		"data": result,
+	})
+}
+
+// RotateDecoy 为诱饵对象更换新的诱饵凭据
+func RotateDecoy(c *gin.Context) {
+	d, cluster, ok := findDecoy(c)
+	if !ok {
+		return
+	}
+
+	if err := decoy.Rotate(cluster, &d); err != nil {
+		log.Pr("KubePot", "127.0.0.1", "轮换诱饵对象失败", err)
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": error.ErrSuccessCode,
+		"msg":  error.ErrSuccessMsg,
+		"data": d,
+	})
+}
+
+// DeleteDecoy 从集群中删除诱饵对象
+func DeleteDecoy(c *gin.Context) {
+	d, cluster, ok := findDecoy(c)
+	if !ok {
+		return
+	}
+
+	if err := decoy.Remove(cluster, &d); err != nil {
+		log.Pr("KubePot", "127.0.0.1", "删除诱饵对象失败", err)
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": error.ErrSuccessCode,
+		"msg":  error.ErrSuccessMsg,
+	})
+}
+
+// findDecoy 按请求中的 id 查找诱饵对象和所在集群，找不到时直接返回错误
+func findDecoy(c *gin.Context) (models.KubePotK8sDecoy, models.KubePotK8s, bool) {
+	id := c.PostForm("id")
+
+	var d models.KubePotK8sDecoy
+	var cluster models.KubePotK8s
+	err := dbUtil.GORM().First(&d, id).Error
+	if err == nil {
+		err = dbUtil.GORM().First(&cluster, d.K8sID).Error
+	}
 	if err != nil {
-		log.Pr("KubePot", "127.0.0.1", "插入k8s失败", err)
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "诱饵对象或集群不存在",
+		})
+		return d, cluster, false
+	}
+	return d, cluster, true
+}
+
+// findCluster 按 ID 查找集群，审计 Webhook 测试时替换为不依赖数据库的实现
+var findCluster = func(id string) (models.KubePotK8s, bool) {
+	var cluster models.KubePotK8s
+	err := dbUtil.GORM().First(&cluster, id).Error
+	return cluster, err == nil
+}
+
+// ReceiveAudit 集群审计 Webhook，接收 audit.k8s.io/v1 EventList 并检查诱饵对象是否被访问
+func ReceiveAudit(c *gin.Context) {
+	cluster, ok := findCluster(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "集群不存在",
+		})
+		return
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !hmac.Equal([]byte(token), []byte(decoy.AuditToken(cluster))) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code": error.ErrFailApiKeyCode,
+			"msg":  error.ErrFailApiKeyMsg,
+		})
+		return
+	}
+
+	var list decoy.AuditEventList
+	if err := c.BindJSON(&list); err != nil || list.Kind != "EventList" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "参数错误",
+		})
+		return
+	}
+
+	alerts := decoy.CheckAudit(cluster, &list)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": error.ErrSuccessCode,
+		"msg":  error.ErrSuccessMsg,
+		"data": gin.H{"events": len(list.Items), "alerts": alerts},
+	})
+}
+
+// GetAuditConfig 集群审计 Webhook 的地址和 Token，用于配置 Apiserver 的 --audit-webhook-config-file
+func GetAuditConfig(c *gin.Context) {
+	cluster, ok := findCluster(c.Query("id"))
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "集群不存在",
+		})
+		return
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": error.ErrSuccessCode,
 		"msg":  error.ErrSuccessMsg,
+		"data": gin.H{
+			"server": fmt.Sprintf("%s://%s/api/v1/k8s/audit/%d", scheme, c.Request.Host, cluster.ID),
+			"token":  decoy.AuditToken(cluster),
+		},
 	})
 }
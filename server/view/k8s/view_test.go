@@ -0,0 +1,187 @@
+package k8s
+
+import (
+	"KubePot/core/decoy"
+	"KubePot/core/kube"
+	"KubePot/core/models"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 集群 Token 认证后的用户名，与审计事件样本中服务端自身的操作一致
+const serverUser = "system:serviceaccount:kubepot:kubepot-server"
+
+// auditEnv 替换集群查询、诱饵对象列表、告警存储和集群客户端，返回保存的告警
+func auditEnv(t *testing.T, cluster models.KubePotK8s) *[]models.KubePotSecretLabelAlert {
+	findClusterFn, listDecoys, saveAlert, newClient := findCluster, decoy.ListDecoys, decoy.SaveAlert, kube.NewClient
+	t.Cleanup(func() {
+		findCluster, decoy.ListDecoys, decoy.SaveAlert, kube.NewClient = findClusterFn, listDecoys, saveAlert, newClient
+	})
+
+	findCluster = func(id string) (models.KubePotK8s, bool) {
+		return cluster, id == fmt.Sprint(cluster.ID)
+	}
+	decoy.ListDecoys = func(k8sID int64) ([]models.KubePotK8sDecoy, error) {
+		return []models.KubePotK8sDecoy{
+			{ID: 1, K8sID: k8sID, Kind: decoy.KindSecret, Namespace: "default", Name: "db-backup"},
+			{ID: 2, K8sID: k8sID, Kind: decoy.KindConfigMap, Namespace: "kube-system", Name: "cloud-credentials"},
+			{ID: 3, K8sID: k8sID, Kind: decoy.KindServiceAccount, Namespace: "ci", Name: "deployer"},
+		}, nil
+	}
+	alerts := &[]models.KubePotSecretLabelAlert{}
+	decoy.SaveAlert = func(alert *models.KubePotSecretLabelAlert) error {
+		*alerts = append(*alerts, *alert)
+		return nil
+	}
+	kube.NewClient = func(models.KubePotK8s) (kubernetes.Interface, error) {
+		client := fake.NewSimpleClientset()
+		client.PrependReactor("create", "selfsubjectreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := &authenticationv1.SelfSubjectReview{}
+			review.Status.UserInfo.Username = serverUser
+			return true, review, nil
+		})
+		return client, nil
+	}
+	return alerts
+}
+
+func postAudit(t *testing.T, id string, token string, body []byte) (int, map[string]interface{}) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/v1/k8s/audit/:id", ReceiveAudit)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/k8s/audit/"+id, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response %q: %v", w.Body.String(), err)
+	}
+	return w.Code, resp
+}
+
+func fixture(t *testing.T) []byte {
+	body, err := os.ReadFile("testdata/audit_events.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// findAlert 按 auditID 查找告警
+func findAlert(alerts []models.KubePotSecretLabelAlert, auditID string) (models.KubePotSecretLabelAlert, bool) {
+	for _, alert := range alerts {
+		if strings.HasSuffix(alert.AccessContent, "auditID: "+auditID) {
+			return alert, true
+		}
+	}
+	return models.KubePotSecretLabelAlert{}, false
+}
+
+func TestReceiveAudit(t *testing.T) {
+	cluster := models.KubePotK8s{ID: 3, Name: "audit-fixture", ApiServer: "https://10.0.0.1:6443", Token: "cluster-token"}
+	alerts := auditEnv(t, cluster)
+
+	code, resp := postAudit(t, fmt.Sprint(cluster.ID), decoy.AuditToken(cluster), fixture(t))
+	if code != http.StatusOK || resp["code"] != float64(200) {
+		t.Fatalf("unexpected response %d %v", code, resp)
+	}
+	data := resp["data"].(map[string]interface{})
+	if data["events"] != float64(9) || data["alerts"] != float64(4) {
+		t.Errorf("events = %v, alerts = %v, want 9 and 4", data["events"], data["alerts"])
+	}
+
+	cases := []struct {
+		name    string
+		auditID string
+		label   string
+		alert   bool
+	}{
+		// 同一请求的两个阶段只告警一次
+		{"get decoy secret", "4f8c1d2e-0b6a-4c55-9d3e-1a2b3c4d5e01", "secret default/db-backup", true},
+		{"list namespace with serviceaccount token", "4f8c1d2e-0b6a-4c55-9d3e-1a2b3c4d5e02", "serviceaccount ci/deployer", true},
+		{"cluster-wide watch", "4f8c1d2e-0b6a-4c55-9d3e-1a2b3c4d5e03", "configmap kube-system/cloud-credentials", true},
+		{"server rotate", "4f8c1d2e-0b6a-4c55-9d3e-1a2b3c4d5e04", "", false},
+		{"spoofed server user agent", "4f8c1d2e-0b6a-4c55-9d3e-1a2b3c4d5e05", "serviceaccount ci/deployer", true},
+		{"non-decoy secret", "4f8c1d2e-0b6a-4c55-9d3e-1a2b3c4d5e06", "", false},
+		{"list namespace without decoys", "4f8c1d2e-0b6a-4c55-9d3e-1a2b3c4d5e07", "", false},
+		{"other api group", "4f8c1d2e-0b6a-4c55-9d3e-1a2b3c4d5e08", "", false},
+	}
+	for _, c := range cases {
+		alert, ok := findAlert(*alerts, c.auditID)
+		if ok != c.alert {
+			t.Errorf("%s: alerted = %v, want %v", c.name, ok, c.alert)
+			continue
+		}
+		if ok && alert.SecretLabelName != c.label {
+			t.Errorf("%s: label = %q, want %q", c.name, alert.SecretLabelName, c.label)
+		}
+	}
+
+	alert, _ := findAlert(*alerts, "4f8c1d2e-0b6a-4c55-9d3e-1a2b3c4d5e03")
+	if alert.IP != "203.0.113.45" || !strings.Contains(alert.AccessContent, "request: configmaps */*") {
+		t.Errorf("unexpected cluster-wide watch alert: %+v", alert)
+	}
+
+	// Apiserver 重发同一批事件时不重复告警
+	_, resp = postAudit(t, fmt.Sprint(cluster.ID), decoy.AuditToken(cluster), fixture(t))
+	if data := resp["data"].(map[string]interface{}); data["alerts"] != float64(0) {
+		t.Errorf("resent batch alerted %v times", data["alerts"])
+	}
+	if len(*alerts) != 4 {
+		t.Errorf("got %d alerts, want 4", len(*alerts))
+	}
+}
+
+func TestReceiveAuditRejectsBadToken(t *testing.T) {
+	cluster := models.KubePotK8s{ID: 4, Name: "audit-token", ApiServer: "https://10.0.0.1:6443", Token: "cluster-token"}
+	alerts := auditEnv(t, cluster)
+
+	other := cluster
+	other.Token = "other-token"
+	for _, token := range []string{"", "cluster-token", decoy.AuditToken(other)} {
+		code, resp := postAudit(t, fmt.Sprint(cluster.ID), token, fixture(t))
+		if code != http.StatusUnauthorized || resp["code"] != float64(1001) {
+			t.Errorf("token %q: unexpected response %d %v", token, code, resp)
+		}
+	}
+	if len(*alerts) != 0 {
+		t.Errorf("rejected batch produced %d alerts", len(*alerts))
+	}
+}
+
+func TestReceiveAuditUnknownCluster(t *testing.T) {
+	cluster := models.KubePotK8s{ID: 5, Name: "audit-missing", Token: "cluster-token"}
+	auditEnv(t, cluster)
+
+	if code, _ := postAudit(t, "6", decoy.AuditToken(cluster), fixture(t)); code != http.StatusNotFound {
+		t.Errorf("unknown cluster: status %d, want 404", code)
+	}
+}
+
+func TestReceiveAuditRejectsOtherKinds(t *testing.T) {
+	cluster := models.KubePotK8s{ID: 7, Name: "audit-kind", Token: "cluster-token"}
+	auditEnv(t, cluster)
+
+	body := []byte(`{"kind":"Event","apiVersion":"audit.k8s.io/v1","auditID":"x"}`)
+	if code, _ := postAudit(t, fmt.Sprint(cluster.ID), decoy.AuditToken(cluster), body); code != http.StatusBadRequest {
+		t.Errorf("single event: status %d, want 400", code)
+	}
+}
@@ -2,10 +2,14 @@ package secretlabel
 
 import (
 	"KubePot/core/dbUtil"
+	"KubePot/core/honeytoken"
 	"KubePot/core/models"
+	"KubePot/core/push"
 	"KubePot/error"
 	"KubePot/utils/log"
+	"KubePot/view/enroll"
 	"encoding/json"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -35,6 +39,8 @@ func GetSecretLabelList(c *gin.Context) {
 	type SecretLabelWithStatus struct {
 		models.KubePotSecretLabel
 		TaskStatus string `json:"task_status"`
+		// Watches 各 Agent 上报的文件监控状态
+		Watches []models.KubePotSecretLabelWatch `json:"watches"`
 	}
 
 	var resultWithStatus []SecretLabelWithStatus
@@ -43,7 +49,7 @@ func GetSecretLabelList(c *gin.Context) {
 		// 查询该密标的任务状态
 		var task models.KubePotTask
 		taskStatus := "未知"
-		
+
 		// 查找与该密标相关的任务
 		// 由于任务数据是JSON格式，我们需要查询包含密标名称的任务
 		err := dbUtil.GORM().Where("task_type = ? AND task_data LIKE ?", "secret_label", "%\"name\":\""+label.Name+"%").First(&task).Error
@@ -53,9 +59,13 @@ func GetSecretLabelList(c *gin.Context) {
 
 		// 状态保持为英文，前端会根据英文状态显示对应的中文
 
+		var watches []models.KubePotSecretLabelWatch
+		dbUtil.GORM().Where("secret_label_id = ?", label.ID).Find(&watches)
+
 		resultWithStatus = append(resultWithStatus, SecretLabelWithStatus{
 			KubePotSecretLabel: label,
-			TaskStatus:        taskStatus,
+			TaskStatus:         taskStatus,
+			Watches:            watches,
 		})
 	}
 
@@ -75,6 +85,11 @@ func AddSecretLabel(c *gin.Context) {
 	agentList := c.PostForm("agent_list")
 	monitorTampering := c.PostForm("monitor_tampering") == "true"
 
+	// 生成型密标未填写路径时使用该类凭据的常见路径
+	if filePath == "" && fileContent == "" {
+		filePath = honeytoken.DefaultPath(labelType)
+	}
+
 	now := time.Now()
 
 	secretLabel := models.KubePotSecretLabel{
@@ -95,7 +110,7 @@ func AddSecretLabel(c *gin.Context) {
 		log.Pr("KubePot", "127.0.0.1", "新增密标失败", err)
 	} else {
 		// 为相关Agent创建任务
-		createSecretLabelTasks(&secretLabel)
+		createSecretLabelTasks(&secretLabel, "secret_label")
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -104,15 +119,9 @@ func AddSecretLabel(c *gin.Context) {
 	})
 }
 
-// createSecretLabelTasks 为密标创建任务
-func createSecretLabelTasks(label *models.KubePotSecretLabel) {
-	// 准备任务数据
-	taskData, err := json.Marshal(label)
-	if err != nil {
-		log.Pr("KubePot", "127.0.0.1", "序列化密标数据失败", err)
-		return
-	}
-
+// createSecretLabelTasks 为密标创建任务，taskType 为 secret_label 下发或 secret_label_delete 删除
+func createSecretLabelTasks(label *models.KubePotSecretLabel, taskType string) {
+	var agentNames []string
 	if label.AgentType == "all" {
 		// 为所有Agent创建任务
 		var agents []models.KubePotColony
@@ -121,38 +130,76 @@ func createSecretLabelTasks(label *models.KubePotSecretLabel) {
 			log.Pr("KubePot", "127.0.0.1", "获取Agent列表失败", err)
 			return
 		}
-
 		for _, agent := range agents {
-			task := models.KubePotTask{
-				TaskType:   "secret_label",
-				TaskData:   string(taskData),
-				AgentName:  agent.AgentName,
-				Status:     "pending",
-				CreateTime: time.Now(),
-				UpdateTime: time.Now(),
-			}
-			dbUtil.GORM().Create(&task)
+			agentNames = append(agentNames, agent.AgentName)
 		}
 	} else if label.AgentType == "specific" && label.AgentList != "" {
 		// 为指定Agent创建任务
-		agentNames := strings.Split(label.AgentList, ",")
-		for _, agentName := range agentNames {
-			agentName = strings.TrimSpace(agentName)
-			if agentName != "" {
-				task := models.KubePotTask{
-					TaskType:   "secret_label",
-					TaskData:   string(taskData),
-					AgentName:  agentName,
-					Status:     "pending",
-					CreateTime: time.Now(),
-					UpdateTime: time.Now(),
-				}
-				dbUtil.GORM().Create(&task)
+		for _, agentName := range strings.Split(label.AgentList, ",") {
+			if agentName = strings.TrimSpace(agentName); agentName != "" {
+				agentNames = append(agentNames, agentName)
 			}
 		}
 	}
+
+	for _, agentName := range agentNames {
+		agentLabel := *label
+		// 生成型密标每个 Agent 下发各自的诱饵凭据，删除任务不需要文件内容
+		if taskType == "secret_label" && generated(label) {
+			content, err := plant(label, agentName)
+			if err != nil {
+				log.Pr("KubePot", "127.0.0.1", "生成诱饵凭据失败", err)
+				continue
+			}
+			agentLabel.FileContent = content
+		}
+
+		// 准备任务数据
+		taskData, err := json.Marshal(agentLabel)
+		if err != nil {
+			log.Pr("KubePot", "127.0.0.1", "序列化密标数据失败", err)
+			return
+		}
+
+		task := models.KubePotTask{
+			TaskType:   taskType,
+			TaskData:   string(taskData),
+			AgentName:  agentName,
+			Status:     "pending",
+			CreateTime: time.Now(),
+			UpdateTime: time.Now(),
+		}
+		if err := dbUtil.GORM().Create(&task).Error; err != nil {
+			log.Pr("KubePot", "127.0.0.1", "创建密标任务失败", err)
+			continue
+		}
+		push.Notify(agentName)
+	}
+}
+
+// generated 未填写文件内容且类型可生成的密标，由服务端为每个 Agent 生成诱饵凭据
+func generated(label *models.KubePotSecretLabel) bool {
+	return label.FileContent == "" && honeytoken.Supported(label.LabelType)
+}
+
+// plant 返回密标在 Agent 上的诱饵凭据内容，kubeconfig 指向该 Agent 的 Apiserver 蜜罐
+func plant(label *models.KubePotSecretLabel, agentName string) (string, error) {
+	opts := honeytoken.Options{Host: agentName}
+	var colony models.KubePotColony
+	if err := dbUtil.GORM().Where("agent_name = ?", agentName).First(&colony).Error; err == nil && colony.AgentIP != "" {
+		opts.APIServer = "https://" + net.JoinHostPort(colony.AgentIP, apiServerPort)
+	}
+
+	token, err := honeytoken.Plant(int64(label.ID), label.Name, label.LabelType, agentName, opts)
+	if err != nil {
+		return "", err
+	}
+	return token.Content, nil
 }
 
+// Agent 上 Apiserver 蜜罐的默认端口
+const apiServerPort = "6443"
+
 func UpdateSecretLabel(c *gin.Context) {
 	id := c.PostForm("id")
 	name := c.PostForm("name")
@@ -178,6 +225,12 @@ func UpdateSecretLabel(c *gin.Context) {
 
 	if err != nil {
 		log.Pr("KubePot", "127.0.0.1", "更新密标失败", err)
+	} else {
+		// 重新下发，Agent 更新文件并重新监控
+		var label models.KubePotSecretLabel
+		if err := dbUtil.GORM().Where("id = ?", id).First(&label).Error; err == nil {
+			createSecretLabelTasks(&label, "secret_label")
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -189,10 +242,16 @@ func UpdateSecretLabel(c *gin.Context) {
 func DeleteSecretLabel(c *gin.Context) {
 	id := c.PostForm("id")
 
+	// 删除前取出密标，通知下发过的 Agent 删除文件和监控
+	var label models.KubePotSecretLabel
+	found := dbUtil.GORM().Where("id = ?", id).First(&label).Error == nil
+
 	err := dbUtil.GORM().Delete(&models.KubePotSecretLabel{}, id).Error
 
 	if err != nil {
 		log.Pr("KubePot", "127.0.0.1", "删除密标失败", err)
+	} else if found {
+		createSecretLabelTasks(&label, "secret_label_delete")
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -267,6 +326,9 @@ func ReportSecretLabelAlert(c *gin.Context) {
 		Ip              string `json:"ip"`
 		AccessTime      string `json:"access_time"`
 		AccessContent   string `json:"access_content"`
+		AlertType       string `json:"alert_type"`
+		Severity        string `json:"severity"`
+		EventId         string `json:"event_id"`
 	}
 
 	err := c.BindJSON(&alertData)
@@ -279,8 +341,24 @@ func ReportSecretLabelAlert(c *gin.Context) {
 		return
 	}
 
+	alertData.Agent = enroll.AgentName(c)
+
+	// Agent 重发的告警不重复入库
+	if _, ok := enroll.Lookup(c, alertData.EventId); ok {
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrSuccessCode,
+			"msg":  error.ErrSuccessMsg,
+		})
+		return
+	}
+
 	now := time.Now()
 
+	// 蜜标凭据被使用等高危告警在内容前标注级别和类型
+	if alertData.Severity != "" {
+		alertData.AccessContent = "[" + alertData.Severity + "][" + alertData.AlertType + "] " + alertData.AccessContent
+	}
+
 	alert := models.KubePotSecretLabelAlert{
 		SecretLabelID:   alertData.SecretLabelId,
 		SecretLabelName: alertData.SecretLabelName,
@@ -302,6 +380,8 @@ func ReportSecretLabelAlert(c *gin.Context) {
 		return
 	}
 
+	enroll.Remember(c, alertData.EventId, "")
+
 	c.JSON(http.StatusOK, gin.H{
 		"code": error.ErrSuccessCode,
 		"msg":  error.ErrSuccessMsg,
@@ -319,9 +399,9 @@ func GetAgentSecretLabels(c *gin.Context) {
 		return
 	}
 
-	// 查询需要监控的密标
+	// 所有密标都需要监控读取，篡改监控由 Agent 按 monitor_tampering 开启
 	var secretLabels []models.KubePotSecretLabel
-	err := dbUtil.GORM().Where("monitor_tampering = ?", true).Find(&secretLabels).Error
+	err := dbUtil.GORM().Find(&secretLabels).Error
 
 	if err != nil {
 		log.Pr("KubePot", "127.0.0.1", "获取密标任务失败", err)
@@ -335,20 +415,20 @@ func GetAgentSecretLabels(c *gin.Context) {
 	// 过滤出该Agent需要执行的密标任务
 	var agentSecretLabels []models.KubePotSecretLabel
 	for _, label := range secretLabels {
-		// 检查Agent类型
-		if label.AgentType == "all" {
-			// 所有Agent都需要执行
-			agentSecretLabels = append(agentSecretLabels, label)
-		} else if label.AgentType == "specific" {
-			// 检查Agent是否在指定列表中
-			agentList := label.AgentList
-			if agentList != "" {
-				// 简单的字符串包含检查，实际应该按逗号分割后检查
-				if strings.Contains(agentList, agentName) {
-					agentSecretLabels = append(agentSecretLabels, label)
-				}
+		if !assigned(&label, agentName) {
+			continue
+		}
+
+		// 生成型密标返回该 Agent 的诱饵凭据，Agent 据此登记蜜标
+		if generated(&label) {
+			content, err := plant(&label, agentName)
+			if err != nil {
+				log.Pr("KubePot", "127.0.0.1", "生成诱饵凭据失败", err)
+				continue
 			}
+			label.FileContent = content
 		}
+		agentSecretLabels = append(agentSecretLabels, label)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -357,3 +437,86 @@ func GetAgentSecretLabels(c *gin.Context) {
 		"data": agentSecretLabels,
 	})
 }
+
+// assigned 密标是否分配给该 Agent，all 为所有 Agent，specific 为 AgentList 中列出的 Agent
+func assigned(label *models.KubePotSecretLabel, agentName string) bool {
+	switch label.AgentType {
+	case "all":
+		return true
+	case "specific":
+		for _, name := range strings.Split(label.AgentList, ",") {
+			if strings.TrimSpace(name) == agentName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReportWatchStatus 接收 Agent 上报的密标文件监控状态
+func ReportWatchStatus(c *gin.Context) {
+	var data struct {
+		Watches []struct {
+			SecretLabelID int    `json:"secret_label_id"`
+			FilePath      string `json:"file_path"`
+			Status        string `json:"status"`
+			Error         string `json:"error"`
+			Mode          string `json:"mode"`
+		} `json:"watches"`
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code": error.ErrFailCode,
+			"msg":  "参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	agentName := enroll.AgentName(c)
+	db := dbUtil.GORM()
+	now := time.Now()
+
+	for _, w := range data.Watches {
+		query := db.Where("agent_name = ? AND secret_label_id = ?", agentName, w.SecretLabelID)
+
+		// 已取消监控的密标不再展示
+		if w.Status == "removed" {
+			query.Delete(&models.KubePotSecretLabelWatch{})
+			continue
+		}
+
+		var watch models.KubePotSecretLabelWatch
+		if query.First(&watch).Error == nil {
+			err := db.Model(&watch).Updates(map[string]interface{}{
+				"file_path":   w.FilePath,
+				"status":      w.Status,
+				"error":       w.Error,
+				"mode":        w.Mode,
+				"update_time": now,
+			}).Error
+			if err != nil {
+				log.Pr("KubePot", "127.0.0.1", "更新密标监控状态失败", err)
+			}
+			continue
+		}
+
+		watch = models.KubePotSecretLabelWatch{
+			AgentName:     agentName,
+			SecretLabelID: w.SecretLabelID,
+			FilePath:      w.FilePath,
+			Status:        w.Status,
+			Error:         w.Error,
+			Mode:          w.Mode,
+			UpdateTime:    now,
+		}
+		if err := db.Create(&watch).Error; err != nil {
+			log.Pr("KubePot", "127.0.0.1", "保存密标监控状态失败", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": error.ErrSuccessCode,
+		"msg":  error.ErrSuccessMsg,
+	})
+}
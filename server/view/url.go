@@ -9,6 +9,7 @@ import (
 	"KubePot/view/colony"
 	"KubePot/view/dashboard"
 	"KubePot/view/data"
+	"KubePot/view/enroll"
 	"KubePot/view/fish"
 	"KubePot/view/honeypod"
 	"KubePot/view/k8s"
@@ -40,6 +41,10 @@ func LoadUrl(r *gin.Engine) {
 	r.GET("/get/fish/info", fish.GetFishInfo)
 	r.GET("/get/fish/typeList", fish.GetFishTypeInfo)
 	r.POST("/post/fish/del", fish.PostFishDel)
+	// 结构化攻击事件筛选和统计
+	r.GET("/get/fish/event/list", login.Jump, fish.GetEventList)
+	r.GET("/get/fish/event/stats", login.Jump, fish.GetEventStats)
+	r.GET("/get/fish/session/list", login.Jump, fish.GetSessionList)
 
 	// 大数据仪表盘
 	r.GET("/data", login.Jump, data.Html)
@@ -63,13 +68,20 @@ func LoadUrl(r *gin.Engine) {
 	r.GET("/get/k8s/list", k8s.GetK8s)
 	r.POST("/post/k8s/del", k8s.DeleteK8s)
 	r.POST("/post/k8s/add", k8s.AddK8s)
-	//r.POST("/post/k8s/pushsecret/add", login.Jump, k8s.AddPushSecret)
+	r.GET("/get/k8s/decoy/list", login.Jump, k8s.GetDecoyList)
+	r.POST("/post/k8s/decoy/add", login.Jump, k8s.AddDecoy)
+	r.POST("/post/k8s/decoy/rotate", login.Jump, k8s.RotateDecoy)
+	r.POST("/post/k8s/decoy/del", login.Jump, k8s.DeleteDecoy)
+	r.GET("/get/k8s/audit/config", login.Jump, k8s.GetAuditConfig)
+	// 集群审计 Webhook，使用 /get/k8s/audit/config 返回的 Token 认证
+	r.POST("/api/v1/k8s/audit/:id", k8s.ReceiveAudit)
 
 	// DeployHoneyPod
 	r.GET("/honeypod", login.Jump, honeypod.Html)
-	r.GET("/get/honeypod/list", honeypod.GetHoneypod)
-	r.POST("/post/honeypod/del", honeypod.DeleteHoneypod)
-	r.POST("/post/honeypod/add", honeypod.AddHoneypod)
+	r.GET("/get/honeypod/list", login.Jump, honeypod.GetHoneypod)
+	r.POST("/post/honeypod/del", login.Jump, honeypod.DeleteHoneypod)
+	r.POST("/post/honeypod/add", login.Jump, honeypod.AddHoneypod)
+	r.POST("/post/honeypod/refresh", login.Jump, honeypod.RefreshHoneypod)
 
 	// 密标管理
 	r.GET("/secretlabel", login.Jump, secretlabel.Html)
@@ -81,9 +93,11 @@ func LoadUrl(r *gin.Engine) {
 	r.POST("/post/secretlabel/update", secretlabel.UpdateSecretLabel)
 	r.POST("/post/secretlabel/del", secretlabel.DeleteSecretLabel)
 	// 密标告警上报
-	r.POST("/api/v1/secretlabel/alert", secretlabel.ReportSecretLabelAlert)
+	r.POST("/api/v1/secretlabel/alert", enroll.Verify, secretlabel.ReportSecretLabelAlert)
 	// Agent获取密标任务
-	r.GET("/api/v1/secretlabel/agent/list", secretlabel.GetAgentSecretLabels)
+	r.GET("/api/v1/secretlabel/agent/list", enroll.Verify, secretlabel.GetAgentSecretLabels)
+	// Agent 上报密标文件监控状态
+	r.POST("/api/v1/secretlabel/watch", enroll.Verify, secretlabel.ReportWatchStatus)
 
 	//DeploySecret
 	//r.GET("/secret", login.Jump, k8s.Html)
@@ -119,23 +133,41 @@ func LoadUrl(r *gin.Engine) {
 	r.GET("/api/v1/get/passwd_list", api.GetAccountPasswdInfo)
 
 	// 节点管理 API
-	r.GET("/api/v1/agent/list", api.GetAgentList)
-	r.GET("/api/v1/agent/config", api.GetAgentConfig)
-	r.POST("/api/v1/agent/update", api.UpdateAgentConfig)
-	r.POST("/api/v1/agent/uninstall", api.UninstallAgent)
-
+	r.GET("/api/v1/agent/list", login.Jump, api.GetAgentList)
+	r.GET("/api/v1/agent/health/list", login.Jump, api.GetAgentHealthList)
+	r.GET("/api/v1/agent/config", login.Jump, api.GetAgentConfig)
+	r.POST("/api/v1/agent/update", login.Jump, api.UpdateAgentConfig)
+	r.POST("/api/v1/agent/uninstall", login.Jump, api.UninstallAgent)
+	// 下发服务、配置和命令任务，查看处理结果
+	r.POST("/api/v1/agent/task/add", login.Jump, api.AddAgentTask)
+	r.GET("/api/v1/agent/task/result", login.Jump, api.GetTaskResult)
+
+	// Agent 注册，一次性令牌由管理员生成
+	r.POST("/api/v1/agent/enroll", enroll.Enroll)
+	r.POST("/post/agent/enroll/token", login.Jump, enroll.AddToken)
+	r.GET("/get/agent/enroll/token/list", login.Jump, enroll.GetTokenList)
+	r.GET("/get/agent/key/list", login.Jump, enroll.GetAgentKeyList)
+	r.POST("/post/agent/key/revoke", login.Jump, enroll.RevokeAgent)
+	r.POST("/post/agent/key/reset", login.Jump, enroll.ResetAgent)
+
+	// 以下接口只接受已注册 Agent 的签名请求
 	// Agent状态上报（心跳包）
-	r.POST("/api/v1/agent/status", api.ReportAgentStatus)
+	r.POST("/api/v1/agent/status", enroll.Verify, api.ReportAgentStatus)
+	// Agent心跳，包含版本、运行时长和各服务监听状态
+	r.POST("/api/v1/agent/heartbeat", enroll.Verify, api.ReportHeartbeat)
+	// 推送连接，新任务和配置变更通过它立即下发，断开时 Agent 回退到轮询
+	r.GET("/api/v1/agent/stream", enroll.VerifyStream, api.AgentStream)
+	r.POST("/api/v1/agent/stream/ack", enroll.Verify, api.AckStream)
 	// Agent结果上报
-	r.POST("/api/v1/agent/result", api.ReportAgentResult)
+	r.POST("/api/v1/agent/result", enroll.Verify, api.ReportAgentResult)
 	// 获取蜜罐服务配置
-	r.GET("/api/v1/agent/honeypot/config", api.GetAgentHoneypotConfig)
+	r.GET("/api/v1/agent/honeypot/config", enroll.Verify, api.GetAgentHoneypotConfig)
 	// 控制服务命令
-	r.POST("/api/v1/agent/control", api.ControlService)
+	r.POST("/api/v1/agent/control", enroll.Verify, api.ControlService)
 	// 获取下发任务
-	r.GET("/api/v1/agent/tasks", api.GetTasks)
+	r.GET("/api/v1/agent/tasks", enroll.Verify, api.GetTasks)
 	// 更新任务状态
-	r.POST("/api/v1/agent/task/status", api.UpdateTaskStatus)
+	r.POST("/api/v1/agent/task/status", enroll.Verify, api.UpdateTaskStatus)
 
 	// 前端静态文件服务 - 必须在所有API路由之后
 	r.Static("/assets", "./web/dist/assets")
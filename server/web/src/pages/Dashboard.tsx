@@ -932,6 +932,12 @@ const Dashboard = () => {
                       className="w-full px-3 py-2 border border-gray-300 rounded-md focus:outline-none focus:ring-2 focus:ring-blue-500"
                     >
                       <option value="kubeconfig">kubeconfig</option>
+                      <option value="serviceaccount">ServiceAccount Token</option>
+                      <option value="dockerconfig">镜像仓库凭据</option>
+                      <option value="aws">AWS 访问密钥</option>
+                      <option value="aliyun">阿里云访问密钥</option>
+                      <option value="etcd">etcd 客户端证书</option>
+                      <option value="ssh">SSH 私钥</option>
                       <option value="custom">自定义</option>
                     </select>
                   </div>
@@ -942,7 +948,7 @@ const Dashboard = () => {
                       value={formData.file_path}
                       onChange={(e) => setFormData({ ...formData, file_path: e.target.value })}
                       className="w-full px-3 py-2 border border-gray-300 rounded-md focus:outline-none focus:ring-2 focus:ring-blue-500"
-                      placeholder="请输入文件路径，例如 /root/.kube/config"
+                      placeholder="请输入文件路径，留空使用该类凭据的默认路径"
                     />
                   </div>
                   <div>
@@ -952,7 +958,7 @@ const Dashboard = () => {
                       onChange={(e) => setFormData({ ...formData, file_content: e.target.value })}
                       className="w-full px-3 py-2 border border-gray-300 rounded-md focus:outline-none focus:ring-2 focus:ring-blue-500"
                       rows={8}
-                      placeholder="请输入文件内容"
+                      placeholder="请输入文件内容，留空由服务端为每个 Agent 生成诱饵凭据"
                     />
                   </div>
                   <div>
@@ -1072,6 +1078,12 @@ const Dashboard = () => {
                       className="w-full px-3 py-2 border border-gray-300 rounded-md focus:outline-none focus:ring-2 focus:ring-blue-500"
                     >
                       <option value="kubeconfig">kubeconfig</option>
+                      <option value="serviceaccount">ServiceAccount Token</option>
+                      <option value="dockerconfig">镜像仓库凭据</option>
+                      <option value="aws">AWS 访问密钥</option>
+                      <option value="aliyun">阿里云访问密钥</option>
+                      <option value="etcd">etcd 客户端证书</option>
+                      <option value="ssh">SSH 私钥</option>
                       <option value="custom">自定义</option>
                     </select>
                   </div>
@@ -1082,7 +1094,7 @@ const Dashboard = () => {
                       value={formData.file_path}
                       onChange={(e) => setFormData({ ...formData, file_path: e.target.value })}
                       className="w-full px-3 py-2 border border-gray-300 rounded-md focus:outline-none focus:ring-2 focus:ring-blue-500"
-                      placeholder="请输入文件路径，例如 /root/.kube/config"
+                      placeholder="请输入文件路径，留空使用该类凭据的默认路径"
                     />
                   </div>
                   <div>
@@ -1092,7 +1104,7 @@ const Dashboard = () => {
                       onChange={(e) => setFormData({ ...formData, file_content: e.target.value })}
                       className="w-full px-3 py-2 border border-gray-300 rounded-md focus:outline-none focus:ring-2 focus:ring-blue-500"
                       rows={8}
-                      placeholder="请输入文件内容"
+                      placeholder="请输入文件内容，留空由服务端为每个 Agent 生成诱饵凭据"
                     />
                   </div>
                   <div>